@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -21,6 +22,16 @@ type Error struct {
 	grpcCode   codes.Code
 	httpStatus int
 	message    string
+	// reason and domain are sent as a google.rpc.ErrorInfo detail, see WithReason
+	reason string
+	domain string
+}
+
+// WithReason attaches a machine-readable reason to the error, e.g. to tell apart the failed preconditions of a call
+func (e *Error) WithReason(domain, reason string) *Error {
+	e.domain, e.reason = domain, reason
+
+	return e
 }
 
 func (e Error) Error() string {
@@ -51,7 +62,14 @@ func (e Error) HTTPError() string {
 }
 
 func (e Error) GRPCError() error {
-	return status.Error(e.grpcCode, e.message)
+	st := status.New(e.grpcCode, e.message)
+	if e.reason != "" {
+		if detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: e.reason, Domain: e.domain}); err == nil {
+			st = detailed
+		}
+	}
+
+	return st.Err()
 }
 
 func isJSON(s string) bool {
@@ -0,0 +1,85 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/domain/delivery"
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+)
+
+// ProcessedCommands runs the handling of a command at most once, answering a command delivered again with the
+// reply recorded the first time, see persistence.ProcessedMessages
+type ProcessedCommands interface {
+	Process(ctx context.Context, id string, handle func(ctx context.Context) (interface{}, error)) (json.RawMessage, error)
+}
+
+// DeliveryCommands handles the commands sent to the delivery service by saga steps, see saga.ServeCommands.
+// Commands are delivered at least once, so they are deduplicated by their Message.ID.
+type DeliveryCommands struct {
+	DeliveryAPIUseCases
+	processed ProcessedCommands
+}
+
+func NewDeliveryCommands(uc DeliveryAPIUseCases, processed ProcessedCommands) *DeliveryCommands {
+	return &DeliveryCommands{
+		DeliveryAPIUseCases: uc,
+		processed:           processed,
+	}
+}
+
+func (c *DeliveryCommands) Handle(ctx context.Context, command saga.Message) (interface{}, error) {
+	return c.processed.Process(ctx, command.ID, func(ctx context.Context) (interface{}, error) {
+		return c.handle(ctx, command)
+	})
+}
+
+func (c *DeliveryCommands) handle(ctx context.Context, command saga.Message) (interface{}, error) {
+	switch command.Type {
+	case delivery.CreateDeliveryCommand:
+		var input delivery.CreateDeliveryInput
+		if err := json.Unmarshal(command.Payload, &input); err != nil {
+			return nil, saga.Reject(fmt.Errorf("decoding %s command: %w", command.Type, err))
+		}
+		o, err := c.DeliveryAPIUseCases.CreateDelivery(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		return o.Delivery, nil
+	case delivery.CancelDeliveryCommand:
+		var input delivery.CancelDeliveryInput
+		if err := json.Unmarshal(command.Payload, &input); err != nil {
+			return nil, saga.Reject(fmt.Errorf("decoding %s command: %w", command.Type, err))
+		}
+		o, err := c.DeliveryAPIUseCases.CancelDelivery(ctx, input)
+		if err != nil {
+			return nil, rejectPermanent(err)
+		}
+		return o.Delivery, nil
+	case delivery.ReinstateDeliveryCommand:
+		var input delivery.ReinstateDeliveryInput
+		if err := json.Unmarshal(command.Payload, &input); err != nil {
+			return nil, saga.Reject(fmt.Errorf("decoding %s command: %w", command.Type, err))
+		}
+		o, err := c.DeliveryAPIUseCases.ReinstateDelivery(ctx, input)
+		if err != nil {
+			return nil, rejectPermanent(err)
+		}
+		return o.Delivery, nil
+	}
+
+	return nil, saga.Reject(fmt.Errorf("unknown command %q", command.Type))
+}
+
+// rejectPermanent rejects the commands failing because of the delivery they act on, which a redelivery would not
+// change, and leaves the other failures to be retried
+func rejectPermanent(err error) error {
+	if errors.Is(err, domain.ErrAlreadyDelivered) || errors.Is(err, domain.ErrStatusChanged) || errors.Is(err, domain.ErrNotFound) {
+		return saga.Reject(err)
+	}
+
+	return err
+}
@@ -0,0 +1,135 @@
+package v1_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	v1 "github.com/didopimentel/go-saga-poc/app/delivery/api/v1"
+	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/domain/delivery"
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDeliveries struct {
+	v1.DeliveryAPIUseCases
+	created []int64
+	err     error
+	// delivered is the delivery that was delivered, so it cannot be cancelled
+	delivered int64
+}
+
+func (f *fakeDeliveries) CreateDelivery(_ context.Context, input delivery.CreateDeliveryInput) (delivery.CreateDeliveryOutput, error) {
+	if f.err != nil {
+		return delivery.CreateDeliveryOutput{}, f.err
+	}
+	f.created = append(f.created, input.OrderID)
+	return delivery.CreateDeliveryOutput{Delivery: entities.Delivery{ID: 9, OrderID: input.OrderID, Status: entities.DeliveryStatusScheduled}}, nil
+}
+
+func (f *fakeDeliveries) CancelDelivery(_ context.Context, input delivery.CancelDeliveryInput) (delivery.CancelDeliveryOutput, error) {
+	if input.DeliveryID == f.delivered {
+		return delivery.CancelDeliveryOutput{}, fmt.Errorf("delivery %d: %w", input.DeliveryID, domain.ErrAlreadyDelivered)
+	}
+	return delivery.CancelDeliveryOutput{Delivery: entities.Delivery{ID: input.DeliveryID, OrderID: 1, Status: entities.DeliveryStatusCancelled}}, nil
+}
+
+func (f *fakeDeliveries) ReinstateDelivery(_ context.Context, input delivery.ReinstateDeliveryInput) (delivery.ReinstateDeliveryOutput, error) {
+	return delivery.ReinstateDeliveryOutput{Delivery: entities.Delivery{ID: input.DeliveryID, OrderID: 1, Status: entities.DeliveryStatusScheduled}}, nil
+}
+
+// fakeProcessed records the replies of the handled commands like persistence.ProcessedMessages
+type fakeProcessed struct {
+	replies map[string]json.RawMessage
+}
+
+func (f *fakeProcessed) Process(ctx context.Context, id string, handle func(ctx context.Context) (interface{}, error)) (json.RawMessage, error) {
+	if reply, ok := f.replies[id]; ok {
+		return reply, nil
+	}
+	output, err := handle(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := json.Marshal(output)
+	if err != nil {
+		return nil, err
+	}
+	f.replies[id] = reply
+
+	return reply, nil
+}
+
+func TestDeliveryCommands_Handle(t *testing.T) {
+	deliveries := &fakeDeliveries{}
+	commands := v1.NewDeliveryCommands(deliveries, &fakeProcessed{replies: map[string]json.RawMessage{}})
+	ctx := context.Background()
+
+	reply, err := commands.Handle(ctx, saga.Message{ID: "1/create-delivery", Type: delivery.CreateDeliveryCommand, Payload: []byte(`{"OrderID":1}`)})
+	require.NoError(t, err)
+	var created entities.Delivery
+	require.NoError(t, json.Unmarshal(reply.(json.RawMessage), &created))
+	require.Equal(t, entities.Delivery{ID: 9, OrderID: 1, Status: entities.DeliveryStatusScheduled}, created)
+
+	var rejected *saga.RejectedError
+	_, err = commands.Handle(ctx, saga.Message{ID: "2/complete-delivery", Type: "deliveries.CompleteDelivery"})
+	require.ErrorAs(t, err, &rejected)
+	_, err = commands.Handle(ctx, saga.Message{ID: "3/create-delivery", Type: delivery.CreateDeliveryCommand, Payload: []byte(`not json`)})
+	require.ErrorAs(t, err, &rejected)
+}
+
+func TestDeliveryCommands_Handle_CancelsDeliveries(t *testing.T) {
+	deliveries := &fakeDeliveries{delivered: 8}
+	commands := v1.NewDeliveryCommands(deliveries, &fakeProcessed{replies: map[string]json.RawMessage{}})
+	ctx := context.Background()
+
+	reply, err := commands.Handle(ctx, saga.Message{ID: "1/cancel-delivery", Type: delivery.CancelDeliveryCommand, Payload: []byte(`{"DeliveryID":9}`)})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"ID":9,"OrderID":1,"Status":"CANCELLED"}`, string(reply.(json.RawMessage)))
+	reply, err = commands.Handle(ctx, saga.Message{ID: "1/cancel-delivery/compensation", Type: delivery.ReinstateDeliveryCommand, Payload: []byte(`{"DeliveryID":9}`)})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"ID":9,"OrderID":1,"Status":"SCHEDULED"}`, string(reply.(json.RawMessage)))
+
+	// a delivered delivery cannot be cancelled, however often the command is delivered
+	_, err = commands.Handle(ctx, saga.Message{ID: "2/cancel-delivery", Type: delivery.CancelDeliveryCommand, Payload: []byte(`{"DeliveryID":8}`)})
+	var rejected *saga.RejectedError
+	require.ErrorAs(t, err, &rejected)
+	require.ErrorIs(t, err, domain.ErrAlreadyDelivered)
+}
+
+func TestDeliveryCommands_Handle_DeduplicatesRedeliveredCommands(t *testing.T) {
+	deliveries := &fakeDeliveries{}
+	commands := v1.NewDeliveryCommands(deliveries, &fakeProcessed{replies: map[string]json.RawMessage{}})
+	ctx := context.Background()
+	command := saga.Message{ID: "1/create-delivery", Type: delivery.CreateDeliveryCommand, Payload: []byte(`{"OrderID":1}`)}
+
+	first, err := commands.Handle(ctx, command)
+	require.NoError(t, err)
+	again, err := commands.Handle(ctx, command)
+	require.NoError(t, err)
+
+	require.Equal(t, first, again)
+	require.Equal(t, []int64{1}, deliveries.created)
+}
+
+func TestDeliveryCommands_Handle_RetriesTransientFailures(t *testing.T) {
+	deliveries := &fakeDeliveries{err: errors.New("database is down")}
+	commands := v1.NewDeliveryCommands(deliveries, &fakeProcessed{replies: map[string]json.RawMessage{}})
+	ctx := context.Background()
+	command := saga.Message{ID: "1/create-delivery", Type: delivery.CreateDeliveryCommand, Payload: []byte(`{"OrderID":1}`)}
+
+	_, err := commands.Handle(ctx, command)
+	var rejected *saga.RejectedError
+	require.Error(t, err)
+	require.False(t, errors.As(err, &rejected))
+
+	// the failure was not recorded, so the redelivered command is handled
+	deliveries.err = nil
+	_, err = commands.Handle(ctx, command)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1}, deliveries.created)
+}
@@ -2,6 +2,9 @@ package v1
 
 import (
 	"context"
+	"errors"
+	"github.com/didopimentel/go-saga-poc/app/delivery/api"
+	"github.com/didopimentel/go-saga-poc/domain"
 	"github.com/didopimentel/go-saga-poc/domain/delivery"
 	v12 "github.com/didopimentel/go-saga-poc/protogen/delivery/api/v1"
 )
@@ -18,6 +21,9 @@ func NewDeliveryAPI(uc DeliveryAPIUseCases) *DeliveryAPI {
 
 type DeliveryAPIUseCases interface {
 	CreateDelivery(ctx context.Context, input delivery.CreateDeliveryInput) (delivery.CreateDeliveryOutput, error)
+	CancelDelivery(ctx context.Context, input delivery.CancelDeliveryInput) (delivery.CancelDeliveryOutput, error)
+	ReinstateDelivery(ctx context.Context, input delivery.ReinstateDeliveryInput) (delivery.ReinstateDeliveryOutput, error)
+	CompleteDelivery(ctx context.Context, input delivery.CompleteDeliveryInput) (delivery.CompleteDeliveryOutput, error)
 }
 
 func (a *DeliveryAPI) CreateDelivery(ctx context.Context, req *v12.CreateDeliveryRequest) (*v12.CreateDeliveryResponse, error) {
@@ -33,3 +39,61 @@ func (a *DeliveryAPI) CreateDelivery(ctx context.Context, req *v12.CreateDeliver
 		OrderId: o.Delivery.OrderID,
 	}, nil
 }
+
+func (a *DeliveryAPI) CancelDelivery(ctx context.Context, req *v12.CancelDeliveryRequest) (*v12.CancelDeliveryResponse, error) {
+	o, err := a.DeliveryAPIUseCases.CancelDelivery(ctx, delivery.CancelDeliveryInput{
+		DeliveryID: req.Id,
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &v12.CancelDeliveryResponse{
+		Id:     o.Delivery.ID,
+		Status: string(o.Delivery.Status),
+	}, nil
+}
+
+func (a *DeliveryAPI) ReinstateDelivery(ctx context.Context, req *v12.ReinstateDeliveryRequest) (*v12.ReinstateDeliveryResponse, error) {
+	o, err := a.DeliveryAPIUseCases.ReinstateDelivery(ctx, delivery.ReinstateDeliveryInput{
+		DeliveryID: req.Id,
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &v12.ReinstateDeliveryResponse{
+		Id:     o.Delivery.ID,
+		Status: string(o.Delivery.Status),
+	}, nil
+}
+
+func (a *DeliveryAPI) CompleteDelivery(ctx context.Context, req *v12.CompleteDeliveryRequest) (*v12.CompleteDeliveryResponse, error) {
+	o, err := a.DeliveryAPIUseCases.CompleteDelivery(ctx, delivery.CompleteDeliveryInput{
+		DeliveryID: req.Id,
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &v12.CompleteDeliveryResponse{
+		Id:     o.Delivery.ID,
+		Status: string(o.Delivery.Status),
+	}, nil
+}
+
+// statusError maps the errors of the delivery status use cases to API errors
+func statusError(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		return api.NewNotFoundError("%s", err.Error())
+	case errors.Is(err, domain.ErrAlreadyDelivered):
+		return api.NewFailedPreconditionError("%s", err.Error()).WithReason(delivery.ErrorDomain, delivery.ReasonAlreadyDelivered)
+	case errors.Is(err, domain.ErrDeliveryCancelled):
+		return api.NewFailedPreconditionError("%s", err.Error()).WithReason(delivery.ErrorDomain, delivery.ReasonDeliveryCancelled)
+	case errors.Is(err, domain.ErrStatusChanged):
+		return api.NewFailedPreconditionError("%s", err.Error()).WithReason(delivery.ErrorDomain, delivery.ReasonStatusChanged)
+	}
+
+	return err
+}
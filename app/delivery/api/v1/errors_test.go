@@ -0,0 +1,83 @@
+package v1_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/didopimentel/go-saga-poc/app/delivery/api"
+	v1 "github.com/didopimentel/go-saga-poc/app/delivery/api/v1"
+	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/domain/delivery"
+	"github.com/didopimentel/go-saga-poc/extensions/circuitbreaker"
+	"github.com/didopimentel/go-saga-poc/gateways/deliveries"
+	v12 "github.com/didopimentel/go-saga-poc/protogen/delivery/api/v1"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type failingCancellations struct {
+	v1.DeliveryAPIUseCases
+	err error
+}
+
+func (f failingCancellations) CancelDelivery(context.Context, delivery.CancelDeliveryInput) (delivery.CancelDeliveryOutput, error) {
+	return delivery.CancelDeliveryOutput{}, f.err
+}
+
+// localClient calls the delivery API in process, translating its errors like the server interceptor does
+type localClient struct {
+	v12.DeliveryAPIClient
+	server *v1.DeliveryAPI
+}
+
+func (c localClient) CancelDelivery(ctx context.Context, in *v12.CancelDeliveryRequest, _ ...grpc.CallOption) (*v12.CancelDeliveryResponse, error) {
+	response, err := c.server.CancelDelivery(ctx, in)
+	if err != nil {
+		return nil, api.FromError(err).GRPCError()
+	}
+	return response, nil
+}
+
+func TestCancelDelivery_FailedPreconditionsKeepTheirReason(t *testing.T) {
+	for _, domainErr := range []error{domain.ErrAlreadyDelivered, domain.ErrStatusChanged, domain.ErrDeliveryCancelled} {
+		t.Run(domainErr.Error(), func(t *testing.T) {
+			server := v1.NewDeliveryAPI(failingCancellations{err: domainErr})
+			gateway := deliveries.NewGateway(localClient{server: server}, circuitbreaker.New(circuitbreaker.Settings{
+				Name:             "deliveries",
+				FailureThreshold: 10,
+				Logger:           zap.NewNop(),
+			}))
+
+			err := gateway.CancelDelivery(context.Background(), 1)
+			require.Error(t, err)
+			require.True(t, errors.Is(err, domainErr), err.Error())
+			for _, other := range []error{domain.ErrAlreadyDelivered, domain.ErrStatusChanged, domain.ErrDeliveryCancelled} {
+				if other != domainErr {
+					require.False(t, errors.Is(err, other), err.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestCancelDelivery_FailedPreconditionsWithoutReasonAreNotAlreadyDelivered(t *testing.T) {
+	gateway := deliveries.NewGateway(failingClient{err: status.Error(codes.FailedPrecondition, "delivery 1 is stuck")},
+		circuitbreaker.New(circuitbreaker.Settings{Name: "deliveries", FailureThreshold: 10, Logger: zap.NewNop()}))
+
+	err := gateway.CancelDelivery(context.Background(), 1)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	require.False(t, errors.Is(err, domain.ErrAlreadyDelivered))
+}
+
+type failingClient struct {
+	v12.DeliveryAPIClient
+	err error
+}
+
+func (c failingClient) CancelDelivery(context.Context, *v12.CancelDeliveryRequest, ...grpc.CallOption) (*v12.CancelDeliveryResponse, error) {
+	return nil, c.err
+}
@@ -152,6 +152,19 @@ func NewResourceExhaustedError(messageFormat string, messageArgs ...interface{})
 	}
 }
 
+func NewUnavailableError(messageFormat string, messageArgs ...interface{}) *Error {
+	if messageFormat == "" {
+		messageFormat = "service unavailable"
+	}
+	grpcCode := codes.Unavailable
+
+	return &Error{
+		message:    fmt.Sprintf(messageFormat, messageArgs...),
+		grpcCode:   grpcCode,
+		httpStatus: runtime.HTTPStatusFromCode(grpcCode),
+	}
+}
+
 func NewNotFoundError(messageFormat string, messageArgs ...interface{}) *Error {
 	if messageFormat == "" {
 		messageFormat = "not found"
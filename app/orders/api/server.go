@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"errors"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
 	v1 "github.com/didopimentel/go-saga-poc/protogen/orders/api/v1"
 	"go.uber.org/zap"
 	"golang.org/x/net/http2"
@@ -29,6 +30,8 @@ type Settings struct {
 	MaxConnAgeGrace time.Duration
 	MaxConnAge      time.Duration
 	Logger          *zap.Logger
+	// Authenticator verifies the credentials of the tenant every call is served for
+	Authenticator *tenant.Authenticator
 }
 
 type ProtoErrorHandler struct {
@@ -60,6 +63,7 @@ func New(ctx context.Context, s Settings) (*http.Server, error) {
 		grpcmiddleware.WithUnaryServerChain(
 			grpcrecovery.UnaryServerInterceptor(grpcrecovery.WithRecoveryHandler(recoveryHandler)),
 			ErrorInterceptor(s.Logger),
+			tenant.UnaryServerInterceptor(s.Authenticator),
 		),
 		keepAlive,
 	)
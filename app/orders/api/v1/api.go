@@ -15,11 +15,15 @@ var _ v1.OrdersAPIServer = &API{}
 type API struct {
 	*Repository
 	*OrdersAPI
+	*ProductsAPI
+	*SagasAPI
 }
 
 type Repository struct {
-	Orders *persistence.Orders
-	Health *persistence.Health
+	Orders     *persistence.Orders
+	Products   *persistence.Products
+	OrderLocks *persistence.SemanticLocks
+	Health     *persistence.Health
 }
 
 // GetHealth lets clients know if Events Manager Server is healthy to respond requests
@@ -2,8 +2,16 @@ package v1
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/didopimentel/go-saga-poc/app/orders/api"
+	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/domain/entities"
 	"github.com/didopimentel/go-saga-poc/domain/order"
+	"github.com/didopimentel/go-saga-poc/extensions/circuitbreaker"
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
 	v1 "github.com/didopimentel/go-saga-poc/protogen/orders/api/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type OrdersAPI struct {
@@ -16,20 +24,182 @@ func NewOrdersAPI(uc OrdersAPIUseCases) *OrdersAPI {
 	}
 }
 
+// maxIdempotencyKeyLength bounds the keys clients send, as they are stored with every order
+const maxIdempotencyKeyLength = 255
+
+// maxLineItems bounds the items of an order, which are priced and stored in single queries
+const maxLineItems = 100
+
 type OrdersAPIUseCases interface {
 	CreateOrder(ctx context.Context, input order.CreateOrderInput) (order.CreateOrderOutput, error)
+	CancelOrder(ctx context.Context, input order.CancelOrderInput) (order.CancelOrderOutput, error)
+	GetOrder(ctx context.Context, input order.GetOrderInput) (order.GetOrderOutput, error)
+	ListOrders(ctx context.Context, input order.ListOrdersInput) (order.ListOrdersOutput, error)
 }
 
 func (a *OrdersAPI) CreateOrder(ctx context.Context, req *v1.CreateOrderRequest) (*v1.CreateOrderResponse, error) {
+	if len(req.IdempotencyKey) > maxIdempotencyKeyLength {
+		return nil, api.NewFieldValidationError(req.IdempotencyKey, "idempotency_key")
+	}
+	if len(req.Items) > maxLineItems {
+		return nil, api.NewBadRequestError("an order has at most %d items", maxLineItems)
+	}
+
+	items := make([]entities.LineItem, 0, len(req.Items))
+	for _, item := range req.Items {
+		items = append(items, entities.LineItem{ProductID: item.ProductId, Quantity: item.Quantity})
+	}
+
 	o, err := a.OrdersAPIUseCases.CreateOrder(ctx, order.CreateOrderInput{
-		Amount: req.Amount,
+		Items:          items,
+		IdempotencyKey: req.IdempotencyKey,
 	})
 	if err != nil {
+		var reusedErr *order.IdempotencyKeyReusedError
+		if errors.As(err, &reusedErr) {
+			return nil, api.NewConflictError("%s", reusedErr.Error())
+		}
+		var itemErr *order.InvalidItemError
+		if errors.Is(err, order.ErrNoItems) || errors.As(err, &itemErr) {
+			return nil, api.NewBadRequestError("%s", err.Error())
+		}
+		if errors.Is(err, saga.ErrLimitExceeded) {
+			return nil, api.NewResourceExhaustedError("too many orders are being created, try again later")
+		}
+		var openErr *circuitbreaker.OpenError
+		if errors.As(err, &openErr) {
+			return nil, api.NewUnavailableError("%s is unavailable, try again later", openErr.Name)
+		}
 		return nil, err
 	}
 
 	return &v1.CreateOrderResponse{
-		Id:     o.Order.ID,
-		Amount: o.Order.Amount,
+		Id:         o.Order.ID,
+		Amount:     o.Order.Amount,
+		Items:      toLineItems(o.Order.Items),
+		InProgress: o.InProgress,
+		Status:     string(o.Order.Status),
+		PaymentId:  o.Order.PaymentID,
+		DeliveryId: o.Order.DeliveryID,
+	}, nil
+}
+
+func (a *OrdersAPI) CancelOrder(ctx context.Context, req *v1.CancelOrderRequest) (*v1.CancelOrderResponse, error) {
+	o, err := a.OrdersAPIUseCases.CancelOrder(ctx, order.CancelOrderInput{
+		OrderID: req.Id,
+	})
+	if err != nil {
+		var transitionErr *order.InvalidTransitionError
+		switch {
+		case errors.Is(err, domain.ErrNotFound):
+			return nil, api.NewNotFoundError("order %d not found", req.Id)
+		case errors.As(err, &transitionErr), errors.Is(err, order.ErrOrderIncomplete), errors.Is(err, domain.ErrAlreadyDelivered),
+			errors.Is(err, domain.ErrStatusChanged), errors.Is(err, domain.ErrResourceLocked):
+			return nil, api.NewFailedPreconditionError("%s", err.Error())
+		case errors.Is(err, saga.ErrLimitExceeded):
+			return nil, api.NewResourceExhaustedError("too many orders are being cancelled, try again later")
+		}
+		var openErr *circuitbreaker.OpenError
+		if errors.As(err, &openErr) {
+			return nil, api.NewUnavailableError("%s is unavailable, try again later", openErr.Name)
+		}
+		return nil, err
+	}
+
+	return &v1.CancelOrderResponse{
+		Id:         o.Order.ID,
+		Status:     string(o.Order.Status),
+		InProgress: o.InProgress,
+	}, nil
+}
+
+func (a *OrdersAPI) GetOrder(ctx context.Context, req *v1.GetOrderRequest) (*v1.GetOrderResponse, error) {
+	o, err := a.OrdersAPIUseCases.GetOrder(ctx, order.GetOrderInput{
+		OrderID: req.Id,
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, api.NewNotFoundError("order %d not found", req.Id)
+		}
+		return nil, err
+	}
+
+	return &v1.GetOrderResponse{
+		Order: toOrder(o.Order),
 	}, nil
 }
+
+func (a *OrdersAPI) ListOrders(ctx context.Context, req *v1.ListOrdersRequest) (*v1.ListOrdersResponse, error) {
+	if req.PageSize < 0 {
+		return nil, api.NewFieldValidationError(fmt.Sprint(req.PageSize), "page_size")
+	}
+
+	filter := entities.OrderFilter{}
+	for _, s := range req.Statuses {
+		status := entities.OrderStatus(s)
+		if !status.Valid() {
+			return nil, api.NewFieldValidationError(s, "statuses")
+		}
+		filter.Statuses = append(filter.Statuses, status)
+	}
+	if req.MinAmount != nil {
+		filter.MinAmount = &req.MinAmount.Value
+	}
+	if req.MaxAmount != nil {
+		filter.MaxAmount = &req.MaxAmount.Value
+	}
+	if req.CreatedAfter != nil {
+		filter.CreatedAfter = req.CreatedAfter.AsTime()
+	}
+	if req.CreatedBefore != nil {
+		filter.CreatedBefore = req.CreatedBefore.AsTime()
+	}
+
+	o, err := a.OrdersAPIUseCases.ListOrders(ctx, order.ListOrdersInput{
+		Filter:    filter,
+		PageSize:  int(req.PageSize),
+		PageToken: req.PageToken,
+	})
+	if err != nil {
+		if errors.Is(err, order.ErrInvalidPageToken) {
+			return nil, api.NewFieldValidationError(req.PageToken, "page_token")
+		}
+		return nil, err
+	}
+
+	res := &v1.ListOrdersResponse{
+		Orders:        make([]*v1.Order, 0, len(o.Orders)),
+		NextPageToken: o.NextPageToken,
+	}
+	for _, listed := range o.Orders {
+		res.Orders = append(res.Orders, toOrder(listed))
+	}
+
+	return res, nil
+}
+
+func toOrder(o entities.Order) *v1.Order {
+	return &v1.Order{
+		Id:         o.ID,
+		Amount:     o.Amount,
+		Status:     string(o.Status),
+		PaymentId:  o.PaymentID,
+		DeliveryId: o.DeliveryID,
+		CreatedAt:  timestamppb.New(o.CreatedAt),
+		UpdatedAt:  timestamppb.New(o.UpdatedAt),
+		Items:      toLineItems(o.Items),
+	}
+}
+
+func toLineItems(items []entities.LineItem) []*v1.LineItem {
+	res := make([]*v1.LineItem, 0, len(items))
+	for _, item := range items {
+		res = append(res, &v1.LineItem{
+			ProductId: item.ProductID,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+		})
+	}
+
+	return res
+}
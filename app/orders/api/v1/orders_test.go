@@ -2,14 +2,18 @@ package v1_test
 
 import (
 	"context"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
 	v1 "github.com/didopimentel/go-saga-poc/protogen/orders/api/v1"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"os"
 	"testing"
+	"time"
 )
 
 func TestCreateOrder(t *testing.T) {
-	ctx := context.Background()
+	ctx := authenticatedContext(t)
 	dial, err := grpc.DialContext(ctx, ":7000", grpc.WithInsecure())
 	if err != nil {
 		panic(err)
@@ -17,7 +21,61 @@ func TestCreateOrder(t *testing.T) {
 
 	client := v1.NewOrdersAPIClient(dial)
 
-	response, err := client.CreateOrder(ctx, &v1.CreateOrderRequest{Amount: 100})
+	product, err := client.CreateProduct(ctx, &v1.CreateProductRequest{Name: "book", Price: 50})
+	require.NoError(t, err)
+
+	response, err := client.CreateOrder(ctx, &v1.CreateOrderRequest{
+		Items: []*v1.LineItem{{ProductId: product.Product.Id, Quantity: 2}},
+	})
 	require.NoError(t, err)
 	require.Equal(t, int64(100), response.Amount)
 }
+
+func TestGetAndListOrders(t *testing.T) {
+	ctx := authenticatedContext(t)
+	dial, err := grpc.DialContext(ctx, ":7000", grpc.WithInsecure())
+	if err != nil {
+		panic(err)
+	}
+
+	client := v1.NewOrdersAPIClient(dial)
+
+	product, err := client.CreateProduct(ctx, &v1.CreateProductRequest{Name: "book", Price: 50})
+	require.NoError(t, err)
+	created, err := client.CreateOrder(ctx, &v1.CreateOrderRequest{
+		Items: []*v1.LineItem{{ProductId: product.Product.Id, Quantity: 2}},
+	})
+	require.NoError(t, err)
+
+	// the payment and the delivery are created once the payments and delivery services handle their commands
+	var got *v1.GetOrderResponse
+	require.Eventually(t, func() bool {
+		got, err = client.GetOrder(ctx, &v1.GetOrderRequest{Id: created.Id})
+		return err == nil && got.Order.Status == "APPROVED"
+	}, 10*time.Second, 100*time.Millisecond)
+	require.NotZero(t, got.Order.PaymentId)
+	require.NotZero(t, got.Order.DeliveryId)
+	require.Equal(t, int64(50), got.Order.Items[0].UnitPrice)
+
+	listed, err := client.ListOrders(ctx, &v1.ListOrdersRequest{PageSize: 1, Statuses: []string{got.Order.Status}})
+	require.NoError(t, err)
+	require.Len(t, listed.Orders, 1)
+	require.Equal(t, created.Id, listed.Orders[0].Id)
+}
+
+// testTokenSecret signs the credentials when TENANT_TOKEN_SECRET is not set, for services started with it
+const testTokenSecret = "go-saga-poc-test-tenant-token-secret"
+
+// authenticatedContext sends the credentials of the test tenant, signed with the TENANT_TOKEN_SECRET of the services
+func authenticatedContext(t *testing.T) context.Context {
+	secret := os.Getenv("TENANT_TOKEN_SECRET")
+	if secret == "" {
+		secret = testTokenSecret
+	}
+	auth, err := tenant.NewAuthenticator([]byte(secret), time.Minute)
+	require.NoError(t, err)
+	token, err := auth.Sign("test")
+	require.NoError(t, err)
+
+	return metadata.AppendToOutgoingContext(context.Background(), tenant.MetadataKey, "Bearer "+token)
+}
@@ -0,0 +1,130 @@
+package v1
+
+import (
+	"context"
+	"errors"
+
+	"github.com/didopimentel/go-saga-poc/app/orders/api"
+	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/domain/product"
+	v1 "github.com/didopimentel/go-saga-poc/protogen/orders/api/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type ProductsAPI struct {
+	ProductsAPIUseCases
+}
+
+func NewProductsAPI(uc ProductsAPIUseCases) *ProductsAPI {
+	return &ProductsAPI{
+		ProductsAPIUseCases: uc,
+	}
+}
+
+type ProductsAPIUseCases interface {
+	CreateProduct(ctx context.Context, input product.CreateProductInput) (product.CreateProductOutput, error)
+	GetProduct(ctx context.Context, input product.GetProductInput) (product.GetProductOutput, error)
+	ListProducts(ctx context.Context, input product.ListProductsInput) (product.ListProductsOutput, error)
+	UpdateProduct(ctx context.Context, input product.UpdateProductInput) (product.UpdateProductOutput, error)
+	DeleteProduct(ctx context.Context, input product.DeleteProductInput) (product.DeleteProductOutput, error)
+}
+
+func (a *ProductsAPI) CreateProduct(ctx context.Context, req *v1.CreateProductRequest) (*v1.CreateProductResponse, error) {
+	o, err := a.ProductsAPIUseCases.CreateProduct(ctx, product.CreateProductInput{
+		Name:  req.Name,
+		Price: req.Price,
+	})
+	if err != nil {
+		return nil, productError(err, 0)
+	}
+
+	return &v1.CreateProductResponse{
+		Product: toProduct(o.Product),
+	}, nil
+}
+
+func (a *ProductsAPI) GetProduct(ctx context.Context, req *v1.GetProductRequest) (*v1.GetProductResponse, error) {
+	o, err := a.ProductsAPIUseCases.GetProduct(ctx, product.GetProductInput{
+		ProductID: req.Id,
+	})
+	if err != nil {
+		return nil, productError(err, req.Id)
+	}
+
+	return &v1.GetProductResponse{
+		Product: toProduct(o.Product),
+	}, nil
+}
+
+func (a *ProductsAPI) ListProducts(ctx context.Context, req *v1.ListProductsRequest) (*v1.ListProductsResponse, error) {
+	o, err := a.ProductsAPIUseCases.ListProducts(ctx, product.ListProductsInput{
+		PageSize:  int(req.PageSize),
+		PageToken: req.PageToken,
+	})
+	if err != nil {
+		if errors.Is(err, product.ErrInvalidPageToken) {
+			return nil, api.NewFieldValidationError(req.PageToken, "page_token")
+		}
+		return nil, err
+	}
+
+	res := &v1.ListProductsResponse{
+		Products:      make([]*v1.Product, 0, len(o.Products)),
+		NextPageToken: o.NextPageToken,
+	}
+	for _, listed := range o.Products {
+		res.Products = append(res.Products, toProduct(listed))
+	}
+
+	return res, nil
+}
+
+func (a *ProductsAPI) UpdateProduct(ctx context.Context, req *v1.UpdateProductRequest) (*v1.UpdateProductResponse, error) {
+	o, err := a.ProductsAPIUseCases.UpdateProduct(ctx, product.UpdateProductInput{
+		ProductID: req.Id,
+		Name:      req.Name,
+		Price:     req.Price,
+	})
+	if err != nil {
+		return nil, productError(err, req.Id)
+	}
+
+	return &v1.UpdateProductResponse{
+		Product: toProduct(o.Product),
+	}, nil
+}
+
+func (a *ProductsAPI) DeleteProduct(ctx context.Context, req *v1.DeleteProductRequest) (*v1.DeleteProductResponse, error) {
+	_, err := a.ProductsAPIUseCases.DeleteProduct(ctx, product.DeleteProductInput{
+		ProductID: req.Id,
+	})
+	if err != nil {
+		return nil, productError(err, req.Id)
+	}
+
+	return &v1.DeleteProductResponse{}, nil
+}
+
+// productError maps the errors of the product use cases to API errors
+func productError(err error, id int64) error {
+	var invalidErr *product.InvalidProductError
+	switch {
+	case errors.As(err, &invalidErr):
+		return api.NewBadRequestError("%s", invalidErr.Error())
+	case errors.Is(err, domain.ErrNotFound):
+		return api.NewNotFoundError("product %d not found", id)
+	}
+
+	return err
+}
+
+func toProduct(p entities.Product) *v1.Product {
+	return &v1.Product{
+		Id:        p.ID,
+		Name:      p.Name,
+		Price:     p.Price,
+		CreatedAt: timestamppb.New(p.CreatedAt),
+		UpdatedAt: timestamppb.New(p.UpdatedAt),
+	}
+}
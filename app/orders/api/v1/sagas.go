@@ -0,0 +1,213 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/app/orders/api"
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+	v1 "github.com/didopimentel/go-saga-poc/protogen/orders/api/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type SagasAPI struct {
+	SagasAPIExecutor
+}
+
+func NewSagasAPI(executor SagasAPIExecutor) *SagasAPI {
+	return &SagasAPI{
+		SagasAPIExecutor: executor,
+	}
+}
+
+// PayloadAccessRole lets the bearer of a tenant token read the sensitive payloads of the instances of its tenant,
+// see tenant.Authenticator.Sign. Without it they are redacted.
+const PayloadAccessRole = "saga-payloads"
+
+// SagasAPIExecutor is only given payload access, see saga.WithPayloadAccess, for callers granted PayloadAccessRole
+type SagasAPIExecutor interface {
+	SignalSaga(ctx context.Context, instanceID string, signalName string, payload interface{}) (saga.Instance, error)
+	Get(ctx context.Context, id string) (saga.Instance, error)
+	List(ctx context.Context) ([]saga.Instance, error)
+	History(ctx context.Context, id string) ([]saga.Event, error)
+}
+
+func (a *SagasAPI) SignalSaga(ctx context.Context, req *v1.SignalSagaRequest) (*v1.SignalSagaResponse, error) {
+	if req.InstanceId == "" {
+		return nil, api.NewFieldValidationError(req.InstanceId, "instance_id")
+	}
+	if req.Signal == "" {
+		return nil, api.NewFieldValidationError(req.Signal, "signal")
+	}
+
+	var payload interface{}
+	if req.Payload != nil {
+		payload = req.Payload.AsMap()
+	}
+
+	instance, err := a.SagasAPIExecutor.SignalSaga(ctx, req.InstanceId, req.Signal, payload)
+	// the signal was delivered even if the saga failed afterwards and was compensated
+	var execErr *saga.ExecutionError
+	if err != nil && !errors.As(err, &execErr) {
+		switch {
+		case errors.Is(err, saga.ErrInstanceNotFound):
+			return nil, api.NewNotFoundError("saga instance %s not found", req.InstanceId)
+		case errors.Is(err, saga.ErrReservedSignal):
+			return nil, api.NewBadRequestError("signal %s is reserved for command replies", req.Signal)
+		case errors.Is(err, saga.ErrNotWaitingForSignal):
+			return nil, api.NewFailedPreconditionError("saga instance %s is not waiting for signal %s", req.InstanceId, req.Signal)
+		case errors.Is(err, saga.ErrLeaseLost):
+			return nil, api.NewUnavailableError("saga instance %s is being resumed, try again later", req.InstanceId)
+		}
+		return nil, err
+	}
+
+	return &v1.SignalSagaResponse{
+		InstanceId: instance.ID,
+		Status:     string(instance.Status),
+	}, nil
+}
+
+func (a *SagasAPI) GetSaga(ctx context.Context, req *v1.GetSagaRequest) (*v1.GetSagaResponse, error) {
+	if req.InstanceId == "" {
+		return nil, api.NewFieldValidationError(req.InstanceId, "instance_id")
+	}
+
+	instance, err := a.SagasAPIExecutor.Get(payloadAccess(ctx), req.InstanceId)
+	if err != nil {
+		if errors.Is(err, saga.ErrInstanceNotFound) {
+			return nil, api.NewNotFoundError("saga instance %s not found", req.InstanceId)
+		}
+		return nil, err
+	}
+
+	res, err := toSaga(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.GetSagaResponse{Saga: res}, nil
+}
+
+func (a *SagasAPI) ListSagas(ctx context.Context, _ *v1.ListSagasRequest) (*v1.ListSagasResponse, error) {
+	instances, err := a.SagasAPIExecutor.List(payloadAccess(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &v1.ListSagasResponse{Sagas: make([]*v1.Saga, 0, len(instances))}
+	for _, instance := range instances {
+		s, err := toSaga(instance)
+		if err != nil {
+			return nil, err
+		}
+		res.Sagas = append(res.Sagas, s)
+	}
+
+	return res, nil
+}
+
+func (a *SagasAPI) GetSagaHistory(ctx context.Context, req *v1.GetSagaHistoryRequest) (*v1.GetSagaHistoryResponse, error) {
+	if req.InstanceId == "" {
+		return nil, api.NewFieldValidationError(req.InstanceId, "instance_id")
+	}
+
+	events, err := a.SagasAPIExecutor.History(payloadAccess(ctx), req.InstanceId)
+	if err != nil {
+		if errors.Is(err, saga.ErrInstanceNotFound) {
+			return nil, api.NewNotFoundError("saga instance %s not found", req.InstanceId)
+		}
+		return nil, err
+	}
+
+	res := &v1.GetSagaHistoryResponse{Events: make([]*v1.SagaEvent, 0, len(events))}
+	for _, event := range events {
+		payload, redacted, err := toPayload(event.Payload)
+		if err != nil {
+			return nil, err
+		}
+		res.Events = append(res.Events, &v1.SagaEvent{
+			Sequence:        int32(event.Sequence),
+			Type:            string(event.Type),
+			Step:            int32(event.Step),
+			StepName:        event.StepName,
+			Payload:         payload,
+			PayloadRedacted: redacted,
+			Error:           event.Error,
+			At:              timestamppb.New(event.At),
+		})
+	}
+
+	return res, nil
+}
+
+// payloadAccess authorizes the caller to read sensitive payloads if its credentials grant PayloadAccessRole
+func payloadAccess(ctx context.Context) context.Context {
+	if tenant.HasRole(ctx, PayloadAccessRole) {
+		return saga.WithPayloadAccess(ctx)
+	}
+
+	return ctx
+}
+
+func toSaga(instance saga.Instance) (*v1.Saga, error) {
+	payload, redacted, err := toPayload(instance.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.Saga{
+		InstanceId:         instance.ID,
+		SagaName:           instance.SagaName,
+		SagaVersion:        int32(instance.SagaVersion),
+		Status:             string(instance.Status),
+		Step:               int32(instance.Step),
+		Payload:            payload,
+		PayloadRedacted:    redacted,
+		Errors:             instance.Errors,
+		CompensationErrors: instance.CompensationErrors,
+		WaitingFor:         instance.WaitingFor,
+		WakeAt:             toOptionalTimestamp(instance.WakeAt),
+		Failures:           int32(instance.Failures),
+		CreatedAt:          timestamppb.New(instance.CreatedAt),
+		UpdatedAt:          timestamppb.New(instance.UpdatedAt),
+	}, nil
+}
+
+// toPayload converts a decoded payload to its JSON representation, and tells whether it was redacted
+func toPayload(payload interface{}) (*structpb.Value, bool, error) {
+	if _, redacted := payload.(saga.RedactedPayload); redacted {
+		return nil, true, nil
+	}
+	if payload == nil {
+		return nil, false, nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, false, fmt.Errorf("encoding saga payload: %w", err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, false, fmt.Errorf("decoding saga payload: %w", err)
+	}
+	res, err := structpb.NewValue(value)
+	if err != nil {
+		return nil, false, fmt.Errorf("converting saga payload: %w", err)
+	}
+
+	return res, false, nil
+}
+
+func toOptionalTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+
+	return timestamppb.New(t)
+}
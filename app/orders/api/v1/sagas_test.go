@@ -0,0 +1,116 @@
+package v1_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/app/orders/api"
+	apiv1 "github.com/didopimentel/go-saga-poc/app/orders/api/v1"
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+	v1 "github.com/didopimentel/go-saga-poc/protogen/orders/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type card struct {
+	Number string
+}
+
+func newCheckoutExecutor(t *testing.T) *saga.Executor {
+	registry := saga.NewRegistry()
+	keys, err := saga.NewLocalKeyProvider("test", map[string][]byte{"test": make([]byte, 32)})
+	require.NoError(t, err)
+	registry.SetKeyProvider(keys)
+	require.NoError(t, registry.RegisterPayloadType("card", card{}, saga.JSONCodec{}, saga.Sensitive()))
+	require.NoError(t, registry.Register(saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		{
+			Name:    "charge",
+			Output:  card{},
+			Command: func(ctx context.Context) (interface{}, error) { return card{Number: "4111111111111111"}, nil },
+		},
+		saga.Sleep("wait-for-stock", time.Hour),
+	})))
+
+	return saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: saga.NewMemoryStore()})
+}
+
+func TestSagasAPI_RedactsSensitivePayloads(t *testing.T) {
+	executor := newCheckoutExecutor(t)
+	sagasAPI := apiv1.NewSagasAPI(executor)
+	ctx := tenant.WithID(context.Background(), "acme")
+
+	instance, err := executor.Start(ctx, "checkout", nil)
+	require.NoError(t, err)
+
+	got, err := sagasAPI.GetSaga(ctx, &v1.GetSagaRequest{InstanceId: instance.ID})
+	require.NoError(t, err)
+	require.Equal(t, "waiting", got.Saga.Status)
+	require.True(t, got.Saga.PayloadRedacted)
+	require.Nil(t, got.Saga.Payload)
+
+	listed, err := sagasAPI.ListSagas(ctx, &v1.ListSagasRequest{})
+	require.NoError(t, err)
+	require.Len(t, listed.Sagas, 1)
+	require.True(t, listed.Sagas[0].PayloadRedacted)
+
+	history, err := sagasAPI.GetSagaHistory(ctx, &v1.GetSagaHistoryRequest{InstanceId: instance.ID})
+	require.NoError(t, err)
+	for _, event := range history.Events {
+		require.NotContains(t, event.Payload.String(), "4111111111111111")
+	}
+
+	// other tenants do not see the instance
+	_, err = sagasAPI.GetSaga(tenant.WithID(context.Background(), "globex"), &v1.GetSagaRequest{InstanceId: instance.ID})
+	var apiErr *api.Error
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, codes.NotFound, status.Code(apiErr.GRPCError()))
+}
+
+func TestSagasAPI_ServesPayloadsToAuthorizedCallers(t *testing.T) {
+	executor := newCheckoutExecutor(t)
+	sagasAPI := apiv1.NewSagasAPI(executor)
+	instance, err := executor.Start(tenant.WithID(context.Background(), "acme"), "checkout", nil)
+	require.NoError(t, err)
+
+	auth, err := tenant.NewAuthenticator([]byte(strings.Repeat("s", 32)), time.Minute)
+	require.NoError(t, err)
+	getSaga := func(token string) (*v1.GetSagaResponse, error) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenant.MetadataKey, "Bearer "+token))
+		res, err := tenant.UnaryServerInterceptor(auth)(ctx, &v1.GetSagaRequest{InstanceId: instance.ID},
+			&grpc.UnaryServerInfo{FullMethod: "/orders.OrdersAPI/GetSaga"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return sagasAPI.GetSaga(ctx, req.(*v1.GetSagaRequest))
+			})
+		if err != nil {
+			return nil, err
+		}
+		return res.(*v1.GetSagaResponse), nil
+	}
+
+	token, err := auth.Sign("acme", apiv1.PayloadAccessRole)
+	require.NoError(t, err)
+	got, err := getSaga(token)
+	require.NoError(t, err)
+	require.False(t, got.Saga.PayloadRedacted)
+	require.Equal(t, "4111111111111111", got.Saga.Payload.GetStructValue().Fields["Number"].GetStringValue())
+
+	token, err = auth.Sign("acme")
+	require.NoError(t, err)
+	got, err = getSaga(token)
+	require.NoError(t, err)
+	require.True(t, got.Saga.PayloadRedacted)
+
+	// the role does not reach the instances of other tenants
+	token, err = auth.Sign("globex", apiv1.PayloadAccessRole)
+	require.NoError(t, err)
+	_, err = getSaga(token)
+	var apiErr *api.Error
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, codes.NotFound, status.Code(apiErr.GRPCError()))
+}
@@ -0,0 +1,66 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/didopimentel/go-saga-poc/domain/payment"
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+)
+
+// ProcessedCommands runs the handling of a command at most once, answering a command delivered again with the
+// reply recorded the first time, see persistence.ProcessedMessages
+type ProcessedCommands interface {
+	Process(ctx context.Context, id string, handle func(ctx context.Context) (interface{}, error)) (json.RawMessage, error)
+}
+
+// PaymentsCommands handles the commands sent to the payments service by saga steps, see saga.ServeCommands.
+// Commands are delivered at least once, so they are deduplicated by their Message.ID.
+type PaymentsCommands struct {
+	PaymentsAPIUseCases
+	processed ProcessedCommands
+}
+
+func NewPaymentsCommands(uc PaymentsAPIUseCases, processed ProcessedCommands) *PaymentsCommands {
+	return &PaymentsCommands{
+		PaymentsAPIUseCases: uc,
+		processed:           processed,
+	}
+}
+
+func (c *PaymentsCommands) Handle(ctx context.Context, command saga.Message) (interface{}, error) {
+	return c.processed.Process(ctx, command.ID, func(ctx context.Context) (interface{}, error) {
+		return c.handle(ctx, command)
+	})
+}
+
+func (c *PaymentsCommands) handle(ctx context.Context, command saga.Message) (interface{}, error) {
+	switch command.Type {
+	case payment.CreatePaymentCommand:
+		var input payment.CreatePaymentInput
+		if err := json.Unmarshal(command.Payload, &input); err != nil {
+			return nil, saga.Reject(fmt.Errorf("decoding %s command: %w", command.Type, err))
+		}
+		o, err := c.PaymentsAPIUseCases.CreatePayment(ctx, input)
+		if errors.Is(err, payment.ErrInvalidAmount) {
+			return nil, saga.Reject(err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return o.Payment, nil
+	case payment.DeletePaymentCommand:
+		var input payment.DeletePaymentInput
+		if err := json.Unmarshal(command.Payload, &input); err != nil {
+			return nil, saga.Reject(fmt.Errorf("decoding %s command: %w", command.Type, err))
+		}
+		if _, err := c.PaymentsAPIUseCases.DeletePayment(ctx, input); err != nil {
+			return nil, err
+		}
+		return input, nil
+	}
+
+	return nil, saga.Reject(fmt.Errorf("unknown command %q", command.Type))
+}
@@ -0,0 +1,112 @@
+package v1_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	v1 "github.com/didopimentel/go-saga-poc/app/payments/api/v1"
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/domain/payment"
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePayments struct {
+	created []int64
+	deleted []int64
+}
+
+func (f *fakePayments) CreatePayment(_ context.Context, input payment.CreatePaymentInput) (payment.CreatePaymentOutput, error) {
+	f.created = append(f.created, input.OrderID)
+	return payment.CreatePaymentOutput{Payment: entities.Payment{ID: 7, OrderID: input.OrderID}}, nil
+}
+
+func (f *fakePayments) DeletePayment(_ context.Context, input payment.DeletePaymentInput) (payment.DeletePaymentOutput, error) {
+	f.deleted = append(f.deleted, input.PaymentID)
+	return payment.DeletePaymentOutput{}, nil
+}
+
+// fakeProcessed records the replies of the handled commands like persistence.ProcessedMessages
+type fakeProcessed struct {
+	replies map[string]json.RawMessage
+}
+
+func (f *fakeProcessed) Process(ctx context.Context, id string, handle func(ctx context.Context) (interface{}, error)) (json.RawMessage, error) {
+	if reply, ok := f.replies[id]; ok {
+		return reply, nil
+	}
+	output, err := handle(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := json.Marshal(output)
+	if err != nil {
+		return nil, err
+	}
+	f.replies[id] = reply
+
+	return reply, nil
+}
+
+func TestPaymentsCommands_Handle(t *testing.T) {
+	payments := &fakePayments{}
+	commands := v1.NewPaymentsCommands(payments, &fakeProcessed{replies: map[string]json.RawMessage{}})
+	ctx := context.Background()
+
+	reply, err := commands.Handle(ctx, saga.Message{ID: "1/create-payment", Type: payment.CreatePaymentCommand, Payload: []byte(`{"OrderID":1}`)})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"ID":7,"OrderID":1,"Amount":0}`, string(reply.(json.RawMessage)))
+
+	reply, err = commands.Handle(ctx, saga.Message{ID: "2/refund-payment", Type: payment.DeletePaymentCommand, Payload: []byte(`{"PaymentID":7,"OrderID":1}`)})
+	require.NoError(t, err)
+	require.Equal(t, []int64{7}, payments.deleted)
+	// the reply tells the saga which order was refunded
+	require.JSONEq(t, `{"PaymentID":7,"OrderID":1}`, string(reply.(json.RawMessage)))
+
+	var rejected *saga.RejectedError
+	_, err = commands.Handle(ctx, saga.Message{ID: "2/refund", Type: "payments.Refund"})
+	require.ErrorAs(t, err, &rejected)
+	_, err = commands.Handle(ctx, saga.Message{ID: "3/create-payment", Type: payment.CreatePaymentCommand, Payload: []byte(`not json`)})
+	require.ErrorAs(t, err, &rejected)
+}
+
+func TestPaymentsCommands_Handle_DeduplicatesRedeliveredCommands(t *testing.T) {
+	payments := &fakePayments{}
+	commands := v1.NewPaymentsCommands(payments, &fakeProcessed{replies: map[string]json.RawMessage{}})
+	ctx := context.Background()
+	command := saga.Message{ID: "1/create-payment", Type: payment.CreatePaymentCommand, Payload: []byte(`{"OrderID":1}`)}
+
+	first, err := commands.Handle(ctx, command)
+	require.NoError(t, err)
+	again, err := commands.Handle(ctx, command)
+	require.NoError(t, err)
+
+	require.Equal(t, first, again)
+	require.Equal(t, []int64{1}, payments.created)
+}
+
+type fakePaymentsGateway struct{}
+
+func (fakePaymentsGateway) CreatePayment(_ context.Context, orderID, amount int64) (entities.Payment, error) {
+	return entities.Payment{ID: 7, OrderID: orderID, Amount: amount}, nil
+}
+
+func (fakePaymentsGateway) DeletePayment(context.Context, int64) error {
+	return nil
+}
+
+func TestPaymentsCommands_Handle_RejectsInvalidAmounts(t *testing.T) {
+	uc := &struct {
+		*payment.CreatePaymentUseCase
+		*payment.DeletePaymentUseCase
+	}{payment.NewCreatePaymentUseCase(fakePaymentsGateway{}), payment.NewDeletePaymentUseCase(fakePaymentsGateway{})}
+	commands := v1.NewPaymentsCommands(uc, &fakeProcessed{replies: map[string]json.RawMessage{}})
+
+	// an invalid amount is not transient, so the command is answered with a failure rather than delivered again
+	var rejected *saga.RejectedError
+	_, err := commands.Handle(context.Background(), saga.Message{ID: "1/create-payment", Type: payment.CreatePaymentCommand,
+		Payload: []byte(`{"OrderID":1,"Amount":0}`)})
+	require.ErrorAs(t, err, &rejected)
+	require.ErrorIs(t, err, payment.ErrInvalidAmount)
+}
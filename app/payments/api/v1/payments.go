@@ -2,6 +2,8 @@ package v1
 
 import (
 	"context"
+	"errors"
+	"github.com/didopimentel/go-saga-poc/app/payments/api"
 	"github.com/didopimentel/go-saga-poc/domain/payment"
 	v1 "github.com/didopimentel/go-saga-poc/protogen/payments/api/v1"
 )
@@ -24,14 +26,19 @@ type PaymentsAPIUseCases interface {
 func (a *PaymentsAPI) CreatePayment(ctx context.Context, req *v1.CreatePaymentRequest) (*v1.CreatePaymentResponse, error) {
 	o, err := a.PaymentsAPIUseCases.CreatePayment(ctx, payment.CreatePaymentInput{
 		OrderID: req.OrderId,
+		Amount:  req.Amount,
 	})
 	if err != nil {
+		if errors.Is(err, payment.ErrInvalidAmount) {
+			return nil, api.NewBadRequestError("%s", err.Error())
+		}
 		return nil, err
 	}
 
 	return &v1.CreatePaymentResponse{
 		Id:      o.Payment.ID,
 		OrderId: o.Payment.OrderID,
+		Amount:  o.Payment.Amount,
 	}, nil
 }
 
@@ -2,14 +2,18 @@ package v1_test
 
 import (
 	"context"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
 	v12 "github.com/didopimentel/go-saga-poc/protogen/payments/api/v1"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"os"
 	"testing"
+	"time"
 )
 
 func TestCreateOrder(t *testing.T) {
-	ctx := context.Background()
+	ctx := authenticatedContext(t)
 	dial, err := grpc.DialContext(ctx, ":7010", grpc.WithInsecure())
 	if err != nil {
 		panic(err)
@@ -17,7 +21,24 @@ func TestCreateOrder(t *testing.T) {
 
 	client := v12.NewPaymentsAPIClient(dial)
 
-	response, err := client.CreatePayment(ctx, &v12.CreatePaymentRequest{OrderId: 1})
+	response, err := client.CreatePayment(ctx, &v12.CreatePaymentRequest{OrderId: 1, Amount: 100})
 	require.NoError(t, err)
 	require.Equal(t, int64(1), response.OrderId)
 }
+
+// testTokenSecret signs the credentials when TENANT_TOKEN_SECRET is not set, for services started with it
+const testTokenSecret = "go-saga-poc-test-tenant-token-secret"
+
+// authenticatedContext sends the credentials of the test tenant, signed with the TENANT_TOKEN_SECRET of the services
+func authenticatedContext(t *testing.T) context.Context {
+	secret := os.Getenv("TENANT_TOKEN_SECRET")
+	if secret == "" {
+		secret = testTokenSecret
+	}
+	auth, err := tenant.NewAuthenticator([]byte(secret), time.Minute)
+	require.NoError(t, err)
+	token, err := auth.Sign("test")
+	require.NoError(t, err)
+
+	return metadata.AppendToOutgoingContext(context.Background(), tenant.MetadataKey, "Bearer "+token)
+}
@@ -0,0 +1,84 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+)
+
+type DeliveryStatusPersistenceGateway interface {
+	// GetDelivery fails with domain.ErrNotFound if the tenant has no such delivery
+	GetDelivery(ctx context.Context, id int64) (entities.Delivery, error)
+	// UpdateDeliveryStatus fails with domain.ErrStatusChanged if the delivery is not in the from status anymore
+	UpdateDeliveryStatus(ctx context.Context, id int64, from, to entities.DeliveryStatus) (entities.Delivery, error)
+}
+
+// CancelDeliveryUseCase cancels scheduled deliveries, and reinstates them when the cancellation is compensated
+type CancelDeliveryUseCase struct {
+	persistenceGateway DeliveryStatusPersistenceGateway
+}
+
+func NewCancelDeliveryUseCase(persistenceGateway DeliveryStatusPersistenceGateway) *CancelDeliveryUseCase {
+	return &CancelDeliveryUseCase{persistenceGateway: persistenceGateway}
+}
+
+type CancelDeliveryInput struct {
+	DeliveryID int64
+}
+type CancelDeliveryOutput struct {
+	Delivery entities.Delivery
+}
+
+// CancelDelivery fails with domain.ErrAlreadyDelivered if the delivery was delivered.
+// Cancelling a cancelled delivery is a no-op.
+func (u *CancelDeliveryUseCase) CancelDelivery(ctx context.Context, input CancelDeliveryInput) (CancelDeliveryOutput, error) {
+	delivery, err := u.move(ctx, input.DeliveryID, entities.DeliveryStatusScheduled, entities.DeliveryStatusCancelled)
+	if err != nil {
+		return CancelDeliveryOutput{}, err
+	}
+
+	return CancelDeliveryOutput{Delivery: delivery}, nil
+}
+
+type ReinstateDeliveryInput struct {
+	DeliveryID int64
+}
+type ReinstateDeliveryOutput struct {
+	Delivery entities.Delivery
+}
+
+// ReinstateDelivery schedules a cancelled delivery again. Reinstating a scheduled or a delivered delivery is a no-op,
+// the latter because it is what compensating a cancellation that failed with domain.ErrAlreadyDelivered does.
+func (u *CancelDeliveryUseCase) ReinstateDelivery(ctx context.Context, input ReinstateDeliveryInput) (ReinstateDeliveryOutput, error) {
+	delivery, err := u.move(ctx, input.DeliveryID, entities.DeliveryStatusCancelled, entities.DeliveryStatusScheduled)
+	if errors.Is(err, domain.ErrAlreadyDelivered) {
+		delivery, err = u.persistenceGateway.GetDelivery(ctx, input.DeliveryID)
+	}
+	if err != nil {
+		return ReinstateDeliveryOutput{}, err
+	}
+
+	return ReinstateDeliveryOutput{Delivery: delivery}, nil
+}
+
+// move changes the status of a delivery from one status to another, unless it already has the target one
+func (u *CancelDeliveryUseCase) move(ctx context.Context, id int64, from, to entities.DeliveryStatus) (entities.Delivery, error) {
+	delivery, err := u.persistenceGateway.GetDelivery(ctx, id)
+	if err != nil {
+		return entities.Delivery{}, err
+	}
+
+	switch delivery.Status {
+	case to:
+		return delivery, nil
+	case from:
+		return u.persistenceGateway.UpdateDeliveryStatus(ctx, id, from, to)
+	case entities.DeliveryStatusDelivered:
+		return entities.Delivery{}, fmt.Errorf("delivery %d: %w", id, domain.ErrAlreadyDelivered)
+	}
+
+	return entities.Delivery{}, fmt.Errorf("delivery %d is %s: %w", id, delivery.Status, domain.ErrStatusChanged)
+}
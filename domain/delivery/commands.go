@@ -0,0 +1,13 @@
+package delivery
+
+// Commands accepted by the delivery service through a saga.Transport, see saga.Commands
+const (
+	CommandsDestination = "deliveries.commands"
+	// CreateDeliveryCommand takes a CreateDeliveryInput and replies with the created entities.Delivery
+	CreateDeliveryCommand = "deliveries.CreateDelivery"
+	// CancelDeliveryCommand takes a CancelDeliveryInput and replies with the cancelled entities.Delivery.
+	// It is rejected once the delivery was delivered.
+	CancelDeliveryCommand = "deliveries.CancelDelivery"
+	// ReinstateDeliveryCommand takes a ReinstateDeliveryInput and replies with the reinstated entities.Delivery
+	ReinstateDeliveryCommand = "deliveries.ReinstateDelivery"
+)
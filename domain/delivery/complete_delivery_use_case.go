@@ -0,0 +1,48 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+)
+
+// CompleteDeliveryUseCase records that scheduled deliveries were delivered
+type CompleteDeliveryUseCase struct {
+	persistenceGateway DeliveryStatusPersistenceGateway
+}
+
+func NewCompleteDeliveryUseCase(persistenceGateway DeliveryStatusPersistenceGateway) *CompleteDeliveryUseCase {
+	return &CompleteDeliveryUseCase{persistenceGateway: persistenceGateway}
+}
+
+type CompleteDeliveryInput struct {
+	DeliveryID int64
+}
+type CompleteDeliveryOutput struct {
+	Delivery entities.Delivery
+}
+
+// CompleteDelivery fails with domain.ErrDeliveryCancelled if the delivery was cancelled.
+// Completing a delivered delivery is a no-op.
+func (u *CompleteDeliveryUseCase) CompleteDelivery(ctx context.Context, input CompleteDeliveryInput) (CompleteDeliveryOutput, error) {
+	delivery, err := u.persistenceGateway.GetDelivery(ctx, input.DeliveryID)
+	if err != nil {
+		return CompleteDeliveryOutput{}, err
+	}
+
+	switch delivery.Status {
+	case entities.DeliveryStatusDelivered:
+		return CompleteDeliveryOutput{Delivery: delivery}, nil
+	case entities.DeliveryStatusCancelled:
+		return CompleteDeliveryOutput{}, fmt.Errorf("delivery %d: %w", input.DeliveryID, domain.ErrDeliveryCancelled)
+	}
+
+	delivery, err = u.persistenceGateway.UpdateDeliveryStatus(ctx, input.DeliveryID, delivery.Status, entities.DeliveryStatusDelivered)
+	if err != nil {
+		return CompleteDeliveryOutput{}, err
+	}
+
+	return CompleteDeliveryOutput{Delivery: delivery}, nil
+}
@@ -0,0 +1,13 @@
+package delivery
+
+// Reasons of the failed preconditions of the delivery API, sent in the google.rpc.ErrorInfo details of its errors
+// so clients tell the domain errors apart without parsing messages
+const (
+	ErrorDomain = "delivery"
+	// ReasonAlreadyDelivered stands for domain.ErrAlreadyDelivered
+	ReasonAlreadyDelivered = "ALREADY_DELIVERED"
+	// ReasonDeliveryCancelled stands for domain.ErrDeliveryCancelled
+	ReasonDeliveryCancelled = "DELIVERY_CANCELLED"
+	// ReasonStatusChanged stands for domain.ErrStatusChanged
+	ReasonStatusChanged = "STATUS_CHANGED"
+)
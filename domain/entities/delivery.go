@@ -1,6 +1,16 @@
 package entities
 
+// DeliveryStatus is a state of the lifecycle of a delivery
+type DeliveryStatus string
+
+const (
+	DeliveryStatusScheduled DeliveryStatus = "SCHEDULED"
+	DeliveryStatusDelivered DeliveryStatus = "DELIVERED"
+	DeliveryStatusCancelled DeliveryStatus = "CANCELLED"
+)
+
 type Delivery struct {
 	ID      int64
 	OrderID int64
+	Status  DeliveryStatus
 }
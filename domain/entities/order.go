@@ -1,8 +1,74 @@
 package entities
 
+import "time"
+
+// OrderStatus is a state of the lifecycle of an order, see order.ValidateTransition
+type OrderStatus string
+
+const (
+	// OrderStatusPending is the status of an order created by the create-order saga, which has no payment yet
+	OrderStatusPending           OrderStatus = "PENDING"
+	OrderStatusPaymentCreated    OrderStatus = "PAYMENT_CREATED"
+	OrderStatusDeliveryScheduled OrderStatus = "DELIVERY_SCHEDULED"
+	// OrderStatusApproved is the status of an order whose create-order saga completed
+	OrderStatusApproved OrderStatus = "APPROVED"
+	// OrderStatusRejected is the status of an order whose create-order saga was compensated
+	OrderStatusRejected  OrderStatus = "REJECTED"
+	OrderStatusCancelled OrderStatus = "CANCELLED"
+)
+
+// Valid tells whether the status is one of the statuses above
+func (s OrderStatus) Valid() bool {
+	switch s {
+	case OrderStatusPending, OrderStatusPaymentCreated, OrderStatusDeliveryScheduled, OrderStatusApproved,
+		OrderStatusRejected, OrderStatusCancelled:
+		return true
+	}
+
+	return false
+}
+
+// LineItem is a product ordered in some quantity. Its unit price is the price of the product when it was ordered.
+type LineItem struct {
+	ProductID int64
+	Quantity  int64
+	UnitPrice int64
+}
+
 type Order struct {
-	ID         int64
+	ID int64
+	// Amount is the total of the items
 	Amount     int64
+	Items      []LineItem
 	PaymentID  int64
 	DeliveryID int64
+	Status     OrderStatus
+	// LockedBy is the id of the saga instance that owns the order while it runs, empty otherwise
+	LockedBy string
+	// IdempotencyKey is the key given by the client that created the order, if any, and RequestFingerprint
+	// identifies the content of its request, so a repeat can be told apart from a different request reusing the key
+	IdempotencyKey     string
+	RequestFingerprint string
+	// SagaInstanceID is the id of the saga instance that created the order
+	SagaInstanceID string
+	CreatedAt      time.Time
+	// UpdatedAt is when the order last changed status
+	UpdatedAt time.Time
+}
+
+// Locked tells whether a saga is still working on the order, in which case it may be incomplete
+func (o Order) Locked() bool {
+	return o.LockedBy != ""
+}
+
+// OrderFilter selects orders. Its zero value selects every order.
+type OrderFilter struct {
+	// Statuses selects the orders in any of them, if set
+	Statuses []OrderStatus
+	// MinAmount and MaxAmount bound the amount of the orders inclusively, if set
+	MinAmount *int64
+	MaxAmount *int64
+	// CreatedAfter and CreatedBefore bound the creation time of the orders, inclusively and exclusively, if set
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
 }
@@ -3,4 +3,5 @@ package entities
 type Payment struct {
 	ID      int64
 	OrderID int64
+	Amount  int64
 }
@@ -0,0 +1,13 @@
+package entities
+
+import "time"
+
+// Product is an entry of the catalog orders are priced from
+type Product struct {
+	ID   int64
+	Name string
+	// Price is the unit price of the product, in the same unit as order amounts
+	Price     int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,19 @@
+package domain
+
+import "errors"
+
+// ErrNotFound is returned by gateways looking up a record that does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrIdempotencyKeyConflict is returned by gateways creating a record with an idempotency key that another record
+// already has, e.g. because a retry of the same request raced with it
+var ErrIdempotencyKeyConflict = errors.New("idempotency key is already used")
+
+// ErrStatusChanged is returned by gateways updating the status of a record that changed in the meantime
+var ErrStatusChanged = errors.New("status changed concurrently")
+
+// ErrAlreadyDelivered is returned when cancelling a delivery that was already delivered
+var ErrAlreadyDelivered = errors.New("delivery was already delivered")
+
+// ErrDeliveryCancelled is returned when completing a delivery that was cancelled
+var ErrDeliveryCancelled = errors.New("delivery was cancelled")
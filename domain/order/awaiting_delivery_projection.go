@@ -0,0 +1,60 @@
+package order
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+)
+
+// AwaitingDeliveryProjection is a read model of the orders that were paid but have no delivery yet,
+// built from the history of the create-order sagas
+type AwaitingDeliveryProjection struct {
+	mu     sync.RWMutex
+	orders map[int64]entities.Order
+}
+
+func NewAwaitingDeliveryProjection() *AwaitingDeliveryProjection {
+	return &AwaitingDeliveryProjection{orders: map[int64]entities.Order{}}
+}
+
+func (p *AwaitingDeliveryProjection) Project(_ context.Context, event saga.Event) error {
+	if event.SagaName != CreateOrderSagaName {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// versions before 3 create the payment and the delivery in the create-* steps, and later ones save them in the
+	// record-* steps, whose completions are the ones carrying the order
+	switch {
+	case event.Type == saga.EventStepCompleted && (event.StepName == "create-payment" || event.StepName == "record-payment"):
+		if order, ok := event.Payload.(entities.Order); ok {
+			p.orders[order.ID] = order
+		}
+	case event.Type == saga.EventStepCompleted && (event.StepName == "create-delivery" || event.StepName == "record-delivery"),
+		event.Type == saga.EventCompensationCompleted && event.StepName == "create-payment":
+		if order, ok := event.Payload.(entities.Order); ok {
+			delete(p.orders, order.ID)
+		}
+	}
+
+	return nil
+}
+
+// Orders returns the orders awaiting delivery, by id
+func (p *AwaitingDeliveryProjection) Orders() []entities.Order {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	orders := make([]entities.Order, 0, len(p.orders))
+	for _, order := range p.orders {
+		orders = append(orders, order)
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+
+	return orders
+}
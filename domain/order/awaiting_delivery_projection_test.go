@@ -0,0 +1,55 @@
+package order_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/domain/order"
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/gateways/payments"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAwaitingDeliveryProjection(t *testing.T) {
+	registry := saga.NewRegistry()
+	keys, err := saga.NewLocalKeyProvider("test", map[string][]byte{"test": make([]byte, 32)})
+	require.NoError(t, err)
+	registry.SetKeyProvider(keys)
+	executor := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: saga.NewMemoryStore()})
+	projection := order.NewAwaitingDeliveryProjection()
+	projector := saga.NewProjector(executor, projection, 0, time.Second)
+
+	var awaitingDuringDelivery []entities.Order
+	deliveries := &fakeDeliveries{onCreate: func(orderID int64) {
+		_, err := projector.CatchUp(context.Background())
+		require.NoError(t, err)
+		awaitingDuringDelivery = projection.Orders()
+	}}
+	paymentsGateway := payments.NewMemoryGateway()
+	orders, locks := newFakeOrders(), newFakeLocks()
+	uc := order.NewCreateOrderUseCase(orders, fakeCatalog{}, locks, fakeTx{orders: orders, locks: locks}, paymentsGateway, deliveries,
+		syncCommands{payments: paymentsGateway, deliveries: deliveries}, executor, saga.NewLimiter(saga.LimiterConfig{}))
+	require.NoError(t, uc.RegisterSagas(registry))
+
+	output, err := uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks})
+	require.NoError(t, err)
+	require.Len(t, awaitingDuringDelivery, 1)
+	require.Equal(t, output.Order.ID, awaitingDuringDelivery[0].ID)
+	require.Equal(t, output.Order.PaymentID, awaitingDuringDelivery[0].PaymentID)
+
+	_, err = projector.CatchUp(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, projection.Orders())
+
+	// a compensated payment is no longer awaiting delivery either
+	deliveries.onCreate = nil
+	deliveries.err = errors.New("deliveries unavailable")
+	_, err = uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks})
+	require.Error(t, err)
+	_, err = projector.CatchUp(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, projection.Orders())
+}
@@ -0,0 +1,102 @@
+package order
+
+import (
+	"context"
+
+	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+)
+
+// cancelOrderSagaV1 is the first version of the cancel-order saga, cancelling the delivery and refunding the payment
+// with synchronous calls. It stays registered so the instances started with it can be resumed, and must not change
+// anymore.
+func (u *CancelOrderUseCase) cancelOrderSagaV1() saga.Saga {
+	steps := []saga.Step{
+		{
+			Name:   "lock-order",
+			Output: entities.Order{},
+			Command: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
+				if err := domain.LockForSaga(ctx, u.orderLocks, reqInput.ID); err != nil {
+					return nil, err
+				}
+
+				// the order may have changed since it was checked, it cannot anymore
+				locked, err := u.persistenceGateway.GetOrder(ctx, reqInput.ID)
+				if err != nil {
+					return nil, err
+				}
+				if err := ValidateTransition(locked.ID, locked.Status, entities.OrderStatusCancelled); err != nil {
+					return nil, err
+				}
+
+				return locked, nil
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
+				return nil, domain.UnlockForSaga(ctx, u.orderLocks, reqInput.ID)
+			},
+		},
+		{
+			Name:   "cancel-delivery",
+			Output: entities.Order{},
+			Command: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
+				if reqInput.DeliveryID == 0 {
+					return reqInput, nil
+				}
+
+				return reqInput, u.deliveriesGateway.CancelDelivery(ctx, reqInput.DeliveryID)
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
+				if reqInput.DeliveryID == 0 {
+					return nil, nil
+				}
+
+				return nil, u.deliveriesGateway.ReinstateDelivery(ctx, reqInput.DeliveryID)
+			},
+		},
+		{
+			Name:   "refund-payment",
+			Output: entities.Order{},
+			Pivot:  true,
+			Command: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
+				if reqInput.PaymentID == 0 {
+					return reqInput, nil
+				}
+
+				return reqInput, u.paymentsGateway.DeletePayment(ctx, reqInput.PaymentID)
+			},
+		},
+		{
+			Name:      "mark-cancelled",
+			Output:    entities.Order{},
+			Retriable: true,
+			Command: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
+				// the order is cancelled and released at once
+				var cancelled entities.Order
+				err := u.tx.WithTx(ctx, func(ctx context.Context) error {
+					var err error
+					if cancelled, err = Transition(ctx, u.persistenceGateway, reqInput, entities.OrderStatusCancelled); err != nil {
+						return err
+					}
+					return domain.UnlockForSaga(ctx, u.orderLocks, reqInput.ID)
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				cancelled.LockedBy = ""
+				return cancelled, nil
+			},
+		},
+	}
+	s := saga.NewVersionedSaga(CancelOrderSagaName, 1, steps)
+	s.Input = entities.Order{}
+
+	return s
+}
@@ -0,0 +1,290 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/domain/delivery"
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/domain/payment"
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+)
+
+// CancelOrderUseCasePaymentGateway and CancelOrderUseCaseDeliveriesGateway are only called by the first version of
+// the cancel-order saga, later ones send commands instead, see CancelOrderUseCaseCommands
+type CancelOrderUseCasePaymentGateway interface {
+	DeletePayment(ctx context.Context, paymentID int64) error
+}
+
+type CancelOrderUseCaseDeliveriesGateway interface {
+	// CancelDelivery fails with domain.ErrAlreadyDelivered if the delivery was delivered
+	CancelDelivery(ctx context.Context, deliveryID int64) error
+	ReinstateDelivery(ctx context.Context, deliveryID int64) error
+}
+
+// CancelOrderUseCaseCommands builds the saga steps sending commands to the payments and delivery services,
+// see saga.Commands
+type CancelOrderUseCaseCommands interface {
+	Step(name, destination, commandType string, command func(ctx context.Context) (interface{}, error), timeout time.Duration) saga.Step
+	Compensation(name, destination, commandType string, command func(ctx context.Context) (interface{}, error)) func(ctx context.Context) (interface{}, error)
+}
+
+type CancelOrderUseCaseSagaExecutor interface {
+	Start(ctx context.Context, name string, payload interface{}) (saga.Instance, error)
+}
+
+// CancelOrderUseCaseLimiter admits order cancellations, see CreateOrderUseCaseLimiter
+type CancelOrderUseCaseLimiter interface {
+	Do(ctx context.Context, name string, f func(ctx context.Context) error) error
+}
+
+const (
+	CancelOrderSagaName = "cancel-order"
+	// CancelOrderSagaVersion is the version of the saga built by CancelOrderSaga, the one new instances run.
+	// Older versions stay registered by RegisterSagas
+	CancelOrderSagaVersion = 2
+)
+
+// ErrOrderIncomplete is returned when cancelling an order that has no payment or no delivery, e.g. one left behind
+// by the first version of the create-order saga
+var ErrOrderIncomplete = errors.New("order has no payment or delivery to cancel")
+
+type CancelOrderUseCase struct {
+	persistenceGateway OrderStatusGateway
+	paymentsGateway    CancelOrderUseCasePaymentGateway
+	deliveriesGateway  CancelOrderUseCaseDeliveriesGateway
+	commands           CancelOrderUseCaseCommands
+	orderLocks         domain.SemanticLocker
+	tx                 domain.Transactioner
+	sagas              CancelOrderUseCaseSagaExecutor
+	limiter            CancelOrderUseCaseLimiter
+}
+
+func NewCancelOrderUseCase(persistenceGateway OrderStatusGateway,
+	orderLocks domain.SemanticLocker,
+	tx domain.Transactioner,
+	paymentsGateway CancelOrderUseCasePaymentGateway,
+	deliveriesGateway CancelOrderUseCaseDeliveriesGateway,
+	commands CancelOrderUseCaseCommands,
+	sagas CancelOrderUseCaseSagaExecutor,
+	limiter CancelOrderUseCaseLimiter) *CancelOrderUseCase {
+	return &CancelOrderUseCase{
+		persistenceGateway: persistenceGateway,
+		orderLocks:         orderLocks,
+		tx:                 tx,
+		paymentsGateway:    paymentsGateway,
+		deliveriesGateway:  deliveriesGateway,
+		commands:           commands,
+		sagas:              sagas,
+		limiter:            limiter,
+	}
+}
+
+// RegisterSagas registers the sagas run by the use case. Its payloads are entities.Order values, whose payload type
+// is registered by CreateOrderUseCase.RegisterSagas, which must be called first.
+// Versions that may still have unfinished instances must stay registered when a new one is added.
+func (u *CancelOrderUseCase) RegisterSagas(registry *saga.Registry) error {
+	if err := registry.Register(u.cancelOrderSagaV1()); err != nil {
+		return err
+	}
+
+	return registry.Register(u.CancelOrderSaga())
+}
+
+type CancelOrderInput struct {
+	OrderID int64
+}
+
+type CancelOrderOutput struct {
+	Order entities.Order
+	// InProgress is set while the saga waits for the delivery and payments services, or retries marking the order
+	// as cancelled. The saga goes on in the background.
+	InProgress bool
+}
+
+// CancelOrder cancels the delivery of an order, refunds its payment and marks it as cancelled.
+// It returns once the order is locked, while the delivery and the payment may still be in progress.
+// It fails with an *InvalidTransitionError if the order cannot be cancelled anymore, e.g. because it was rejected,
+// with a *domain.LockedError while another saga works on it, and with ErrOrderIncomplete if it has no payment or
+// no delivery. Once its delivery was delivered, the saga is compensated and leaves the order as it was.
+// Cancelling a cancelled order is a no-op.
+func (u *CancelOrderUseCase) CancelOrder(ctx context.Context, input CancelOrderInput) (CancelOrderOutput, error) {
+	if _, err := tenant.Require(ctx); err != nil {
+		return CancelOrderOutput{}, err
+	}
+
+	o, err := u.persistenceGateway.GetOrder(ctx, input.OrderID)
+	if err != nil {
+		return CancelOrderOutput{}, err
+	}
+	if o.Status == entities.OrderStatusCancelled {
+		return CancelOrderOutput{Order: o}, nil
+	}
+	if err := validateCancellation(o); err != nil {
+		return CancelOrderOutput{}, err
+	}
+	if err := domain.EnsureUnlocked(ctx, u.orderLocks, "order", o.ID); err != nil {
+		return CancelOrderOutput{}, err
+	}
+
+	output := CancelOrderOutput{}
+	err = u.limiter.Do(ctx, CancelOrderSagaName, func(ctx context.Context) error {
+		instance, err := u.sagas.Start(ctx, CancelOrderSagaName, o)
+		if err != nil {
+			var execErr *saga.ExecutionError
+			if errors.As(err, &execErr) {
+				return fmt.Errorf("could not cancel order %d: %w", o.ID, execErr)
+			}
+			return err
+		}
+
+		// the saga waits for the delivery service after locking the order
+		output.Order = instance.Payload.(entities.Order)
+		output.InProgress = instance.Status != saga.StatusCompleted
+		return nil
+	})
+	if err != nil {
+		return CancelOrderOutput{}, err
+	}
+
+	return output, nil
+}
+
+// validateCancellation checks that the order can move to CANCELLED, and has a delivery to cancel and a payment to refund
+func validateCancellation(o entities.Order) error {
+	if err := ValidateTransition(o.ID, o.Status, entities.OrderStatusCancelled); err != nil {
+		return err
+	}
+	if o.PaymentID == 0 || o.DeliveryID == 0 {
+		return fmt.Errorf("order %d: %w", o.ID, ErrOrderIncomplete)
+	}
+
+	return nil
+}
+
+// CancelOrderSaga builds the saga that cancels an order. It expects the entities.Order to cancel as its initial
+// saga.ParamKey value and results in the cancelled entities.Order.
+// The delivery is cancelled and the payment refunded by commands sent through the saga transport, see saga.Commands.
+// The order is semantically locked while the saga runs. Refunding the payment is the pivot of the saga: the delivery
+// is reinstated if cancelling it fails, and marking the order as cancelled is retried until it succeeds once the
+// payment is refunded.
+func (u *CancelOrderUseCase) CancelOrderSaga() saga.Saga {
+	cancelDelivery := u.commands.Step("cancel-delivery", delivery.CommandsDestination, delivery.CancelDeliveryCommand,
+		func(ctx context.Context) (interface{}, error) {
+			o := ctx.Value(saga.ParamKey).(entities.Order)
+			return delivery.CancelDeliveryInput{DeliveryID: o.DeliveryID}, nil
+		}, 0)
+	// reinstating a delivery that was not cancelled is a no-op, so it is sent whether the cancellation went through
+	// or not
+	cancelDelivery.CompensationCommand = u.commands.Compensation("cancel-delivery", delivery.CommandsDestination,
+		delivery.ReinstateDeliveryCommand, func(ctx context.Context) (interface{}, error) {
+			o, err := u.orderOf(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return delivery.ReinstateDeliveryInput{DeliveryID: o.DeliveryID}, nil
+		})
+
+	refundPayment := u.commands.Step("refund-payment", payment.CommandsDestination, payment.DeletePaymentCommand,
+		func(ctx context.Context) (interface{}, error) {
+			o, err := u.orderOf(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return payment.DeletePaymentInput{PaymentID: o.PaymentID, OrderID: o.ID}, nil
+		}, 0)
+	refundPayment.Pivot = true
+
+	steps := []saga.Step{
+		{
+			Name:   "lock-order",
+			Output: entities.Order{},
+			Command: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
+				if err := domain.LockForSaga(ctx, u.orderLocks, reqInput.ID); err != nil {
+					return nil, err
+				}
+
+				// the order may have changed since it was checked, it cannot anymore
+				locked, err := u.persistenceGateway.GetOrder(ctx, reqInput.ID)
+				if err != nil {
+					return nil, err
+				}
+				if err := validateCancellation(locked); err != nil {
+					return nil, err
+				}
+
+				return locked, nil
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) {
+				o, err := u.orderOf(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return nil, domain.UnlockForSaga(ctx, u.orderLocks, o.ID)
+			},
+		},
+		cancelDelivery,
+		refundPayment,
+		{
+			Name:      "mark-cancelled",
+			Output:    entities.Order{},
+			Retriable: true,
+			Command: func(ctx context.Context) (interface{}, error) {
+				var refund payment.DeletePaymentInput
+				if err := decodeReply(ctx, &refund); err != nil {
+					return nil, fmt.Errorf("decoding refund: %w", err)
+				}
+				o, err := u.persistenceGateway.GetOrder(ctx, refund.OrderID)
+				if err != nil {
+					return nil, fmt.Errorf("loading order %d: %w", refund.OrderID, err)
+				}
+
+				// the order is cancelled and released at once
+				var cancelled entities.Order
+				err = u.tx.WithTx(ctx, func(ctx context.Context) error {
+					var err error
+					if cancelled, err = Transition(ctx, u.persistenceGateway, o, entities.OrderStatusCancelled); err != nil {
+						return err
+					}
+					return domain.UnlockForSaga(ctx, u.orderLocks, o.ID)
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				cancelled.LockedBy = ""
+				return cancelled, nil
+			},
+		},
+	}
+	s := saga.NewVersionedSaga(CancelOrderSagaName, CancelOrderSagaVersion, steps)
+	s.Input = entities.Order{}
+
+	return s
+}
+
+// orderOf returns the order a step of the cancel-order saga applies to. Steps before the pivot see either the order
+// or the reply to the cancel-delivery command.
+func (u *CancelOrderUseCase) orderOf(ctx context.Context) (entities.Order, error) {
+	switch param := ctx.Value(saga.ParamKey).(type) {
+	case entities.Order:
+		return param, nil
+	case saga.Reply:
+		var d entities.Delivery
+		if err := param.Decode(&d); err != nil {
+			return entities.Order{}, fmt.Errorf("decoding delivery: %w", err)
+		}
+		o, err := u.persistenceGateway.GetOrder(ctx, d.OrderID)
+		if err != nil {
+			return entities.Order{}, fmt.Errorf("loading order %d: %w", d.OrderID, err)
+		}
+		return o, nil
+	}
+
+	return entities.Order{}, fmt.Errorf("unexpected input %T of a cancel-order step", ctx.Value(saga.ParamKey))
+}
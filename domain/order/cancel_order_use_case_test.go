@@ -0,0 +1,221 @@
+package order_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/domain/delivery"
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/domain/order"
+	"github.com/didopimentel/go-saga-poc/domain/payment"
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/gateways/deliveries"
+	"github.com/didopimentel/go-saga-poc/gateways/payments"
+	"github.com/stretchr/testify/require"
+)
+
+type cancelFixture struct {
+	create     *order.CreateOrderUseCase
+	cancel     *order.CancelOrderUseCase
+	payments   *payments.MemoryGateway
+	deliveries *deliveries.MemoryGateway
+	orders     *fakeOrders
+	locks      *fakeLocks
+}
+
+// newCancelFixture returns use cases sharing their gateways, so orders created by one can be cancelled by the other
+func newCancelFixture(t *testing.T) cancelFixture {
+	registry := saga.NewRegistry()
+	keys, err := saga.NewLocalKeyProvider("test", map[string][]byte{"test": make([]byte, 32)})
+	require.NoError(t, err)
+	registry.SetKeyProvider(keys)
+	executor := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: saga.NewMemoryStore()})
+	limiter := saga.NewLimiter(saga.LimiterConfig{})
+
+	f := cancelFixture{
+		payments:   payments.NewMemoryGateway(),
+		deliveries: deliveries.NewMemoryGateway(),
+		orders:     newFakeOrders(),
+		locks:      newFakeLocks(),
+	}
+	f.create = order.NewCreateOrderUseCase(f.orders, fakeCatalog{}, f.locks, fakeTx{orders: f.orders, locks: f.locks}, f.payments, f.deliveries,
+		syncCommands{payments: f.payments, deliveries: f.deliveries}, executor, limiter)
+	require.NoError(t, f.create.RegisterSagas(registry))
+	f.cancel = order.NewCancelOrderUseCase(f.orders, f.locks, fakeTx{orders: f.orders, locks: f.locks}, f.payments, f.deliveries,
+		syncCommands{payments: f.payments, deliveries: f.deliveries}, executor, limiter)
+	require.NoError(t, f.cancel.RegisterSagas(registry))
+
+	return f
+}
+
+// throughTransport replaces the cancel use case of the fixture by one sending its commands through a transport,
+// served by the gateways of the fixture once serve is called
+func (f *cancelFixture) throughTransport(t *testing.T) (executor *saga.Executor, serve func()) {
+	registry := saga.NewRegistry()
+	keys, err := saga.NewLocalKeyProvider("test", map[string][]byte{"test": make([]byte, 32)})
+	require.NoError(t, err)
+	registry.SetKeyProvider(keys)
+	executor = saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: saga.NewMemoryStore()})
+	transport := saga.NewMemoryTransport(time.Millisecond)
+	commands := syncCommands{payments: f.payments, deliveries: f.deliveries}
+
+	f.cancel = order.NewCancelOrderUseCase(f.orders, f.locks, fakeTx{orders: f.orders, locks: f.locks}, f.payments, f.deliveries,
+		saga.NewCommands(transport, order.RepliesDestination), executor, saga.NewLimiter(saga.LimiterConfig{}))
+	require.NoError(t, f.create.RegisterSagas(registry))
+	require.NoError(t, f.cancel.RegisterSagas(registry))
+
+	return executor, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		go func() { _ = saga.ServeCommands(ctx, transport, payment.CommandsDestination, commands.serve) }()
+		go func() { _ = saga.ServeCommands(ctx, transport, delivery.CommandsDestination, commands.serve) }()
+		go func() { _ = transport.Receive(ctx, order.RepliesDestination, executor.HandleReply) }()
+	}
+}
+
+func (f cancelFixture) approvedOrder(t *testing.T) entities.Order {
+	output, err := f.create.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks})
+	require.NoError(t, err)
+	require.Equal(t, entities.OrderStatusApproved, output.Order.Status)
+
+	return output.Order
+}
+
+func TestCancelOrderUseCase_Success(t *testing.T) {
+	f := newCancelFixture(t)
+	approved := f.approvedOrder(t)
+
+	output, err := f.cancel.CancelOrder(tenantCtx(), order.CancelOrderInput{OrderID: approved.ID})
+	require.NoError(t, err)
+	require.False(t, output.InProgress)
+	require.Equal(t, entities.OrderStatusCancelled, output.Order.Status)
+	require.Equal(t, entities.OrderStatusCancelled, f.orders.orders[approved.ID].Status)
+	require.Equal(t, entities.DeliveryStatusCancelled, f.deliveries.Deliveries()[0].Status)
+	require.Empty(t, f.payments.Payments())
+	require.False(t, output.Order.Locked())
+	require.Empty(t, f.locks.owners)
+
+	// cancelling again is a no-op
+	again, err := f.cancel.CancelOrder(tenantCtx(), order.CancelOrderInput{OrderID: approved.ID})
+	require.NoError(t, err)
+	require.Equal(t, entities.OrderStatusCancelled, again.Order.Status)
+}
+
+func TestCancelOrderUseCase_DeliveredOrders(t *testing.T) {
+	f := newCancelFixture(t)
+	approved := f.approvedOrder(t)
+	f.deliveries.Complete(approved.DeliveryID)
+
+	_, err := f.cancel.CancelOrder(tenantCtx(), order.CancelOrderInput{OrderID: approved.ID})
+	require.ErrorIs(t, err, domain.ErrAlreadyDelivered)
+	var execErr *saga.ExecutionError
+	require.ErrorAs(t, err, &execErr)
+
+	// the order is left as it was
+	require.Equal(t, entities.OrderStatusApproved, f.orders.orders[approved.ID].Status)
+	require.Equal(t, entities.DeliveryStatusDelivered, f.deliveries.Deliveries()[0].Status)
+	require.Len(t, f.payments.Payments(), 1)
+	require.Empty(t, f.locks.owners)
+}
+
+func TestCancelOrderUseCase_WaitsForTheServicesThroughTheTransport(t *testing.T) {
+	f := newCancelFixture(t)
+	approved := f.approvedOrder(t)
+	executor, serve := f.throughTransport(t)
+
+	// the delivery service is down: the order is locked and its cancellation waits in the transport
+	output, err := f.cancel.CancelOrder(tenantCtx(), order.CancelOrderInput{OrderID: approved.ID})
+	require.NoError(t, err)
+	require.True(t, output.InProgress)
+	require.Equal(t, entities.OrderStatusApproved, output.Order.Status)
+	require.Equal(t, entities.DeliveryStatusScheduled, f.deliveries.Deliveries()[0].Status)
+	instanceID := f.locks.owners[approved.ID]
+	require.NotEmpty(t, instanceID)
+
+	serve()
+	waitForInstance(t, executor, instanceID, saga.StatusCompleted)
+
+	require.Equal(t, entities.OrderStatusCancelled, f.orders.orders[approved.ID].Status)
+	require.Equal(t, entities.DeliveryStatusCancelled, f.deliveries.Deliveries()[0].Status)
+	require.Empty(t, f.payments.Payments())
+}
+
+func TestCancelOrderUseCase_DeliveredOrdersThroughTheTransport(t *testing.T) {
+	f := newCancelFixture(t)
+	approved := f.approvedOrder(t)
+	f.deliveries.Complete(approved.DeliveryID)
+	executor, serve := f.throughTransport(t)
+
+	output, err := f.cancel.CancelOrder(tenantCtx(), order.CancelOrderInput{OrderID: approved.ID})
+	require.NoError(t, err)
+	require.True(t, output.InProgress)
+	instanceID := f.locks.owners[approved.ID]
+
+	// the delivery service rejects the cancellation, which compensates the saga
+	serve()
+	waitForInstance(t, executor, instanceID, saga.StatusCompensated)
+	require.Empty(t, f.locks.owners)
+	require.Equal(t, entities.OrderStatusApproved, f.orders.orders[approved.ID].Status)
+	require.Equal(t, entities.DeliveryStatusDelivered, f.deliveries.Deliveries()[0].Status)
+	require.Len(t, f.payments.Payments(), 1)
+}
+
+func waitForInstance(t *testing.T, executor *saga.Executor, id string, status saga.Status) {
+	require.Eventually(t, func() bool {
+		instance, err := executor.Get(tenantCtx(), id)
+		return err == nil && instance.Status == status
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestCancelOrderUseCase_IncompleteOrders(t *testing.T) {
+	f := newCancelFixture(t)
+	incomplete := f.approvedOrder(t)
+	incomplete.Status, incomplete.DeliveryID = entities.OrderStatusPaymentCreated, 0
+	f.orders.orders[incomplete.ID] = incomplete
+
+	_, err := f.cancel.CancelOrder(tenantCtx(), order.CancelOrderInput{OrderID: incomplete.ID})
+	require.ErrorIs(t, err, order.ErrOrderIncomplete)
+	require.Len(t, f.payments.Payments(), 1)
+}
+
+func TestCancelOrderUseCase_RejectedOrders(t *testing.T) {
+	f := newCancelFixture(t)
+	rejected := f.approvedOrder(t)
+	rejected.Status = entities.OrderStatusRejected
+	f.orders.orders[rejected.ID] = rejected
+
+	_, err := f.cancel.CancelOrder(tenantCtx(), order.CancelOrderInput{OrderID: rejected.ID})
+	var transitionErr *order.InvalidTransitionError
+	require.ErrorAs(t, err, &transitionErr)
+	require.Equal(t, entities.OrderStatusRejected, transitionErr.From)
+	require.Len(t, f.payments.Payments(), 1)
+}
+
+func TestCancelOrderUseCase_LockedOrders(t *testing.T) {
+	f := newCancelFixture(t)
+	approved := f.approvedOrder(t)
+	require.NoError(t, f.locks.Lock(tenantCtx(), approved.ID, "another-saga"))
+
+	_, err := f.cancel.CancelOrder(tenantCtx(), order.CancelOrderInput{OrderID: approved.ID})
+	require.ErrorIs(t, err, domain.ErrResourceLocked)
+	require.Equal(t, entities.DeliveryStatusScheduled, f.deliveries.Deliveries()[0].Status)
+}
+
+func TestCancelOrderSaga_Plan(t *testing.T) {
+	f := newCancelFixture(t)
+	s := f.cancel.CancelOrderSaga()
+	require.NoError(t, saga.Validate(s))
+
+	plan, err := saga.DryRun(s)
+	require.NoError(t, err)
+	t.Log(plan)
+	require.Equal(t, `saga "cancel-order" version 2
+  no failure: run lock-order, cancel-delivery, refund-payment, mark-cancelled; completed
+  step 0 fails: run lock-order; compensate lock-order; compensated
+  step 1 fails: run lock-order, cancel-delivery; compensate cancel-delivery, lock-order; compensated
+  step 2 fails: run lock-order, cancel-delivery, refund-payment; compensate refund-payment, cancel-delivery, lock-order; compensated
+  step 3 fails: run lock-order, cancel-delivery, refund-payment, mark-cancelled, mark-cancelled; completed
+`, plan.String())
+}
@@ -0,0 +1,4 @@
+package order
+
+// RepliesDestination receives the replies to the commands sent by the sagas of the orders service, see saga.Commands
+const RepliesDestination = "orders.replies"
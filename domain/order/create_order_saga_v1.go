@@ -0,0 +1,69 @@
+package order
+
+import (
+	"context"
+
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+)
+
+// createOrderSagaV1 is the first version of the create-order saga, from before semantic locks and order statuses.
+// It stays registered so the instances started with it can be resumed, and must not change anymore.
+func (u *CreateOrderUseCase) createOrderSagaV1() saga.Saga {
+	steps := []saga.Step{
+		{
+			Name:   "create-order",
+			Output: entities.Order{},
+			Command: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(CreateOrderInput)
+				return u.persistenceGateway.CreateOrder(ctx, entities.Order{
+					Amount: reqInput.Amount,
+					Items:  reqInput.Items,
+					Status: entities.OrderStatusPending,
+				})
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) {
+				return nil, nil
+			},
+		},
+		{
+			Name:   "create-payment",
+			Output: entities.Order{},
+			Command: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
+				payment, err := u.paymentsGateway.CreatePayment(ctx, reqInput.ID, reqInput.Amount)
+				if err != nil {
+					return nil, err
+				}
+
+				reqInput.PaymentID = payment.ID
+				return reqInput, nil
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
+				return nil, u.paymentsGateway.DeletePayment(ctx, reqInput.PaymentID)
+			},
+		},
+		{
+			Name:   "create-delivery",
+			Output: entities.Order{},
+			Command: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
+				delivery, err := u.deliveriesGateway.CreateDelivery(ctx, reqInput.ID)
+				if err != nil {
+					return nil, err
+				}
+
+				reqInput.DeliveryID = delivery.ID
+				return reqInput, nil
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) {
+				return nil, nil
+			},
+		},
+	}
+	s := saga.NewVersionedSaga(CreateOrderSagaName, 1, steps)
+	s.Input = CreateOrderInput{}
+
+	return s
+}
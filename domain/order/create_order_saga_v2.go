@@ -0,0 +1,105 @@
+package order
+
+import (
+	"context"
+
+	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+)
+
+// createOrderSagaV2 is the version of the create-order saga that locked the order, from before order statuses.
+// It stays registered so the instances started with it can be resumed, and must not change anymore.
+func (u *CreateOrderUseCase) createOrderSagaV2() saga.Saga {
+	steps := []saga.Step{
+		{
+			Name:   "create-order",
+			Output: entities.Order{},
+			Command: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(CreateOrderInput)
+				createdOrder, err := u.persistenceGateway.CreateOrder(ctx, entities.Order{
+					Amount:             reqInput.Amount,
+					Items:              reqInput.Items,
+					Status:             entities.OrderStatusPending,
+					IdempotencyKey:     reqInput.IdempotencyKey,
+					RequestFingerprint: reqInput.RequestFingerprint,
+					SagaInstanceID:     saga.InstanceID(ctx),
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				if err := domain.LockForSaga(ctx, u.orderLocks, createdOrder.ID); err != nil {
+					return nil, err
+				}
+
+				createdOrder.LockedBy = saga.InstanceID(ctx)
+				return createdOrder, nil
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) {
+				// the order does not exist if this very step failed
+				createdOrder, ok := ctx.Value(saga.ParamKey).(entities.Order)
+				if !ok {
+					return nil, nil
+				}
+
+				return nil, domain.UnlockForSaga(ctx, u.orderLocks, createdOrder.ID)
+			},
+		},
+		{
+			Name:   "create-payment",
+			Output: entities.Order{},
+			Command: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
+				payment, err := u.paymentsGateway.CreatePayment(ctx, reqInput.ID, reqInput.Amount)
+				if err != nil {
+					return nil, err
+				}
+
+				reqInput.PaymentID = payment.ID
+				return reqInput, nil
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
+				return nil, u.paymentsGateway.DeletePayment(ctx, reqInput.PaymentID)
+			},
+		},
+		{
+			Name:   "create-delivery",
+			Output: entities.Order{},
+			Command: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
+				delivery, err := u.deliveriesGateway.CreateDelivery(ctx, reqInput.ID)
+				if err != nil {
+					return nil, err
+				}
+
+				reqInput.DeliveryID = delivery.ID
+				return reqInput, nil
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) {
+				return nil, nil
+			},
+		},
+		{
+			Name:   "release-order",
+			Output: entities.Order{},
+			Command: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
+				if err := domain.UnlockForSaga(ctx, u.orderLocks, reqInput.ID); err != nil {
+					return nil, err
+				}
+
+				reqInput.LockedBy = ""
+				return reqInput, nil
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) {
+				return nil, nil
+			},
+		},
+	}
+	s := saga.NewVersionedSaga(CreateOrderSagaName, 2, steps)
+	s.Input = CreateOrderInput{}
+
+	return s
+}
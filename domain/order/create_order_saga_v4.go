@@ -0,0 +1,128 @@
+package order
+
+import (
+	"context"
+
+	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+)
+
+// createOrderSagaV4 is the version of the create-order saga from before line items, when the client sent the amount
+// of the order. It stays registered so the instances started with it can be resumed, and must not change anymore.
+func (u *CreateOrderUseCase) createOrderSagaV4() saga.Saga {
+	steps := []saga.Step{
+		{
+			Name:   "create-order",
+			Output: entities.Order{},
+			Command: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(CreateOrderInput)
+				// the pending order and its lock are committed before any remote call
+				var createdOrder entities.Order
+				err := u.tx.WithTx(ctx, func(ctx context.Context) error {
+					var err error
+					createdOrder, err = u.persistenceGateway.CreateOrder(ctx, entities.Order{
+						Amount:             reqInput.Amount,
+						Status:             entities.OrderStatusPending,
+						IdempotencyKey:     reqInput.IdempotencyKey,
+						RequestFingerprint: reqInput.RequestFingerprint,
+						SagaInstanceID:     saga.InstanceID(ctx),
+					})
+					if err != nil {
+						return err
+					}
+
+					return domain.LockForSaga(ctx, u.orderLocks, createdOrder.ID)
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				createdOrder.LockedBy = saga.InstanceID(ctx)
+				return createdOrder, nil
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) {
+				// the order does not exist if this very step failed
+				createdOrder, ok := ctx.Value(saga.ParamKey).(entities.Order)
+				if !ok {
+					return nil, nil
+				}
+
+				return nil, u.tx.WithTx(ctx, func(ctx context.Context) error {
+					if _, err := Transition(ctx, u.persistenceGateway, createdOrder, entities.OrderStatusRejected); err != nil {
+						return err
+					}
+					return domain.UnlockForSaga(ctx, u.orderLocks, createdOrder.ID)
+				})
+			},
+		},
+		{
+			Name:   "create-payment",
+			Output: entities.Order{},
+			Command: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
+				payment, err := u.paymentsGateway.CreatePayment(ctx, reqInput.ID, reqInput.Amount)
+				if err != nil {
+					return nil, err
+				}
+
+				reqInput.PaymentID = payment.ID
+				return Transition(ctx, u.persistenceGateway, reqInput, entities.OrderStatusPaymentCreated)
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
+				err := u.paymentsGateway.DeletePayment(ctx, reqInput.PaymentID)
+				if err != nil {
+					return nil, err
+				}
+				return nil, nil
+			},
+		},
+		{
+			Name:   "create-delivery",
+			Output: entities.Order{},
+			Command: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
+				delivery, err := u.deliveriesGateway.CreateDelivery(ctx, reqInput.ID)
+				if err != nil {
+					return nil, err
+				}
+
+				reqInput.DeliveryID = delivery.ID
+				return Transition(ctx, u.persistenceGateway, reqInput, entities.OrderStatusDeliveryScheduled)
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) {
+				return nil, nil
+			},
+		},
+		{
+			Name:   "release-order",
+			Output: entities.Order{},
+			Command: func(ctx context.Context) (interface{}, error) {
+				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
+				// the order is approved and released at once
+				var approved entities.Order
+				err := u.tx.WithTx(ctx, func(ctx context.Context) error {
+					var err error
+					if approved, err = Transition(ctx, u.persistenceGateway, reqInput, entities.OrderStatusApproved); err != nil {
+						return err
+					}
+					return domain.UnlockForSaga(ctx, u.orderLocks, reqInput.ID)
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				approved.LockedBy = ""
+				return approved, nil
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) {
+				return nil, nil
+			},
+		},
+	}
+	s := saga.NewVersionedSaga(CreateOrderSagaName, 4, steps)
+	s.Input = CreateOrderInput{}
+
+	return s
+}
@@ -2,19 +2,38 @@ package order
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/domain/delivery"
 	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/domain/payment"
 	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
 	"log"
+	"math"
+	"strings"
+	"time"
 )
 
 type CreateOrderUseCasePersistenceGateway interface {
-	CreateOrder(context.Context, int64) (entities.Order, error)
+	OrderStatusGateway
+	// CreateOrder fails with domain.ErrIdempotencyKeyConflict if another order of the tenant has its idempotency key
+	CreateOrder(context.Context, entities.Order) (entities.Order, error)
+	// GetOrderByIdempotencyKey fails with domain.ErrNotFound if no order of the tenant has the key
+	GetOrderByIdempotencyKey(ctx context.Context, key string) (entities.Order, error)
+}
+
+type CreateOrderUseCaseCatalogGateway interface {
+	// GetProducts returns the products of the tenant that have any of the ids
+	GetProducts(ctx context.Context, ids []int64) ([]entities.Product, error)
 }
 
 type CreateOrderUseCasePaymentGateway interface {
-	CreatePayment(ctx context.Context, orderID int64) (entities.Payment, error)
+	CreatePayment(ctx context.Context, orderID, amount int64) (entities.Payment, error)
 	DeletePayment(ctx context.Context, paymentID int64) error
 }
 
@@ -22,109 +41,512 @@ type CreateOrderUseCaseDeliveriesGateway interface {
 	CreateDelivery(ctx context.Context, orderID int64) (entities.Delivery, error)
 }
 
+// CreateOrderUseCaseCommands builds the saga steps sending commands to the payments and delivery services,
+// see saga.Commands
+type CreateOrderUseCaseCommands interface {
+	Step(name, destination, commandType string, command func(ctx context.Context) (interface{}, error), timeout time.Duration) saga.Step
+	Compensation(name, destination, commandType string, command func(ctx context.Context) (interface{}, error)) func(ctx context.Context) (interface{}, error)
+}
+
+type CreateOrderUseCaseSagaExecutor interface {
+	Start(ctx context.Context, name string, payload interface{}) (saga.Instance, error)
+	// StartWithKey runs the saga once per idempotency key, see saga.Executor.StartWithKey
+	StartWithKey(ctx context.Context, name string, key string, payload interface{}) (saga.Instance, error)
+	Get(ctx context.Context, id string) (saga.Instance, error)
+}
+
+// CreateOrderUseCaseLimiter admits order creations, so a burst of requests does not fan out
+// an unbounded number of remote calls and transactions
+type CreateOrderUseCaseLimiter interface {
+	Do(ctx context.Context, name string, f func(ctx context.Context) error) error
+}
+
+const (
+	CreateOrderSagaName = "create-order"
+	// CreateOrderSagaVersion must be bumped whenever CreateOrderSaga changes, keeping the previous versions
+	// registered by RegisterSagas
+	CreateOrderSagaVersion = 6
+)
+
 type CreateOrderUseCase struct {
 	persistenceGateway CreateOrderUseCasePersistenceGateway
+	catalogGateway     CreateOrderUseCaseCatalogGateway
 	paymentsGateway    CreateOrderUseCasePaymentGateway
 	deliveriesGateway  CreateOrderUseCaseDeliveriesGateway
+	commands           CreateOrderUseCaseCommands
+	orderLocks         domain.SemanticLocker
 	tx                 domain.Transactioner
+	sagas              CreateOrderUseCaseSagaExecutor
+	limiter            CreateOrderUseCaseLimiter
 }
 
 func NewCreateOrderUseCase(persistenceGateway CreateOrderUseCasePersistenceGateway,
+	catalogGateway CreateOrderUseCaseCatalogGateway,
+	orderLocks domain.SemanticLocker,
 	tx domain.Transactioner,
 	paymentsGateway CreateOrderUseCasePaymentGateway,
-	deliveriesGateway CreateOrderUseCaseDeliveriesGateway) *CreateOrderUseCase {
+	deliveriesGateway CreateOrderUseCaseDeliveriesGateway,
+	commands CreateOrderUseCaseCommands,
+	sagas CreateOrderUseCaseSagaExecutor,
+	limiter CreateOrderUseCaseLimiter) *CreateOrderUseCase {
 	return &CreateOrderUseCase{
 		persistenceGateway: persistenceGateway,
+		catalogGateway:     catalogGateway,
+		orderLocks:         orderLocks,
 		tx:                 tx,
 		paymentsGateway:    paymentsGateway,
 		deliveriesGateway:  deliveriesGateway,
+		commands:           commands,
+		sagas:              sagas,
+		limiter:            limiter,
+	}
+}
+
+// RegisterSagas registers the sagas run by the use case. It must be called before creating orders.
+// Versions that may still have unfinished instances must stay registered when a new one is added.
+// Order payloads hold payment details, so the registry must have a key provider to encrypt them.
+func (u *CreateOrderUseCase) RegisterSagas(registry *saga.Registry) error {
+	if err := registry.RegisterPayloadType("order.CreateOrderInput", CreateOrderInput{}, saga.JSONCodec{}, saga.Sensitive()); err != nil {
+		return err
+	}
+	if err := registry.RegisterPayloadType("entities.Order", entities.Order{}, saga.JSONCodec{}, saga.Sensitive()); err != nil {
+		return err
+	}
+
+	if err := registry.Register(u.createOrderSagaV1()); err != nil {
+		return err
 	}
+	if err := registry.Register(u.createOrderSagaV2()); err != nil {
+		return err
+	}
+	if err := registry.Register(u.createOrderSagaV3()); err != nil {
+		return err
+	}
+	if err := registry.Register(u.createOrderSagaV4()); err != nil {
+		return err
+	}
+	if err := registry.Register(u.createOrderSagaV5()); err != nil {
+		return err
+	}
+
+	return registry.Register(u.CreateOrderSaga())
 }
 
 type CreateOrderInput struct {
+	// Items are priced by CreateOrder from the catalog, which sets their unit prices
+	Items []entities.LineItem
+	// Amount is the total of the items, set by CreateOrder
 	Amount int64
+	// IdempotencyKey is an optional key given by the client, so a retry returns the order created by the first request
+	IdempotencyKey string
+	// RequestFingerprint is set by CreateOrder from the other fields
+	RequestFingerprint string
+}
+
+// fingerprint hashes the content of the request, leaving the idempotency key and the prices out
+func (i CreateOrderInput) fingerprint() string {
+	i.IdempotencyKey, i.RequestFingerprint, i.Amount = "", "", 0
+	i.Items = append([]entities.LineItem(nil), i.Items...)
+	for n := range i.Items {
+		i.Items[n].UnitPrice = 0
+	}
+	data, _ := json.Marshal(i) //nolint:errcheck
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
 }
+
 type CreateOrderOutput struct {
 	Order entities.Order
+	// InProgress is set while the order is still being created, i.e. its saga waits for the payments or delivery
+	// services, or the request repeats one whose order is. Order is incomplete then.
+	InProgress bool
+}
+
+// IdempotencyKeyReusedError is returned when an idempotency key is sent again with a different request
+type IdempotencyKeyReusedError struct {
+	Key string
+}
+
+func (e *IdempotencyKeyReusedError) Error() string {
+	return fmt.Sprintf("idempotency key %q was already used for a different request", e.Key)
+}
+
+// ErrNoItems is returned when creating an order without items
+var ErrNoItems = errors.New("an order needs at least one item")
+
+// InvalidItemError is returned for line items that cannot be ordered
+type InvalidItemError struct {
+	// Index is the position of the item in the order
+	Index     int
+	ProductID int64
+	Reason    string
+}
+
+func (e *InvalidItemError) Error() string {
+	return fmt.Sprintf("item %d of product %d %s", e.Index, e.ProductID, e.Reason)
 }
 
+// CreateOrder prices the items from the catalog and starts the create-order saga, which charges their total.
+// It returns once the order is created, while the payment and the delivery may still be in progress.
+// It fails with ErrNoItems or an *InvalidItemError unless every item is a positive quantity of a product of the
+// catalog.
 func (u *CreateOrderUseCase) CreateOrder(ctx context.Context, input CreateOrderInput) (CreateOrderOutput, error) {
+	// every order belongs to the tenant it is created for, see tenant.WithID
+	if _, err := tenant.Require(ctx); err != nil {
+		return CreateOrderOutput{}, err
+	}
+
+	if input.IdempotencyKey != "" {
+		input.RequestFingerprint = input.fingerprint()
+		output, found, err := u.replay(ctx, input)
+		if found || err != nil {
+			return output, err
+		}
+	}
+
+	items, amount, err := u.price(ctx, input.Items)
+	if err != nil {
+		return CreateOrderOutput{}, err
+	}
+	input.Items, input.Amount = items, amount
+
 	output := CreateOrderOutput{}
-	err := u.tx.WithTx(ctx, func(ctx context.Context) error {
+	// the saga is not run in a transaction: its local steps commit on their own, so no connection is held
+	// during the remote calls, and a payment can never exist for an order that was not committed
+	err = u.limiter.Do(ctx, CreateOrderSagaName, func(ctx context.Context) error {
+		instance, err := u.start(ctx, input)
+		if err != nil {
+			var execErr *saga.ExecutionError
+			if !errors.As(err, &execErr) {
+				return err
+			}
 
-		coordinator := u.getCreateOrderSagaCoordinator()
-		
-		sagaContext := context.WithValue(ctx, saga.ParamKey, input)
-		result, ok := coordinator.Execute(sagaContext)
-		if !ok {
-			for _, e := range coordinator.GetErrors() {
+			for _, e := range execErr.Errors {
 				log.Println(e.Error())
+				var panicErr *saga.StepPanicError
+				if errors.As(e, &panicErr) {
+					log.Println(string(panicErr.Stack))
+				}
 			}
-			return errors.New("could not create order")
+			return fmt.Errorf("could not create order: %w", execErr)
 		}
 
-		output.Order = result.(entities.Order)
+		// the saga waits for the replies of the payments and delivery services after creating the order
+		output.Order = instance.Payload.(entities.Order)
+		output.InProgress = instance.Status != saga.StatusCompleted
 		return nil
 	})
 	if err != nil {
+		// a concurrent request with the same idempotency key created the order first
+		if input.IdempotencyKey != "" && errors.Is(err, domain.ErrIdempotencyKeyConflict) {
+			if output, found, replayErr := u.replay(ctx, input); found || replayErr != nil {
+				return output, replayErr
+			}
+		}
 		return CreateOrderOutput{}, err
 	}
 
 	return output, nil
 }
 
-func (u *CreateOrderUseCase) getCreateOrderSagaCoordinator() *saga.Coordinator {
+// start runs the create-order saga. With an idempotency key, its instance is started once per key: a request
+// repeating one whose order is not created yet gets the outcome of the first instance, which is resumed if the run
+// that started it crashed.
+func (u *CreateOrderUseCase) start(ctx context.Context, input CreateOrderInput) (saga.Instance, error) {
+	if input.IdempotencyKey == "" {
+		return u.sagas.Start(ctx, CreateOrderSagaName, input)
+	}
+
+	instance, err := u.sagas.StartWithKey(ctx, CreateOrderSagaName, input.IdempotencyKey, input)
+	if fingerprint, ok := requestFingerprint(instance.Payload); ok && fingerprint != input.RequestFingerprint {
+		return saga.Instance{}, &IdempotencyKeyReusedError{Key: input.IdempotencyKey}
+	}
+
+	return instance, err
+}
+
+// requestFingerprint returns the fingerprint of the request that started a create-order instance, from its payload
+func requestFingerprint(payload interface{}) (string, bool) {
+	switch p := payload.(type) {
+	case CreateOrderInput:
+		return p.RequestFingerprint, true
+	case entities.Order:
+		return p.RequestFingerprint, true
+	}
+
+	return "", false
+}
+
+// price returns the items with the current prices of their products, and their total
+func (u *CreateOrderUseCase) price(ctx context.Context, items []entities.LineItem) ([]entities.LineItem, int64, error) {
+	if len(items) == 0 {
+		return nil, 0, ErrNoItems
+	}
+
+	ids := make([]int64, 0, len(items))
+	for i, item := range items {
+		if item.Quantity <= 0 {
+			return nil, 0, &InvalidItemError{Index: i, ProductID: item.ProductID, Reason: "must have a positive quantity"}
+		}
+		ids = append(ids, item.ProductID)
+	}
+	products, err := u.catalogGateway.GetProducts(ctx, ids)
+	if err != nil {
+		return nil, 0, fmt.Errorf("loading products: %w", err)
+	}
+	prices := make(map[int64]int64, len(products))
+	for _, p := range products {
+		prices[p.ID] = p.Price
+	}
+
+	priced := make([]entities.LineItem, 0, len(items))
+	var amount int64
+	for i, item := range items {
+		unitPrice, ok := prices[item.ProductID]
+		if !ok {
+			return nil, 0, &InvalidItemError{Index: i, ProductID: item.ProductID, Reason: "is not in the catalog"}
+		}
+		if unitPrice <= 0 {
+			return nil, 0, &InvalidItemError{Index: i, ProductID: item.ProductID, Reason: "has no price"}
+		}
+		if item.Quantity > (math.MaxInt64-amount)/unitPrice {
+			return nil, 0, &InvalidItemError{Index: i, ProductID: item.ProductID, Reason: "makes the total too large"}
+		}
+		item.UnitPrice = unitPrice
+		amount += item.Quantity * unitPrice
+		priced = append(priced, item)
+	}
+
+	return priced, amount, nil
+}
+
+// replay returns the outcome of the request that created the order with the idempotency key of input, if any:
+// its result once its saga completed, the order in progress until then, or its failure
+func (u *CreateOrderUseCase) replay(ctx context.Context, input CreateOrderInput) (CreateOrderOutput, bool, error) {
+	existing, err := u.persistenceGateway.GetOrderByIdempotencyKey(ctx, input.IdempotencyKey)
+	if errors.Is(err, domain.ErrNotFound) {
+		return CreateOrderOutput{}, false, nil
+	}
+	if err != nil {
+		return CreateOrderOutput{}, false, err
+	}
+	if existing.RequestFingerprint != input.RequestFingerprint {
+		return CreateOrderOutput{}, true, &IdempotencyKeyReusedError{Key: input.IdempotencyKey}
+	}
+
+	instance, err := u.sagas.Get(saga.WithPayloadAccess(ctx), existing.SagaInstanceID)
+	if err != nil {
+		return CreateOrderOutput{}, true, fmt.Errorf("loading saga of order %d: %w", existing.ID, err)
+	}
+	switch instance.Status {
+	case saga.StatusCompleted:
+		return CreateOrderOutput{Order: instance.Payload.(entities.Order)}, true, nil
+	case saga.StatusCompensated:
+		return CreateOrderOutput{}, true, fmt.Errorf("could not create order: saga instance %s failed: %s",
+			instance.ID, strings.Join(instance.Errors, "; "))
+	}
+
+	return CreateOrderOutput{Order: existing, InProgress: true}, true, nil
+}
+
+// CreateOrderSaga builds the saga that creates an order, its payment and its delivery.
+// It expects a CreateOrderInput as its initial saga.ParamKey value and results in an entities.Order.
+// The payment and the delivery are created by commands sent through the saga transport, so the saga waits for
+// the payments and delivery services while they are down rather than failing, see saga.Commands. Their replies
+// are saved by the local step following each command.
+// The order is semantically locked by the saga until it completes or is compensated,
+// so other operations do not act on an order that has a payment but no delivery yet.
+// Its steps move the order through its statuses up to APPROVED, and its compensation leaves it REJECTED.
+// Creating the delivery is the pivot: once it is scheduled, the remaining steps are retried until they succeed.
+func (u *CreateOrderUseCase) CreateOrderSaga() saga.Saga {
+	createPayment := u.commands.Step("create-payment", payment.CommandsDestination, payment.CreatePaymentCommand,
+		func(ctx context.Context) (interface{}, error) {
+			o := ctx.Value(saga.ParamKey).(entities.Order)
+			return payment.CreatePaymentInput{OrderID: o.ID, Amount: o.Amount}, nil
+		}, 0)
+	createPayment.CompensationCommand = u.commands.Compensation("create-payment", payment.CommandsDestination,
+		payment.DeletePaymentCommand, func(ctx context.Context) (interface{}, error) {
+			paymentID, err := paymentOf(ctx)
+			if err != nil || paymentID == 0 {
+				return nil, err
+			}
+			return payment.DeletePaymentInput{PaymentID: paymentID}, nil
+		})
+
+	createDelivery := u.commands.Step("create-delivery", delivery.CommandsDestination, delivery.CreateDeliveryCommand,
+		func(ctx context.Context) (interface{}, error) {
+			o := ctx.Value(saga.ParamKey).(entities.Order)
+			return delivery.CreateDeliveryInput{OrderID: o.ID}, nil
+		}, 0)
+	createDelivery.Pivot = true
+
 	steps := []saga.Step{
 		{
+			Name:   "create-order",
+			Output: entities.Order{},
 			Command: func(ctx context.Context) (interface{}, error) {
 				reqInput := ctx.Value(saga.ParamKey).(CreateOrderInput)
-				createdOrder, err := u.persistenceGateway.CreateOrder(ctx, reqInput.Amount)
+				// the pending order and its lock are committed before any command is sent
+				var createdOrder entities.Order
+				err := u.tx.WithTx(ctx, func(ctx context.Context) error {
+					var err error
+					createdOrder, err = u.persistenceGateway.CreateOrder(ctx, entities.Order{
+						Amount:             reqInput.Amount,
+						Items:              reqInput.Items,
+						Status:             entities.OrderStatusPending,
+						IdempotencyKey:     reqInput.IdempotencyKey,
+						RequestFingerprint: reqInput.RequestFingerprint,
+						SagaInstanceID:     saga.InstanceID(ctx),
+					})
+					if err != nil {
+						return err
+					}
+
+					return domain.LockForSaga(ctx, u.orderLocks, createdOrder.ID)
+				})
 				if err != nil {
 					return nil, err
 				}
 
+				createdOrder.LockedBy = saga.InstanceID(ctx)
 				return createdOrder, nil
 			},
 			CompensationCommand: func(ctx context.Context) (interface{}, error) {
-				return nil, nil
+				createdOrder, found, err := u.orderOf(ctx)
+				// the order does not exist if this very step failed
+				if err != nil || !found {
+					return nil, err
+				}
+
+				return nil, u.tx.WithTx(ctx, func(ctx context.Context) error {
+					if _, err := Transition(ctx, u.persistenceGateway, createdOrder, entities.OrderStatusRejected); err != nil {
+						return err
+					}
+					return domain.UnlockForSaga(ctx, u.orderLocks, createdOrder.ID)
+				})
 			},
 		},
+		createPayment,
 		{
+			Name:   "record-payment",
+			Output: entities.Order{},
 			Command: func(ctx context.Context) (interface{}, error) {
-				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
-				payment, err := u.paymentsGateway.CreatePayment(ctx, reqInput.ID)
+				var p entities.Payment
+				if err := decodeReply(ctx, &p); err != nil {
+					return nil, fmt.Errorf("decoding payment: %w", err)
+				}
+				o, err := u.persistenceGateway.GetOrder(ctx, p.OrderID)
 				if err != nil {
-					return nil, err
+					return nil, fmt.Errorf("loading order %d: %w", p.OrderID, err)
 				}
 
-				reqInput.PaymentID = payment.ID
-				return reqInput, nil
+				o.PaymentID = p.ID
+				return Transition(ctx, u.persistenceGateway, o, entities.OrderStatusPaymentCreated)
 			},
+			// the payment is deleted by the compensation of create-payment
 			CompensationCommand: func(ctx context.Context) (interface{}, error) {
-				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
-				err := u.paymentsGateway.DeletePayment(ctx, reqInput.PaymentID)
+				return nil, nil
+			},
+		},
+		createDelivery,
+		{
+			Name:      "record-delivery",
+			Output:    entities.Order{},
+			Retriable: true,
+			Command: func(ctx context.Context) (interface{}, error) {
+				var d entities.Delivery
+				if err := decodeReply(ctx, &d); err != nil {
+					return nil, fmt.Errorf("decoding delivery: %w", err)
+				}
+				o, err := u.persistenceGateway.GetOrder(ctx, d.OrderID)
 				if err != nil {
-					return nil, err
+					return nil, fmt.Errorf("loading order %d: %w", d.OrderID, err)
 				}
-				return nil, nil
+
+				o.DeliveryID = d.ID
+				return Transition(ctx, u.persistenceGateway, o, entities.OrderStatusDeliveryScheduled)
 			},
 		},
 		{
+			Name:      "release-order",
+			Output:    entities.Order{},
+			Retriable: true,
 			Command: func(ctx context.Context) (interface{}, error) {
 				reqInput := ctx.Value(saga.ParamKey).(entities.Order)
-				delivery, err := u.deliveriesGateway.CreateDelivery(ctx, reqInput.ID)
+				// the order is approved and released at once
+				var approved entities.Order
+				err := u.tx.WithTx(ctx, func(ctx context.Context) error {
+					var err error
+					if approved, err = Transition(ctx, u.persistenceGateway, reqInput, entities.OrderStatusApproved); err != nil {
+						return err
+					}
+					return domain.UnlockForSaga(ctx, u.orderLocks, reqInput.ID)
+				})
 				if err != nil {
 					return nil, err
 				}
 
-				reqInput.DeliveryID = delivery.ID
-				return reqInput, nil
-			},
-			CompensationCommand: func(ctx context.Context) (interface{}, error) {
-				return nil, nil
+				approved.LockedBy = ""
+				return approved, nil
 			},
 		},
 	}
-	createOrderSaga := saga.NewSaga(steps)
-	return saga.NewCoordinator(createOrderSaga)
+	s := saga.NewVersionedSaga(CreateOrderSagaName, CreateOrderSagaVersion, steps)
+	s.Input = CreateOrderInput{}
+
+	return s
+}
+
+// orderOf returns the order a compensation of the create-order saga applies to. Compensations see the input of
+// the step that failed: the CreateOrderInput before the order was created, the order, or the reply to the
+// create-payment command.
+func (u *CreateOrderUseCase) orderOf(ctx context.Context) (entities.Order, bool, error) {
+	switch param := ctx.Value(saga.ParamKey).(type) {
+	case entities.Order:
+		return param, true, nil
+	case saga.Reply:
+		var p entities.Payment
+		if err := param.Decode(&p); err != nil {
+			return entities.Order{}, false, fmt.Errorf("decoding payment: %w", err)
+		}
+		o, err := u.persistenceGateway.GetOrder(ctx, p.OrderID)
+		if err != nil {
+			return entities.Order{}, false, fmt.Errorf("loading order %d: %w", p.OrderID, err)
+		}
+		return o, true, nil
+	case CreateOrderInput:
+		return entities.Order{}, false, nil
+	}
+
+	return entities.Order{}, false, fmt.Errorf("unexpected input %T of a create-order compensation", ctx.Value(saga.ParamKey))
+}
+
+// paymentOf returns the id of the payment a compensation of the create-order saga deletes, or zero if the
+// payment was not created
+func paymentOf(ctx context.Context) (int64, error) {
+	switch param := ctx.Value(saga.ParamKey).(type) {
+	case entities.Order:
+		return param.PaymentID, nil
+	case saga.Reply:
+		var p entities.Payment
+		if err := param.Decode(&p); err != nil {
+			return 0, fmt.Errorf("decoding payment: %w", err)
+		}
+		return p.ID, nil
+	case CreateOrderInput:
+		return 0, nil
+	}
+
+	return 0, fmt.Errorf("unexpected input %T of a create-order compensation", ctx.Value(saga.ParamKey))
+}
+
+// decodeReply decodes the reply to a command, which is the input of the step following a command step
+func decodeReply(ctx context.Context, target interface{}) error {
+	reply, ok := ctx.Value(saga.ParamKey).(saga.Reply)
+	if !ok {
+		return fmt.Errorf("expected a command reply, got %T", ctx.Value(saga.ParamKey))
+	}
+
+	return reply.Decode(target)
 }
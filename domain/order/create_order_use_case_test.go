@@ -0,0 +1,795 @@
+package order_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/domain/delivery"
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/domain/order"
+	"github.com/didopimentel/go-saga-poc/domain/payment"
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/saga/sagatest"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+	"github.com/didopimentel/go-saga-poc/gateways/deliveries"
+	"github.com/didopimentel/go-saga-poc/gateways/payments"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTx rolls the fake orders and locks back when the transaction fails, like Postgres would.
+// Ids are not reused, as with a sequence.
+type fakeTx struct {
+	orders *fakeOrders
+	locks  *fakeLocks
+}
+
+func (tx fakeTx) WithTx(ctx context.Context, f domain.TransactionFunc) error {
+	if domain.InTX(ctx) {
+		return &domain.TransactionError{Cause: errors.New("already in transaction")}
+	}
+
+	orders, byKey, transitions := copyOrders(tx.orders.orders), copyKeys(tx.orders.byKey), len(tx.orders.transitions)
+	owners := copyOwners(tx.locks.owners)
+	if err := f(domain.ContextWithTx(ctx)); err != nil {
+		tx.orders.orders, tx.orders.byKey, tx.orders.transitions = orders, byKey, tx.orders.transitions[:transitions]
+		tx.locks.owners = owners
+		return err
+	}
+	return nil
+}
+
+func copyOrders(orders map[int64]entities.Order) map[int64]entities.Order {
+	copied := make(map[int64]entities.Order, len(orders))
+	for id, o := range orders {
+		copied[id] = o
+	}
+	return copied
+}
+
+func copyKeys(keys map[string]int64) map[string]int64 {
+	copied := make(map[string]int64, len(keys))
+	for key, id := range keys {
+		copied[key] = id
+	}
+	return copied
+}
+
+func copyOwners(owners map[int64]string) map[int64]string {
+	copied := make(map[int64]string, len(owners))
+	for id, owner := range owners {
+		copied[id] = owner
+	}
+	return copied
+}
+
+type fakeOrders struct {
+	nextID      int64
+	orders      map[int64]entities.Order
+	byKey       map[string]int64
+	transitions []string
+}
+
+func newFakeOrders() *fakeOrders {
+	return &fakeOrders{orders: map[int64]entities.Order{}, byKey: map[string]int64{}}
+}
+
+func (f *fakeOrders) CreateOrder(_ context.Context, o entities.Order) (entities.Order, error) {
+	if _, ok := f.byKey[o.IdempotencyKey]; ok && o.IdempotencyKey != "" {
+		return entities.Order{}, domain.ErrIdempotencyKeyConflict
+	}
+	f.nextID++
+	o.ID = f.nextID
+	o.CreatedAt, o.UpdatedAt = time.Now().UTC(), time.Now().UTC()
+	f.orders[o.ID] = o
+	if o.IdempotencyKey != "" {
+		f.byKey[o.IdempotencyKey] = o.ID
+	}
+	f.transitions = append(f.transitions, string(o.Status))
+	return o, nil
+}
+
+func (f *fakeOrders) GetOrderByIdempotencyKey(_ context.Context, key string) (entities.Order, error) {
+	id, ok := f.byKey[key]
+	if !ok {
+		return entities.Order{}, domain.ErrNotFound
+	}
+	return f.orders[id], nil
+}
+
+func (f *fakeOrders) GetOrder(_ context.Context, id int64) (entities.Order, error) {
+	o, ok := f.orders[id]
+	if !ok {
+		return entities.Order{}, domain.ErrNotFound
+	}
+	return o, nil
+}
+
+func (f *fakeOrders) UpdateOrder(_ context.Context, update entities.Order, from entities.OrderStatus) (entities.Order, error) {
+	o, ok := f.orders[update.ID]
+	if !ok {
+		return entities.Order{}, domain.ErrNotFound
+	}
+	if o.Status != from {
+		return entities.Order{}, domain.ErrStatusChanged
+	}
+	o.Status, o.UpdatedAt = update.Status, time.Now().UTC()
+	if update.PaymentID != 0 {
+		o.PaymentID = update.PaymentID
+	}
+	if update.DeliveryID != 0 {
+		o.DeliveryID = update.DeliveryID
+	}
+	f.orders[o.ID] = o
+	f.transitions = append(f.transitions, string(o.Status))
+	return o, nil
+}
+
+// ListOrders applies the filter like persistence.Orders, whose query is tested against Postgres
+func (f *fakeOrders) ListOrders(_ context.Context, filter entities.OrderFilter, afterID int64, limit int) ([]entities.Order, error) {
+	var orders []entities.Order
+	for id := f.nextID; id > 0 && len(orders) < limit; id-- {
+		o, ok := f.orders[id]
+		if !ok || (afterID != 0 && id >= afterID) || !matches(filter, o) {
+			continue
+		}
+		orders = append(orders, o)
+	}
+	return orders, nil
+}
+
+func matches(filter entities.OrderFilter, o entities.Order) bool {
+	if len(filter.Statuses) > 0 {
+		found := false
+		for _, status := range filter.Statuses {
+			found = found || status == o.Status
+		}
+		if !found {
+			return false
+		}
+	}
+	switch {
+	case filter.MinAmount != nil && o.Amount < *filter.MinAmount,
+		filter.MaxAmount != nil && o.Amount > *filter.MaxAmount,
+		!filter.CreatedAfter.IsZero() && o.CreatedAt.Before(filter.CreatedAfter),
+		!filter.CreatedBefore.IsZero() && !o.CreatedAt.Before(filter.CreatedBefore):
+		return false
+	}
+	return true
+}
+
+// fakeCatalog sells books, whose product id is 1, at 50. Samples, whose product id is 3, have no price.
+type fakeCatalog struct{}
+
+func (fakeCatalog) GetProducts(_ context.Context, ids []int64) ([]entities.Product, error) {
+	var products []entities.Product
+	for _, id := range ids {
+		switch id {
+		case 1:
+			products = append(products, entities.Product{ID: 1, Name: "book", Price: 50})
+		case 3:
+			products = append(products, entities.Product{ID: 3, Name: "sample"})
+		}
+	}
+	return products, nil
+}
+
+// twoBooks are the items of an order of 100
+var twoBooks = []entities.LineItem{{ProductID: 1, Quantity: 2}}
+
+type fakeLocks struct {
+	owners map[int64]string
+}
+
+func newFakeLocks() *fakeLocks {
+	return &fakeLocks{owners: map[int64]string{}}
+}
+
+func (f *fakeLocks) Lock(_ context.Context, id int64, owner string) error {
+	if current := f.owners[id]; current != "" && current != owner {
+		return &domain.LockedError{Resource: "order", ID: id, Owner: current}
+	}
+	f.owners[id] = owner
+	return nil
+}
+
+func (f *fakeLocks) Unlock(_ context.Context, id int64, owner string) error {
+	if f.owners[id] == owner {
+		delete(f.owners, id)
+	}
+	return nil
+}
+
+func (f *fakeLocks) LockOwner(_ context.Context, id int64) (string, error) {
+	return f.owners[id], nil
+}
+
+type fakeDeliveries struct {
+	err      error
+	onCreate func(orderID int64)
+	// calledInTx tells whether a delivery was created within a transaction
+	calledInTx bool
+}
+
+func (f *fakeDeliveries) CreateDelivery(ctx context.Context, orderID int64) (entities.Delivery, error) {
+	f.calledInTx = f.calledInTx || domain.InTX(ctx)
+	if f.onCreate != nil {
+		f.onCreate(orderID)
+	}
+	if f.err != nil {
+		return entities.Delivery{}, f.err
+	}
+	return entities.Delivery{ID: 7, OrderID: orderID}, nil
+}
+
+// syncCommands handles the commands of the order sagas with the gateways: synchronously as their commands, so their
+// steps run to completion without a transport, e.g. with a saga.Coordinator, or from a transport with serve.
+// The commands of the cancel-order saga need deliveries to be a *deliveries.MemoryGateway.
+type syncCommands struct {
+	payments   order.CreateOrderUseCasePaymentGateway
+	deliveries order.CreateOrderUseCaseDeliveriesGateway
+}
+
+func (c syncCommands) handle(ctx context.Context, commandType string, command interface{}) (interface{}, error) {
+	switch commandType {
+	case payment.CreatePaymentCommand:
+		input := command.(payment.CreatePaymentInput)
+		return c.payments.CreatePayment(ctx, input.OrderID, input.Amount)
+	case payment.DeletePaymentCommand:
+		input := command.(payment.DeletePaymentInput)
+		return input, c.payments.DeletePayment(ctx, input.PaymentID)
+	case delivery.CreateDeliveryCommand:
+		return c.deliveries.CreateDelivery(ctx, command.(delivery.CreateDeliveryInput).OrderID)
+	case delivery.CancelDeliveryCommand:
+		id := command.(delivery.CancelDeliveryInput).DeliveryID
+		return c.delivery(id, c.deliveries.(*deliveries.MemoryGateway).CancelDelivery(ctx, id))
+	case delivery.ReinstateDeliveryCommand:
+		id := command.(delivery.ReinstateDeliveryInput).DeliveryID
+		return c.delivery(id, c.deliveries.(*deliveries.MemoryGateway).ReinstateDelivery(ctx, id))
+	}
+	return nil, fmt.Errorf("unknown command %q", commandType)
+}
+
+// delivery replies to a command acting on a delivery with the delivery, like the delivery service does
+func (c syncCommands) delivery(id int64, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range c.deliveries.(*deliveries.MemoryGateway).Deliveries() {
+		if d.ID == id {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("delivery %d: %w", id, domain.ErrNotFound)
+}
+
+// serve handles the commands sent through a transport, like the payments and delivery services do
+func (c syncCommands) serve(ctx context.Context, m saga.Message) (interface{}, error) {
+	var command interface{}
+	var err error
+	switch m.Type {
+	case payment.CreatePaymentCommand:
+		var input payment.CreatePaymentInput
+		err = json.Unmarshal(m.Payload, &input)
+		command = input
+	case payment.DeletePaymentCommand:
+		var input payment.DeletePaymentInput
+		err = json.Unmarshal(m.Payload, &input)
+		command = input
+	case delivery.CreateDeliveryCommand:
+		var input delivery.CreateDeliveryInput
+		err = json.Unmarshal(m.Payload, &input)
+		command = input
+	case delivery.CancelDeliveryCommand:
+		var input delivery.CancelDeliveryInput
+		err = json.Unmarshal(m.Payload, &input)
+		command = input
+	case delivery.ReinstateDeliveryCommand:
+		var input delivery.ReinstateDeliveryInput
+		err = json.Unmarshal(m.Payload, &input)
+		command = input
+	default:
+		err = fmt.Errorf("unknown command %q", m.Type)
+	}
+	if err != nil {
+		return nil, saga.Reject(err)
+	}
+
+	output, err := c.handle(ctx, m.Type, command)
+	if errors.Is(err, domain.ErrAlreadyDelivered) {
+		return nil, saga.Reject(err)
+	}
+	return output, err
+}
+
+func (c syncCommands) Step(name, _, commandType string, command func(ctx context.Context) (interface{}, error), _ time.Duration) saga.Step {
+	return saga.Step{
+		Name:   name,
+		Output: saga.Reply{},
+		Command: func(ctx context.Context) (interface{}, error) {
+			input, err := command(ctx)
+			if err != nil {
+				return nil, err
+			}
+			output, err := c.handle(ctx, commandType, input)
+			if err != nil {
+				return nil, err
+			}
+			payload, err := json.Marshal(output)
+			return saga.Reply{Payload: payload}, err
+		},
+		CompensationCommand: func(ctx context.Context) (interface{}, error) {
+			return nil, nil
+		},
+	}
+}
+
+func (c syncCommands) Compensation(_, _, commandType string, command func(ctx context.Context) (interface{}, error)) func(ctx context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		input, err := command(ctx)
+		if err != nil || input == nil {
+			return nil, err
+		}
+		return c.handle(ctx, commandType, input)
+	}
+}
+
+func newUseCase(t *testing.T, deliveries order.CreateOrderUseCaseDeliveriesGateway) (*order.CreateOrderUseCase, *payments.MemoryGateway, *fakeLocks) {
+	uc, paymentsGateway, locks, _ := newUseCaseWithOrders(t, deliveries)
+
+	return uc, paymentsGateway, locks
+}
+
+func newUseCaseWithOrders(t *testing.T, deliveries order.CreateOrderUseCaseDeliveriesGateway) (*order.CreateOrderUseCase, *payments.MemoryGateway, *fakeLocks, *fakeOrders) {
+	registry := saga.NewRegistry()
+	keys, err := saga.NewLocalKeyProvider("test", map[string][]byte{"test": make([]byte, 32)})
+	require.NoError(t, err)
+	registry.SetKeyProvider(keys)
+	paymentsGateway := payments.NewMemoryGateway()
+	locks := newFakeLocks()
+	orders := newFakeOrders()
+	uc := order.NewCreateOrderUseCase(orders, fakeCatalog{}, locks, fakeTx{orders: orders, locks: locks}, paymentsGateway, deliveries,
+		syncCommands{payments: paymentsGateway, deliveries: deliveries}, saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: saga.NewMemoryStore()}), saga.NewLimiter(saga.LimiterConfig{}))
+	require.NoError(t, uc.RegisterSagas(registry))
+
+	return uc, paymentsGateway, locks, orders
+}
+
+// tenantCtx returns the context of a request made on behalf of a tenant
+func tenantCtx() context.Context {
+	return tenant.WithID(context.Background(), "acme")
+}
+
+func TestCreateOrderUseCase_Success(t *testing.T) {
+	locksDuringDelivery := ""
+	deliveries := &fakeDeliveries{}
+	uc, paymentsGateway, locks, orders := newUseCaseWithOrders(t, deliveries)
+	deliveries.onCreate = func(orderID int64) {
+		locksDuringDelivery, _ = locks.LockOwner(context.Background(), orderID)
+	}
+
+	output, err := uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks})
+	require.NoError(t, err)
+	require.Equal(t, int64(100), output.Order.Amount)
+	require.Equal(t, entities.OrderStatusApproved, output.Order.Status)
+	require.Equal(t, []string{"PENDING", "PAYMENT_CREATED", "DELIVERY_SCHEDULED", "APPROVED"}, orders.transitions)
+	require.Equal(t, int64(7), output.Order.DeliveryID)
+	require.Equal(t, []entities.LineItem{{ProductID: 1, Quantity: 2, UnitPrice: 50}}, output.Order.Items)
+	// the payment charges the total of the items
+	require.Equal(t, []entities.Payment{{ID: output.Order.PaymentID, OrderID: output.Order.ID, Amount: 100}}, paymentsGateway.Payments())
+
+	// the order is locked while the saga runs and released once it is done
+	require.NotEmpty(t, locksDuringDelivery)
+	require.False(t, output.Order.Locked())
+	require.Empty(t, locks.owners)
+}
+
+func TestCreateOrderUseCase_WaitsForTheServicesThroughTheTransport(t *testing.T) {
+	registry := saga.NewRegistry()
+	keys, err := saga.NewLocalKeyProvider("test", map[string][]byte{"test": make([]byte, 32)})
+	require.NoError(t, err)
+	registry.SetKeyProvider(keys)
+	executor := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: saga.NewMemoryStore()})
+	transport := saga.NewMemoryTransport(time.Millisecond)
+	paymentsGateway := payments.NewMemoryGateway()
+	deliveriesGateway := deliveries.NewMemoryGateway()
+	orders, locks := newFakeOrders(), newFakeLocks()
+	uc := order.NewCreateOrderUseCase(orders, fakeCatalog{}, locks, fakeTx{orders: orders, locks: locks}, paymentsGateway, deliveriesGateway,
+		saga.NewCommands(transport, order.RepliesDestination), executor, saga.NewLimiter(saga.LimiterConfig{}))
+	require.NoError(t, uc.RegisterSagas(registry))
+
+	// the payments and delivery services are down: the order is created and its payment waits in the transport
+	output, err := uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks})
+	require.NoError(t, err)
+	require.True(t, output.InProgress)
+	require.Equal(t, entities.OrderStatusPending, output.Order.Status)
+	require.Equal(t, 1, transport.Pending(payment.CommandsDestination))
+	require.Empty(t, paymentsGateway.Payments())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	commands := syncCommands{payments: paymentsGateway, deliveries: deliveriesGateway}
+	go func() { _ = saga.ServeCommands(ctx, transport, payment.CommandsDestination, commands.serve) }()
+	go func() { _ = saga.ServeCommands(ctx, transport, delivery.CommandsDestination, commands.serve) }()
+	go func() { _ = transport.Receive(ctx, order.RepliesDestination, executor.HandleReply) }()
+
+	var instance saga.Instance
+	require.Eventually(t, func() bool {
+		instance, err = executor.Get(saga.WithPayloadAccess(tenantCtx()), output.Order.SagaInstanceID)
+		return err == nil && instance.Status == saga.StatusCompleted
+	}, 5*time.Second, time.Millisecond)
+
+	approved := instance.Payload.(entities.Order)
+	require.Equal(t, entities.OrderStatusApproved, approved.Status)
+	require.Equal(t, []entities.Payment{{ID: approved.PaymentID, OrderID: approved.ID, Amount: 100}}, paymentsGateway.Payments())
+	require.Equal(t, approved.DeliveryID, deliveriesGateway.Deliveries()[0].ID)
+}
+
+func TestCreateOrderUseCase_InvalidItems(t *testing.T) {
+	uc, paymentsGateway, _ := newUseCase(t, &fakeDeliveries{})
+
+	_, err := uc.CreateOrder(tenantCtx(), order.CreateOrderInput{})
+	require.ErrorIs(t, err, order.ErrNoItems)
+
+	var itemErr *order.InvalidItemError
+	_, err = uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: []entities.LineItem{{ProductID: 1, Quantity: 0}}})
+	require.ErrorAs(t, err, &itemErr)
+	require.Equal(t, 0, itemErr.Index)
+
+	_, err = uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: []entities.LineItem{
+		{ProductID: 1, Quantity: 1},
+		{ProductID: 2, Quantity: 1},
+	}})
+	require.ErrorAs(t, err, &itemErr)
+	require.Equal(t, 1, itemErr.Index)
+	require.Equal(t, int64(2), itemErr.ProductID)
+
+	_, err = uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: []entities.LineItem{{ProductID: 1, Quantity: math.MaxInt64}}})
+	require.ErrorAs(t, err, &itemErr)
+
+	_, err = uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: []entities.LineItem{{ProductID: 3, Quantity: 1}}})
+	require.ErrorAs(t, err, &itemErr)
+	require.Equal(t, int64(3), itemErr.ProductID)
+
+	require.Empty(t, paymentsGateway.Payments())
+}
+
+func TestCreateOrderUseCase_IgnoresClientPrices(t *testing.T) {
+	uc, _, _ := newUseCase(t, &fakeDeliveries{})
+
+	output, err := uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: []entities.LineItem{{ProductID: 1, Quantity: 2, UnitPrice: 1}}})
+	require.NoError(t, err)
+	require.Equal(t, int64(100), output.Order.Amount)
+}
+
+func TestCreateOrderUseCase_RemoteCallsRunOutsideTransactions(t *testing.T) {
+	var statusDuringDelivery entities.OrderStatus
+	deliveries := &fakeDeliveries{}
+	uc, _, _, orders := newUseCaseWithOrders(t, deliveries)
+	deliveries.onCreate = func(orderID int64) {
+		statusDuringDelivery = orders.orders[orderID].Status
+	}
+
+	_, err := uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks})
+	require.NoError(t, err)
+
+	require.False(t, deliveries.calledInTx)
+	require.Equal(t, entities.OrderStatusPaymentCreated, statusDuringDelivery)
+}
+
+func TestCreateOrderUseCase_RequiresTenant(t *testing.T) {
+	uc, paymentsGateway, _ := newUseCase(t, &fakeDeliveries{})
+
+	_, err := uc.CreateOrder(context.Background(), order.CreateOrderInput{Items: twoBooks})
+	require.ErrorIs(t, err, tenant.ErrMissing)
+	require.Empty(t, paymentsGateway.Payments())
+}
+
+func TestCreateOrderUseCase_IdempotencyKey_ReturnsTheFirstOrder(t *testing.T) {
+	uc, paymentsGateway, _ := newUseCase(t, &fakeDeliveries{})
+
+	first, err := uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks, IdempotencyKey: "key-1"})
+	require.NoError(t, err)
+	retry, err := uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks, IdempotencyKey: "key-1"})
+	require.NoError(t, err)
+
+	require.False(t, retry.InProgress)
+	require.Equal(t, first.Order, retry.Order)
+	require.Len(t, paymentsGateway.Payments(), 1)
+}
+
+func TestCreateOrderUseCase_IdempotencyKey_RejectsDifferentRequests(t *testing.T) {
+	uc, paymentsGateway, _ := newUseCase(t, &fakeDeliveries{})
+
+	_, err := uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks, IdempotencyKey: "key-1"})
+	require.NoError(t, err)
+	_, err = uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: []entities.LineItem{{ProductID: 1, Quantity: 4}}, IdempotencyKey: "key-1"})
+
+	var reusedErr *order.IdempotencyKeyReusedError
+	require.ErrorAs(t, err, &reusedErr)
+	require.Equal(t, "key-1", reusedErr.Key)
+	require.Len(t, paymentsGateway.Payments(), 1)
+}
+
+func TestCreateOrderUseCase_IdempotencyKey_ReportsOrdersInProgress(t *testing.T) {
+	var retry order.CreateOrderOutput
+	var retryErr error
+	deliveries := &fakeDeliveries{}
+	uc, paymentsGateway, _ := newUseCase(t, deliveries)
+	deliveries.onCreate = func(orderID int64) {
+		retry, retryErr = uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks, IdempotencyKey: "key-1"})
+	}
+
+	first, err := uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks, IdempotencyKey: "key-1"})
+	require.NoError(t, err)
+
+	require.NoError(t, retryErr)
+	require.True(t, retry.InProgress)
+	require.Equal(t, first.Order.ID, retry.Order.ID)
+	require.Len(t, paymentsGateway.Payments(), 1)
+}
+
+func TestCreateOrderUseCase_IdempotencyKey_ReplaysFailures(t *testing.T) {
+	deliveries := &fakeDeliveries{err: errors.New("deliveries unavailable")}
+	uc, paymentsGateway, _ := newUseCase(t, deliveries)
+
+	_, err := uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks, IdempotencyKey: "key-1"})
+	require.Error(t, err)
+
+	deliveries.err = nil
+	_, err = uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks, IdempotencyKey: "key-1"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "deliveries unavailable")
+	require.Empty(t, paymentsGateway.Payments())
+}
+
+func TestCreateOrderUseCase_DeliveryFailure(t *testing.T) {
+	uc, paymentsGateway, locks, orders := newUseCaseWithOrders(t, &fakeDeliveries{err: errors.New("deliveries unavailable")})
+
+	_, err := uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks})
+	require.Error(t, err)
+	require.Empty(t, paymentsGateway.Payments())
+	require.Empty(t, locks.owners)
+	// the rejection is committed by the compensation, fakeTx would roll it back if it ran in a failed transaction
+	require.Equal(t, entities.OrderStatusRejected, orders.orders[1].Status)
+	require.Equal(t, []string{"PENDING", "PAYMENT_CREATED", "REJECTED"}, orders.transitions)
+}
+
+func TestCreateOrderUseCase_LockFailure_RollsBackTheOrder(t *testing.T) {
+	uc, paymentsGateway, locks, orders := newUseCaseWithOrders(t, &fakeDeliveries{})
+	// the next order is already locked, so create-order fails after inserting it
+	locks.owners[1] = "another-saga"
+
+	_, err := uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks, IdempotencyKey: "key-1"})
+	var lockedErr *domain.LockedError
+	require.ErrorAs(t, err, &lockedErr)
+	require.Empty(t, orders.orders)
+	require.Empty(t, orders.transitions)
+	require.Empty(t, paymentsGateway.Payments())
+
+	// the key belongs to the compensated saga instance, so a retry gets its failure rather than running it again
+	locks.owners = map[int64]string{}
+	_, err = uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks, IdempotencyKey: "key-1"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "order 1 is locked by saga another-saga")
+	require.Empty(t, orders.orders)
+
+	output, err := uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks, IdempotencyKey: "key-2"})
+	require.NoError(t, err)
+	require.Equal(t, entities.OrderStatusApproved, output.Order.Status)
+}
+
+func TestCreateOrderUseCase_KeyOfAFailedRequestIsBoundToIt(t *testing.T) {
+	uc, _, locks, _ := newUseCaseWithOrders(t, &fakeDeliveries{})
+	locks.owners[1] = "another-saga"
+
+	_, err := uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks, IdempotencyKey: "key-1"})
+	require.Error(t, err)
+
+	// no order holds the key, its saga instance does
+	var reusedErr *order.IdempotencyKeyReusedError
+	_, err = uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: []entities.LineItem{{ProductID: 1, Quantity: 1}}, IdempotencyKey: "key-1"})
+	require.ErrorAs(t, err, &reusedErr)
+}
+
+func TestCreateOrderUseCase_DeliveryPanic(t *testing.T) {
+	deliveries := &fakeDeliveries{onCreate: func(orderID int64) {
+		var missing *entities.Order
+		_ = missing.Amount
+	}}
+	uc, paymentsGateway, locks := newUseCase(t, deliveries)
+
+	_, err := uc.CreateOrder(tenantCtx(), order.CreateOrderInput{Items: twoBooks})
+
+	var panicErr *saga.StepPanicError
+	require.ErrorAs(t, err, &panicErr)
+	require.Equal(t, "create-delivery", panicErr.Step)
+	require.Empty(t, paymentsGateway.Payments())
+	require.Empty(t, locks.owners)
+}
+
+func TestCreateOrderSaga_CompensatesInReverseOrder(t *testing.T) {
+	uc, paymentsGateway, _ := newUseCase(t, &fakeDeliveries{})
+	rec := sagatest.NewRecorder()
+	s := rec.Wrap(uc.CreateOrderSaga(), sagatest.FailStep(2, 1, errors.New("boom")))
+
+	ctx := context.WithValue(context.Background(), saga.ParamKey, order.CreateOrderInput{Amount: 100})
+	_, ok := saga.NewCoordinator(s).Execute(ctx)
+
+	require.False(t, ok)
+	rec.AssertCalls(t,
+		sagatest.Command("create-order"),
+		sagatest.Command("create-payment"),
+		sagatest.Command("record-payment"),
+		sagatest.Compensation("record-payment"),
+		sagatest.Compensation("create-payment"),
+		sagatest.Compensation("create-order"),
+	)
+	rec.AssertNotCompensated(t, "create-delivery", "record-delivery", "release-order")
+	require.Empty(t, paymentsGateway.Payments())
+}
+
+func TestCreateOrderUseCase_KeepsPreviousSagaVersions(t *testing.T) {
+	uc, paymentsGateway, _ := newUseCase(t, &fakeDeliveries{})
+	registry := saga.NewRegistry()
+	keys, err := saga.NewLocalKeyProvider("test", map[string][]byte{"test": make([]byte, 32)})
+	require.NoError(t, err)
+	registry.SetKeyProvider(keys)
+	require.NoError(t, uc.RegisterSagas(registry))
+	require.Equal(t, []int{1, 2, 3, 4, 5, order.CreateOrderSagaVersion}, registry.Versions(order.CreateOrderSagaName))
+
+	// instances started with the previous versions still run their steps, which called the services synchronously
+	for version := 1; version < order.CreateOrderSagaVersion; version++ {
+		previous, err := registry.Get(order.CreateOrderSagaName, version)
+		require.NoError(t, err)
+		require.NoError(t, saga.Validate(previous))
+		ctx := context.WithValue(tenantCtx(), saga.ParamKey, order.CreateOrderInput{Amount: 100})
+		result, ok := saga.NewCoordinator(previous).Execute(ctx)
+		require.True(t, ok, "version %d", version)
+		require.Equal(t, int64(7), result.(entities.Order).DeliveryID)
+		require.Len(t, paymentsGateway.Payments(), version)
+	}
+}
+
+func TestCreateOrderSaga_Invariants(t *testing.T) {
+	sagatest.Harness{
+		Depth: 2,
+		Setup: func(t testing.TB, env *sagatest.Env) (saga.Saga, context.Context, interface{}, []sagatest.Invariant) {
+			orders := newFakeOrders()
+			locks := newFakeLocks()
+			paymentsGateway := payments.NewMemoryGateway()
+			deliveriesGateway := deliveries.NewMemoryGateway()
+			uc := order.NewCreateOrderUseCase(orders, fakeCatalog{}, locks, fakeTx{orders: orders, locks: locks}, paymentsGateway, deliveriesGateway,
+				env.Commands, nil, nil)
+			require.NoError(t, uc.RegisterSagas(env.Registry))
+			services := syncCommands{payments: paymentsGateway, deliveries: deliveriesGateway}
+			env.Serve(payment.CommandsDestination, services.serve)
+			env.Serve(delivery.CommandsDestination, services.serve)
+			ctx := tenantCtx()
+
+			// orders rolled back by fakeTx are gone, even though their ids were used
+			listOrders := func() ([]entities.Order, error) {
+				return orders.ListOrders(ctx, entities.OrderFilter{}, 0, 100)
+			}
+			invariants := []sagatest.Invariant{
+				{
+					Name: "no payment exists without an order",
+					Check: func(o sagatest.Outcome) error {
+						for _, p := range paymentsGateway.Payments() {
+							if _, err := orders.GetOrder(ctx, p.OrderID); err != nil {
+								return fmt.Errorf("payment %d references order %d: %w", p.ID, p.OrderID, err)
+							}
+						}
+						return nil
+					},
+				},
+				{
+					Name: "a compensated order leaves no payment behind",
+					Check: func(o sagatest.Outcome) error {
+						if o.Completed || len(o.CompensationErrors) > 0 {
+							return nil
+						}
+						if n := len(paymentsGateway.Payments()); n > 0 {
+							return fmt.Errorf("%d payments left", n)
+						}
+						return nil
+					},
+				},
+				{
+					Name: "no order stays locked once the saga is done",
+					Check: func(o sagatest.Outcome) error {
+						if len(o.CompensationErrors) > 0 {
+							return nil
+						}
+						created, err := listOrders()
+						if err != nil {
+							return err
+						}
+						for _, c := range created {
+							owner, err := locks.LockOwner(ctx, c.ID)
+							if err != nil {
+								return err
+							}
+							if owner != "" {
+								return fmt.Errorf("order %d is still locked by %s", c.ID, owner)
+							}
+						}
+						return nil
+					},
+				},
+				{
+					Name: "a compensated order is rejected",
+					Check: func(o sagatest.Outcome) error {
+						if o.Completed || len(o.CompensationErrors) > 0 {
+							return nil
+						}
+						created, err := listOrders()
+						if err != nil {
+							return err
+						}
+						for _, c := range created {
+							if c.Status != entities.OrderStatusRejected {
+								return fmt.Errorf("order %d is %s", c.ID, c.Status)
+							}
+						}
+						return nil
+					},
+				},
+				{
+					Name: "a completed order has a payment and a delivery",
+					Check: func(o sagatest.Outcome) error {
+						if !o.Completed {
+							return nil
+						}
+						approved, err := orders.GetOrder(ctx, o.Result.(entities.Order).ID)
+						if err != nil {
+							return err
+						}
+						if approved.Status != entities.OrderStatusApproved {
+							return fmt.Errorf("order %d is %s", approved.ID, approved.Status)
+						}
+						payment := entities.Payment{ID: approved.PaymentID, OrderID: approved.ID, Amount: approved.Amount}
+						if p := paymentsGateway.Payments(); len(p) != 1 || p[0] != payment {
+							return fmt.Errorf("order %+v does not have its payment, payments are %+v", approved, p)
+						}
+						if d := deliveriesGateway.Deliveries(); len(d) != 1 || d[0].ID != approved.DeliveryID || d[0].OrderID != approved.ID {
+							return fmt.Errorf("order %+v does not have its delivery, deliveries are %+v", approved, d)
+						}
+						return nil
+					},
+				},
+			}
+
+			s := uc.CreateOrderSaga()
+			// the steps after the pivot are retried without waiting
+			s.ForwardRetry = saga.ForwardRetryPolicy{Backoff: time.Millisecond}
+			// priced as by CreateOrder
+			input := order.CreateOrderInput{Items: []entities.LineItem{{ProductID: 1, Quantity: 2, UnitPrice: 50}}, Amount: 100}
+			return s, ctx, input, invariants
+		},
+	}.Run(t)
+}
+
+func TestCreateOrderSaga_Plan(t *testing.T) {
+	uc, _, _ := newUseCase(t, &fakeDeliveries{})
+	s := uc.CreateOrderSaga()
+	require.NoError(t, saga.Validate(s))
+
+	plan, err := saga.DryRun(s)
+	require.NoError(t, err)
+	t.Log(plan)
+	require.Equal(t, `saga "create-order" version 6
+  no failure: run create-order, create-payment, record-payment, create-delivery, record-delivery, release-order; completed
+  step 0 fails: run create-order; compensate create-order; compensated
+  step 1 fails: run create-order, create-payment; compensate create-payment, create-order; compensated
+  step 2 fails: run create-order, create-payment, record-payment; compensate record-payment, create-payment, create-order; compensated
+  step 3 fails: run create-order, create-payment, record-payment, create-delivery; compensate create-delivery, record-payment, create-payment, create-order; compensated
+  step 4 fails: run create-order, create-payment, record-payment, create-delivery, record-delivery, record-delivery, release-order; completed
+  step 5 fails: run create-order, create-payment, record-payment, create-delivery, record-delivery, release-order, release-order; completed
+`, plan.String())
+}
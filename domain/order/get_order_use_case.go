@@ -0,0 +1,38 @@
+package order
+
+import (
+	"context"
+
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+)
+
+type GetOrderUseCasePersistenceGateway interface {
+	// GetOrder fails with domain.ErrNotFound if the tenant has no such order
+	GetOrder(ctx context.Context, id int64) (entities.Order, error)
+}
+
+type GetOrderUseCase struct {
+	persistenceGateway GetOrderUseCasePersistenceGateway
+}
+
+func NewGetOrderUseCase(persistenceGateway GetOrderUseCasePersistenceGateway) *GetOrderUseCase {
+	return &GetOrderUseCase{persistenceGateway: persistenceGateway}
+}
+
+type GetOrderInput struct {
+	OrderID int64
+}
+
+type GetOrderOutput struct {
+	Order entities.Order
+}
+
+// GetOrder fails with domain.ErrNotFound if the tenant has no such order
+func (u *GetOrderUseCase) GetOrder(ctx context.Context, input GetOrderInput) (GetOrderOutput, error) {
+	o, err := u.persistenceGateway.GetOrder(ctx, input.OrderID)
+	if err != nil {
+		return GetOrderOutput{}, err
+	}
+
+	return GetOrderOutput{Order: o}, nil
+}
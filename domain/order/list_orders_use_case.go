@@ -0,0 +1,121 @@
+package order
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+)
+
+const (
+	// DefaultPageSize is the number of orders listed when the input has no page size
+	DefaultPageSize = 50
+	// MaxPageSize bounds the page size of the input
+	MaxPageSize = 100
+)
+
+// ErrInvalidPageToken is returned for page tokens that were not returned by ListOrders, or that were returned for
+// another filter
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+type ListOrdersUseCasePersistenceGateway interface {
+	// ListOrders returns up to limit orders matching the filter, newest first, starting after the order with the
+	// afterID id unless it is zero
+	ListOrders(ctx context.Context, filter entities.OrderFilter, afterID int64, limit int) ([]entities.Order, error)
+}
+
+type ListOrdersUseCase struct {
+	persistenceGateway ListOrdersUseCasePersistenceGateway
+}
+
+func NewListOrdersUseCase(persistenceGateway ListOrdersUseCasePersistenceGateway) *ListOrdersUseCase {
+	return &ListOrdersUseCase{persistenceGateway: persistenceGateway}
+}
+
+type ListOrdersInput struct {
+	Filter entities.OrderFilter
+	// PageSize defaults to DefaultPageSize and is capped at MaxPageSize
+	PageSize int
+	// PageToken is the NextPageToken of the previous page, empty for the first page
+	PageToken string
+}
+
+type ListOrdersOutput struct {
+	Orders []entities.Order
+	// NextPageToken lists the next page when given back with the same filter, and is empty on the last page
+	NextPageToken string
+}
+
+// pageToken is where a page starts. It is bound to the filter it was returned for, so a token cannot be used to
+// skip orders of another listing.
+type pageToken struct {
+	AfterID int64  `json:"after_id"`
+	Filter  string `json:"filter"`
+}
+
+// ListOrders lists the orders of the tenant, newest first. It fails with ErrInvalidPageToken if the page token is
+// invalid.
+func (u *ListOrdersUseCase) ListOrders(ctx context.Context, input ListOrdersInput) (ListOrdersOutput, error) {
+	pageSize := input.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+
+	filterFingerprint := fingerprintFilter(input.Filter)
+	var afterID int64
+	if input.PageToken != "" {
+		token, err := decodePageToken(input.PageToken)
+		if err != nil || token.Filter != filterFingerprint {
+			return ListOrdersOutput{}, ErrInvalidPageToken
+		}
+		afterID = token.AfterID
+	}
+
+	// one more order tells whether there is a next page
+	orders, err := u.persistenceGateway.ListOrders(ctx, input.Filter, afterID, pageSize+1)
+	if err != nil {
+		return ListOrdersOutput{}, err
+	}
+
+	output := ListOrdersOutput{Orders: orders}
+	if len(orders) > pageSize {
+		output.Orders = orders[:pageSize]
+		output.NextPageToken = encodePageToken(pageToken{AfterID: output.Orders[pageSize-1].ID, Filter: filterFingerprint})
+	}
+
+	return output, nil
+}
+
+func fingerprintFilter(filter entities.OrderFilter) string {
+	data, _ := json.Marshal(filter) //nolint:errcheck
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:8])
+}
+
+func encodePageToken(token pageToken) string {
+	data, _ := json.Marshal(token) //nolint:errcheck
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageToken(s string) (pageToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageToken{}, err
+	}
+
+	var token pageToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return pageToken{}, err
+	}
+
+	return token, nil
+}
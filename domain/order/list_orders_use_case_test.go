@@ -0,0 +1,132 @@
+package order_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/domain/order"
+	"github.com/stretchr/testify/require"
+)
+
+func newOrders(statuses ...entities.OrderStatus) *fakeOrders {
+	orders := newFakeOrders()
+	for _, status := range statuses {
+		_, _ = orders.CreateOrder(context.Background(), entities.Order{Amount: 100, Status: status}) //nolint:errcheck
+	}
+	return orders
+}
+
+func listIDs(orders []entities.Order) []int64 {
+	ids := make([]int64, 0, len(orders))
+	for _, o := range orders {
+		ids = append(ids, o.ID)
+	}
+	return ids
+}
+
+func TestListOrdersUseCase_Pages(t *testing.T) {
+	uc := order.NewListOrdersUseCase(newOrders(entities.OrderStatusApproved, entities.OrderStatusApproved,
+		entities.OrderStatusApproved, entities.OrderStatusApproved, entities.OrderStatusApproved))
+
+	first, err := uc.ListOrders(tenantCtx(), order.ListOrdersInput{PageSize: 2})
+	require.NoError(t, err)
+	require.Equal(t, []int64{5, 4}, listIDs(first.Orders))
+	require.NotEmpty(t, first.NextPageToken)
+
+	second, err := uc.ListOrders(tenantCtx(), order.ListOrdersInput{PageSize: 2, PageToken: first.NextPageToken})
+	require.NoError(t, err)
+	require.Equal(t, []int64{3, 2}, listIDs(second.Orders))
+
+	last, err := uc.ListOrders(tenantCtx(), order.ListOrdersInput{PageSize: 2, PageToken: second.NextPageToken})
+	require.NoError(t, err)
+	require.Equal(t, []int64{1}, listIDs(last.Orders))
+	require.Empty(t, last.NextPageToken)
+}
+
+func TestListOrdersUseCase_Filters(t *testing.T) {
+	uc := order.NewListOrdersUseCase(newOrders(entities.OrderStatusApproved, entities.OrderStatusRejected,
+		entities.OrderStatusApproved, entities.OrderStatusRejected))
+	filter := entities.OrderFilter{Statuses: []entities.OrderStatus{entities.OrderStatusRejected}}
+
+	first, err := uc.ListOrders(tenantCtx(), order.ListOrdersInput{Filter: filter, PageSize: 1})
+	require.NoError(t, err)
+	require.Equal(t, []int64{4}, listIDs(first.Orders))
+
+	second, err := uc.ListOrders(tenantCtx(), order.ListOrdersInput{Filter: filter, PageSize: 1, PageToken: first.NextPageToken})
+	require.NoError(t, err)
+	require.Equal(t, []int64{2}, listIDs(second.Orders))
+	require.Empty(t, second.NextPageToken)
+}
+
+func TestListOrdersUseCase_CombinesFilters(t *testing.T) {
+	orders := newFakeOrders()
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, o := range []entities.Order{
+		{Amount: 50, Status: entities.OrderStatusApproved},
+		{Amount: 100, Status: entities.OrderStatusRejected},
+		{Amount: 150, Status: entities.OrderStatusCancelled},
+		{Amount: 200, Status: entities.OrderStatusApproved},
+		{Amount: 250, Status: entities.OrderStatusPending},
+	} {
+		o, _ = orders.CreateOrder(context.Background(), o) //nolint:errcheck
+		o.CreatedAt = created.Add(time.Duration(i) * time.Hour)
+		orders.orders[o.ID] = o
+	}
+	uc := order.NewListOrdersUseCase(orders)
+	amount := func(a int64) *int64 { return &a }
+
+	for name, test := range map[string]struct {
+		filter entities.OrderFilter
+		ids    []int64
+	}{
+		"several statuses": {
+			filter: entities.OrderFilter{Statuses: []entities.OrderStatus{entities.OrderStatusApproved, entities.OrderStatusCancelled}},
+			ids:    []int64{4, 3, 1},
+		},
+		"amount range, inclusive": {
+			filter: entities.OrderFilter{MinAmount: amount(100), MaxAmount: amount(200)},
+			ids:    []int64{4, 3, 2},
+		},
+		"created after, inclusive": {
+			filter: entities.OrderFilter{CreatedAfter: created.Add(3 * time.Hour)},
+			ids:    []int64{5, 4},
+		},
+		"created before, exclusive": {
+			filter: entities.OrderFilter{CreatedBefore: created.Add(time.Hour)},
+			ids:    []int64{1},
+		},
+		"every filter": {
+			filter: entities.OrderFilter{
+				Statuses:      []entities.OrderStatus{entities.OrderStatusApproved, entities.OrderStatusRejected},
+				MinAmount:     amount(100),
+				CreatedBefore: created.Add(3 * time.Hour),
+			},
+			ids: []int64{2},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			output, err := uc.ListOrders(tenantCtx(), order.ListOrdersInput{Filter: test.filter})
+			require.NoError(t, err)
+			require.Equal(t, test.ids, listIDs(output.Orders))
+		})
+	}
+}
+
+func TestListOrdersUseCase_RejectsInvalidPageTokens(t *testing.T) {
+	uc := order.NewListOrdersUseCase(newOrders(entities.OrderStatusApproved, entities.OrderStatusApproved))
+
+	first, err := uc.ListOrders(tenantCtx(), order.ListOrdersInput{PageSize: 1})
+	require.NoError(t, err)
+
+	_, err = uc.ListOrders(tenantCtx(), order.ListOrdersInput{PageToken: "not-a-token"})
+	require.ErrorIs(t, err, order.ErrInvalidPageToken)
+
+	// tokens are bound to the filter they were returned for
+	_, err = uc.ListOrders(tenantCtx(), order.ListOrdersInput{
+		Filter:    entities.OrderFilter{Statuses: []entities.OrderStatus{entities.OrderStatusApproved}},
+		PageToken: first.NextPageToken,
+	})
+	require.ErrorIs(t, err, order.ErrInvalidPageToken)
+}
@@ -0,0 +1,78 @@
+package order
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+)
+
+// transitions lists the statuses an order can move to from each status. Rejected and cancelled orders are final.
+var transitions = map[entities.OrderStatus][]entities.OrderStatus{
+	entities.OrderStatusPending: {
+		entities.OrderStatusPaymentCreated, entities.OrderStatusRejected, entities.OrderStatusCancelled,
+	},
+	entities.OrderStatusPaymentCreated: {
+		entities.OrderStatusDeliveryScheduled, entities.OrderStatusRejected, entities.OrderStatusCancelled,
+	},
+	entities.OrderStatusDeliveryScheduled: {
+		entities.OrderStatusApproved, entities.OrderStatusRejected, entities.OrderStatusCancelled,
+	},
+	entities.OrderStatusApproved: {entities.OrderStatusCancelled},
+}
+
+// InvalidTransitionError is returned when an order cannot move from its status to another
+type InvalidTransitionError struct {
+	OrderID int64
+	From    entities.OrderStatus
+	To      entities.OrderStatus
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("order %d cannot go from %s to %s", e.OrderID, e.From, e.To)
+}
+
+// ValidateTransition returns an *InvalidTransitionError unless an order can move from one status to the other
+func ValidateTransition(orderID int64, from, to entities.OrderStatus) error {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+
+	return &InvalidTransitionError{OrderID: orderID, From: from, To: to}
+}
+
+// OrderStatusGateway persists the status of orders
+type OrderStatusGateway interface {
+	// GetOrder fails with domain.ErrNotFound if the tenant has no such order
+	GetOrder(ctx context.Context, id int64) (entities.Order, error)
+	// UpdateOrder saves the status of an order, and its PaymentID and DeliveryID unless they are zero, and records
+	// the transition with its time. It fails with domain.ErrStatusChanged if the order is not in the from status
+	// anymore.
+	UpdateOrder(ctx context.Context, o entities.Order, from entities.OrderStatus) (entities.Order, error)
+}
+
+// Transition moves an order to a status after validating the transition from its current one, saving its payment
+// and delivery along. Moving an order to the status it already has is a no-op, so the saga steps driving transitions
+// can be retried.
+func Transition(ctx context.Context, gateway OrderStatusGateway, o entities.Order, to entities.OrderStatus) (entities.Order, error) {
+	current, err := gateway.GetOrder(ctx, o.ID)
+	if err != nil {
+		return entities.Order{}, fmt.Errorf("loading order %d: %w", o.ID, err)
+	}
+	if current.Status == to {
+		return current, nil
+	}
+	if err := ValidateTransition(o.ID, current.Status, to); err != nil {
+		return entities.Order{}, err
+	}
+
+	o.Status = to
+	updated, err := gateway.UpdateOrder(ctx, o, current.Status)
+	if err != nil {
+		return entities.Order{}, fmt.Errorf("moving order %d to %s: %w", o.ID, to, err)
+	}
+
+	return updated, nil
+}
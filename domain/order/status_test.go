@@ -0,0 +1,56 @@
+package order_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/domain/order"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTransition(t *testing.T) {
+	tests := []struct {
+		from, to entities.OrderStatus
+		valid    bool
+	}{
+		{entities.OrderStatusPending, entities.OrderStatusPaymentCreated, true},
+		{entities.OrderStatusPaymentCreated, entities.OrderStatusDeliveryScheduled, true},
+		{entities.OrderStatusDeliveryScheduled, entities.OrderStatusApproved, true},
+		{entities.OrderStatusDeliveryScheduled, entities.OrderStatusRejected, true},
+		{entities.OrderStatusApproved, entities.OrderStatusCancelled, true},
+		{entities.OrderStatusPending, entities.OrderStatusApproved, false},
+		{entities.OrderStatusApproved, entities.OrderStatusRejected, false},
+		{entities.OrderStatusRejected, entities.OrderStatusPending, false},
+		{entities.OrderStatusCancelled, entities.OrderStatusApproved, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			err := order.ValidateTransition(1, tt.from, tt.to)
+			if tt.valid {
+				require.NoError(t, err)
+				return
+			}
+			var transitionErr *order.InvalidTransitionError
+			require.ErrorAs(t, err, &transitionErr)
+			require.Equal(t, tt.from, transitionErr.From)
+		})
+	}
+}
+
+func TestTransition_IsIdempotent(t *testing.T) {
+	orders := newFakeOrders()
+	created, err := orders.CreateOrder(context.Background(), entities.Order{Amount: 100, Status: entities.OrderStatusPending})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		updated, err := order.Transition(context.Background(), orders, created, entities.OrderStatusRejected)
+		require.NoError(t, err)
+		require.Equal(t, entities.OrderStatusRejected, updated.Status)
+	}
+	require.Equal(t, []string{"PENDING", "REJECTED"}, orders.transitions)
+
+	_, err = order.Transition(context.Background(), orders, created, entities.OrderStatusApproved)
+	var transitionErr *order.InvalidTransitionError
+	require.ErrorAs(t, err, &transitionErr)
+}
@@ -0,0 +1,10 @@
+package payment
+
+// Commands accepted by the payments service through a saga.Transport, see saga.Commands
+const (
+	CommandsDestination = "payments.commands"
+	// CreatePaymentCommand takes a CreatePaymentInput and replies with the created entities.Payment
+	CreatePaymentCommand = "payments.CreatePayment"
+	// DeletePaymentCommand takes a DeletePaymentInput and replies with it once the payment is deleted
+	DeletePaymentCommand = "payments.DeletePayment"
+)
@@ -2,11 +2,15 @@ package payment
 
 import (
 	"context"
+	"errors"
 	"github.com/didopimentel/go-saga-poc/domain/entities"
 )
 
+// ErrInvalidAmount is returned when creating a payment whose amount is not positive
+var ErrInvalidAmount = errors.New("a payment needs a positive amount")
+
 type CreatePaymentUseCasePersistenceGateway interface {
-	CreatePayment(context.Context, int64) (entities.Payment, error)
+	CreatePayment(ctx context.Context, orderID, amount int64) (entities.Payment, error)
 }
 
 type CreatePaymentUseCase struct {
@@ -19,13 +23,19 @@ func NewCreatePaymentUseCase(persistenceGateway CreatePaymentUseCasePersistenceG
 
 type CreatePaymentInput struct {
 	OrderID int64
+	Amount  int64
 }
 type CreatePaymentOutput struct {
 	Payment entities.Payment
 }
 
+// CreatePayment fails with ErrInvalidAmount unless the amount is positive
 func (u *CreatePaymentUseCase) CreatePayment(ctx context.Context, input CreatePaymentInput) (CreatePaymentOutput, error) {
-	payment, err := u.persistenceGateway.CreatePayment(ctx, input.OrderID)
+	if input.Amount <= 0 {
+		return CreatePaymentOutput{}, ErrInvalidAmount
+	}
+
+	payment, err := u.persistenceGateway.CreatePayment(ctx, input.OrderID, input.Amount)
 	if err != nil {
 		return CreatePaymentOutput{}, err
 	}
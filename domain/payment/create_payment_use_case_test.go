@@ -0,0 +1,40 @@
+package payment_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/domain/payment"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePayments struct {
+	created []entities.Payment
+}
+
+func (f *fakePayments) CreatePayment(_ context.Context, orderID, amount int64) (entities.Payment, error) {
+	p := entities.Payment{ID: int64(len(f.created) + 1), OrderID: orderID, Amount: amount}
+	f.created = append(f.created, p)
+	return p, nil
+}
+
+func TestCreatePaymentUseCase(t *testing.T) {
+	payments := &fakePayments{}
+	uc := payment.NewCreatePaymentUseCase(payments)
+
+	output, err := uc.CreatePayment(context.Background(), payment.CreatePaymentInput{OrderID: 1, Amount: 100})
+	require.NoError(t, err)
+	require.Equal(t, entities.Payment{ID: 1, OrderID: 1, Amount: 100}, output.Payment)
+}
+
+func TestCreatePaymentUseCase_RejectsNonPositiveAmounts(t *testing.T) {
+	payments := &fakePayments{}
+	uc := payment.NewCreatePaymentUseCase(payments)
+
+	for _, amount := range []int64{0, -100} {
+		_, err := uc.CreatePayment(context.Background(), payment.CreatePaymentInput{OrderID: 1, Amount: amount})
+		require.ErrorIs(t, err, payment.ErrInvalidAmount)
+	}
+	require.Empty(t, payments.created)
+}
@@ -19,6 +19,9 @@ func NewDeletePaymentUseCase(persistenceGateway DeletePaymentUseCasePersistenceG
 
 type DeletePaymentInput struct {
 	PaymentID int64
+	// OrderID is the order the payment was made for. It is only echoed in the reply to a DeletePaymentCommand,
+	// so the saga refunding an order knows which one it is.
+	OrderID int64
 }
 type DeletePaymentOutput struct {
 	Payment entities.Delivery
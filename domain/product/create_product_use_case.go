@@ -0,0 +1,41 @@
+package product
+
+import (
+	"context"
+
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+)
+
+type CreateProductUseCasePersistenceGateway interface {
+	CreateProduct(ctx context.Context, product entities.Product) (entities.Product, error)
+}
+
+type CreateProductUseCase struct {
+	persistenceGateway CreateProductUseCasePersistenceGateway
+}
+
+func NewCreateProductUseCase(persistenceGateway CreateProductUseCasePersistenceGateway) *CreateProductUseCase {
+	return &CreateProductUseCase{persistenceGateway: persistenceGateway}
+}
+
+type CreateProductInput struct {
+	Name  string
+	Price int64
+}
+type CreateProductOutput struct {
+	Product entities.Product
+}
+
+// CreateProduct fails with an *InvalidProductError unless the product has a name and a positive price
+func (u *CreateProductUseCase) CreateProduct(ctx context.Context, input CreateProductInput) (CreateProductOutput, error) {
+	if err := validate(input.Name, input.Price); err != nil {
+		return CreateProductOutput{}, err
+	}
+
+	product, err := u.persistenceGateway.CreateProduct(ctx, entities.Product{Name: input.Name, Price: input.Price})
+	if err != nil {
+		return CreateProductOutput{}, err
+	}
+
+	return CreateProductOutput{Product: product}, nil
+}
@@ -0,0 +1,29 @@
+package product
+
+import (
+	"context"
+)
+
+type DeleteProductUseCasePersistenceGateway interface {
+	// DeleteProduct fails with domain.ErrNotFound if the tenant has no such product
+	DeleteProduct(ctx context.Context, id int64) error
+}
+
+type DeleteProductUseCase struct {
+	persistenceGateway DeleteProductUseCasePersistenceGateway
+}
+
+func NewDeleteProductUseCase(persistenceGateway DeleteProductUseCasePersistenceGateway) *DeleteProductUseCase {
+	return &DeleteProductUseCase{persistenceGateway: persistenceGateway}
+}
+
+type DeleteProductInput struct {
+	ProductID int64
+}
+type DeleteProductOutput struct{}
+
+// DeleteProduct removes a product from the catalog, so it cannot be ordered anymore.
+// Orders keep the items they have of it.
+func (u *DeleteProductUseCase) DeleteProduct(ctx context.Context, input DeleteProductInput) (DeleteProductOutput, error) {
+	return DeleteProductOutput{}, u.persistenceGateway.DeleteProduct(ctx, input.ProductID)
+}
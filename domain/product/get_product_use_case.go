@@ -0,0 +1,37 @@
+package product
+
+import (
+	"context"
+
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+)
+
+type GetProductUseCasePersistenceGateway interface {
+	// GetProduct fails with domain.ErrNotFound if the tenant has no such product
+	GetProduct(ctx context.Context, id int64) (entities.Product, error)
+}
+
+type GetProductUseCase struct {
+	persistenceGateway GetProductUseCasePersistenceGateway
+}
+
+func NewGetProductUseCase(persistenceGateway GetProductUseCasePersistenceGateway) *GetProductUseCase {
+	return &GetProductUseCase{persistenceGateway: persistenceGateway}
+}
+
+type GetProductInput struct {
+	ProductID int64
+}
+type GetProductOutput struct {
+	Product entities.Product
+}
+
+// GetProduct fails with domain.ErrNotFound if the tenant has no such product
+func (u *GetProductUseCase) GetProduct(ctx context.Context, input GetProductInput) (GetProductOutput, error) {
+	product, err := u.persistenceGateway.GetProduct(ctx, input.ProductID)
+	if err != nil {
+		return GetProductOutput{}, err
+	}
+
+	return GetProductOutput{Product: product}, nil
+}
@@ -0,0 +1,82 @@
+package product
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strconv"
+
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+)
+
+const (
+	// DefaultPageSize is the number of products listed when the input has no page size
+	DefaultPageSize = 50
+	// MaxPageSize bounds the page size of the input
+	MaxPageSize = 100
+)
+
+// ErrInvalidPageToken is returned for page tokens that were not returned by ListProducts
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+type ListProductsUseCasePersistenceGateway interface {
+	// ListProducts returns up to limit products by ascending id, starting after the product with the afterID id
+	ListProducts(ctx context.Context, afterID int64, limit int) ([]entities.Product, error)
+}
+
+type ListProductsUseCase struct {
+	persistenceGateway ListProductsUseCasePersistenceGateway
+}
+
+func NewListProductsUseCase(persistenceGateway ListProductsUseCasePersistenceGateway) *ListProductsUseCase {
+	return &ListProductsUseCase{persistenceGateway: persistenceGateway}
+}
+
+type ListProductsInput struct {
+	// PageSize defaults to DefaultPageSize and is capped at MaxPageSize
+	PageSize int
+	// PageToken is the NextPageToken of the previous page, empty for the first page
+	PageToken string
+}
+type ListProductsOutput struct {
+	Products []entities.Product
+	// NextPageToken lists the next page, and is empty on the last page
+	NextPageToken string
+}
+
+// ListProducts lists the catalog of the tenant. It fails with ErrInvalidPageToken if the page token is invalid.
+func (u *ListProductsUseCase) ListProducts(ctx context.Context, input ListProductsInput) (ListProductsOutput, error) {
+	pageSize := input.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+
+	var afterID int64
+	if input.PageToken != "" {
+		data, err := base64.RawURLEncoding.DecodeString(input.PageToken)
+		if err != nil {
+			return ListProductsOutput{}, ErrInvalidPageToken
+		}
+		if afterID, err = strconv.ParseInt(string(data), 10, 64); err != nil {
+			return ListProductsOutput{}, ErrInvalidPageToken
+		}
+	}
+
+	// one more product tells whether there is a next page
+	products, err := u.persistenceGateway.ListProducts(ctx, afterID, pageSize+1)
+	if err != nil {
+		return ListProductsOutput{}, err
+	}
+
+	output := ListProductsOutput{Products: products}
+	if len(products) > pageSize {
+		output.Products = products[:pageSize]
+		lastID := output.Products[pageSize-1].ID
+		output.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(lastID, 10)))
+	}
+
+	return output, nil
+}
@@ -0,0 +1,24 @@
+package product
+
+import "fmt"
+
+// InvalidProductError is returned for products that cannot be in the catalog
+type InvalidProductError struct {
+	Field  string
+	Reason string
+}
+
+func (e *InvalidProductError) Error() string {
+	return fmt.Sprintf("product %s %s", e.Field, e.Reason)
+}
+
+func validate(name string, price int64) error {
+	if name == "" {
+		return &InvalidProductError{Field: "name", Reason: "is required"}
+	}
+	if price <= 0 {
+		return &InvalidProductError{Field: "price", Reason: "must be positive"}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package product_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/domain/product"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProducts struct {
+	products []entities.Product
+}
+
+func (f *fakeProducts) CreateProduct(_ context.Context, p entities.Product) (entities.Product, error) {
+	p.ID = int64(len(f.products) + 1)
+	f.products = append(f.products, p)
+	return p, nil
+}
+
+func (f *fakeProducts) ListProducts(_ context.Context, afterID int64, limit int) ([]entities.Product, error) {
+	var products []entities.Product
+	for _, p := range f.products {
+		if p.ID > afterID && len(products) < limit {
+			products = append(products, p)
+		}
+	}
+	return products, nil
+}
+
+func TestCreateProductUseCase_Validates(t *testing.T) {
+	uc := product.NewCreateProductUseCase(&fakeProducts{})
+
+	var invalidErr *product.InvalidProductError
+	_, err := uc.CreateProduct(context.Background(), product.CreateProductInput{Price: 50})
+	require.ErrorAs(t, err, &invalidErr)
+	require.Equal(t, "name", invalidErr.Field)
+
+	_, err = uc.CreateProduct(context.Background(), product.CreateProductInput{Name: "book"})
+	require.ErrorAs(t, err, &invalidErr)
+	require.Equal(t, "price", invalidErr.Field)
+
+	created, err := uc.CreateProduct(context.Background(), product.CreateProductInput{Name: "book", Price: 50})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), created.Product.ID)
+}
+
+func TestListProductsUseCase_Pages(t *testing.T) {
+	products := &fakeProducts{}
+	create := product.NewCreateProductUseCase(products)
+	for _, name := range []string{"book", "pen", "lamp"} {
+		_, err := create.CreateProduct(context.Background(), product.CreateProductInput{Name: name, Price: 10})
+		require.NoError(t, err)
+	}
+	uc := product.NewListProductsUseCase(products)
+
+	first, err := uc.ListProducts(context.Background(), product.ListProductsInput{PageSize: 2})
+	require.NoError(t, err)
+	require.Len(t, first.Products, 2)
+	require.NotEmpty(t, first.NextPageToken)
+
+	last, err := uc.ListProducts(context.Background(), product.ListProductsInput{PageSize: 2, PageToken: first.NextPageToken})
+	require.NoError(t, err)
+	require.Len(t, last.Products, 1)
+	require.Equal(t, "lamp", last.Products[0].Name)
+	require.Empty(t, last.NextPageToken)
+
+	_, err = uc.ListProducts(context.Background(), product.ListProductsInput{PageToken: "not-a-token"})
+	require.ErrorIs(t, err, product.ErrInvalidPageToken)
+}
@@ -0,0 +1,45 @@
+package product
+
+import (
+	"context"
+
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+)
+
+type UpdateProductUseCasePersistenceGateway interface {
+	// UpdateProduct saves the name and the price of the product. It fails with domain.ErrNotFound if the tenant has
+	// no such product.
+	UpdateProduct(ctx context.Context, product entities.Product) (entities.Product, error)
+}
+
+type UpdateProductUseCase struct {
+	persistenceGateway UpdateProductUseCasePersistenceGateway
+}
+
+func NewUpdateProductUseCase(persistenceGateway UpdateProductUseCasePersistenceGateway) *UpdateProductUseCase {
+	return &UpdateProductUseCase{persistenceGateway: persistenceGateway}
+}
+
+type UpdateProductInput struct {
+	ProductID int64
+	Name      string
+	Price     int64
+}
+type UpdateProductOutput struct {
+	Product entities.Product
+}
+
+// UpdateProduct fails with an *InvalidProductError unless the product has a name and a positive price.
+// Orders keep the prices their items were ordered at.
+func (u *UpdateProductUseCase) UpdateProduct(ctx context.Context, input UpdateProductInput) (UpdateProductOutput, error) {
+	if err := validate(input.Name, input.Price); err != nil {
+		return UpdateProductOutput{}, err
+	}
+
+	product, err := u.persistenceGateway.UpdateProduct(ctx, entities.Product{ID: input.ProductID, Name: input.Name, Price: input.Price})
+	if err != nil {
+		return UpdateProductOutput{}, err
+	}
+
+	return UpdateProductOutput{Product: product}, nil
+}
@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+)
+
+// ErrResourceLocked is matched by errors.Is when an operation conflicts with a saga owning the resource
+var ErrResourceLocked = errors.New("resource is locked by a running saga")
+
+// LockedError is returned when a resource is owned by another saga
+type LockedError struct {
+	Resource string
+	ID       int64
+	Owner    string
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s %d is locked by saga %s", e.Resource, e.ID, e.Owner)
+}
+
+func (e *LockedError) Is(target error) bool {
+	return target == ErrResourceLocked
+}
+
+// SemanticLocker persists semantic locks: a flag on a record telling it is owned by a running saga,
+// so other operations do not act on it while it is only partially built or undone.
+type SemanticLocker interface {
+	// Lock marks the resource as owned by owner. It returns a *LockedError if another owner has it.
+	Lock(ctx context.Context, id int64, owner string) error
+	// Unlock releases the resource if owner has it. Releasing a resource that is not locked is a no-op.
+	Unlock(ctx context.Context, id int64, owner string) error
+	// LockOwner returns the owner of the resource, or an empty string if it is not locked.
+	// It fails with ErrNotFound if the tenant has no such resource.
+	LockOwner(ctx context.Context, id int64) (string, error)
+}
+
+// LockForSaga locks the resource on behalf of the saga instance the step runs in
+func LockForSaga(ctx context.Context, locker SemanticLocker, id int64) error {
+	return locker.Lock(ctx, id, saga.InstanceID(ctx))
+}
+
+// UnlockForSaga releases the lock taken by LockForSaga. It must be called both when the saga completes
+// and when it is compensated.
+func UnlockForSaga(ctx context.Context, locker SemanticLocker, id int64) error {
+	return locker.Unlock(ctx, id, saga.InstanceID(ctx))
+}
+
+// EnsureUnlocked rejects an operation on a resource owned by a saga with a *LockedError
+func EnsureUnlocked(ctx context.Context, locker SemanticLocker, resource string, id int64) error {
+	owner, err := locker.LockOwner(ctx, id)
+	if err != nil {
+		return err
+	}
+	if owner != "" {
+		return &LockedError{Resource: resource, ID: id, Owner: owner}
+	}
+
+	return nil
+}
+
+// WaitUnlocked queues an operation on a resource until the saga owning it is done, checking it every interval.
+// It gives up with the context error once ctx is done.
+func WaitUnlocked(ctx context.Context, locker SemanticLocker, id int64, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		owner, err := locker.LockOwner(ctx, id)
+		if err != nil {
+			return err
+		}
+		if owner == "" {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Package circuitbreaker stops calling a downstream service that keeps failing, so callers fail fast
+// instead of waiting for it, and lets trial calls through after a while to detect its recovery.
+package circuitbreaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type State int
+
+const (
+	// Closed lets every call through
+	Closed State = iota
+	// Open rejects every call until the open timeout is over
+	Open
+	// HalfOpen lets a single trial call through at a time to check whether the downstream recovered
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// ErrOpen is matched by errors.Is on every error returned while the breaker rejects calls
+var ErrOpen = errors.New("circuit breaker is open")
+
+// OpenError is returned instead of calling the downstream while the breaker is open
+type OpenError struct {
+	Name  string
+	Until time.Time
+}
+
+func (e *OpenError) Error() string {
+	if e.Until.IsZero() {
+		return fmt.Sprintf("%s circuit breaker is open, a trial call is already in flight", e.Name)
+	}
+
+	return fmt.Sprintf("%s circuit breaker is open, calls are rejected until %s", e.Name, e.Until.Format(time.RFC3339))
+}
+
+func (e *OpenError) Is(target error) bool {
+	return target == ErrOpen
+}
+
+type Settings struct {
+	// Name identifies the downstream in errors and logs
+	Name string
+	// FailureThreshold is the number of consecutive failures that opens the breaker. Defaults to 5.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before letting trial calls through. Defaults to 30s.
+	OpenTimeout time.Duration
+	// SuccessThreshold is the number of consecutive successful trial calls that closes the breaker again. Defaults to 1.
+	SuccessThreshold int
+	// IsFailure tells which errors count as failures of the downstream. Defaults to every non-nil error.
+	IsFailure func(err error) bool
+	Logger    *zap.Logger
+}
+
+type Breaker struct {
+	settings Settings
+	now      func() time.Time
+
+	mu        sync.Mutex
+	state     State
+	failures  int
+	successes int
+	openUntil time.Time
+	// trial is true while a half-open trial call is in flight
+	trial bool
+	// generation changes with every state transition, so the results of calls admitted in a previous state,
+	// e.g. a slow call admitted while closed that returns during a half-open trial, are ignored
+	generation uint64
+}
+
+func New(s Settings) *Breaker {
+	if s.FailureThreshold <= 0 {
+		s.FailureThreshold = 5
+	}
+	if s.OpenTimeout <= 0 {
+		s.OpenTimeout = 30 * time.Second
+	}
+	if s.SuccessThreshold <= 0 {
+		s.SuccessThreshold = 1
+	}
+	if s.IsFailure == nil {
+		s.IsFailure = func(err error) bool { return err != nil }
+	}
+	if s.Logger == nil {
+		s.Logger = zap.L()
+	}
+
+	return &Breaker{
+		settings: s,
+		now:      time.Now,
+	}
+}
+
+// Execute calls f unless the breaker is open, in which case it returns an *OpenError right away.
+// A panic of f counts as a failure, and is propagated.
+func (b *Breaker) Execute(f func() error) (err error) {
+	generation, err := b.before()
+	if err != nil {
+		return err
+	}
+
+	// recorded even if f panics, so a panicking trial call does not leave the breaker half-open forever
+	panicked := true
+	defer func() {
+		b.after(generation, err, panicked)
+	}()
+	err = f()
+	panicked = false
+
+	return err
+}
+
+// State returns the current state of the breaker
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && !b.now().Before(b.openUntil) {
+		return HalfOpen
+	}
+
+	return b.state
+}
+
+// before admits a call, and returns the generation it was admitted in
+func (b *Breaker) before() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if b.now().Before(b.openUntil) {
+			return 0, &OpenError{Name: b.settings.Name, Until: b.openUntil}
+		}
+		b.transition(HalfOpen)
+		b.trial = true
+	case HalfOpen:
+		if b.trial {
+			return 0, &OpenError{Name: b.settings.Name}
+		}
+		b.trial = true
+	}
+
+	return b.generation, nil
+}
+
+// after records the result of a call admitted in generation, unless the breaker changed state since
+func (b *Breaker) after(generation uint64, err error, panicked bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	failed := panicked || err != nil && b.settings.IsFailure(err)
+	switch b.state {
+	case HalfOpen:
+		b.trial = false
+		if failed {
+			b.open()
+			return
+		}
+		b.successes++
+		if b.successes >= b.settings.SuccessThreshold {
+			b.transition(Closed)
+		}
+	case Closed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.settings.FailureThreshold {
+			b.open()
+		}
+	}
+}
+
+func (b *Breaker) open() {
+	b.openUntil = b.now().Add(b.settings.OpenTimeout)
+	b.transition(Open)
+}
+
+// transition must be called with b.mu held
+func (b *Breaker) transition(to State) {
+	from := b.state
+	b.state = to
+	b.generation++
+	b.failures = 0
+	b.successes = 0
+
+	fields := []zap.Field{
+		zap.String("breaker", b.settings.Name),
+		zap.String("from", from.String()),
+		zap.String("to", to.String()),
+	}
+	if to == Open {
+		b.settings.Logger.Warn("circuit breaker opened", append(fields, zap.Time("until", b.openUntil))...)
+		return
+	}
+	b.settings.Logger.Info("circuit breaker state changed", fields...)
+}
+
+// IsGRPCFailure tells whether a gRPC error means the downstream is unhealthy, as opposed to
+// a business error such as NotFound or InvalidArgument, which must not open the breaker
+func IsGRPCFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown:
+		return true
+	default:
+		return false
+	}
+}
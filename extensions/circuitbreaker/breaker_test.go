@@ -0,0 +1,130 @@
+package circuitbreaker_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/circuitbreaker"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBreaker_OpensAndRecovers(t *testing.T) {
+	breaker := circuitbreaker.New(circuitbreaker.Settings{
+		Name:             "payments",
+		FailureThreshold: 2,
+		OpenTimeout:      20 * time.Millisecond,
+		Logger:           zap.NewNop(),
+	})
+	downstreamErr := errors.New("unavailable")
+	calls := 0
+	failing := func() error {
+		calls++
+		return downstreamErr
+	}
+
+	require.ErrorIs(t, breaker.Execute(failing), downstreamErr)
+	require.Equal(t, circuitbreaker.Closed, breaker.State())
+	require.ErrorIs(t, breaker.Execute(failing), downstreamErr)
+	require.Equal(t, circuitbreaker.Open, breaker.State())
+
+	// fails fast without calling the downstream
+	err := breaker.Execute(failing)
+	require.ErrorIs(t, err, circuitbreaker.ErrOpen)
+	require.Contains(t, err.Error(), "payments circuit breaker is open")
+	require.Equal(t, 2, calls)
+
+	// a failed trial call opens it again
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, circuitbreaker.HalfOpen, breaker.State())
+	require.ErrorIs(t, breaker.Execute(failing), downstreamErr)
+	require.Equal(t, circuitbreaker.Open, breaker.State())
+
+	// a successful trial call closes it
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, breaker.Execute(func() error { return nil }))
+	require.Equal(t, circuitbreaker.Closed, breaker.State())
+}
+
+func TestBreaker_IgnoresCallsAdmittedBeforeTheTrial(t *testing.T) {
+	breaker := circuitbreaker.New(circuitbreaker.Settings{
+		Name:             "payments",
+		FailureThreshold: 1,
+		OpenTimeout:      20 * time.Millisecond,
+		Logger:           zap.NewNop(),
+	})
+	downstreamErr := errors.New("unavailable")
+
+	// a slow call admitted while closed
+	slowStarted, slowDone, slowReturned := make(chan struct{}), make(chan struct{}), make(chan error)
+	go func() {
+		slowReturned <- breaker.Execute(func() error {
+			close(slowStarted)
+			<-slowDone
+			return nil
+		})
+	}()
+	<-slowStarted
+	require.ErrorIs(t, breaker.Execute(func() error { return downstreamErr }), downstreamErr)
+	require.Equal(t, circuitbreaker.Open, breaker.State())
+
+	time.Sleep(20 * time.Millisecond)
+	trialStarted, trialDone, trialReturned := make(chan struct{}), make(chan struct{}), make(chan error)
+	go func() {
+		trialReturned <- breaker.Execute(func() error {
+			close(trialStarted)
+			<-trialDone
+			return downstreamErr
+		})
+	}()
+	<-trialStarted
+
+	// the slow call neither ends the trial nor closes the breaker
+	close(slowDone)
+	require.NoError(t, <-slowReturned)
+	require.Equal(t, circuitbreaker.HalfOpen, breaker.State())
+	require.ErrorIs(t, breaker.Execute(func() error { return nil }), circuitbreaker.ErrOpen)
+
+	close(trialDone)
+	require.ErrorIs(t, <-trialReturned, downstreamErr)
+	require.Equal(t, circuitbreaker.Open, breaker.State())
+}
+
+func TestBreaker_IgnoresBusinessErrors(t *testing.T) {
+	breaker := circuitbreaker.New(circuitbreaker.Settings{
+		Name:             "deliveries",
+		FailureThreshold: 1,
+		IsFailure:        circuitbreaker.IsGRPCFailure,
+		Logger:           zap.NewNop(),
+	})
+
+	_ = breaker.Execute(func() error { return status.Error(codes.InvalidArgument, "invalid order") })
+	require.Equal(t, circuitbreaker.Closed, breaker.State())
+
+	_ = breaker.Execute(func() error { return status.Error(codes.Unavailable, "connection refused") })
+	require.Equal(t, circuitbreaker.Open, breaker.State())
+}
+
+func TestBreaker_PanickingTrialReopens(t *testing.T) {
+	breaker := circuitbreaker.New(circuitbreaker.Settings{
+		Name:             "payments",
+		FailureThreshold: 1,
+		OpenTimeout:      20 * time.Millisecond,
+		Logger:           zap.NewNop(),
+	})
+	require.Error(t, breaker.Execute(func() error { return errors.New("unavailable") }))
+
+	time.Sleep(20 * time.Millisecond)
+	require.Panics(t, func() {
+		_ = breaker.Execute(func() error { panic("boom") })
+	})
+	require.Equal(t, circuitbreaker.Open, breaker.State())
+
+	// the next trial is let through once the breaker timed out again
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, breaker.Execute(func() error { return nil }))
+	require.Equal(t, circuitbreaker.Closed, breaker.State())
+}
@@ -0,0 +1,98 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+)
+
+// ErrDuplicateBusinessKey is returned by KeyStore.CreateInstance when the saga already has an instance with the
+// same business key for the same tenant
+var ErrDuplicateBusinessKey = errors.New("saga business key already taken")
+
+// KeyStore is a Store that indexes instances by business key, e.g. an order reference or a cart id, so a saga is
+// executed only once per key. Keys are unique per tenant and saga name, across versions.
+// CreateInstance must fail with ErrDuplicateBusinessKey when the key of the instance is taken.
+type KeyStore interface {
+	Store
+	// GetInstanceByKey returns the instance of the saga with the business key for the tenant, or
+	// ErrInstanceNotFound if there is none
+	GetInstanceByKey(ctx context.Context, tenantID, sagaName, key string) (Instance, error)
+}
+
+// StartWithKey starts the saga as Start does, unless it already has an instance with the business key for the
+// tenant of ctx, in which case it returns the outcome of that instance instead of running the saga again:
+// its result once completed, its *ExecutionError once compensated, or the instance once suspended. If the instance
+// is running, e.g. on another replica, it waits for the run to stop, polling every AwaitInterval until ctx is done.
+// The payload is ignored then. It fails if the Store is not a KeyStore.
+func (e *Executor) StartWithKey(ctx context.Context, name string, key string, payload interface{}) (Instance, error) {
+	if e.keys == nil {
+		return Instance{}, errors.New("saga store does not index business keys")
+	}
+	if key == "" {
+		return Instance{}, errors.New("saga business key must not be empty")
+	}
+
+	existing, err := e.keys.GetInstanceByKey(ctx, tenant.ID(ctx), name, key)
+	if err == nil {
+		return e.attach(ctx, existing)
+	}
+	if !errors.Is(err, ErrInstanceNotFound) {
+		return Instance{}, fmt.Errorf("loading saga instance with business key %q: %w", key, err)
+	}
+
+	instance, err := e.start(ctx, name, key, payload)
+	if !errors.Is(err, ErrDuplicateBusinessKey) {
+		return instance, err
+	}
+
+	// a concurrent call created the instance first
+	existing, err = e.keys.GetInstanceByKey(ctx, tenant.ID(ctx), name, key)
+	if err != nil {
+		return Instance{}, fmt.Errorf("loading saga instance with business key %q: %w", key, err)
+	}
+
+	return e.attach(ctx, existing)
+}
+
+// attach waits until the run of an instance in progress stops, and returns the instance as Start would have.
+// With a LeaseStore, an instance whose run stopped without releasing it, e.g. because its replica crashed, is
+// resumed once its lease expired rather than awaited forever.
+func (e *Executor) attach(ctx context.Context, instance Instance) (Instance, error) {
+	for instance.Status == StatusRunning || instance.Status == StatusCompensating {
+		if e.leases != nil && abandoned(instance.Lease, e.clock.Now()) {
+			resumed, err := e.Resume(ctx, instance.ID)
+			// another replica claimed it first
+			if !errors.Is(err, ErrLeaseLost) {
+				return resumed, err
+			}
+		}
+
+		timer := time.NewTimer(e.awaitInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return Instance{}, fmt.Errorf("awaiting saga instance %s: %w", instance.ID, ctx.Err())
+		case <-timer.C:
+		}
+
+		latest, err := e.store.GetInstance(ctx, instance.ID)
+		if err != nil {
+			return Instance{}, fmt.Errorf("awaiting saga instance %s: %w", instance.ID, err)
+		}
+		instance = latest
+	}
+
+	instance, err := e.decode(ctx, instance)
+	if err != nil {
+		return instance, err
+	}
+	if instance.Status == StatusCompensated {
+		return instance, newExecutionError(instance, nil)
+	}
+
+	return instance, nil
+}
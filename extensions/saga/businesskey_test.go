@@ -0,0 +1,153 @@
+package saga_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/saga/sagatest"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecutor_StartWithKey_ReturnsTheStoredResult(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	executor, _, _ := newExecutor(t, rec.Wrap(saga.NewVersionedSaga("checkout", 1, []saga.Step{sagatest.Step("charge", "receipt")})))
+
+	first, err := executor.StartWithKey(tenantCtx(), "checkout", "cart-1", nil)
+	require.NoError(t, err)
+	again, err := executor.StartWithKey(tenantCtx(), "checkout", "cart-1", nil)
+	require.NoError(t, err)
+
+	require.Equal(t, first.ID, again.ID)
+	require.Equal(t, saga.StatusCompleted, again.Status)
+	require.Equal(t, "receipt", again.Payload)
+	require.Equal(t, "cart-1", again.BusinessKey)
+	rec.AssertCommands(t, "charge")
+}
+
+func TestExecutor_StartWithKey_ReturnsTheStoredFailure(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	s := rec.Wrap(saga.NewVersionedSaga("checkout", 1, []saga.Step{sagatest.Step("charge", "receipt")}),
+		sagatest.FailStep(0, 1, errors.New("card declined")))
+	executor, _, _ := newExecutor(t, s)
+
+	_, err := executor.StartWithKey(tenantCtx(), "checkout", "cart-1", nil)
+	require.Error(t, err)
+	instance, err := executor.StartWithKey(tenantCtx(), "checkout", "cart-1", nil)
+
+	var execErr *saga.ExecutionError
+	require.ErrorAs(t, err, &execErr)
+	require.EqualError(t, execErr.Unwrap(), "card declined")
+	require.Equal(t, saga.StatusCompensated, instance.Status)
+	rec.AssertCommands(t, "charge")
+}
+
+func TestExecutor_StartWithKey_AttachesToRunningInstances(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	runs := 0
+	s := saga.NewVersionedSaga("checkout", 1, []saga.Step{{
+		Name: "charge",
+		Command: func(ctx context.Context) (interface{}, error) {
+			runs++
+			close(started)
+			<-release
+			return "receipt", nil
+		},
+	}})
+	registry := saga.NewRegistry()
+	require.NoError(t, registry.Register(s))
+	executor := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: saga.NewMemoryStore(), AwaitInterval: time.Millisecond})
+
+	firstDone := make(chan saga.Instance)
+	go func() {
+		instance, _ := executor.StartWithKey(tenantCtx(), "checkout", "cart-1", nil)
+		firstDone <- instance
+	}()
+	<-started
+
+	attachedDone := make(chan saga.Instance)
+	var attachErr error
+	go func() {
+		instance, err := executor.StartWithKey(tenantCtx(), "checkout", "cart-1", nil)
+		attachErr = err
+		attachedDone <- instance
+	}()
+	close(release)
+
+	first, attached := <-firstDone, <-attachedDone
+	require.NoError(t, attachErr)
+	require.Equal(t, first.ID, attached.ID)
+	require.Equal(t, saga.StatusCompleted, attached.Status)
+	require.Equal(t, "receipt", attached.Payload)
+	require.Equal(t, 1, runs)
+}
+
+func TestExecutor_StartWithKey_StopsAwaitingWithTheContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	s := saga.NewVersionedSaga("checkout", 1, []saga.Step{{
+		Name: "charge",
+		Command: func(ctx context.Context) (interface{}, error) {
+			<-release
+			return nil, nil
+		},
+	}})
+	executor, _, store := newExecutor(t, s)
+	go executor.StartWithKey(tenantCtx(), "checkout", "cart-1", nil) //nolint:errcheck
+	require.Eventually(t, func() bool {
+		_, err := store.GetInstanceByKey(tenantCtx(), "acme", "checkout", "cart-1")
+		return err == nil
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(tenantCtx(), 10*time.Millisecond)
+	defer cancel()
+	_, err := executor.StartWithKey(ctx, "checkout", "cart-1", nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestExecutor_StartWithKey_KeysAreScopedToTenants(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	executor, _, _ := newExecutor(t, rec.Wrap(saga.NewVersionedSaga("checkout", 1, []saga.Step{sagatest.Step("charge", "receipt")})))
+
+	acme, err := executor.StartWithKey(tenant.WithID(context.Background(), "acme"), "checkout", "cart-1", nil)
+	require.NoError(t, err)
+	globex, err := executor.StartWithKey(tenant.WithID(context.Background(), "globex"), "checkout", "cart-1", nil)
+	require.NoError(t, err)
+
+	require.NotEqual(t, acme.ID, globex.ID)
+	rec.AssertCommands(t, "charge", "charge")
+}
+
+func TestExecutor_StartWithKey_ResumesInstancesWhoseRunCrashed(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	registry := saga.NewRegistry()
+	require.NoError(t, registry.Register(rec.Wrap(saga.NewVersionedSaga("checkout", 1, []saga.Step{sagatest.Step("charge", "receipt")}))))
+	store := saga.NewMemoryStore()
+	clock := sagatest.NewFakeClock(time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC))
+	executor := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: store, Clock: clock, AwaitInterval: time.Millisecond})
+	ctx := tenant.WithID(context.Background(), "acme")
+
+	// the replica running it crashed before the first step, leaving its lease to expire
+	require.NoError(t, store.CreateInstance(ctx, saga.Instance{
+		ID: "crashed", SagaName: "checkout", SagaVersion: 1, Tenant: "acme", BusinessKey: "cart-1", Status: saga.StatusRunning,
+		Lease: saga.Lease{Owner: "gone", ExpiresAt: clock.Now().Add(time.Minute)}, CreatedAt: clock.Now(),
+	}))
+
+	// it is awaited while its lease holds
+	awaitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err := executor.StartWithKey(awaitCtx, "checkout", "cart-1", nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	rec.AssertCommands(t)
+
+	clock.Advance(2 * time.Minute)
+	instance, err := executor.StartWithKey(ctx, "checkout", "cart-1", nil)
+	require.NoError(t, err)
+	require.Equal(t, "crashed", instance.ID)
+	require.Equal(t, saga.StatusCompleted, instance.Status)
+	require.Equal(t, "receipt", instance.Payload)
+	rec.AssertCommands(t, "charge")
+}
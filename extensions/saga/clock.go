@@ -0,0 +1,14 @@
+package saga
+
+import "time"
+
+// Clock tells the time to the Executor, so tests can control when timers fire and leases expire
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,58 @@
+package saga
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec serializes saga payloads so they can be persisted and decoded back into their concrete type on recovery
+type Codec interface {
+	// Name is stored with every payload, so it can be decoded with the same codec
+	Name() string
+	Encode(v interface{}) ([]byte, error)
+	// Decode fills target, a pointer to a new value of the registered type,
+	// or a new value of it when the registered type is itself a pointer, e.g. a protobuf message
+	Decode(data []byte, target interface{}) error
+}
+
+// JSONCodec encodes payloads with encoding/json. Only exported fields are persisted.
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string {
+	return "json"
+}
+
+func (JSONCodec) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Decode(data []byte, target interface{}) error {
+	return json.Unmarshal(data, target)
+}
+
+// ProtoCodec encodes protobuf messages in their binary wire format
+type ProtoCodec struct{}
+
+func (ProtoCodec) Name() string {
+	return "proto"
+}
+
+func (ProtoCodec) Encode(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a protobuf message", v)
+	}
+
+	return proto.Marshal(m)
+}
+
+func (ProtoCodec) Decode(data []byte, target interface{}) error {
+	m, ok := target.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T is not a protobuf message", target)
+	}
+
+	return proto.Unmarshal(data, m)
+}
@@ -0,0 +1,109 @@
+package saga_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/saga/sagatest"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type reservation struct {
+	OrderID int64
+	Items   []string
+}
+
+func TestRegistry_Register_RequiresPayloadTypes(t *testing.T) {
+	registry := saga.NewRegistry()
+	step := sagatest.Step("reserve", reservation{})
+	step.Output = reservation{}
+	s := saga.NewVersionedSaga("checkout", 1, []saga.Step{step})
+
+	require.EqualError(t, registry.Register(s),
+		`output of step 0 of saga "checkout" version 1: payload type saga_test.reservation is not registered`)
+
+	require.NoError(t, registry.RegisterPayloadType("reservation", reservation{}, saga.JSONCodec{}))
+	require.NoError(t, registry.Register(s))
+}
+
+func TestRegistry_RegisterPayloadType_ChecksTheCodec(t *testing.T) {
+	registry := saga.NewRegistry()
+
+	require.Error(t, registry.RegisterPayloadType("reservation", reservation{}, saga.ProtoCodec{}))
+	require.Error(t, registry.RegisterPayloadType("channel", make(chan int), saga.JSONCodec{}))
+
+	require.NoError(t, registry.RegisterPayloadType("reservation", reservation{}, saga.JSONCodec{}))
+	require.Error(t, registry.RegisterPayloadType("reservation", &reservation{}, saga.JSONCodec{}))
+	require.Error(t, registry.RegisterPayloadType("other-reservation", reservation{}, saga.JSONCodec{}))
+}
+
+func TestRegistry_Payloads_RoundTrip(t *testing.T) {
+	registry := saga.NewRegistry()
+	require.NoError(t, registry.RegisterPayloadType("reservation", reservation{}, saga.JSONCodec{}))
+	require.NoError(t, registry.RegisterPayloadType("sku", &wrapperspb.StringValue{}, saga.ProtoCodec{}))
+
+	owner := saga.PayloadOwner{InstanceID: "i-1"}
+	for _, payload := range []interface{}{
+		reservation{OrderID: 1, Items: []string{"book"}},
+		wrapperspb.String("book-123"),
+	} {
+		encoded, err := registry.EncodePayload(tenantCtx(), owner, payload)
+		require.NoError(t, err)
+		require.IsType(t, saga.EncodedPayload{}, encoded)
+
+		decoded, err := registry.DecodePayload(tenantCtx(), owner, encoded)
+		require.NoError(t, err)
+		require.IsType(t, payload, decoded)
+		if m, ok := payload.(proto.Message); ok {
+			require.True(t, proto.Equal(m, decoded.(proto.Message)))
+		} else {
+			require.Equal(t, payload, decoded)
+		}
+	}
+
+	// unregistered payloads are left as they are
+	encoded, err := registry.EncodePayload(tenantCtx(), owner, 42)
+	require.NoError(t, err)
+	require.Equal(t, 42, encoded)
+}
+
+func TestExecutor_Recover_DecodesPayloads(t *testing.T) {
+	var resumedWith interface{}
+	reserve := sagatest.Step("reserve", reservation{OrderID: 1, Items: []string{"book"}})
+	reserve.Output = reservation{}
+	confirm := saga.Step{
+		Name: "confirm",
+		Command: func(ctx context.Context) (interface{}, error) {
+			resumedWith = ctx.Value(saga.ParamKey)
+			return nil, nil
+		},
+		CompensationCommand: func(ctx context.Context) (interface{}, error) { return nil, nil },
+	}
+	clock := sagatest.NewFakeClock(time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC))
+	store := saga.NewMemoryStore()
+	registry := saga.NewRegistry()
+	require.NoError(t, registry.RegisterPayloadType("reservation", reservation{}, saga.JSONCodec{}))
+	require.NoError(t, registry.Register(saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		reserve, saga.Sleep("wait", time.Minute), confirm,
+	})))
+	executor := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: store, Clock: clock})
+
+	instance, err := executor.Start(tenantCtx(), "checkout", nil)
+	require.NoError(t, err)
+	require.Equal(t, reservation{OrderID: 1, Items: []string{"book"}}, instance.Payload)
+
+	stored, err := store.GetInstance(tenantCtx(), instance.ID)
+	require.NoError(t, err)
+	require.Equal(t, saga.EncodedPayload{Type: "reservation", Codec: "json", Data: []byte(`{"OrderID":1,"Items":["book"]}`)}, stored.Payload)
+
+	clock.Advance(time.Minute)
+	results, err := executor.Recover(tenantCtx())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Err)
+	require.Equal(t, reservation{OrderID: 1, Items: []string{"book"}}, resumedWith)
+}
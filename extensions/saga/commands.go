@@ -0,0 +1,181 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+)
+
+// Reply is the output of a command step: the payload of the reply to its command
+type Reply struct {
+	Payload json.RawMessage
+}
+
+// Decode unmarshals the reply payload into target
+func (r Reply) Decode(target interface{}) error {
+	return json.Unmarshal(r.Payload, target)
+}
+
+// CommandError fails a command step whose command was rejected by the service handling it, which compensates the saga
+type CommandError struct {
+	Step    string
+	Message string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("command of step %s was rejected: %s", e.Step, e.Message)
+}
+
+// RejectedError is returned by command handlers to reply with a failure. Other errors leave the command
+// to be delivered again, as they are expected to be transient.
+type RejectedError struct {
+	Err error
+}
+
+func (e *RejectedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RejectedError) Unwrap() error {
+	return e.Err
+}
+
+// Reject makes a command handler reply with err rather than have the command delivered again
+func Reject(err error) error {
+	return &RejectedError{Err: err}
+}
+
+// Commands builds steps orchestrating other services through a Transport rather than synchronous calls,
+// so a saga waiting for a service that is down holds no connection and survives restarts.
+type Commands struct {
+	transport Transport
+	replyTo   string
+}
+
+// NewCommands creates steps sending their commands through transport, and asking for replies on replyTo,
+// which must be consumed with Executor.HandleReply
+func NewCommands(transport Transport, replyTo string) *Commands {
+	return &Commands{transport: transport, replyTo: replyTo}
+}
+
+// Step returns a step sending the command built by command to destination, then suspending the instance until
+// the reply arrives, as the signal ReplySignalPrefix+name. Its output is a Reply. If the command is rejected the step
+// fails with a *CommandError, and if timeout is positive and no reply arrives in time, with a *SignalTimeoutError.
+// The compensation does nothing; set CompensationCommand to send a compensating command, see Compensation.
+func (c *Commands) Step(name, destination, commandType string, command func(ctx context.Context) (interface{}, error), timeout time.Duration) Step {
+	step := WaitForSignal(name, ReplySignalPrefix+name, timeout)
+	step.Output = Reply{}
+	step.Command = func(ctx context.Context) (interface{}, error) {
+		payload, err := command(ctx)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("encoding %s command: %w", commandType, err)
+		}
+
+		return nil, c.transport.Send(ctx, Message{
+			ID:          InstanceID(ctx) + "/" + name,
+			Destination: destination,
+			Type:        commandType,
+			InstanceID:  InstanceID(ctx),
+			Step:        name,
+			ReplyTo:     c.replyTo,
+			Tenant:      tenant.ID(ctx),
+			Payload:     data,
+		})
+	}
+
+	return step
+}
+
+// Compensation returns a CompensationCommand sending the command built by command to destination, without waiting
+// for its reply, which Executor.HandleReply drops. The transport delivers it until it is handled, even while the
+// service is down, so the compensation only fails if the command cannot be queued. Nothing is sent when command
+// returns a nil payload, e.g. when the step failed before it had anything to undo.
+func (c *Commands) Compensation(name, destination, commandType string, command func(ctx context.Context) (interface{}, error)) func(ctx context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		payload, err := command(ctx)
+		if err != nil || payload == nil {
+			return nil, err
+		}
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("encoding %s command: %w", commandType, err)
+		}
+
+		return nil, c.transport.Send(ctx, Message{
+			ID:          InstanceID(ctx) + "/" + name + "/compensation",
+			Destination: destination,
+			Type:        commandType,
+			InstanceID:  InstanceID(ctx),
+			Step:        name,
+			ReplyTo:     c.replyTo,
+			Tenant:      tenant.ID(ctx),
+			Payload:     data,
+		})
+	}
+}
+
+// HandleReply resumes the instance waiting for the reply to a command sent by a Commands step.
+// Replies to instances that no longer wait for them, e.g. duplicates or replies arriving after a timeout,
+// are dropped. It fails with ErrLeaseLost while the instance is still owned by another replica, e.g. when the
+// reply arrives before the step that sent the command returned, so the transport delivers the reply again later.
+func (e *Executor) HandleReply(ctx context.Context, reply Message) error {
+	sig := &signal{name: ReplySignalPrefix + reply.Step, payload: Reply{Payload: reply.Payload}}
+	if reply.Error != "" {
+		sig.err = &CommandError{Step: reply.Step, Message: reply.Error}
+	}
+
+	// a reply only reaches an instance of the tenant its command was sent for
+	if reply.Tenant != "" {
+		ctx = tenant.WithID(ctx, reply.Tenant)
+	}
+	_, err := e.deliver(ctx, reply.InstanceID, sig)
+	var execErr *ExecutionError
+	if errors.Is(err, ErrNotWaitingForSignal) || errors.Is(err, ErrInstanceNotFound) || errors.As(err, &execErr) {
+		return nil
+	}
+
+	return err
+}
+
+// ServeCommands handles the commands sent to destination until ctx is done, and replies to them with the output
+// of handle. Commands handle rejects with Reject get a failed reply, and commands it fails on otherwise are
+// delivered again. Commands can be delivered more than once, so handle must be idempotent, e.g. using Message.ID.
+// handle runs on behalf of the tenant of the command.
+func ServeCommands(ctx context.Context, transport Transport, destination string, handle func(ctx context.Context, command Message) (interface{}, error)) error {
+	return transport.Receive(ctx, destination, func(ctx context.Context, command Message) error {
+		reply := Message{
+			ID:          command.ID,
+			Destination: command.ReplyTo,
+			Type:        command.Type,
+			InstanceID:  command.InstanceID,
+			Step:        command.Step,
+			Tenant:      command.Tenant,
+		}
+		if command.Tenant != "" {
+			ctx = tenant.WithID(ctx, command.Tenant)
+		}
+
+		output, err := handle(ctx, command)
+		var rejected *RejectedError
+		switch {
+		case errors.As(err, &rejected):
+			reply.Error = rejected.Error()
+		case err != nil:
+			return err
+		default:
+			if reply.Payload, err = json.Marshal(output); err != nil {
+				return fmt.Errorf("encoding reply to %s command: %w", command.Type, err)
+			}
+		}
+
+		return transport.Send(ctx, reply)
+	})
+}
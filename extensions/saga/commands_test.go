@@ -0,0 +1,250 @@
+package saga_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/saga/sagatest"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+	"github.com/stretchr/testify/require"
+)
+
+type chargeCommand struct {
+	OrderID int64
+}
+
+type chargeReply struct {
+	PaymentID int64
+}
+
+func newCommandExecutor(t *testing.T, transport saga.Transport, rec *sagatest.Recorder) *saga.Executor {
+	commands := saga.NewCommands(transport, "orders.replies")
+	charge := commands.Step("charge", "payments.commands", "payments.Charge", func(ctx context.Context) (interface{}, error) {
+		return chargeCommand{OrderID: 42}, nil
+	}, time.Hour)
+	registry := saga.NewRegistry()
+	// replies are sensitive
+	registry.SetKeyProvider(newKeys(t, "k1", "k1"))
+	require.NoError(t, registry.Register(rec.Wrap(saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		sagatest.Step("create-order", nil),
+		charge,
+		{
+			Name: "confirm",
+			Command: func(ctx context.Context) (interface{}, error) {
+				var reply chargeReply
+				err := ctx.Value(saga.ParamKey).(saga.Reply).Decode(&reply)
+				return reply.PaymentID, err
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) { return nil, nil },
+		},
+	}))))
+
+	return saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: saga.NewMemoryStore()})
+}
+
+// serve runs f in the background until the test ends
+func serve(t *testing.T, f func(ctx context.Context) error) {
+	ctx, cancel := context.WithCancel(tenantCtx())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = f(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func waitForStatus(t *testing.T, executor *saga.Executor, id string, status saga.Status) saga.Instance {
+	var instance saga.Instance
+	require.Eventually(t, func() bool {
+		var err error
+		instance, err = executor.Get(tenant.WithSystem(context.Background()), id)
+		require.NoError(t, err)
+		return instance.Status == status
+	}, time.Second, time.Millisecond)
+
+	return instance
+}
+
+func TestCommands_ResumeOnReply(t *testing.T) {
+	transport := saga.NewMemoryTransport(time.Millisecond)
+	rec := sagatest.NewRecorder()
+	executor := newCommandExecutor(t, transport, rec)
+	ctx := tenant.WithID(context.Background(), "acme")
+
+	instance, err := executor.Start(ctx, "checkout", nil)
+	require.NoError(t, err)
+	require.Equal(t, saga.StatusWaiting, instance.Status)
+
+	// payments is down: the command waits in the queue and nothing holds a connection to it
+	require.Equal(t, 1, transport.Pending("payments.commands"))
+
+	var received []saga.Message
+	var tenants []string
+	serve(t, func(ctx context.Context) error {
+		return saga.ServeCommands(ctx, transport, "payments.commands", func(ctx context.Context, command saga.Message) (interface{}, error) {
+			received = append(received, command)
+			tenants = append(tenants, tenant.ID(ctx))
+			return chargeReply{PaymentID: 7}, nil
+		})
+	})
+	serve(t, func(ctx context.Context) error { return transport.Receive(ctx, "orders.replies", executor.HandleReply) })
+
+	instance = waitForStatus(t, executor, instance.ID, saga.StatusCompleted)
+	require.Equal(t, int64(7), instance.Payload)
+	require.Len(t, received, 1)
+	require.Equal(t, "payments.Charge", received[0].Type)
+	require.Equal(t, instance.ID, received[0].InstanceID)
+	require.JSONEq(t, `{"OrderID":42}`, string(received[0].Payload))
+	// the handler acts on behalf of the tenant of the saga
+	require.Equal(t, []string{"acme"}, tenants)
+	rec.AssertCommands(t, "create-order", "charge", "confirm")
+}
+
+func TestCommands_RepliesCannotBeSignaled(t *testing.T) {
+	transport := saga.NewMemoryTransport(time.Millisecond)
+	executor := newCommandExecutor(t, transport, sagatest.NewRecorder())
+	ctx := tenant.WithID(context.Background(), "acme")
+
+	instance, err := executor.Start(ctx, "checkout", nil)
+	require.NoError(t, err)
+	require.Equal(t, saga.ReplySignalPrefix+"charge", instance.WaitingFor)
+
+	_, err = executor.SignalSaga(ctx, instance.ID, saga.ReplySignalPrefix+"charge", map[string]interface{}{"PaymentID": 7})
+	require.ErrorIs(t, err, saga.ErrReservedSignal)
+	_, err = executor.SignalSaga(ctx, instance.ID, "charge", map[string]interface{}{"PaymentID": 7})
+	require.ErrorIs(t, err, saga.ErrNotWaitingForSignal)
+
+	instance, err = executor.Get(ctx, instance.ID)
+	require.NoError(t, err)
+	require.Equal(t, saga.StatusWaiting, instance.Status)
+}
+
+func TestCommands_RepliesAreEncrypted(t *testing.T) {
+	step := saga.NewCommands(saga.NewMemoryTransport(time.Millisecond), "orders.replies").Step("charge", "payments.commands",
+		"payments.Charge", func(ctx context.Context) (interface{}, error) { return chargeCommand{OrderID: 42}, nil }, 0)
+	registry := saga.NewRegistry()
+	require.Error(t, registry.Register(saga.NewVersionedSaga("checkout", 1, []saga.Step{step})))
+
+	registry.SetKeyProvider(newKeys(t, "k1", "k1"))
+	require.NoError(t, registry.Register(saga.NewVersionedSaga("checkout", 1, []saga.Step{step})))
+	encoded, err := registry.EncodePayload(tenantCtx(), saga.PayloadOwner{InstanceID: "i-1"}, saga.Reply{Payload: []byte(`{"PaymentID":7}`)})
+	require.NoError(t, err)
+	require.True(t, encoded.(saga.EncodedPayload).Encrypted())
+}
+
+func TestCommands_RejectedCommandCompensates(t *testing.T) {
+	transport := saga.NewMemoryTransport(time.Millisecond)
+	rec := sagatest.NewRecorder()
+	executor := newCommandExecutor(t, transport, rec)
+	attempts := 0
+	serve(t, func(ctx context.Context) error {
+		return saga.ServeCommands(ctx, transport, "payments.commands", func(ctx context.Context, command saga.Message) (interface{}, error) {
+			attempts++
+			if attempts == 1 {
+				// transient, delivered again
+				return nil, errors.New("connection refused")
+			}
+			return nil, saga.Reject(errors.New("card declined"))
+		})
+	})
+	serve(t, func(ctx context.Context) error { return transport.Receive(ctx, "orders.replies", executor.HandleReply) })
+
+	instance, err := executor.Start(tenantCtx(), "checkout", nil)
+	require.NoError(t, err)
+
+	instance = waitForStatus(t, executor, instance.ID, saga.StatusCompensated)
+	require.Equal(t, []string{"command of step charge was rejected: card declined"}, instance.Errors)
+	require.Equal(t, 2, attempts)
+	rec.AssertCompensations(t, "charge", "create-order")
+}
+
+func TestCommands_SendFailureCompensates(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	executor := newCommandExecutor(t, failingTransport{}, rec)
+
+	instance, err := executor.Start(tenantCtx(), "checkout", nil)
+
+	var execErr *saga.ExecutionError
+	require.ErrorAs(t, err, &execErr)
+	require.Equal(t, saga.StatusCompensated, instance.Status)
+	rec.AssertCompensations(t, "charge", "create-order")
+}
+
+type failingTransport struct{}
+
+func (failingTransport) Send(context.Context, saga.Message) error {
+	return errors.New("broker unavailable")
+}
+
+func (failingTransport) Receive(ctx context.Context, _ string, _ func(context.Context, saga.Message) error) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestCommands_CompensationSendsTheCommand(t *testing.T) {
+	transport := saga.NewMemoryTransport(time.Millisecond)
+	commands := saga.NewCommands(transport, "orders.replies")
+	charge := commands.Step("charge", "payments.commands", "payments.Charge", func(ctx context.Context) (interface{}, error) {
+		return chargeCommand{OrderID: 42}, nil
+	}, time.Hour)
+	charge.CompensationCommand = commands.Compensation("charge", "payments.commands", "payments.Refund", func(ctx context.Context) (interface{}, error) {
+		var reply chargeReply
+		err := ctx.Value(saga.ParamKey).(saga.Reply).Decode(&reply)
+		return reply, err
+	})
+	registry := saga.NewRegistry()
+	// replies are sensitive
+	registry.SetKeyProvider(newKeys(t, "k1", "k1"))
+	require.NoError(t, registry.Register(saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		charge,
+		{
+			Name: "confirm",
+			Command: func(ctx context.Context) (interface{}, error) {
+				return nil, errors.New("out of stock")
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) { return nil, nil },
+		},
+	})))
+	executor := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: saga.NewMemoryStore()})
+
+	received := make(chan saga.Message, 2)
+	serve(t, func(ctx context.Context) error {
+		return saga.ServeCommands(ctx, transport, "payments.commands", func(ctx context.Context, command saga.Message) (interface{}, error) {
+			received <- command
+			return chargeReply{PaymentID: 7}, nil
+		})
+	})
+	serve(t, func(ctx context.Context) error { return transport.Receive(ctx, "orders.replies", executor.HandleReply) })
+
+	instance, err := executor.Start(tenant.WithID(context.Background(), "acme"), "checkout", nil)
+	require.NoError(t, err)
+	waitForStatus(t, executor, instance.ID, saga.StatusCompensated)
+
+	require.Equal(t, "payments.Charge", (<-received).Type)
+	refund := <-received
+	require.Equal(t, "payments.Refund", refund.Type)
+	require.Equal(t, instance.ID+"/charge/compensation", refund.ID)
+	require.Equal(t, "acme", refund.Tenant)
+	require.JSONEq(t, `{"PaymentID":7}`, string(refund.Payload))
+
+	// the reply to the compensating command is dropped
+	require.Eventually(t, func() bool { return transport.Pending("orders.replies") == 0 }, time.Second, time.Millisecond)
+	instance = waitForStatus(t, executor, instance.ID, saga.StatusCompensated)
+	require.Empty(t, instance.CompensationErrors)
+}
+
+func TestCommands_CompensationWithoutPayloadSendsNothing(t *testing.T) {
+	transport := saga.NewMemoryTransport(time.Millisecond)
+	compensation := saga.NewCommands(transport, "orders.replies").Compensation("charge", "payments.commands", "payments.Refund",
+		func(ctx context.Context) (interface{}, error) { return nil, nil })
+
+	_, err := compensation(tenantCtx())
+	require.NoError(t, err)
+	require.Equal(t, 0, transport.Pending("payments.commands"))
+}
@@ -1,6 +1,11 @@
 package saga
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
 
 type SagaContextKey string
 
@@ -8,6 +13,16 @@ type SagaContextKey string
 // it will be overridden each step
 const ParamKey = SagaContextKey("saga-context-param")
 
+const instanceIDKey = SagaContextKey("saga-context-instance-id")
+
+// InstanceID returns the id of the saga instance a step is running in.
+// Sagas run by an Executor use the id of their stored Instance; other executions get a random one.
+func InstanceID(ctx context.Context) string {
+	id, _ := ctx.Value(instanceIDKey).(string)
+
+	return id
+}
+
 type Coordinator struct {
 	saga               Saga
 	errors             []error
@@ -15,22 +30,69 @@ type Coordinator struct {
 	currentStep        int
 	ctx                context.Context
 	result             interface{}
+	now                func() time.Time
+
+	// observe is notified every time the coordinator moves on, so an Executor can persist the progress.
+	// If it fails the coordinator stops right away and keeps the error in interruption.
+	observe      func(ctx context.Context, p progress) error
+	interruption error
+	// suspended is set when a timer or signal step suspended the execution, which only happens when it is observed
+	suspended bool
+	// signal is delivered to the signal step the resumed instance waits for
+	signal *signal
+	// failures counts the consecutive failures of the current step of a Forward saga
+	failures int
+	// retry is set when the current step of a Forward saga must run again right away
+	retry bool
+	// request runs the command of the signal step the instance was suspended on, which asks for the signal,
+	// e.g. by sending a command whose reply is the signal. The Executor runs it once the instance is released.
+	request func() error
+}
+
+// progress is a snapshot of where the coordinator is in the saga, and the event that led to it
+type progress struct {
+	event  EventType
+	status Status
+	// step is the index of the next step to execute or to compensate
+	step    int
+	payload interface{}
+	// err is set when a step command fails and compensationErr when a compensation does
+	err             error
+	compensationErr error
+	// wakeAt and waitingFor are set when a timer or signal step suspends the saga, and wakeAt when a failed step
+	// of a Forward saga waits to be retried
+	wakeAt     time.Time
+	waitingFor string
+	failures   int
 }
 
 func NewCoordinator(saga Saga) *Coordinator {
 	return &Coordinator{
 		saga: saga,
+		now:  time.Now,
 	}
 }
 
 func (c *Coordinator) Execute(ctx context.Context) (interface{}, bool) {
+	if InstanceID(ctx) == "" {
+		ctx = context.WithValue(ctx, instanceIDKey, newInstanceID())
+	}
 	c.ctx = ctx
 
-	for i, step := range c.saga.Steps {
+	return c.executeFrom(0)
+}
+
+func (c *Coordinator) executeFrom(index int) (interface{}, bool) {
+	for i := index; i < len(c.saga.Steps); i++ {
 		c.currentStep = i
-		ok := c.executeStep(step)
+		ok := c.executeStep(c.saga.Steps[i])
+		if !ok && c.retry {
+			c.retry = false
+			i--
+			continue
+		}
 		if !ok {
-			return nil, false
+			return nil, c.suspended
 		}
 	}
 
@@ -38,35 +100,272 @@ func (c *Coordinator) Execute(ctx context.Context) (interface{}, bool) {
 }
 
 func (c *Coordinator) executeStep(step Step) bool {
-	response, err := step.Command(c.ctx)
+	if !c.notify(progress{event: EventStepStarted, status: StatusRunning, step: c.currentStep, payload: c.ctx.Value(ParamKey)}) {
+		return false
+	}
+
+	if step.Timer != nil || step.Signal != "" {
+		return c.wait(step)
+	}
+
+	response, err := c.runCommand(step)
 	if err != nil {
-		c.errors = append(c.errors, err)
-		c.compensateStep(c.currentStep)
+		return c.fail(err)
+	}
+
+	return c.complete(response)
+}
+
+// runCommand runs the command of a step as many times as its retry policy allows
+func (c *Coordinator) runCommand(step Step) (interface{}, error) {
+	hb := newHeartbeats()
+	for attempt := 1; ; attempt++ {
+		response, err := c.attempt(step, hb)
+		var panicErr *StepPanicError
+		if err == nil || attempt >= step.Retry.attempts() || errors.As(err, &panicErr) {
+			return response, err
+		}
+
+		if step.Retry.Backoff > 0 {
+			timer := time.NewTimer(step.Retry.Backoff)
+			select {
+			case <-c.ctx.Done():
+				timer.Stop()
+				return nil, err
+			case <-timer.C:
+			}
+		}
+		hb = hb.next()
+	}
+}
+
+// attempt runs the command of a step once, failing it if it misses its heartbeats
+func (c *Coordinator) attempt(step Step, hb *heartbeats) (interface{}, error) {
+	ctx := context.WithValue(c.ctx, heartbeatKey, hb)
+	if step.HeartbeatTimeout <= 0 {
+		return protect(ctx, step, c.currentStep, false, step.Command)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		response interface{}
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		response, err := protect(ctx, step, c.currentStep, false, step.Command)
+		done <- result{response: response, err: err}
+	}()
+
+	timer := time.NewTimer(step.HeartbeatTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case r := <-done:
+			return r.response, r.err
+		case <-hb.beat:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(step.HeartbeatTimeout)
+		case <-timer.C:
+			return nil, &HeartbeatTimeoutError{Step: step.Name, Timeout: step.HeartbeatTimeout}
+		}
+	}
+}
+
+// wait runs a timer or signal step. When the coordinator is observed the saga is suspended until the timer fires
+// or the signal arrives. Otherwise nothing could resume it, so a timer blocks and a signal step fails.
+func (c *Coordinator) wait(step Step) bool {
+	var wakeAt time.Time
+	if step.Timer != nil {
+		var err error
+		_, err = protect(c.ctx, step, c.currentStep, false, func(ctx context.Context) (interface{}, error) {
+			var err error
+			wakeAt, err = step.Timer(ctx, c.now())
+			return nil, err
+		})
+		if err != nil {
+			return c.fail(err)
+		}
+	}
+
+	payload := c.ctx.Value(ParamKey)
+	if step.Signal != "" {
+		if c.observe == nil {
+			return c.fail(fmt.Errorf("signal step %q can only run in an Executor", step.Name))
+		}
+		c.suspend(progress{event: EventStepWaiting, status: StatusWaiting, step: c.currentStep, payload: payload,
+			wakeAt: wakeAt, waitingFor: step.Signal})
+		if c.suspended && step.Command != nil {
+			c.request = func() error {
+				_, err := c.runCommand(step)
+				return err
+			}
+		}
+		return false
+	}
+
+	delay := wakeAt.Sub(c.now())
+	if delay <= 0 {
+		return c.complete(payload)
+	}
+
+	if c.observe != nil {
+		return c.suspend(progress{event: EventStepWaiting, status: StatusWaiting, step: c.currentStep, payload: payload,
+			wakeAt: wakeAt})
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-c.ctx.Done():
+		return c.fail(c.ctx.Err())
+	case <-timer.C:
+		return c.complete(payload)
+	}
+}
+
+func (c *Coordinator) suspend(p progress) bool {
+	if c.notify(p) {
+		c.suspended = true
+	}
+
+	return false
+}
+
+func (c *Coordinator) fail(err error) bool {
+	c.errors = append(c.errors, err)
+	if c.saga.Recovery == Forward || c.saga.Steps[c.currentStep].Retriable {
+		return c.retryForward(err)
+	}
+
+	if !c.notify(progress{event: EventStepFailed, status: StatusCompensating, step: c.currentStep,
+		payload: c.ctx.Value(ParamKey), err: err}) {
 		return false
 	}
+	c.compensateStep(c.currentStep)
+
+	return false
+}
+
+// retryForward schedules the failed step of a Forward saga, or a Retriable step, to run again. Observed, the instance
+// is suspended until then; otherwise the coordinator waits and runs the step again, until ctx is done.
+func (c *Coordinator) retryForward(err error) bool {
+	c.failures++
+	delay := c.saga.ForwardRetry.delay(c.failures)
+
+	if c.observe != nil {
+		p := progress{event: EventStepRetrying, status: StatusRetrying, step: c.currentStep, payload: c.ctx.Value(ParamKey),
+			err: err, wakeAt: c.now().Add(delay), failures: c.failures}
+		if c.saga.ForwardRetry.stuck(c.failures) {
+			p.event, p.status = EventStepStuck, StatusStuck
+		}
+		return c.suspend(p)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-c.ctx.Done():
+		return false
+	case <-timer.C:
+		c.retry = true
+		return false
+	}
+}
+
+func (c *Coordinator) complete(response interface{}) bool {
 	c.ctx = context.WithValue(c.ctx, ParamKey, response)
+	c.failures = 0
 
 	if c.currentStep == len(c.saga.Steps)-1 {
 		c.result = response
+		return c.notify(progress{event: EventStepCompleted, status: StatusCompleted, step: c.currentStep + 1, payload: response})
 	}
 
-	return true
+	return c.notify(progress{event: EventStepCompleted, status: StatusRunning, step: c.currentStep + 1, payload: response})
 }
 
 func (c *Coordinator) compensateStep(index int) {
 	if index < 0 {
+		c.notify(progress{event: EventSagaCompensated, status: StatusCompensated, step: index, payload: c.ctx.Value(ParamKey)})
 		return
 	}
 
-	_, err := c.saga.Steps[index].CompensationCommand(c.ctx)
+	step := c.saga.Steps[index]
+	var err error
+	if step.CompensationCommand != nil || !step.Pivot {
+		_, err = protect(c.ctx, step, index, true, step.CompensationCommand)
+	}
+	event := EventCompensationCompleted
 	if err != nil {
 		c.compensationErrors = append(c.compensationErrors, err)
+		event = EventCompensationFailed
 	}
 
 	index = index - 1
+	if !c.notify(progress{event: event, status: StatusCompensating, step: index, payload: c.ctx.Value(ParamKey), compensationErr: err}) {
+		return
+	}
 	c.compensateStep(index)
 }
 
+// resume picks up an instance where it stopped, either executing or compensating its steps,
+// or going on after the step it waits for if its timer fired or its signal was delivered
+func (c *Coordinator) resume(ctx context.Context, instance Instance) (interface{}, bool) {
+	ctx = context.WithValue(ctx, instanceIDKey, instance.ID)
+	c.ctx = context.WithValue(ctx, ParamKey, instance.Payload)
+
+	switch instance.Status {
+	case StatusRetrying, StatusStuck:
+		c.failures = instance.Failures
+		return c.executeFrom(instance.Step)
+	case StatusCompensating:
+		c.currentStep = instance.Step
+		c.compensateStep(instance.Step)
+		return nil, false
+	case StatusWaiting:
+		c.currentStep = instance.Step
+		output := instance.Payload
+		switch {
+		case instance.WaitingFor != "" && c.signal != nil && c.signal.name == instance.WaitingFor:
+			if c.signal.err != nil {
+				c.fail(c.signal.err)
+				return nil, false
+			}
+			output = c.signal.payload
+		case !instance.Due(c.now()):
+			c.suspended = true
+			return nil, true
+		case instance.WaitingFor != "":
+			c.fail(&SignalTimeoutError{Signal: instance.WaitingFor})
+			return nil, false
+		}
+		if !c.complete(output) {
+			return nil, false
+		}
+		return c.executeFrom(instance.Step + 1)
+	}
+
+	return c.executeFrom(instance.Step)
+}
+
+func (c *Coordinator) notify(p progress) bool {
+	if c.observe == nil || c.interruption != nil {
+		return c.interruption == nil
+	}
+
+	if err := c.observe(c.ctx, p); err != nil {
+		c.interruption = err
+		return false
+	}
+
+	return true
+}
+
 func (c *Coordinator) GetErrors() []error {
 	return c.errors
 }
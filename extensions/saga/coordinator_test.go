@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/saga/sagatest"
 	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 type InitialPayload struct {
@@ -68,7 +70,7 @@ func TestCoordinator_Success(t *testing.T) {
 
 	coordinator := saga.NewCoordinator(aSaga)
 
-	ctx := context.WithValue(context.Background(), saga.ParamKey, InitialPayload{field: 0})
+	ctx := context.WithValue(tenantCtx(), saga.ParamKey, InitialPayload{field: 0})
 	coordinator.Execute(ctx)
 
 	require.True(t, calledFirstStep)
@@ -125,7 +127,7 @@ func TestCoordinator_Compensation_Success(t *testing.T) {
 
 	coordinator := saga.NewCoordinator(aSaga)
 
-	ctx := context.WithValue(context.Background(), saga.ParamKey, InitialPayload{field: 0})
+	ctx := context.WithValue(tenantCtx(), saga.ParamKey, InitialPayload{field: 0})
 	coordinator.Execute(ctx)
 
 	require.True(t, calledThirdCompensation)
@@ -135,3 +137,45 @@ func TestCoordinator_Compensation_Success(t *testing.T) {
 	require.Equal(t, 1, len(coordinator.GetErrors()))
 	require.Equal(t, 0, len(coordinator.GetCompensationErrors()))
 }
+
+func TestCoordinator_CompensationFailure_KeepsCompensating(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	aSaga := rec.Wrap(
+		saga.NewSaga([]saga.Step{
+			sagatest.Step("first", Step1Response{}),
+			sagatest.Step("second", Step2Response{}),
+			sagatest.Step("third", Step3Response{}),
+		}),
+		sagatest.FailStep(2, 1, errors.New("error on step 3")),
+		sagatest.FailCompensation(1, 1, errors.New("error on compensation 2")),
+	)
+
+	coordinator := saga.NewCoordinator(aSaga)
+	_, ok := coordinator.Execute(tenantCtx())
+
+	require.False(t, ok)
+	rec.AssertCommands(t, "first", "second", "third")
+	rec.AssertCompensations(t, "third", "second", "first")
+	require.Equal(t, 1, len(coordinator.GetErrors()))
+	require.Equal(t, 1, len(coordinator.GetCompensationErrors()))
+}
+
+func TestCoordinator_Timeout(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	aSaga := rec.Wrap(
+		saga.NewSaga([]saga.Step{
+			sagatest.Step("first", Step1Response{}),
+			sagatest.Step("second", Step2Response{}),
+		}),
+		sagatest.TimeoutStep(1, 1),
+	)
+
+	ctx, cancel := context.WithTimeout(tenantCtx(), 10*time.Millisecond)
+	defer cancel()
+	coordinator := saga.NewCoordinator(aSaga)
+	_, ok := coordinator.Execute(ctx)
+
+	require.False(t, ok)
+	require.ErrorIs(t, coordinator.GetErrors()[0], context.DeadlineExceeded)
+	rec.AssertCompensations(t, "second", "first")
+}
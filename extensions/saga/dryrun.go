@@ -0,0 +1,125 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// errDryRun is the failure injected by DryRun
+var errDryRun = errors.New("dry run failure")
+
+// Plan lists what a saga does when it runs without failures, and when each of its steps fails
+type Plan struct {
+	Saga      string
+	Version   int
+	Scenarios []Scenario
+}
+
+// Scenario is a dry run of a saga where a single step fails once, or none when FailingStep is -1
+type Scenario struct {
+	FailingStep int
+	// Forward lists the steps run, in order. A Retriable step, or a step of a Forward saga, shows up again when it
+	// is retried.
+	Forward []string
+	// Compensation lists the steps compensated, in order
+	Compensation []string
+	Completed    bool
+}
+
+func (p Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "saga %q version %d\n", p.Saga, p.Version)
+	for _, scenario := range p.Scenarios {
+		fmt.Fprintf(&b, "  %s\n", scenario)
+	}
+
+	return b.String()
+}
+
+func (s Scenario) String() string {
+	failure := "no failure"
+	if s.FailingStep >= 0 {
+		failure = fmt.Sprintf("step %d fails", s.FailingStep)
+	}
+	outcome := "completed"
+	if !s.Completed {
+		outcome = "compensated"
+	}
+
+	plan := fmt.Sprintf("%s: run %s", failure, strings.Join(s.Forward, ", "))
+	if len(s.Compensation) > 0 {
+		plan += fmt.Sprintf("; compensate %s", strings.Join(s.Compensation, ", "))
+	}
+
+	return fmt.Sprintf("%s; %s", plan, outcome)
+}
+
+// DryRun validates a saga definition and runs it against stub actions, once without failures and once for each
+// step failing, to plan what it does in each case. Timers and signals do not wait, retry policies are ignored and
+// Retriable steps, as well as the steps of a Forward saga, succeed when retried.
+func DryRun(s Saga) (Plan, error) {
+	if err := Validate(s); err != nil {
+		return Plan{}, err
+	}
+
+	plan := Plan{Saga: s.Name, Version: s.Version}
+	for failing := -1; failing < len(s.Steps); failing++ {
+		scenario, err := dryRun(s, failing)
+		if err != nil {
+			return Plan{}, err
+		}
+		plan.Scenarios = append(plan.Scenarios, scenario)
+	}
+
+	return plan, nil
+}
+
+// dryRun runs a stub of s where the step at index failing fails on its first attempt
+func dryRun(s Saga, failing int) (Scenario, error) {
+	scenario := Scenario{FailingStep: failing}
+	stub := Saga{
+		Name:         s.Name,
+		Version:      s.Version,
+		Recovery:     s.Recovery,
+		ForwardRetry: ForwardRetryPolicy{Backoff: time.Nanosecond, MaxBackoff: time.Nanosecond},
+	}
+	for i, step := range s.Steps {
+		i, name := i, step.Name
+		if name == "" {
+			name = fmt.Sprintf("step-%d", i)
+		}
+		attempts := 0
+		stubStep := Step{
+			Name:      name,
+			Pivot:     step.Pivot,
+			Retriable: step.Retriable,
+			Command: func(ctx context.Context) (interface{}, error) {
+				attempts++
+				scenario.Forward = append(scenario.Forward, name)
+				if i == failing && attempts == 1 {
+					return nil, errDryRun
+				}
+				return nil, nil
+			},
+		}
+		if step.CompensationCommand != nil {
+			stubStep.CompensationCommand = func(ctx context.Context) (interface{}, error) {
+				scenario.Compensation = append(scenario.Compensation, name)
+				return nil, nil
+			}
+		}
+		stub.Steps = append(stub.Steps, stubStep)
+	}
+
+	coordinator := NewCoordinator(stub)
+	_, scenario.Completed = coordinator.Execute(context.Background())
+	if errs := coordinator.GetCompensationErrors(); len(errs) > 0 {
+		return Scenario{}, fmt.Errorf("dry run of saga %q version %d with step %d failing: %w",
+			s.Name, s.Version, failing, errs[0])
+	}
+
+	return scenario, nil
+}
@@ -0,0 +1,116 @@
+package saga
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+const payloadAccessKey = SagaContextKey("saga-context-payload-access")
+
+// RedactedPayload replaces a sensitive payload in the instances returned to callers without payload access
+type RedactedPayload struct {
+	// Type is the name the payload type was registered with
+	Type string
+}
+
+// WithPayloadAccess authorizes the caller to read sensitive payloads through Executor.Get and Executor.List.
+// It must only be used once the caller was checked to be allowed to, e.g. an operator role.
+func WithPayloadAccess(ctx context.Context) context.Context {
+	return context.WithValue(ctx, payloadAccessKey, true)
+}
+
+// HasPayloadAccess tells whether WithPayloadAccess authorized the caller
+func HasPayloadAccess(ctx context.Context) bool {
+	access, _ := ctx.Value(payloadAccessKey).(bool)
+
+	return access
+}
+
+// encrypt seals data with a fresh data key, itself sealed with the current key of the provider (envelope encryption).
+// The type name and the owner are authenticated along, so a payload cannot be swapped for one of another type,
+// nor copied to another instance, step or event.
+func encrypt(ctx context.Context, keys KeyProvider, typeName string, owner PayloadOwner, data []byte) (EncodedPayload, error) {
+	keyID, key, err := keys.CurrentKey(ctx)
+	if err != nil {
+		return EncodedPayload{}, fmt.Errorf("getting current payload key: %w", err)
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return EncodedPayload{}, err
+	}
+	ciphertext, err := seal(dataKey, data, additionalData(typeName, owner))
+	if err != nil {
+		return EncodedPayload{}, err
+	}
+	wrappedKey, err := seal(key, dataKey, []byte(keyID))
+	if err != nil {
+		return EncodedPayload{}, err
+	}
+
+	return EncodedPayload{Type: typeName, Data: ciphertext, KeyID: keyID, WrappedKey: wrappedKey}, nil
+}
+
+func decrypt(ctx context.Context, keys KeyProvider, owner PayloadOwner, encoded EncodedPayload) ([]byte, error) {
+	if keys == nil {
+		return nil, errors.New("payload is encrypted but no key provider is set")
+	}
+	key, err := keys.Key(ctx, encoded.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := open(key, encoded.WrappedKey, []byte(encoded.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping data key with payload key %q: %w", encoded.KeyID, err)
+	}
+
+	return open(dataKey, encoded.Data, additionalData(encoded.Type, owner))
+}
+
+// additionalData is what a payload is bound to. Its parts are quoted, so they cannot run into each other.
+func additionalData(typeName string, owner PayloadOwner) []byte {
+	return []byte(fmt.Sprintf("%q %q %d %d", typeName, owner.InstanceID, owner.Step, owner.Sequence))
+}
+
+// seal encrypts plaintext with AES-GCM and prepends the nonce to the result
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("encrypted payload is too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,191 @@
+package saga_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/saga/sagatest"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+	"github.com/stretchr/testify/require"
+)
+
+type card struct {
+	Number string
+}
+
+func newKeys(t *testing.T, current string, ids ...string) *saga.LocalKeyProvider {
+	keys := map[string][]byte{}
+	for _, id := range ids {
+		keys[id] = bytes.Repeat([]byte(id[len(id)-1:]), 32)
+	}
+	provider, err := saga.NewLocalKeyProvider(current, keys)
+	require.NoError(t, err)
+
+	return provider
+}
+
+func newPaymentExecutor(t *testing.T, keys saga.KeyProvider, store saga.Store, clock saga.Clock) *saga.Executor {
+	charge := sagatest.Step("charge", card{Number: "4111111111111111"})
+	charge.Output = card{}
+	capture := sagatest.Step("capture", card{Number: "4111111111111111"})
+	capture.Output = card{}
+	registry := saga.NewRegistry()
+	registry.SetKeyProvider(keys)
+	require.NoError(t, registry.RegisterPayloadType("card", card{}, saga.JSONCodec{}, saga.Sensitive()))
+	require.NoError(t, registry.Register(saga.NewVersionedSaga("payment", 1, []saga.Step{
+		charge, saga.Sleep("wait", time.Minute), capture,
+	})))
+
+	return saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: store, Clock: clock})
+}
+
+func TestRegistry_RegisterPayloadType_SensitiveRequiresKeys(t *testing.T) {
+	registry := saga.NewRegistry()
+
+	require.EqualError(t, registry.RegisterPayloadType("card", card{}, saga.JSONCodec{}, saga.Sensitive()),
+		`payload type "card" is sensitive but no key provider is set`)
+}
+
+func TestExecutor_SensitivePayloads_AreEncryptedAndRedacted(t *testing.T) {
+	clock := sagatest.NewFakeClock(time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC))
+	store := saga.NewMemoryStore()
+	executor := newPaymentExecutor(t, newKeys(t, "k1", "k1"), store, clock)
+	ctx := tenantCtx()
+
+	instance, err := executor.Start(ctx, "payment", nil)
+	require.NoError(t, err)
+	require.Equal(t, card{Number: "4111111111111111"}, instance.Payload)
+
+	stored, err := store.GetInstance(ctx, instance.ID)
+	require.NoError(t, err)
+	encoded := stored.Payload.(saga.EncodedPayload)
+	require.Equal(t, "k1", encoded.KeyID)
+	require.NotContains(t, string(encoded.Data), "4111")
+
+	got, err := executor.Get(ctx, instance.ID)
+	require.NoError(t, err)
+	require.Equal(t, saga.RedactedPayload{Type: "card"}, got.Payload)
+	listed, err := executor.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	require.Equal(t, saga.RedactedPayload{Type: "card"}, listed[0].Payload)
+
+	got, err = executor.Get(saga.WithPayloadAccess(ctx), instance.ID)
+	require.NoError(t, err)
+	require.Equal(t, card{Number: "4111111111111111"}, got.Payload)
+}
+
+func TestExecutor_SensitivePayloads_KeyRotation(t *testing.T) {
+	clock := sagatest.NewFakeClock(time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC))
+	store := saga.NewMemoryStore()
+	ctx := saga.WithPayloadAccess(tenantCtx())
+
+	instance, err := newPaymentExecutor(t, newKeys(t, "k1", "k1"), store, clock).Start(ctx, "payment", nil)
+	require.NoError(t, err)
+
+	// k2 becomes current, k1 is kept to decrypt what it encrypted
+	rotated := newPaymentExecutor(t, newKeys(t, "k2", "k1", "k2"), store, clock)
+	got, err := rotated.Get(ctx, instance.ID)
+	require.NoError(t, err)
+	require.Equal(t, card{Number: "4111111111111111"}, got.Payload)
+
+	// without k1, the payload cannot be decrypted
+	_, err = newPaymentExecutor(t, newKeys(t, "k2", "k2"), store, clock).Get(ctx, instance.ID)
+	require.Error(t, err)
+
+	// payloads are encrypted with the current key whenever they are stored again
+	clock.Advance(time.Minute)
+	results, err := rotated.Recover(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Err)
+	stored, err := store.GetInstance(ctx, instance.ID)
+	require.NoError(t, err)
+	require.Equal(t, "k2", stored.Payload.(saga.EncodedPayload).KeyID)
+}
+
+func TestRegistry_DecodePayload_RejectsTamperedPayloads(t *testing.T) {
+	registry := saga.NewRegistry()
+	registry.SetKeyProvider(newKeys(t, "k1", "k1"))
+	require.NoError(t, registry.RegisterPayloadType("card", card{}, saga.JSONCodec{}, saga.Sensitive()))
+	require.NoError(t, registry.RegisterPayloadType("reservation", reservation{}, saga.JSONCodec{}, saga.Sensitive()))
+	ctx := tenantCtx()
+	owner := saga.PayloadOwner{InstanceID: "i-1", Step: 1, Sequence: 3}
+
+	encoded, err := registry.EncodePayload(ctx, owner, card{Number: "4111111111111111"})
+	require.NoError(t, err)
+	_, err = registry.DecodePayload(ctx, owner, encoded)
+	require.NoError(t, err)
+
+	swapped := encoded.(saga.EncodedPayload)
+	swapped.Type = "reservation"
+	_, err = registry.DecodePayload(ctx, owner, swapped)
+	require.Error(t, err)
+
+	// payloads only decrypt for the instance, step and event they were encrypted for
+	for _, other := range []saga.PayloadOwner{
+		{InstanceID: "i-2", Step: 1, Sequence: 3},
+		{InstanceID: "i-1", Step: 2, Sequence: 3},
+		{InstanceID: "i-1", Step: 1, Sequence: 4},
+		{InstanceID: "i-1", Step: 1},
+	} {
+		_, err = registry.DecodePayload(ctx, other, encoded)
+		require.Error(t, err, "decoded for %+v", other)
+	}
+}
+
+func TestExecutor_Get_RejectsPayloadsCopiedFromAnotherInstance(t *testing.T) {
+	store := saga.NewMemoryStore()
+	executor := newPaymentExecutor(t, newKeys(t, "k1", "k1"), store, nil)
+	ctx := tenant.WithID(context.Background(), "acme")
+	first, err := executor.Start(ctx, "payment", nil)
+	require.NoError(t, err)
+	second, err := executor.Start(ctx, "payment", nil)
+	require.NoError(t, err)
+
+	// someone with access to the store copies the payload of an instance to another one
+	copied, err := store.GetInstance(ctx, first.ID)
+	require.NoError(t, err)
+	target, err := store.GetInstance(ctx, second.ID)
+	require.NoError(t, err)
+	target.Payload = copied.Payload
+	require.NoError(t, store.UpdateInstance(ctx, target))
+
+	_, err = executor.Get(saga.WithPayloadAccess(ctx), second.ID)
+	require.Error(t, err)
+	_, err = executor.Get(saga.WithPayloadAccess(ctx), first.ID)
+	require.NoError(t, err)
+}
+
+func TestParseLocalKeys(t *testing.T) {
+	k1 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	k2 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 16))
+
+	provider, err := saga.ParseLocalKeys("k2:" + k2 + ",k1:" + k1)
+	require.NoError(t, err)
+	id, key, err := provider.CurrentKey(tenantCtx())
+	require.NoError(t, err)
+	require.Equal(t, "k2", id)
+	require.Len(t, key, 16)
+	_, err = provider.Key(tenantCtx(), "k1")
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "keys")
+	require.NoError(t, os.WriteFile(path, []byte("k1:"+k1+"\n"), 0o600))
+	provider, err = saga.LocalKeyProviderFromFile(path)
+	require.NoError(t, err)
+	id, _, err = provider.CurrentKey(tenantCtx())
+	require.NoError(t, err)
+	require.Equal(t, "k1", id)
+
+	_, err = saga.ParseLocalKeys("k1")
+	require.Error(t, err)
+	_, err = saga.ParseLocalKeys("k1:" + base64.StdEncoding.EncodeToString([]byte("short")))
+	require.Error(t, err)
+}
@@ -0,0 +1,193 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrEventConflict is returned by EventStore.AppendEvents when the history of an instance already has an event
+// with the same sequence, i.e. when another replica wrote to it in the meantime
+var ErrEventConflict = errors.New("saga event sequence already taken")
+
+type EventType string
+
+const (
+	EventSagaStarted           EventType = "SagaStarted"
+	EventStepStarted           EventType = "StepStarted"
+	EventStepWaiting           EventType = "StepWaiting"
+	EventStepCompleted         EventType = "StepCompleted"
+	EventStepFailed            EventType = "StepFailed"
+	EventStepRetrying          EventType = "StepRetrying"
+	EventStepStuck             EventType = "StepStuck"
+	EventCompensationCompleted EventType = "CompensationCompleted"
+	EventCompensationFailed    EventType = "CompensationFailed"
+	EventSagaCompleted         EventType = "SagaCompleted"
+	EventSagaCompensated       EventType = "SagaCompensated"
+)
+
+// Event is an immutable entry of the history of a saga instance
+type Event struct {
+	// Position orders the events of every instance. It is assigned by the EventStore.
+	Position   int64
+	InstanceID string
+	// Sequence orders the events of an instance, starting at 1
+	Sequence    int
+	Type        EventType
+	SagaName    string
+	SagaVersion int
+	// Tenant is the tenant of the instance
+	Tenant string
+	// Step is the index of the step the event is about. SagaCompleted has the number of steps and
+	// SagaCompensated has -1, as Instance.Step.
+	Step int
+	// StepName is the name of that step, empty for the events about the whole saga
+	StepName string
+	// Payload is the ParamKey value after the event: the saga input, a step output, or the input of a step
+	Payload interface{}
+	// Error is set by StepFailed, StepRetrying, StepStuck and CompensationFailed events
+	Error string
+	// Failures is set by StepRetrying and StepStuck events, see Instance.Failures
+	Failures int
+	// WakeAt is set by StepWaiting, StepRetrying and StepStuck events, and WaitingFor by StepWaiting events
+	WakeAt     time.Time
+	WaitingFor string
+	At         time.Time
+}
+
+// EventStore is a Store that also keeps the history of the instances as an append-only stream of events.
+// The Executor appends the events of an instance after saving its progress, and rebuilds the instance from its
+// history when it loads it.
+type EventStore interface {
+	Store
+	// AppendEvents adds events to the history of their instance. It fails with ErrEventConflict if the history
+	// already has one of their sequences, and appends none of them then.
+	AppendEvents(ctx context.Context, events []Event) error
+	// ListEvents returns the history of an instance, in sequence order
+	ListEvents(ctx context.Context, instanceID string) ([]Event, error)
+	// ReadEvents returns up to limit events of any instance appended after position, in position order.
+	// Positions should follow each other: Projector waits for missing ones, as for appends in flight.
+	ReadEvents(ctx context.Context, after int64, limit int) ([]Event, error)
+}
+
+// Replay rebuilds an instance from its history. The lease of the instance is not part of it.
+func Replay(events []Event) (Instance, error) {
+	if len(events) == 0 || events[0].Type != EventSagaStarted {
+		return Instance{}, errors.New("saga history must start with a SagaStarted event")
+	}
+
+	var instance Instance
+	for i, event := range events {
+		if event.Sequence != i+1 {
+			return Instance{}, fmt.Errorf("saga history of instance %s has event %d at sequence %d",
+				event.InstanceID, event.Sequence, i+1)
+		}
+
+		switch event.Type {
+		case EventSagaStarted:
+			instance = Instance{
+				ID:          event.InstanceID,
+				SagaName:    event.SagaName,
+				SagaVersion: event.SagaVersion,
+				Tenant:      event.Tenant,
+				Status:      StatusRunning,
+				CreatedAt:   event.At,
+			}
+		case EventStepStarted:
+			instance.Status = StatusRunning
+		case EventStepWaiting:
+			instance.Status = StatusWaiting
+			instance.WakeAt = event.WakeAt
+			instance.WaitingFor = event.WaitingFor
+		case EventStepCompleted:
+			instance.Status = StatusRunning
+			instance.Step = event.Step + 1
+			instance.Failures = 0
+		case EventStepFailed:
+			instance.Status = StatusCompensating
+			instance.Errors = append(instance.Errors, event.Error)
+		case EventStepRetrying, EventStepStuck:
+			instance.Status = StatusRetrying
+			if event.Type == EventStepStuck {
+				instance.Status = StatusStuck
+			}
+			instance.Errors = []string{event.Error}
+			instance.WakeAt = event.WakeAt
+			instance.Failures = event.Failures
+		case EventCompensationCompleted:
+			instance.Status = StatusCompensating
+			instance.Step = event.Step - 1
+		case EventCompensationFailed:
+			instance.Status = StatusCompensating
+			instance.Step = event.Step - 1
+			instance.CompensationErrors = append(instance.CompensationErrors, event.Error)
+		case EventSagaCompleted:
+			instance.Status = StatusCompleted
+		case EventSagaCompensated:
+			instance.Status = StatusCompensated
+		default:
+			return Instance{}, fmt.Errorf("unknown saga event type %q", event.Type)
+		}
+
+		switch event.Type {
+		case EventStepStarted, EventStepWaiting, EventStepFailed, EventStepRetrying, EventStepStuck,
+			EventSagaCompleted, EventSagaCompensated:
+			instance.Step = event.Step
+		}
+		switch event.Type {
+		case EventStepWaiting, EventStepRetrying, EventStepStuck:
+		default:
+			instance.WakeAt = time.Time{}
+			instance.WaitingFor = ""
+		}
+		instance.Payload = event.Payload
+		instance.UpdatedAt = event.At
+	}
+
+	return instance, nil
+}
+
+// progressEvents tells what happened to an instance of s when the coordinator notified p
+func progressEvents(s Saga, instance Instance, p progress, at time.Time) []Event {
+	event := Event{
+		InstanceID:  instance.ID,
+		Type:        p.event,
+		SagaName:    instance.SagaName,
+		SagaVersion: instance.SagaVersion,
+		Tenant:      instance.Tenant,
+		Step:        p.step,
+		Payload:     p.payload,
+		WakeAt:      p.wakeAt,
+		WaitingFor:  p.waitingFor,
+		Failures:    p.failures,
+		At:          at,
+	}
+
+	switch p.event {
+	case EventStepCompleted:
+		event.Step = p.step - 1
+	case EventCompensationCompleted, EventCompensationFailed:
+		event.Step = p.step + 1
+	}
+	if event.Step >= 0 && event.Step < len(s.Steps) && p.event != EventSagaCompensated {
+		event.StepName = s.Steps[event.Step].Name
+	}
+	if p.err != nil {
+		event.Error = p.err.Error()
+	}
+	if p.compensationErr != nil {
+		event.Error = p.compensationErr.Error()
+	}
+
+	if p.status != StatusCompleted {
+		return []Event{event}
+	}
+
+	completed := event
+	completed.Type = EventSagaCompleted
+	completed.Step = p.step
+	completed.StepName = ""
+
+	return []Event{event, completed}
+}
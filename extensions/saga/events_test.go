@@ -0,0 +1,260 @@
+package saga_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/saga/sagatest"
+	"github.com/stretchr/testify/require"
+)
+
+func eventTypes(events []saga.Event) []saga.EventType {
+	types := make([]saga.EventType, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+
+	return types
+}
+
+func TestExecutor_History_RecordsEveryTransition(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	executor, _, store := newExecutor(t, rec.Wrap(saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		sagatest.Step("create-order", "order"),
+		sagatest.Step("create-payment", "payment"),
+	})))
+	ctx := tenantCtx()
+
+	instance, err := executor.Start(ctx, "checkout", "input")
+	require.NoError(t, err)
+
+	history, err := executor.History(ctx, instance.ID)
+	require.NoError(t, err)
+	require.Equal(t, []saga.EventType{
+		saga.EventSagaStarted,
+		saga.EventStepStarted, saga.EventStepCompleted,
+		saga.EventStepStarted, saga.EventStepCompleted,
+		saga.EventSagaCompleted,
+	}, eventTypes(history))
+	require.Equal(t, "input", history[0].Payload)
+	require.Equal(t, "order", history[2].Payload)
+	require.Equal(t, 1, history[4].Step)
+	require.Equal(t, "create-payment", history[4].StepName)
+
+	replayed, err := saga.Replay(history)
+	require.NoError(t, err)
+	stored, err := store.GetInstance(ctx, instance.ID)
+	require.NoError(t, err)
+	replayed.Lease = stored.Lease
+	require.Equal(t, stored, replayed)
+}
+
+func TestExecutor_History_RecordsCompensation(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	executor, _, store := newExecutor(t, rec.Wrap(saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		sagatest.Step("create-order", "order"),
+		sagatest.Step("create-payment", "payment"),
+	}), sagatest.FailStep(1, 1, errors.New("card declined")), sagatest.FailCompensation(0, 1, errors.New("db down"))))
+	ctx := tenantCtx()
+
+	instance, err := executor.Start(ctx, "checkout", nil)
+	var execErr *saga.ExecutionError
+	require.ErrorAs(t, err, &execErr)
+
+	history, err := executor.History(ctx, instance.ID)
+	require.NoError(t, err)
+	require.Equal(t, []saga.EventType{
+		saga.EventSagaStarted,
+		saga.EventStepStarted, saga.EventStepCompleted,
+		saga.EventStepStarted, saga.EventStepFailed,
+		saga.EventCompensationCompleted, saga.EventCompensationFailed,
+		saga.EventSagaCompensated,
+	}, eventTypes(history))
+	require.Equal(t, "card declined", history[4].Error)
+	require.Equal(t, 0, history[6].Step)
+	require.Equal(t, "db down", history[6].Error)
+
+	replayed, err := saga.Replay(history)
+	require.NoError(t, err)
+	stored, err := store.GetInstance(ctx, instance.ID)
+	require.NoError(t, err)
+	replayed.Lease = stored.Lease
+	require.Equal(t, stored, replayed)
+}
+
+func TestExecutor_Recover_ResumesFromHistory(t *testing.T) {
+	clock := sagatest.NewFakeClock(time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC))
+	registry := saga.NewRegistry()
+	require.NoError(t, registry.Register(saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		sagatest.Step("create-order", "order"),
+		saga.Sleep("wait", time.Minute),
+		sagatest.Step("create-payment", "payment"),
+	})))
+	store := saga.NewMemoryStore()
+	executor := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: store, Clock: clock})
+	ctx := tenantCtx()
+
+	instance, err := executor.Start(ctx, "checkout", nil)
+	require.NoError(t, err)
+	require.Equal(t, saga.StatusWaiting, instance.Status)
+
+	clock.Advance(time.Minute)
+	results, err := executor.Recover(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Err)
+
+	history, err := executor.History(ctx, instance.ID)
+	require.NoError(t, err)
+	require.Equal(t, []saga.EventType{
+		saga.EventSagaStarted,
+		saga.EventStepStarted, saga.EventStepCompleted,
+		saga.EventStepStarted, saga.EventStepWaiting, saga.EventStepCompleted,
+		saga.EventStepStarted, saga.EventStepCompleted,
+		saga.EventSagaCompleted,
+	}, eventTypes(history))
+	require.Equal(t, clock.Now(), history[5].At)
+}
+
+func TestReplay_RejectsBrokenHistories(t *testing.T) {
+	_, err := saga.Replay(nil)
+	require.Error(t, err)
+
+	_, err = saga.Replay([]saga.Event{
+		{InstanceID: "1", Sequence: 1, Type: saga.EventSagaStarted},
+		{InstanceID: "1", Sequence: 3, Type: saga.EventStepStarted},
+	})
+	require.Error(t, err)
+}
+
+func TestMemoryStore_AppendEvents_RejectsTakenSequences(t *testing.T) {
+	store := saga.NewMemoryStore()
+	ctx := tenantCtx()
+
+	require.NoError(t, store.AppendEvents(ctx, []saga.Event{{InstanceID: "1", Sequence: 1}, {InstanceID: "1", Sequence: 2}}))
+	require.ErrorIs(t, store.AppendEvents(ctx, []saga.Event{{InstanceID: "1", Sequence: 2}}), saga.ErrEventConflict)
+	require.NoError(t, store.AppendEvents(ctx, []saga.Event{{InstanceID: "2", Sequence: 1}}))
+
+	events, err := store.ReadEvents(ctx, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, int64(2), events[0].Position)
+	require.Equal(t, int64(3), events[1].Position)
+}
+
+func TestProjector_CatchUp(t *testing.T) {
+	clock := sagatest.NewFakeClock(time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC))
+	registry := saga.NewRegistry()
+	require.NoError(t, registry.Register(saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		sagatest.Step("create-payment", "payment"),
+		saga.Sleep("wait-for-stock", time.Minute),
+		sagatest.Step("create-delivery", "delivery"),
+	})))
+	executor := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: saga.NewMemoryStore(), Clock: clock})
+	ctx := tenantCtx()
+
+	// instances paid but not delivered yet
+	awaitingDelivery := map[string]bool{}
+	projector := saga.NewProjector(executor, saga.ProjectionFunc(func(ctx context.Context, event saga.Event) error {
+		if event.Type != saga.EventStepCompleted {
+			return nil
+		}
+		switch event.Step {
+		case 0:
+			awaitingDelivery[event.InstanceID] = true
+		case 2:
+			delete(awaitingDelivery, event.InstanceID)
+		}
+		return nil
+	}), 0, time.Second)
+
+	first, err := executor.Start(ctx, "checkout", nil)
+	require.NoError(t, err)
+	clock.Advance(30 * time.Second)
+	second, err := executor.Start(ctx, "checkout", nil)
+	require.NoError(t, err)
+
+	count, err := projector.CatchUp(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 10, count)
+	require.Equal(t, map[string]bool{first.ID: true, second.ID: true}, awaitingDelivery)
+
+	clock.Advance(30 * time.Second)
+	_, err = executor.Recover(ctx)
+	require.NoError(t, err)
+
+	_, err = projector.CatchUp(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{second.ID: true}, awaitingDelivery)
+
+	count, err = projector.CatchUp(ctx)
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+// inFlightStore hides the events at the positions in inFlight, as a store does with appends not committed yet
+type inFlightStore struct {
+	*saga.MemoryStore
+	inFlight map[int64]bool
+}
+
+func (s *inFlightStore) ReadEvents(ctx context.Context, after int64, limit int) ([]saga.Event, error) {
+	events, err := s.MemoryStore.ReadEvents(ctx, after, limit)
+	visible := events[:0]
+	for _, event := range events {
+		if !s.inFlight[event.Position] {
+			visible = append(visible, event)
+		}
+	}
+
+	return visible, err
+}
+
+func TestProjector_CatchUp_WaitsForGaps(t *testing.T) {
+	clock := sagatest.NewFakeClock(time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC))
+	registry := saga.NewRegistry()
+	require.NoError(t, registry.Register(saga.NewVersionedSaga("checkout", 1, []saga.Step{sagatest.Step("create-payment", "payment")})))
+	store := &inFlightStore{MemoryStore: saga.NewMemoryStore(), inFlight: map[int64]bool{}}
+	executor := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: store, Clock: clock})
+	ctx := tenantCtx()
+
+	var projected []int64
+	projector := saga.NewProjector(executor, saga.ProjectionFunc(func(ctx context.Context, event saga.Event) error {
+		projected = append(projected, event.Position)
+		return nil
+	}), 0, time.Second)
+	projector.SetGapTimeout(time.Minute)
+
+	_, err := executor.Start(ctx, "checkout", nil)
+	require.NoError(t, err)
+	_, err = executor.Start(ctx, "checkout", nil)
+	require.NoError(t, err)
+	store.inFlight[2] = true
+	store.inFlight[7] = true
+
+	// the events after a missing position wait for it
+	count, err := projector.CatchUp(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	require.Equal(t, int64(1), projector.Position())
+
+	delete(store.inFlight, 2)
+	count, err = projector.CatchUp(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 5, count)
+	require.Equal(t, []int64{1, 2, 3, 4, 5, 6}, projected)
+
+	// positions that are never filled, e.g. of failed appends, are skipped after the gap timeout
+	clock.Advance(30 * time.Second)
+	count, err = projector.CatchUp(ctx)
+	require.NoError(t, err)
+	require.Zero(t, count)
+	clock.Advance(30 * time.Second)
+	count, err = projector.CatchUp(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	require.Equal(t, []int64{1, 2, 3, 4, 5, 6, 8}, projected)
+}
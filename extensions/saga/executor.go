@@ -0,0 +1,691 @@
+package saga
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+)
+
+// ExecutionError is returned by the Executor when a saga could not complete and was compensated
+type ExecutionError struct {
+	InstanceID         string
+	Errors             []error
+	CompensationErrors []error
+}
+
+func (e *ExecutionError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+
+	return fmt.Sprintf("saga instance %s failed: %s", e.InstanceID, strings.Join(messages, "; "))
+}
+
+// Unwrap returns the error of the step that failed, so callers can inspect it with errors.Is and errors.As
+func (e *ExecutionError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	return e.Errors[0]
+}
+
+// Executor runs saga definitions from a Registry and persists their progress in a Store,
+// so unfinished instances can be resumed with the definition version they were started with.
+//
+// When the Store is a LeaseStore, the Executor owns the instances it runs through leases: it renews them
+// with heartbeats while running, and only recovers instances whose lease is free or expired, so several
+// replicas can share the same store without resuming the same instance twice.
+//
+// When the Store is an EventStore, the Executor also records the history of the instances, and resumes them
+// from their history rather than from their last saved state.
+//
+// When the Store is a KeyStore, sagas can be started once per business key, see StartWithKey.
+type Executor struct {
+	registry *Registry
+	store    Store
+	leases   LeaseStore
+	events   EventStore
+	keys     KeyStore
+	owner    string
+	leaseTTL time.Duration
+	batch    int
+	clock    Clock
+	// awaitInterval is how often StartWithKey checks an instance running elsewhere
+	awaitInterval time.Duration
+}
+
+type ExecutorSettings struct {
+	Registry *Registry
+	Store    Store
+	// Owner identifies this replica in leases, followed by a token unique to each run. Defaults to a random id.
+	Owner string
+	// LeaseTTL is how long an instance stays owned by this replica without a heartbeat. Defaults to 30s.
+	// Heartbeats are sent every third of it.
+	LeaseTTL time.Duration
+	// RecoveryBatchSize is the number of instances claimed at once by Recover. Defaults to 10.
+	RecoveryBatchSize int
+	// Clock defaults to the system clock
+	Clock Clock
+	// AwaitInterval is how often StartWithKey checks whether an instance it attached to stopped running.
+	// Defaults to 100ms.
+	AwaitInterval time.Duration
+}
+
+func NewExecutor(s ExecutorSettings) *Executor {
+	if s.Owner == "" {
+		s.Owner = newInstanceID()
+	}
+	if s.LeaseTTL <= 0 {
+		s.LeaseTTL = 30 * time.Second
+	}
+	if s.RecoveryBatchSize <= 0 {
+		s.RecoveryBatchSize = 10
+	}
+	if s.Clock == nil {
+		s.Clock = systemClock{}
+	}
+	if s.AwaitInterval <= 0 {
+		s.AwaitInterval = 100 * time.Millisecond
+	}
+
+	leases, _ := s.Store.(LeaseStore)
+	events, _ := s.Store.(EventStore)
+	keys, _ := s.Store.(KeyStore)
+
+	return &Executor{
+		registry: s.Registry,
+		store:    s.Store,
+		leases:   leases,
+		events:   events,
+		keys:     keys,
+		owner:    s.Owner,
+		leaseTTL: s.LeaseTTL,
+		batch:    s.RecoveryBatchSize,
+		clock:    s.Clock,
+
+		awaitInterval: s.AwaitInterval,
+	}
+}
+
+// Start creates an instance of the latest version of the saga and executes it with payload as its initial
+// ParamKey value. If the saga fails and is compensated, the returned error is an *ExecutionError.
+// If it reaches a timer or signal step, it returns the instance with StatusWaiting, to be resumed by a Scheduler
+// or by SignalSaga.
+func (e *Executor) Start(ctx context.Context, name string, payload interface{}) (Instance, error) {
+	return e.start(ctx, name, "", payload)
+}
+
+// start creates and executes an instance of the latest version of the saga, with an optional business key.
+// Every instance belongs to the tenant it is started for, so it fails with tenant.ErrMissing without one.
+func (e *Executor) start(ctx context.Context, name string, key string, payload interface{}) (Instance, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return Instance{}, err
+	}
+	s, err := e.registry.Latest(name)
+	if err != nil {
+		return Instance{}, err
+	}
+
+	now := e.clock.Now()
+	instance := Instance{
+		ID:          newInstanceID(),
+		SagaName:    s.Name,
+		SagaVersion: s.Version,
+		Tenant:      tenantID,
+		BusinessKey: key,
+		Status:      StatusRunning,
+		Payload:     payload,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if e.leases != nil {
+		instance.Lease = e.newLease()
+	}
+	encoded, err := e.encode(ctx, instance)
+	if err != nil {
+		return Instance{}, err
+	}
+	if err := e.store.CreateInstance(ctx, encoded); err != nil {
+		return Instance{}, fmt.Errorf("creating saga instance: %w", err)
+	}
+
+	sequence := noHistory
+	if e.events != nil {
+		sequence = 0
+		started := Event{InstanceID: instance.ID, Type: EventSagaStarted, SagaName: s.Name, SagaVersion: s.Version,
+			Tenant: instance.Tenant, Payload: payload, At: now}
+		if sequence, err = e.appendEvents(ctx, sequence, []Event{started}); err != nil {
+			return Instance{}, fmt.Errorf("recording history of saga instance %s: %w", instance.ID, err)
+		}
+	}
+
+	return e.run(ctx, s, instance, sequence, nil)
+}
+
+// Resume continues an unfinished instance with the exact definition version it was started with.
+// If that version is no longer registered it returns a *VersionNotFoundError and leaves the instance untouched.
+// With a LeaseStore, it returns ErrLeaseLost if another replica owns the instance.
+func (e *Executor) Resume(ctx context.Context, id string) (Instance, error) {
+	instance, sequence, err := e.getInstance(ctx, id)
+	if err != nil {
+		return instance, err
+	}
+	if instance.Finished() {
+		return instance, nil
+	}
+
+	s, err := e.registry.Get(instance.SagaName, instance.SagaVersion)
+	if err != nil {
+		return instance, err
+	}
+	if e.leases != nil {
+		claimed, claimedSequence, err := e.claimInstance(ctx, id)
+		if err != nil {
+			return instance, err
+		}
+		// it may have finished in the meantime
+		if claimed.Finished() {
+			if err := e.leases.ReleaseLease(ctx, id, claimed.Lease.Owner); err != nil && !errors.Is(err, ErrLeaseLost) {
+				return claimed, fmt.Errorf("releasing lease of saga instance %s: %w", id, err)
+			}
+			return claimed, nil
+		}
+		instance, sequence = claimed, claimedSequence
+	}
+
+	return e.run(ctx, s, instance, sequence, nil)
+}
+
+// SignalSaga delivers a signal to an instance waiting for it in a signal step, and resumes the instance
+// with payload as the step output. It returns ErrNotWaitingForSignal if the instance does not wait for that
+// signal, and ErrLeaseLost if another replica is resuming it at the same time, e.g. because it timed out.
+// The replies to commands cannot be signaled, see ReplySignalPrefix.
+func (e *Executor) SignalSaga(ctx context.Context, instanceID string, signalName string, payload interface{}) (Instance, error) {
+	if reserved(signalName) {
+		return Instance{}, ErrReservedSignal
+	}
+	return e.deliver(ctx, instanceID, &signal{name: signalName, payload: payload})
+}
+
+func (e *Executor) deliver(ctx context.Context, instanceID string, sig *signal) (Instance, error) {
+	signalName := sig.name
+	instance, sequence, err := e.getInstance(ctx, instanceID)
+	if err != nil {
+		return instance, err
+	}
+	if instance.Status != StatusWaiting || instance.WaitingFor != signalName {
+		return instance, ErrNotWaitingForSignal
+	}
+
+	s, err := e.registry.Get(instance.SagaName, instance.SagaVersion)
+	if err != nil {
+		return instance, err
+	}
+	if e.leases != nil {
+		claimed, claimedSequence, err := e.claimInstance(ctx, instanceID)
+		if err != nil {
+			return instance, err
+		}
+		// it may have timed out or been signaled in the meantime
+		if claimed.Status != StatusWaiting || claimed.WaitingFor != signalName {
+			if err := e.leases.ReleaseLease(ctx, instanceID, claimed.Lease.Owner); err != nil {
+				return claimed, fmt.Errorf("releasing lease of saga instance %s: %w", instanceID, err)
+			}
+			return claimed, ErrNotWaitingForSignal
+		}
+		instance, sequence = claimed, claimedSequence
+	}
+
+	return e.run(ctx, s, instance, sequence, sig)
+}
+
+// Get returns an instance from the store, with its payload decoded.
+// Sensitive payloads are redacted unless the caller has payload access, see WithPayloadAccess.
+// Instances of other tenants than the one of ctx are not found.
+func (e *Executor) Get(ctx context.Context, id string) (Instance, error) {
+	instance, err := e.lookup(ctx, id)
+	if err != nil {
+		return Instance{}, err
+	}
+
+	return e.view(ctx, instance)
+}
+
+// List returns the unfinished instances of the store visible from ctx, with their payloads decoded or redacted
+// as with Get
+func (e *Executor) List(ctx context.Context) ([]Instance, error) {
+	instances, err := e.store.ListUnfinishedInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]Instance, 0, len(instances))
+	for _, instance := range instances {
+		if !tenant.Visible(ctx, instance.Tenant) {
+			continue
+		}
+		view, err := e.view(ctx, instance)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, view)
+	}
+
+	return views, nil
+}
+
+// History returns the events of an instance, with their payloads decoded or redacted as with Get.
+// It fails if the Store is not an EventStore.
+func (e *Executor) History(ctx context.Context, id string) ([]Event, error) {
+	if e.events == nil {
+		return nil, errors.New("saga store does not keep histories")
+	}
+
+	if _, err := e.lookup(ctx, id); err != nil {
+		return nil, err
+	}
+	events, err := e.events.ListEvents(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range events {
+		if !HasPayloadAccess(ctx) {
+			if payload, redacted := e.registry.RedactPayload(events[i].Payload); redacted {
+				events[i].Payload = payload
+				continue
+			}
+		}
+		if events[i].Payload, err = e.registry.DecodePayload(ctx, eventOwner(events[i]), events[i].Payload); err != nil {
+			return nil, fmt.Errorf("decoding payload of event %d of saga instance %s: %w", events[i].Sequence, id, err)
+		}
+	}
+
+	return events, nil
+}
+
+// RecoveryResult tells what happened to an instance resumed by Recover
+type RecoveryResult struct {
+	Instance Instance
+	// Err is a *VersionNotFoundError if the instance could not be resumed because its version was removed,
+	// an *ExecutionError if it was compensated, or any other error that stopped it
+	Err error
+}
+
+// Recover resumes unfinished instances that are due, one at a time: instances whose timer fired and instances
+// that stopped before reaching the end, e.g. because of a crash or a deploy.
+// With a LeaseStore it only claims instances whose lease is free or expired, RecoveryBatchSize at a time;
+// otherwise it resumes every unfinished instance of the store visible from ctx, which is only safe with a single
+// replica. Background jobs recovering every tenant pass a tenant.WithSystem context.
+func (e *Executor) Recover(ctx context.Context) ([]RecoveryResult, error) {
+	var instances []Instance
+	var owner string
+	var err error
+	if e.leases != nil {
+		// the batch is run by this call alone, under its own lease token
+		lease := e.newLease()
+		owner = lease.Owner
+		instances, err = e.leases.ClaimInstances(ctx, lease, e.clock.Now(), e.batch)
+	} else {
+		instances, err = e.dueInstances(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listing unfinished saga instances: %w", err)
+	}
+
+	results := make([]RecoveryResult, 0, len(instances))
+	for _, instance := range instances {
+		// claims span every tenant, the instances ctx cannot see are left to a context that can
+		if !tenant.Visible(ctx, instance.Tenant) {
+			if e.leases != nil {
+				if err := e.leases.ReleaseLease(ctx, instance.ID, owner); err != nil {
+					results = append(results, RecoveryResult{Instance: instance, Err: err})
+				}
+			}
+			continue
+		}
+		instance, sequence, err := e.rebuild(ctx, instance)
+		if err != nil {
+			results = append(results, RecoveryResult{Instance: instance, Err: err})
+			continue
+		}
+		// its history may have finished since the claimed row was saved, e.g. compensated by another run
+		if instance.Finished() {
+			if e.leases != nil {
+				if err := e.leases.ReleaseLease(ctx, instance.ID, owner); err != nil && !errors.Is(err, ErrLeaseLost) {
+					results = append(results, RecoveryResult{Instance: instance, Err: err})
+				}
+			}
+			continue
+		}
+		s, err := e.registry.Get(instance.SagaName, instance.SagaVersion)
+		if err != nil {
+			results = append(results, RecoveryResult{Instance: instance, Err: err})
+			continue
+		}
+		// instances of the batch waiting for their turn get no heartbeats, so their lease may have expired
+		if e.leases != nil {
+			if err := e.leases.RenewLease(ctx, instance.ID, e.renewal(owner)); err != nil {
+				results = append(results, RecoveryResult{Instance: instance, Err: err})
+				continue
+			}
+		}
+
+		resumed, err := e.run(ctx, s, instance, sequence, nil)
+		results = append(results, RecoveryResult{Instance: resumed, Err: err})
+	}
+
+	return results, nil
+}
+
+// run executes an instance, whose history has sequence events, or noHistory if it is not recorded
+func (e *Executor) run(ctx context.Context, s Saga, instance Instance, sequence int, sig *signal) (Instance, error) {
+	ctx = onBehalfOf(ctx, instance)
+	var leaseLost <-chan struct{}
+	if e.leases != nil {
+		heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+		defer stopHeartbeat()
+		leaseLost = e.heartbeat(heartbeatCtx, instance.ID, instance.Lease.Owner)
+	}
+
+	coordinator := NewCoordinator(s)
+	coordinator.now = e.clock.Now
+	coordinator.signal = sig
+	coordinator.observe = func(ctx context.Context, p progress) error {
+		select {
+		case <-leaseLost:
+			return ErrLeaseLost
+		default:
+		}
+
+		instance.Status = p.status
+		instance.Step = p.step
+		instance.Payload = p.payload
+		instance.WakeAt = p.wakeAt
+		instance.WaitingFor = p.waitingFor
+		instance.Failures = p.failures
+		switch {
+		case p.event == EventStepRetrying || p.event == EventStepStuck:
+			// a Forward saga may fail many times, only its last failure is kept
+			instance.Errors = []string{p.err.Error()}
+		case p.err != nil:
+			instance.Errors = append(instance.Errors, p.err.Error())
+		}
+		if p.compensationErr != nil {
+			instance.CompensationErrors = append(instance.CompensationErrors, p.compensationErr.Error())
+		}
+		instance.UpdatedAt = e.clock.Now()
+
+		// starting a step changes nothing but the history
+		if p.event != EventStepStarted {
+			encoded, err := e.encode(ctx, instance)
+			if err != nil {
+				return err
+			}
+			if err := e.store.UpdateInstance(ctx, encoded); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		sequence, err = e.appendEvents(ctx, sequence, progressEvents(s, instance, p, instance.UpdatedAt))
+		return err
+	}
+
+	_, ok := coordinator.resume(ctx, instance)
+	if coordinator.interruption != nil {
+		return instance, fmt.Errorf("persisting saga instance %s: %w", instance.ID, coordinator.interruption)
+	}
+	if coordinator.suspended {
+		suspended, err := e.suspend(ctx, instance)
+		if err != nil || coordinator.request == nil {
+			return suspended, err
+		}
+		if err := coordinator.request(); err != nil {
+			return e.deliver(ctx, instance.ID, &signal{name: instance.WaitingFor, err: err})
+		}
+		return suspended, nil
+	}
+	if !ok {
+		return instance, newExecutionError(instance, coordinator)
+	}
+
+	return instance, nil
+}
+
+// suspend gives up the lease of a waiting instance, so whichever replica is running a Scheduler when
+// its timer fires can resume it
+func (e *Executor) suspend(ctx context.Context, instance Instance) (Instance, error) {
+	if e.leases == nil {
+		return instance, nil
+	}
+
+	if err := e.leases.ReleaseLease(ctx, instance.ID, instance.Lease.Owner); err != nil && !errors.Is(err, ErrLeaseLost) {
+		return instance, fmt.Errorf("releasing lease of saga instance %s: %w", instance.ID, err)
+	}
+	instance.Lease = Lease{}
+
+	return instance, nil
+}
+
+func (e *Executor) dueInstances(ctx context.Context) ([]Instance, error) {
+	instances, err := e.store.ListUnfinishedInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	due := instances[:0]
+	for _, instance := range instances {
+		if instance.Due(e.clock.Now()) {
+			due = append(due, instance)
+		}
+	}
+
+	return due, nil
+}
+
+// onBehalfOf returns a context acting on behalf of the tenant the instance was started for, so resumed instances
+// only see their own tenant's data
+func onBehalfOf(ctx context.Context, instance Instance) context.Context {
+	if instance.Tenant == "" {
+		return ctx
+	}
+
+	return tenant.WithID(ctx, instance.Tenant)
+}
+
+// getInstance loads an instance visible from ctx with its payload decoded, see rebuild
+func (e *Executor) getInstance(ctx context.Context, id string) (Instance, int, error) {
+	instance, err := e.lookup(ctx, id)
+	if err != nil {
+		return Instance{}, noHistory, err
+	}
+
+	return e.rebuild(ctx, instance)
+}
+
+// lookup returns a stored instance, or ErrInstanceNotFound if it belongs to another tenant than the one of ctx
+func (e *Executor) lookup(ctx context.Context, id string) (Instance, error) {
+	instance, err := e.store.GetInstance(ctx, id)
+	if err != nil {
+		return Instance{}, err
+	}
+	if !tenant.Visible(ctx, instance.Tenant) {
+		return Instance{}, ErrInstanceNotFound
+	}
+
+	return instance, nil
+}
+
+func (e *Executor) claimInstance(ctx context.Context, id string) (Instance, int, error) {
+	instance, err := e.leases.ClaimInstance(ctx, id, e.newLease(), e.clock.Now())
+	if err != nil {
+		return Instance{}, noHistory, err
+	}
+
+	return e.rebuild(ctx, instance)
+}
+
+// noHistory is the sequence of instances whose history is not recorded: either the Store is not an EventStore,
+// or the instance was started before it was
+const noHistory = -1
+
+// rebuild replays the history of a stored instance, keeping its lease, and returns it with the sequence of its
+// last event. Without a history, it decodes the stored instance.
+func (e *Executor) rebuild(ctx context.Context, stored Instance) (Instance, int, error) {
+	ctx = onBehalfOf(ctx, stored)
+	if e.events == nil {
+		instance, err := e.decode(ctx, stored)
+		return instance, noHistory, err
+	}
+
+	events, err := e.events.ListEvents(ctx, stored.ID)
+	if err != nil {
+		return stored, noHistory, fmt.Errorf("loading history of saga instance %s: %w", stored.ID, err)
+	}
+	if len(events) == 0 {
+		instance, err := e.decode(ctx, stored)
+		return instance, noHistory, err
+	}
+
+	instance, err := Replay(events)
+	if err != nil {
+		return stored, noHistory, err
+	}
+	instance.Lease = stored.Lease
+	instance.BusinessKey = stored.BusinessKey
+	// the payload is the one of the last event
+	last := events[len(events)-1]
+	if instance.Payload, err = e.registry.DecodePayload(ctx, eventOwner(last), instance.Payload); err != nil {
+		return instance, len(events), fmt.Errorf("decoding payload of event %d of saga instance %s: %w", last.Sequence, stored.ID, err)
+	}
+
+	return instance, len(events), nil
+}
+
+// appendEvents records events after the sequence-th event of the history of their instance, and returns
+// the sequence of the last one
+func (e *Executor) appendEvents(ctx context.Context, sequence int, events []Event) (int, error) {
+	if e.events == nil || sequence == noHistory {
+		return sequence, nil
+	}
+
+	for i := range events {
+		sequence++
+		events[i].Sequence = sequence
+		payload, err := e.registry.EncodePayload(ctx, eventOwner(events[i]), events[i].Payload)
+		if err != nil {
+			return sequence, fmt.Errorf("encoding payload of saga event: %w", err)
+		}
+		events[i].Payload = payload
+	}
+
+	return sequence, e.events.AppendEvents(ctx, events)
+}
+
+// encode serializes the payload of an instance before it is handed to the store
+func (e *Executor) encode(ctx context.Context, instance Instance) (Instance, error) {
+	payload, err := e.registry.EncodePayload(ctx, instanceOwner(instance), instance.Payload)
+	if err != nil {
+		return instance, fmt.Errorf("encoding payload of saga instance %s: %w", instance.ID, err)
+	}
+	instance.Payload = payload
+
+	return instance, nil
+}
+
+func (e *Executor) decode(ctx context.Context, instance Instance) (Instance, error) {
+	payload, err := e.registry.DecodePayload(ctx, instanceOwner(instance), instance.Payload)
+	if err != nil {
+		return instance, fmt.Errorf("decoding payload of saga instance %s: %w", instance.ID, err)
+	}
+	instance.Payload = payload
+
+	return instance, nil
+}
+
+// view decodes the payload of a stored instance for callers with payload access, and redacts sensitive ones otherwise
+func (e *Executor) view(ctx context.Context, instance Instance) (Instance, error) {
+	if !HasPayloadAccess(ctx) {
+		if payload, redacted := e.registry.RedactPayload(instance.Payload); redacted {
+			instance.Payload = payload
+			return instance, nil
+		}
+	}
+
+	return e.decode(ctx, instance)
+}
+
+// newLease returns a lease for a single run of this replica. Each run has its own token, so two runs of the same
+// replica never both own an instance, e.g. a reply delivered while the instance is being recovered.
+func (e *Executor) newLease() Lease {
+	return e.renewal(e.owner + "/" + newInstanceID())
+}
+
+// renewal extends the lease held by owner
+func (e *Executor) renewal(owner string) Lease {
+	return Lease{Owner: owner, ExpiresAt: e.clock.Now().Add(e.leaseTTL)}
+}
+
+// heartbeat renews the lease owner holds on the instance until ctx is done.
+// The returned channel is closed if the lease is lost, after which the instance must not be updated anymore.
+func (e *Executor) heartbeat(ctx context.Context, id string, owner string) <-chan struct{} {
+	lost := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(e.leaseTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if err := e.leases.RenewLease(ctx, id, e.renewal(owner)); errors.Is(err, ErrLeaseLost) {
+				close(lost)
+				return
+			}
+		}
+	}()
+
+	return lost
+}
+
+// newExecutionError returns the errors of the coordinator that ran the instance, or of the instance itself
+// without one
+func newExecutionError(instance Instance, c *Coordinator) *ExecutionError {
+	execErr := &ExecutionError{InstanceID: instance.ID}
+	if c != nil {
+		execErr.Errors = c.GetErrors()
+		execErr.CompensationErrors = c.GetCompensationErrors()
+	}
+
+	// a resumed compensation only knows the errors of the previous run by their messages
+	if len(execErr.Errors) == 0 {
+		for _, message := range instance.Errors {
+			execErr.Errors = append(execErr.Errors, errors.New(message))
+		}
+	}
+
+	return execErr
+}
+
+func newInstanceID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("saga: generating instance id: %v", err))
+	}
+
+	return hex.EncodeToString(b)
+}
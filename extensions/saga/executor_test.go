@@ -0,0 +1,198 @@
+package saga_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/saga/sagatest"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+	"github.com/stretchr/testify/require"
+)
+
+func newExecutor(t *testing.T, sagas ...saga.Saga) (*saga.Executor, *saga.Registry, *saga.MemoryStore) {
+	registry := saga.NewRegistry()
+	for _, s := range sagas {
+		require.NoError(t, registry.Register(s))
+	}
+	store := saga.NewMemoryStore()
+
+	return saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: store}), registry, store
+}
+
+func TestExecutor_Start_PersistsVersionAndResult(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	v1 := rec.Wrap(saga.NewVersionedSaga("checkout", 1, []saga.Step{sagatest.Step("v1", "result v1")}))
+	v2 := rec.Wrap(saga.NewVersionedSaga("checkout", 2, []saga.Step{sagatest.Step("v2", "result v2")}))
+	executor, _, store := newExecutor(t, v1, v2)
+
+	instance, err := executor.Start(tenantCtx(), "checkout", nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, instance.SagaVersion)
+	require.Equal(t, saga.StatusCompleted, instance.Status)
+	require.Equal(t, "result v2", instance.Payload)
+
+	stored, err := store.GetInstance(tenantCtx(), instance.ID)
+	require.NoError(t, err)
+	require.Equal(t, instance, stored)
+	rec.AssertCommands(t, "v2")
+}
+
+func TestExecutor_Start_Compensation(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	stepErr := errors.New("step failed")
+	s := rec.Wrap(saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		sagatest.Step("first", 1),
+		sagatest.Step("second", 2),
+	}), sagatest.FailStep(1, 1, stepErr))
+	executor, _, _ := newExecutor(t, s)
+
+	instance, err := executor.Start(tenantCtx(), "checkout", nil)
+
+	var execErr *saga.ExecutionError
+	require.ErrorAs(t, err, &execErr)
+	require.ErrorIs(t, err, stepErr)
+	require.Equal(t, saga.StatusCompensated, instance.Status)
+	require.Equal(t, []string{"step failed"}, instance.Errors)
+	rec.AssertCompensations(t, "second", "first")
+}
+
+func TestExecutor_Recover_UsesStartedVersion(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	v1 := rec.Wrap(saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		sagatest.Step("v1-first", 1),
+		sagatest.Step("v1-second", 2),
+	}))
+	v2 := rec.Wrap(saga.NewVersionedSaga("checkout", 2, []saga.Step{
+		sagatest.Step("v2-first", 1),
+		sagatest.Step("v2-second", 2),
+	}))
+	executor, _, store := newExecutor(t, v1, v2)
+
+	// an instance started with version 1 crashed after its first step
+	require.NoError(t, store.CreateInstance(tenantCtx(), saga.Instance{
+		ID:          "crashed",
+		SagaName:    "checkout",
+		SagaVersion: 1,
+		Tenant:      "acme",
+		Status:      saga.StatusRunning,
+		Step:        1,
+		Payload:     1,
+		CreatedAt:   time.Now(),
+	}))
+
+	results, err := executor.Recover(tenantCtx())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Err)
+	require.Equal(t, saga.StatusCompleted, results[0].Instance.Status)
+	rec.AssertCommands(t, "v1-second")
+}
+
+func TestExecutor_Recover_ReportsRemovedVersion(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	v1 := rec.Wrap(saga.NewVersionedSaga("checkout", 1, []saga.Step{sagatest.Step("v1", 1)}))
+	v2 := rec.Wrap(saga.NewVersionedSaga("checkout", 2, []saga.Step{sagatest.Step("v2", 2)}))
+	executor, registry, store := newExecutor(t, v1, v2)
+	registry.Unregister("checkout", 1)
+
+	orphan := saga.Instance{ID: "orphan", SagaName: "checkout", SagaVersion: 1, Tenant: "acme", Status: saga.StatusRunning}
+	require.NoError(t, store.CreateInstance(tenantCtx(), orphan))
+
+	results, err := executor.Recover(tenantCtx())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	var notFound *saga.VersionNotFoundError
+	require.ErrorAs(t, results[0].Err, &notFound)
+	require.Equal(t, 1, notFound.Version)
+	rec.AssertCommands(t)
+
+	// the instance keeps its progress, and stays claimed until its lease expires
+	stored, err := store.GetInstance(tenantCtx(), "orphan")
+	require.NoError(t, err)
+	require.NotEmpty(t, stored.Lease.Owner)
+	stored.Lease = saga.Lease{}
+	require.Equal(t, orphan, stored)
+}
+
+func TestRegistry_Register_RejectsDuplicates(t *testing.T) {
+	registry := saga.NewRegistry()
+	s := saga.NewVersionedSaga("checkout", 1, []saga.Step{sagatest.Step("first", 1)})
+
+	require.NoError(t, registry.Register(s))
+	require.Error(t, registry.Register(s))
+	require.Error(t, registry.Register(saga.NewSaga(s.Steps)))
+}
+
+func TestExecutor_Tenants_IsolateInstances(t *testing.T) {
+	var tenants []string
+	s := saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		saga.Sleep("wait-for-stock", time.Minute),
+		{
+			Name: "capture-payment",
+			Command: func(ctx context.Context) (interface{}, error) {
+				tenants = append(tenants, tenant.ID(ctx))
+				return nil, nil
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) { return nil, nil },
+		},
+	})
+	clock := sagatest.NewFakeClock(time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC))
+	registry := saga.NewRegistry()
+	require.NoError(t, registry.Register(s))
+	executor := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: saga.NewMemoryStore(), Clock: clock})
+	acme := tenant.WithID(context.Background(), "acme")
+	globex := tenant.WithID(context.Background(), "globex")
+
+	instance, err := executor.Start(acme, "checkout", nil)
+	require.NoError(t, err)
+	require.Equal(t, "acme", instance.Tenant)
+
+	_, err = executor.Get(globex, instance.ID)
+	require.ErrorIs(t, err, saga.ErrInstanceNotFound)
+	_, err = executor.History(globex, instance.ID)
+	require.ErrorIs(t, err, saga.ErrInstanceNotFound)
+	_, err = executor.Resume(globex, instance.ID)
+	require.ErrorIs(t, err, saga.ErrInstanceNotFound)
+	listed, err := executor.List(globex)
+	require.NoError(t, err)
+	require.Empty(t, listed)
+
+	listed, err = executor.List(acme)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+
+	// a context missing its tenant sees no instance, and cannot start one
+	_, err = executor.Start(context.Background(), "checkout", nil)
+	require.ErrorIs(t, err, tenant.ErrMissing)
+	_, err = executor.Get(context.Background(), instance.ID)
+	require.ErrorIs(t, err, saga.ErrInstanceNotFound)
+	listed, err = executor.List(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, listed)
+	clock.Advance(time.Minute)
+	results, err := executor.Recover(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, results)
+
+	// the scheduler works on behalf of every tenant, and resumes each instance on behalf of its own
+	results, err = executor.Recover(tenant.WithSystem(context.Background()))
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, saga.StatusCompleted, results[0].Instance.Status)
+	require.Equal(t, []string{"acme"}, tenants)
+
+	events, err := executor.History(acme, instance.ID)
+	require.NoError(t, err)
+	for _, event := range events {
+		require.Equal(t, "acme", event.Tenant)
+	}
+}
+
+// tenantCtx returns the context of a request made on behalf of a tenant, which every instance is started for
+func tenantCtx() context.Context {
+	return tenant.WithID(context.Background(), "acme")
+}
@@ -0,0 +1,53 @@
+package saga
+
+import "time"
+
+// RecoveryStrategy tells what the coordinator does when a step fails after the retries of its RetryPolicy
+type RecoveryStrategy int
+
+const (
+	// Backward compensates the steps that ran, in reverse order
+	Backward RecoveryStrategy = iota
+	// Forward retries the failed step until it succeeds and never compensates, for sagas that cannot be rolled
+	// back once started, e.g. a refund after the delivery was dispatched
+	Forward
+)
+
+// ForwardRetryPolicy paces the retries of a failed step in Forward recovery
+type ForwardRetryPolicy struct {
+	// Backoff is the delay before the first retry, doubled after every failure. Defaults to 1s.
+	Backoff time.Duration
+	// MaxBackoff caps the delay between retries. Defaults to 5m.
+	MaxBackoff time.Duration
+	// StuckAfter is the number of consecutive failures after which the instance is reported as StatusStuck.
+	// It is still retried every MaxBackoff then. Defaults to 10.
+	StuckAfter int
+}
+
+// delay returns how long to wait before retrying a step that failed failures times in a row
+func (p ForwardRetryPolicy) delay(failures int) time.Duration {
+	backoff, maxBackoff := p.Backoff, p.MaxBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = 5 * time.Minute
+	}
+
+	for i := 1; i < failures && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+
+	return backoff
+}
+
+func (p ForwardRetryPolicy) stuck(failures int) bool {
+	if p.StuckAfter <= 0 {
+		return failures >= 10
+	}
+
+	return failures >= p.StuckAfter
+}
@@ -0,0 +1,120 @@
+package saga_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/saga/sagatest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecutor_Forward_RetriesUntilTheStepSucceeds(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	refundErr := errors.New("refund provider unavailable")
+	s := saga.NewVersionedSaga("refund", 1, []saga.Step{
+		sagatest.Step("dispatch-delivery", "dispatched"),
+		sagatest.Step("refund-payment", "refunded"),
+	})
+	s.Recovery = saga.Forward
+	s.ForwardRetry = saga.ForwardRetryPolicy{Backoff: time.Minute, MaxBackoff: 3 * time.Minute, StuckAfter: 3}
+	s = rec.Wrap(s,
+		sagatest.FailStep(1, 1, refundErr),
+		sagatest.FailStep(1, 2, refundErr),
+		sagatest.FailStep(1, 3, refundErr),
+	)
+	clock := sagatest.NewFakeClock(time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC))
+	registry := saga.NewRegistry()
+	require.NoError(t, registry.Register(s))
+	executor := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: saga.NewMemoryStore(), Clock: clock})
+
+	instance, err := executor.Start(tenantCtx(), "refund", nil)
+	require.NoError(t, err)
+	require.Equal(t, saga.StatusRetrying, instance.Status)
+	require.Equal(t, 1, instance.Step)
+	require.Equal(t, 1, instance.Failures)
+	require.Equal(t, []string{"refund provider unavailable"}, instance.Errors)
+	require.Equal(t, clock.Now().Add(time.Minute), instance.WakeAt)
+
+	// not due yet
+	results, err := executor.Recover(tenantCtx())
+	require.NoError(t, err)
+	require.Empty(t, results)
+
+	clock.Advance(time.Minute)
+	results, err = executor.Recover(tenantCtx())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, saga.StatusRetrying, results[0].Instance.Status)
+	require.Equal(t, 2, results[0].Instance.Failures)
+	require.Equal(t, clock.Now().Add(2*time.Minute), results[0].Instance.WakeAt)
+
+	clock.Advance(2 * time.Minute)
+	results, err = executor.Recover(tenantCtx())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, saga.StatusStuck, results[0].Instance.Status)
+	require.Equal(t, 3, results[0].Instance.Failures)
+	require.Equal(t, clock.Now().Add(3*time.Minute), results[0].Instance.WakeAt)
+
+	// stuck instances are still retried
+	clock.Advance(3 * time.Minute)
+	results, err = executor.Recover(tenantCtx())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Err)
+	require.Equal(t, saga.StatusCompleted, results[0].Instance.Status)
+	require.Equal(t, 0, results[0].Instance.Failures)
+	require.Equal(t, "refunded", results[0].Instance.Payload)
+	rec.AssertCommands(t, "dispatch-delivery", "refund-payment", "refund-payment", "refund-payment", "refund-payment")
+	require.Empty(t, rec.Compensations())
+
+	events, err := executor.History(tenantCtx(), instance.ID)
+	require.NoError(t, err)
+	var types []saga.EventType
+	for _, event := range events {
+		if event.Type == saga.EventStepRetrying || event.Type == saga.EventStepStuck {
+			types = append(types, event.Type)
+		}
+	}
+	require.Equal(t, []saga.EventType{saga.EventStepRetrying, saga.EventStepRetrying, saga.EventStepStuck}, types)
+}
+
+func TestCoordinator_Forward_RetriesInProcessWithoutExecutor(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	s := saga.NewSaga([]saga.Step{
+		sagatest.Step("dispatch-delivery", "dispatched"),
+		sagatest.Step("refund-payment", "refunded"),
+	})
+	s.Recovery = saga.Forward
+	s.ForwardRetry = saga.ForwardRetryPolicy{Backoff: time.Millisecond}
+	s = rec.Wrap(s, sagatest.FailStep(1, 1, errors.New("boom")), sagatest.FailStep(1, 2, errors.New("boom")))
+
+	coordinator := saga.NewCoordinator(s)
+	result, ok := coordinator.Execute(tenantCtx())
+
+	require.True(t, ok)
+	require.Equal(t, "refunded", result)
+	require.Len(t, coordinator.GetErrors(), 2)
+	require.Equal(t, 3, rec.Attempts(1))
+	require.Empty(t, rec.Compensations())
+}
+
+func TestCoordinator_Forward_StopsRetryingWhenTheContextIsDone(t *testing.T) {
+	s := saga.NewSaga([]saga.Step{{
+		Name: "refund-payment",
+		Command: func(ctx context.Context) (interface{}, error) {
+			return nil, errors.New("boom")
+		},
+	}})
+	s.Recovery = saga.Forward
+	s.ForwardRetry = saga.ForwardRetryPolicy{Backoff: time.Millisecond}
+	ctx, cancel := context.WithTimeout(tenantCtx(), 20*time.Millisecond)
+	defer cancel()
+
+	_, ok := saga.NewCoordinator(s).Execute(ctx)
+
+	require.False(t, ok)
+}
@@ -0,0 +1,87 @@
+package saga
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const heartbeatKey = SagaContextKey("saga-context-heartbeat")
+
+// HeartbeatTimeoutError fails a step that did not record a heartbeat within its HeartbeatTimeout
+type HeartbeatTimeoutError struct {
+	Step    string
+	Timeout time.Duration
+}
+
+func (e *HeartbeatTimeoutError) Error() string {
+	return fmt.Sprintf("step %q recorded no heartbeat for %s", e.Step, e.Timeout)
+}
+
+// RecordHeartbeat tells the coordinator that a long-running step command is still making progress.
+// details are optional, e.g. the last item processed. If the attempt fails, they are given to the next attempt
+// through HeartbeatDetails so it can resume where this one stopped. Outside of a step it does nothing.
+func RecordHeartbeat(ctx context.Context, details interface{}) {
+	hb, ok := ctx.Value(heartbeatKey).(*heartbeats)
+	if !ok {
+		return
+	}
+
+	hb.record(details)
+}
+
+// HeartbeatDetails returns the details of the last heartbeat recorded by a previous attempt of the current step.
+// ok is false on the first attempt, or if no previous attempt recorded details.
+func HeartbeatDetails(ctx context.Context) (details interface{}, ok bool) {
+	hb, ok := ctx.Value(heartbeatKey).(*heartbeats)
+	if !ok {
+		return nil, false
+	}
+
+	return hb.previous, hb.hasPrevious
+}
+
+// heartbeats are the heartbeats of a single attempt of a step command
+type heartbeats struct {
+	previous    interface{}
+	hasPrevious bool
+
+	mu       sync.Mutex
+	details  interface{}
+	recorded bool
+	// beat receives a value on every heartbeat. It is buffered so recording never blocks.
+	beat chan struct{}
+}
+
+func newHeartbeats() *heartbeats {
+	return &heartbeats{beat: make(chan struct{}, 1)}
+}
+
+// next returns the heartbeats of the following attempt, which get the last details recorded so far
+func (h *heartbeats) next() *heartbeats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	next := newHeartbeats()
+	next.previous, next.hasPrevious = h.previous, h.hasPrevious
+	if h.recorded {
+		next.previous, next.hasPrevious = h.details, true
+	}
+
+	return next
+}
+
+func (h *heartbeats) record(details interface{}) {
+	h.mu.Lock()
+	if details != nil {
+		h.details = details
+		h.recorded = true
+	}
+	h.mu.Unlock()
+
+	select {
+	case h.beat <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,101 @@
+package saga_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/saga/sagatest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoordinator_Heartbeat_SlowStepSucceeds(t *testing.T) {
+	slow := sagatest.Step("schedule-deliveries", nil)
+	slow.HeartbeatTimeout = 20 * time.Millisecond
+	slow.Command = func(ctx context.Context) (interface{}, error) {
+		for i := 0; i < 10; i++ {
+			time.Sleep(5 * time.Millisecond)
+			saga.RecordHeartbeat(ctx, i)
+		}
+		return "scheduled", nil
+	}
+
+	result, ok := saga.NewCoordinator(saga.NewSaga([]saga.Step{slow})).Execute(tenantCtx())
+
+	require.True(t, ok)
+	require.Equal(t, "scheduled", result)
+}
+
+func TestCoordinator_Heartbeat_DeadStepCompensates(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	stepCtxDone := make(chan struct{})
+	dead := sagatest.Step("schedule-deliveries", nil)
+	dead.HeartbeatTimeout = 20 * time.Millisecond
+	dead.Command = func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		close(stepCtxDone)
+		return nil, ctx.Err()
+	}
+	coordinator := saga.NewCoordinator(rec.Wrap(saga.NewSaga([]saga.Step{sagatest.Step("create-order", 1), dead})))
+
+	_, ok := coordinator.Execute(tenantCtx())
+
+	require.False(t, ok)
+	var timeoutErr *saga.HeartbeatTimeoutError
+	require.ErrorAs(t, coordinator.GetErrors()[0], &timeoutErr)
+	require.Equal(t, "schedule-deliveries", timeoutErr.Step)
+	rec.AssertCompensations(t, "schedule-deliveries", "create-order")
+	select {
+	case <-stepCtxDone:
+	case <-time.After(time.Second):
+		t.Fatal("the context of the dead step was not cancelled")
+	}
+}
+
+func TestCoordinator_Retry_ResumesFromHeartbeatDetails(t *testing.T) {
+	var processed []int
+	bulk := sagatest.Step("schedule-deliveries", nil)
+	bulk.Retry = saga.RetryPolicy{MaxAttempts: 2}
+	bulk.Command = func(ctx context.Context) (interface{}, error) {
+		start := 0
+		if details, ok := saga.HeartbeatDetails(ctx); ok {
+			start = details.(int) + 1
+		}
+		for i := start; i < 6; i++ {
+			if i == 3 && start == 0 {
+				return nil, errors.New("connection reset")
+			}
+			processed = append(processed, i)
+			saga.RecordHeartbeat(ctx, i)
+		}
+		return len(processed), nil
+	}
+
+	result, ok := saga.NewCoordinator(saga.NewSaga([]saga.Step{bulk})).Execute(tenantCtx())
+
+	require.True(t, ok)
+	require.Equal(t, 6, result)
+	require.Equal(t, []int{0, 1, 2, 3, 4, 5}, processed)
+}
+
+func TestCoordinator_Retry_GivesUpAfterMaxAttempts(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	flaky := sagatest.Step("create-payment", 2)
+	flaky.Retry = saga.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	stepErr := errors.New("unavailable")
+	s := rec.Wrap(saga.NewSaga([]saga.Step{flaky}),
+		sagatest.FailStep(0, 1, stepErr), sagatest.FailStep(0, 2, stepErr), sagatest.FailStep(0, 3, stepErr))
+
+	_, ok := saga.NewCoordinator(s).Execute(tenantCtx())
+	require.False(t, ok)
+	require.Equal(t, 3, rec.Attempts(0))
+
+	rec.Reset()
+	s = rec.Wrap(saga.NewSaga([]saga.Step{flaky}), sagatest.FailStep(0, 1, stepErr))
+	result, ok := saga.NewCoordinator(s).Execute(tenantCtx())
+	require.True(t, ok)
+	require.Equal(t, 2, result)
+	require.Equal(t, 2, rec.Attempts(0))
+}
@@ -0,0 +1,68 @@
+package saga
+
+import "time"
+
+type Status string
+
+const (
+	StatusRunning      Status = "running"
+	StatusCompensating Status = "compensating"
+	StatusCompleted    Status = "completed"
+	StatusCompensated  Status = "compensated"
+	// StatusWaiting is the status of an instance suspended by a timer step until its WakeAt,
+	// or by a signal step until it receives the signal it is WaitingFor
+	StatusWaiting Status = "waiting"
+	// StatusRetrying is the status of an instance whose Retriable step, or step of a Forward saga, failed,
+	// until it is retried at WakeAt
+	StatusRetrying Status = "retrying"
+	// StatusStuck is StatusRetrying once the step failed ForwardRetryPolicy.StuckAfter times in a row,
+	// which needs an operator to look into it
+	StatusStuck Status = "stuck"
+)
+
+// Instance is a single execution of a saga definition, as kept by a Store.
+// It records the definition version it was started with, so it can be resumed with that exact
+// definition even after newer versions are deployed.
+type Instance struct {
+	ID          string
+	SagaName    string
+	SagaVersion int
+	// Tenant is the tenant the instance was started for, see tenant.WithID. Its steps run on behalf of that tenant,
+	// and it is only visible to that tenant.
+	Tenant string
+	// BusinessKey is the key the instance was started with by StartWithKey, if any
+	BusinessKey string
+	Status      Status
+	// Step is the index of the next step to execute or, while compensating, of the next step to compensate
+	Step int
+	// Payload is the output of the last completed step, passed down to the next one through ParamKey.
+	// Once the instance is completed it holds the saga result.
+	Payload            interface{}
+	Errors             []string
+	CompensationErrors []string
+	// WakeAt is when a waiting or retrying instance can be resumed. For a signal step it is its timeout,
+	// and it is zero without one.
+	WakeAt time.Time
+	// WaitingFor is the name of the signal a waiting instance expects
+	WaitingFor string
+	// Failures counts the consecutive failures of the current step of a Forward saga or Retriable step
+	Failures int
+	// Lease is only set when the instance is kept in a LeaseStore
+	Lease     Lease
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Due tells whether the instance can be resumed at now, i.e. it is not waiting for a later time
+func (i Instance) Due(now time.Time) bool {
+	if i.Status != StatusWaiting && i.Status != StatusRetrying && i.Status != StatusStuck {
+		return true
+	}
+
+	return !i.WakeAt.IsZero() && !now.Before(i.WakeAt)
+}
+
+// Finished tells whether the instance reached a final status
+func (i Instance) Finished() bool {
+	return i.Status == StatusCompleted || i.Status == StatusCompensated
+}
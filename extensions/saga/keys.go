@@ -0,0 +1,107 @@
+package saga
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeyProvider gives the key-encryption keys protecting sensitive payloads, e.g. from a KMS.
+// Keys are identified so they can be rotated: new payloads use the current key, while payloads encrypted
+// with a previous one can still be decrypted as long as the provider knows it.
+type KeyProvider interface {
+	// CurrentKey returns the key new payloads are encrypted with
+	CurrentKey(ctx context.Context) (id string, key []byte, err error)
+	// Key returns a current or retired key by id
+	Key(ctx context.Context, id string) ([]byte, error)
+}
+
+// LocalKeyProvider keeps AES keys in memory. It is meant for development and tests.
+type LocalKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewLocalKeyProvider creates a provider encrypting with the current key, and decrypting with any of keys.
+// Keys must be 16, 24 or 32 bytes long.
+func NewLocalKeyProvider(current string, keys map[string][]byte) (*LocalKeyProvider, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("current payload key %q is not among the keys", current)
+	}
+	for id, key := range keys {
+		switch len(key) {
+		case 16, 24, 32:
+		default:
+			return nil, fmt.Errorf("payload key %q must be 16, 24 or 32 bytes long, got %d", id, len(key))
+		}
+	}
+
+	return &LocalKeyProvider{current: current, keys: keys}, nil
+}
+
+// ParseLocalKeys reads keys written as comma separated "<id>:<base64 key>" pairs.
+// The first key is the current one, so a key is rotated by prepending a new one.
+func ParseLocalKeys(spec string) (*LocalKeyProvider, error) {
+	var current string
+	keys := map[string][]byte{}
+	for _, pair := range strings.Split(strings.TrimSpace(spec), ",") {
+		id, encoded := splitKeyPair(pair)
+		if id == "" || encoded == "" {
+			return nil, fmt.Errorf("payload keys must be <id>:<base64 key> pairs, got %q", pair)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("decoding payload key %q: %w", id, err)
+		}
+		if current == "" {
+			current = id
+		}
+		keys[id] = key
+	}
+
+	return NewLocalKeyProvider(current, keys)
+}
+
+// LocalKeyProviderFromEnv reads keys in the ParseLocalKeys format from an environment variable
+func LocalKeyProviderFromEnv(name string) (*LocalKeyProvider, error) {
+	spec, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s is not set", name)
+	}
+
+	return ParseLocalKeys(spec)
+}
+
+// LocalKeyProviderFromFile reads keys in the ParseLocalKeys format from a file, one pair per line or comma separated
+func LocalKeyProviderFromFile(path string) (*LocalKeyProvider, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading payload keys: %w", err)
+	}
+
+	return ParseLocalKeys(strings.Join(strings.Fields(string(content)), ","))
+}
+
+func (p *LocalKeyProvider) CurrentKey(_ context.Context) (string, []byte, error) {
+	return p.current, p.keys[p.current], nil
+}
+
+func (p *LocalKeyProvider) Key(_ context.Context, id string) ([]byte, error) {
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown payload key %q", id)
+	}
+
+	return key, nil
+}
+
+func splitKeyPair(pair string) (string, string) {
+	parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+
+	return parts[0], parts[1]
+}
@@ -0,0 +1,41 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrLeaseLost is returned when a replica no longer owns the instance it is running,
+// e.g. because it missed its heartbeats and another replica claimed the instance
+var ErrLeaseLost = errors.New("saga instance lease lost")
+
+// Lease tells which run of which replica owns an instance and until when.
+// An instance whose lease expired is considered abandoned and can be claimed by another replica.
+type Lease struct {
+	Owner     string
+	ExpiresAt time.Time
+}
+
+// abandoned tells whether no run holds the lease at now
+func abandoned(lease Lease, now time.Time) bool {
+	return lease.Owner == "" || lease.ExpiresAt.Before(now)
+}
+
+// LeaseStore is a Store shared by several replicas. Only the replica holding the lease of an instance may run it.
+// UpdateInstance must fail with ErrLeaseLost when the instance's Lease.Owner no longer holds the lease,
+// and it must never change the lease itself.
+type LeaseStore interface {
+	Store
+	// ClaimInstances takes lease of up to limit unfinished instances that are due at now, see Instance.Due,
+	// and have no lease or an expired one
+	ClaimInstances(ctx context.Context, lease Lease, now time.Time, limit int) ([]Instance, error)
+	// ClaimInstance takes lease of an instance if it has no lease, an expired one at now, or one already held by
+	// lease.Owner. It returns ErrLeaseLost if another replica holds it.
+	ClaimInstance(ctx context.Context, id string, lease Lease, now time.Time) (Instance, error)
+	// RenewLease extends the lease of an instance. It returns ErrLeaseLost if lease.Owner does not hold it anymore.
+	RenewLease(ctx context.Context, id string, lease Lease) error
+	// ReleaseLease gives up the lease of an instance, e.g. while it waits for a timer.
+	// It returns ErrLeaseLost if owner does not hold it anymore.
+	ReleaseLease(ctx context.Context, id string, owner string) error
+}
@@ -0,0 +1,177 @@
+package saga_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/saga/sagatest"
+	"github.com/stretchr/testify/require"
+)
+
+func newReplicas(t *testing.T, store *saga.MemoryStore, ttl time.Duration, sagas ...saga.Saga) (*saga.Executor, *saga.Executor) {
+	registry := saga.NewRegistry()
+	for _, s := range sagas {
+		require.NoError(t, registry.Register(s))
+	}
+
+	a := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: store, Owner: "replica-a", LeaseTTL: ttl})
+	b := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: store, Owner: "replica-b", LeaseTTL: ttl})
+
+	return a, b
+}
+
+func TestExecutor_Recover_ClaimsExpiredLeases(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	s := rec.Wrap(saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		sagatest.Step("first", 1),
+		sagatest.Step("second", 2),
+	}))
+	store := saga.NewMemoryStore()
+	_, replica := newReplicas(t, store, time.Minute, s)
+
+	// a dead replica left one instance behind, another one is still running on a live replica
+	require.NoError(t, store.CreateInstance(tenantCtx(), saga.Instance{
+		ID:          "abandoned",
+		SagaName:    "checkout",
+		SagaVersion: 1,
+		Tenant:      "acme",
+		Status:      saga.StatusRunning,
+		Step:        1,
+		Payload:     1,
+		Lease:       saga.Lease{Owner: "dead", ExpiresAt: time.Now().Add(-time.Second)},
+	}))
+	require.NoError(t, store.CreateInstance(tenantCtx(), saga.Instance{
+		ID:          "running",
+		SagaName:    "checkout",
+		SagaVersion: 1,
+		Tenant:      "acme",
+		Status:      saga.StatusRunning,
+		Lease:       saga.Lease{Owner: "alive", ExpiresAt: time.Now().Add(time.Minute)},
+	}))
+
+	results, err := replica.Recover(tenantCtx())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Err)
+	require.Equal(t, "abandoned", results[0].Instance.ID)
+	require.Equal(t, saga.StatusCompleted, results[0].Instance.Status)
+	rec.AssertCommands(t, "second")
+
+	_, err = replica.Resume(tenantCtx(), "running")
+	require.ErrorIs(t, err, saga.ErrLeaseLost)
+	rec.AssertCommands(t, "second")
+}
+
+func TestExecutor_Heartbeat_KeepsLongStepsOwned(t *testing.T) {
+	stepStarted := make(chan struct{})
+	slow := saga.Step{
+		Name: "slow",
+		Command: func(ctx context.Context) (interface{}, error) {
+			close(stepStarted)
+			time.Sleep(100 * time.Millisecond)
+			return nil, nil
+		},
+		CompensationCommand: func(ctx context.Context) (interface{}, error) { return nil, nil },
+	}
+	store := saga.NewMemoryStore()
+	a, b := newReplicas(t, store, 30*time.Millisecond, saga.NewVersionedSaga("checkout", 1, []saga.Step{slow}))
+
+	done := make(chan error)
+	go func() {
+		_, err := a.Start(tenantCtx(), "checkout", nil)
+		done <- err
+	}()
+
+	<-stepStarted
+	for i := 0; i < 5; i++ {
+		time.Sleep(15 * time.Millisecond)
+		results, err := b.Recover(tenantCtx())
+		require.NoError(t, err)
+		require.Empty(t, results, "a running instance must not be claimed by another replica")
+	}
+
+	require.NoError(t, <-done)
+}
+
+func TestExecutor_LostLease_StopsWithoutCompensating(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	store := saga.NewMemoryStore()
+	stolen := saga.Step{
+		Name: "stolen",
+		Command: func(ctx context.Context) (interface{}, error) {
+			// another replica claims the instance while this step runs, e.g. after a long GC pause
+			_, err := store.ClaimInstance(ctx, saga.InstanceID(ctx), saga.Lease{Owner: "replica-b", ExpiresAt: time.Now().Add(time.Minute)}, time.Now().Add(time.Hour))
+			return nil, err
+		},
+		CompensationCommand: func(ctx context.Context) (interface{}, error) { return nil, nil },
+	}
+	s := rec.Wrap(saga.NewVersionedSaga("checkout", 1, []saga.Step{stolen, sagatest.Step("second", 2)}))
+	a, _ := newReplicas(t, store, time.Minute, s)
+
+	instance, err := a.Start(tenantCtx(), "checkout", nil)
+
+	require.ErrorIs(t, err, saga.ErrLeaseLost)
+	rec.AssertCommands(t, "stolen")
+	rec.AssertNotCompensated(t)
+
+	stored, err := store.GetInstance(tenantCtx(), instance.ID)
+	require.NoError(t, err)
+	require.Equal(t, "replica-b", stored.Lease.Owner)
+	require.Equal(t, saga.StatusRunning, stored.Status)
+}
+
+func TestExecutor_Runs_DoNotShareLeases(t *testing.T) {
+	var a *saga.Executor
+	var resumeErr error
+	reentrant := saga.Step{
+		Name: "reentrant",
+		Command: func(ctx context.Context) (interface{}, error) {
+			// e.g. a reply handled by the same replica while the instance is still running
+			_, resumeErr = a.Resume(tenantCtx(), saga.InstanceID(ctx))
+			return nil, nil
+		},
+		CompensationCommand: func(ctx context.Context) (interface{}, error) { return nil, nil },
+	}
+	rec := sagatest.NewRecorder()
+	a, _ = newReplicas(t, saga.NewMemoryStore(), time.Minute, rec.Wrap(saga.NewVersionedSaga("checkout", 1, []saga.Step{reentrant})))
+
+	_, err := a.Start(tenantCtx(), "checkout", nil)
+
+	require.NoError(t, err)
+	require.ErrorIs(t, resumeErr, saga.ErrLeaseLost)
+	rec.AssertCommands(t, "reentrant")
+}
+
+func TestExecutor_Recover_SkipsFinishedHistories(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	s := rec.Wrap(saga.NewVersionedSaga("checkout", 1, []saga.Step{sagatest.Step("first", 1), sagatest.Step("second", 2)}))
+	store := saga.NewMemoryStore()
+	_, replica := newReplicas(t, store, time.Minute, s)
+
+	// the run compensating the instance recorded its history, then died before saving the instance
+	require.NoError(t, store.CreateInstance(tenantCtx(), saga.Instance{
+		ID:          "compensated",
+		SagaName:    "checkout",
+		SagaVersion: 1,
+		Tenant:      "acme",
+		Status:      saga.StatusCompensating,
+		Lease:       saga.Lease{Owner: "dead", ExpiresAt: time.Now().Add(-time.Second)},
+	}))
+	require.NoError(t, store.AppendEvents(tenantCtx(), []saga.Event{
+		{InstanceID: "compensated", Sequence: 1, Type: saga.EventSagaStarted, SagaName: "checkout", SagaVersion: 1},
+		{InstanceID: "compensated", Sequence: 2, Type: saga.EventStepFailed, SagaName: "checkout", SagaVersion: 1},
+		{InstanceID: "compensated", Sequence: 3, Type: saga.EventSagaCompensated, SagaName: "checkout", SagaVersion: 1, Step: -1},
+	}))
+
+	results, err := replica.Recover(tenantCtx())
+
+	require.NoError(t, err)
+	require.Empty(t, results)
+	rec.AssertCommands(t)
+	rec.AssertNotCompensated(t)
+	stored, err := store.GetInstance(tenantCtx(), "compensated")
+	require.NoError(t, err)
+	require.Empty(t, stored.Lease.Owner)
+}
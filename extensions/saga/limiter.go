@@ -0,0 +1,252 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+)
+
+// ErrLimitExceeded is returned when a saga already runs at its concurrency limit and its queue is full
+var ErrLimitExceeded = errors.New("saga concurrency limit exceeded")
+
+type LimiterConfig struct {
+	// MaxConcurrent is the number of executions of a saga that may run at the same time. Zero means unlimited.
+	MaxConcurrent int
+	// MaxQueued is the number of callers that may wait for a free slot. Callers beyond it are rejected.
+	MaxQueued int
+}
+
+// LimiterStats is a snapshot of a saga's admission state, meant to be exposed as metrics
+type LimiterStats struct {
+	Running  int    `json:"running"`
+	Queued   int    `json:"queued"`
+	Rejected uint64 `json:"rejected"`
+}
+
+// Limiter caps the number of concurrent executions per saga name, and optionally per tenant, see SetTenantQuota.
+// Callers over the cap wait in a bounded queue, and are rejected with ErrLimitExceeded once it is full.
+type Limiter struct {
+	mu        sync.Mutex
+	defaults  LimiterConfig
+	overrides map[string]LimiterConfig
+	sagas     map[string]*sagaLimit
+	// tenantDefaults applies to every tenant without a quota in tenantQuotas
+	tenantDefaults LimiterConfig
+	tenantQuotas   map[string]LimiterConfig
+	tenants        map[string]*sagaLimit
+}
+
+type sagaLimit struct {
+	config   LimiterConfig
+	running  int
+	rejected uint64
+	// waiters are the queued callers, first come first served. Each is admitted by closing its channel.
+	waiters []chan struct{}
+}
+
+// NewLimiter creates a limiter applying defaults to every saga without a specific limit
+func NewLimiter(defaults LimiterConfig) *Limiter {
+	return &Limiter{
+		defaults:     defaults,
+		overrides:    map[string]LimiterConfig{},
+		sagas:        map[string]*sagaLimit{},
+		tenantQuotas: map[string]LimiterConfig{},
+		tenants:      map[string]*sagaLimit{},
+	}
+}
+
+// SetLimit overrides the limit of a saga. It must be called before the saga is first executed.
+func (l *Limiter) SetLimit(name string, config LimiterConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.overrides[name] = config
+}
+
+// SetDefaultTenantQuota caps the executions of every saga run on behalf of a tenant, see tenant.WithID,
+// for the tenants without a quota of their own. It must be called before any saga is executed.
+func (l *Limiter) SetDefaultTenantQuota(config LimiterConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tenantDefaults = config
+}
+
+// SetTenantQuota overrides the quota of a tenant. It must be called before the tenant first executes a saga.
+func (l *Limiter) SetTenantQuota(id string, config LimiterConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tenantQuotas[id] = config
+}
+
+// Do runs f once the saga has a free slot, and releases the slot when f returns
+func (l *Limiter) Do(ctx context.Context, name string, f func(ctx context.Context) error) error {
+	release, err := l.Acquire(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return f(ctx)
+}
+
+// Acquire takes a slot for an execution of the saga, waiting in the queue if needed.
+// When ctx has a tenant, it first takes a slot from the quota of the tenant.
+// It returns ErrLimitExceeded if a queue is full, or the context error if ctx is done while waiting.
+// The returned function must be called to release the slots.
+func (l *Limiter) Acquire(ctx context.Context, name string) (func(), error) {
+	id := tenant.ID(ctx)
+	if id == "" {
+		l.mu.Lock()
+		return l.acquire(ctx, l.limit(name))
+	}
+
+	l.mu.Lock()
+	releaseTenant, err := l.acquire(ctx, l.tenantLimit(id))
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	release, err := l.acquire(ctx, l.limit(name))
+	if err != nil {
+		releaseTenant()
+		return nil, err
+	}
+
+	return func() {
+		release()
+		releaseTenant()
+	}, nil
+}
+
+// acquire takes a slot of limit. It must be called with l.mu held, and releases it.
+// Slots go to queued callers first, so newcomers never overtake them.
+func (l *Limiter) acquire(ctx context.Context, limit *sagaLimit) (func(), error) {
+	if limit.config.MaxConcurrent <= 0 || (limit.running < limit.config.MaxConcurrent && len(limit.waiters) == 0) {
+		limit.running++
+		l.mu.Unlock()
+		return l.releaser(limit), nil
+	}
+
+	if len(limit.waiters) >= limit.config.MaxQueued {
+		limit.rejected++
+		l.mu.Unlock()
+		return nil, ErrLimitExceeded
+	}
+	admitted := make(chan struct{})
+	limit.waiters = append(limit.waiters, admitted)
+	l.mu.Unlock()
+
+	select {
+	case <-admitted:
+		return l.releaser(limit), nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		for i, waiter := range limit.waiters {
+			if waiter == admitted {
+				limit.waiters = append(limit.waiters[:i], limit.waiters[i+1:]...)
+				l.mu.Unlock()
+				return nil, ctx.Err()
+			}
+		}
+		l.mu.Unlock()
+		// the slot was handed over as ctx was done, it goes to the next caller
+		l.releaser(limit)()
+		return nil, ctx.Err()
+	}
+}
+
+// Stats returns a snapshot of every saga that has been executed through the limiter
+func (l *Limiter) Stats() map[string]LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := make(map[string]LimiterStats, len(l.sagas))
+	for name, limit := range l.sagas {
+		stats[name] = LimiterStats{
+			Running:  limit.running,
+			Queued:   len(limit.waiters),
+			Rejected: limit.rejected,
+		}
+	}
+
+	return stats
+}
+
+// TenantStats returns a snapshot of every tenant that has executed a saga through the limiter
+func (l *Limiter) TenantStats() map[string]LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := make(map[string]LimiterStats, len(l.tenants))
+	for id, limit := range l.tenants {
+		stats[id] = LimiterStats{
+			Running:  limit.running,
+			Queued:   len(limit.waiters),
+			Rejected: limit.rejected,
+		}
+	}
+
+	return stats
+}
+
+// limit must be called with l.mu held
+func (l *Limiter) limit(name string) *sagaLimit {
+	limit, ok := l.sagas[name]
+	if ok {
+		return limit
+	}
+
+	config, ok := l.overrides[name]
+	if !ok {
+		config = l.defaults
+	}
+	limit = newSagaLimit(config)
+	l.sagas[name] = limit
+
+	return limit
+}
+
+// tenantLimit must be called with l.mu held
+func (l *Limiter) tenantLimit(id string) *sagaLimit {
+	limit, ok := l.tenants[id]
+	if ok {
+		return limit
+	}
+
+	config, ok := l.tenantQuotas[id]
+	if !ok {
+		config = l.tenantDefaults
+	}
+	limit = newSagaLimit(config)
+	l.tenants[id] = limit
+
+	return limit
+}
+
+func newSagaLimit(config LimiterConfig) *sagaLimit {
+	return &sagaLimit{config: config}
+}
+
+// releaser returns a function freeing the slot taken by a caller, or handing it over to the first queued caller.
+// Calling it more than once has no effect.
+func (l *Limiter) releaser(limit *sagaLimit) func() {
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			if len(limit.waiters) == 0 {
+				limit.running--
+				return
+			}
+			close(limit.waiters[0])
+			limit.waiters = limit.waiters[1:]
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package saga_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter_QueuesAndRejects(t *testing.T) {
+	limiter := saga.NewLimiter(saga.LimiterConfig{MaxConcurrent: 1, MaxQueued: 1})
+	ctx := context.Background()
+
+	release, err := limiter.Acquire(ctx, "checkout")
+	require.NoError(t, err)
+
+	admitted := make(chan struct{})
+	go func() {
+		queuedRelease, err := limiter.Acquire(ctx, "checkout")
+		if err == nil {
+			close(admitted)
+			queuedRelease()
+		}
+	}()
+	require.Eventually(t, func() bool {
+		return limiter.Stats()["checkout"].Queued == 1
+	}, time.Second, time.Millisecond)
+
+	_, err = limiter.Acquire(ctx, "checkout")
+	require.ErrorIs(t, err, saga.ErrLimitExceeded)
+	require.Equal(t, saga.LimiterStats{Running: 1, Queued: 1, Rejected: 1}, limiter.Stats()["checkout"])
+
+	// other sagas have their own limit
+	otherRelease, err := limiter.Acquire(ctx, "refund")
+	require.NoError(t, err)
+	otherRelease()
+
+	release()
+	release()
+	select {
+	case <-admitted:
+	case <-time.After(time.Second):
+		t.Fatal("queued caller was not admitted")
+	}
+}
+
+func TestLimiter_QueuedCallerGivesUp(t *testing.T) {
+	limiter := saga.NewLimiter(saga.LimiterConfig{MaxConcurrent: 1, MaxQueued: 5})
+	release, err := limiter.Acquire(context.Background(), "checkout")
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = limiter.Do(ctx, "checkout", func(ctx context.Context) error {
+		t.Fatal("must not run")
+		return nil
+	})
+
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, saga.LimiterStats{Running: 1}, limiter.Stats()["checkout"])
+}
+
+func TestLimiter_AdmitsQueuedCallersFirst(t *testing.T) {
+	limiter := saga.NewLimiter(saga.LimiterConfig{MaxConcurrent: 1, MaxQueued: 2})
+	release, err := limiter.Acquire(context.Background(), "checkout")
+	require.NoError(t, err)
+
+	admitted, done := make(chan string, 2), make(chan struct{})
+	queue := func(name string, queued int) {
+		go func() {
+			queuedRelease, err := limiter.Acquire(context.Background(), "checkout")
+			if err == nil {
+				admitted <- name
+				<-done
+				queuedRelease()
+			}
+		}()
+		require.Eventually(t, func() bool {
+			return limiter.Stats()["checkout"].Queued == queued
+		}, time.Second, time.Millisecond)
+	}
+	queue("first", 1)
+	queue("second", 2)
+
+	// the slot goes to the first queued caller, not to a newcomer
+	release()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = limiter.Acquire(ctx, "checkout")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, "first", <-admitted)
+
+	close(done)
+	require.Equal(t, "second", <-admitted)
+	require.Eventually(t, func() bool {
+		return limiter.Stats()["checkout"] == saga.LimiterStats{}
+	}, time.Second, time.Millisecond)
+}
+
+func TestLimiter_TenantQuotas(t *testing.T) {
+	limiter := saga.NewLimiter(saga.LimiterConfig{})
+	limiter.SetDefaultTenantQuota(saga.LimiterConfig{MaxConcurrent: 1})
+	limiter.SetTenantQuota("acme", saga.LimiterConfig{MaxConcurrent: 2})
+	globex := tenant.WithID(context.Background(), "globex")
+	acme := tenant.WithID(context.Background(), "acme")
+
+	release, err := limiter.Acquire(globex, "checkout")
+	require.NoError(t, err)
+	// the quota spans every saga of the tenant
+	_, err = limiter.Acquire(globex, "refund")
+	require.ErrorIs(t, err, saga.ErrLimitExceeded)
+
+	// other tenants are not affected
+	for i := 0; i < 2; i++ {
+		_, err := limiter.Acquire(acme, "checkout")
+		require.NoError(t, err)
+	}
+	_, err = limiter.Acquire(acme, "checkout")
+	require.ErrorIs(t, err, saga.ErrLimitExceeded)
+	require.Equal(t, saga.LimiterStats{Running: 2, Rejected: 1}, limiter.TenantStats()["acme"])
+
+	release()
+	release, err = limiter.Acquire(globex, "refund")
+	require.NoError(t, err)
+	release()
+	require.Equal(t, saga.LimiterStats{Rejected: 1}, limiter.TenantStats()["globex"])
+}
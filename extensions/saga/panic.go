@@ -0,0 +1,56 @@
+package saga
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// StepPanicError is the error of a step command, timer or compensation that panicked.
+// A panicking command fails its step without being retried, and the saga is compensated as usual.
+type StepPanicError struct {
+	Step         string
+	Index        int
+	Compensation bool
+	// Value is the value the step panicked with
+	Value interface{}
+	// Stack is the stack trace of the goroutine that panicked
+	Stack []byte
+}
+
+func (e *StepPanicError) Error() string {
+	step := e.Step
+	if step == "" {
+		step = fmt.Sprintf("%d", e.Index)
+	}
+	if e.Compensation {
+		return fmt.Sprintf("compensation of step %s panicked: %v", step, e.Value)
+	}
+
+	return fmt.Sprintf("step %s panicked: %v", step, e.Value)
+}
+
+// Unwrap returns the value the step panicked with when it is an error
+func (e *StepPanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+
+	return err
+}
+
+// protect calls f, turning a panic into a *StepPanicError
+func protect(
+	ctx context.Context,
+	step Step,
+	index int,
+	compensation bool,
+	f func(ctx context.Context) (interface{}, error),
+) (response interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			response = nil
+			err = &StepPanicError{Step: step.Name, Index: index, Compensation: compensation, Value: p, Stack: debug.Stack()}
+		}
+	}()
+
+	return f(ctx)
+}
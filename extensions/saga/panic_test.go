@@ -0,0 +1,57 @@
+package saga_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/saga/sagatest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoordinator_PanickingStepIsCompensated(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	flaky := sagatest.Step("create-delivery", 3)
+	flaky.Retry = saga.RetryPolicy{MaxAttempts: 3}
+	s := rec.Wrap(saga.NewSaga([]saga.Step{
+		sagatest.Step("create-order", 1),
+		sagatest.Step("create-payment", 2),
+		flaky,
+	}), sagatest.PanicStep(2, 1, "interface conversion"))
+	coordinator := saga.NewCoordinator(s)
+
+	_, ok := coordinator.Execute(tenantCtx())
+
+	require.False(t, ok)
+	var panicErr *saga.StepPanicError
+	require.ErrorAs(t, coordinator.GetErrors()[0], &panicErr)
+	require.Equal(t, "create-delivery", panicErr.Step)
+	require.Equal(t, "interface conversion", panicErr.Value)
+	require.Contains(t, string(panicErr.Stack), "sagatest")
+	require.EqualError(t, panicErr, `step create-delivery panicked: interface conversion`)
+	// panics are bugs, retrying would not help
+	require.Equal(t, 1, rec.Attempts(2))
+	rec.AssertCompensations(t, "create-delivery", "create-payment", "create-order")
+}
+
+func TestCoordinator_PanickingCompensationDoesNotStopCompensation(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	stepErr := errors.New("delivery failed")
+	panicValue := errors.New("nil pointer dereference")
+	s := rec.Wrap(saga.NewSaga([]saga.Step{
+		sagatest.Step("create-order", 1),
+		sagatest.Step("create-payment", 2),
+		sagatest.Step("create-delivery", 3),
+	}), sagatest.FailStep(2, 1, stepErr), sagatest.PanicCompensation(1, 1, panicValue))
+	coordinator := saga.NewCoordinator(s)
+
+	_, ok := coordinator.Execute(tenantCtx())
+
+	require.False(t, ok)
+	require.Len(t, coordinator.GetCompensationErrors(), 1)
+	var panicErr *saga.StepPanicError
+	require.ErrorAs(t, coordinator.GetCompensationErrors()[0], &panicErr)
+	require.True(t, panicErr.Compensation)
+	require.ErrorIs(t, panicErr, panicValue)
+	rec.AssertCompensations(t, "create-delivery", "create-payment", "create-order")
+}
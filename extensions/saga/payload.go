@@ -0,0 +1,254 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// EncodedPayload is a payload serialized by a Codec, as persisted by a Store.
+// Payloads whose type is not registered are handed to the Store as they are.
+type EncodedPayload struct {
+	// Type is the name the payload type was registered with
+	Type  string
+	Codec string
+	// Data is encrypted when KeyID is set
+	Data []byte
+	// KeyID identifies the key of the KeyProvider that WrappedKey, the data key Data is encrypted with, is encrypted with
+	KeyID      string
+	WrappedKey []byte
+}
+
+// Encrypted tells whether the payload was encrypted at rest
+func (p EncodedPayload) Encrypted() bool {
+	return p.KeyID != ""
+}
+
+// PayloadOwner is where a payload is stored: the payload of an instance, or of an event of its history.
+// Sensitive payloads are bound to their owner, so they only decrypt where they were encrypted.
+type PayloadOwner struct {
+	InstanceID string
+	// Step is the Step of the instance or of the event
+	Step int
+	// Sequence is the Sequence of the event, 0 for the payload of the instance
+	Sequence int
+}
+
+func instanceOwner(instance Instance) PayloadOwner {
+	return PayloadOwner{InstanceID: instance.ID, Step: instance.Step}
+}
+
+func eventOwner(event Event) PayloadOwner {
+	return PayloadOwner{InstanceID: event.InstanceID, Step: event.Step, Sequence: event.Sequence}
+}
+
+// PayloadOption changes how a payload type is persisted
+type PayloadOption func(*payloadType)
+
+// Sensitive encrypts payloads of the type at rest with the key provider of the registry, and redacts them
+// from the instances returned by Executor.Get and Executor.List unless the caller has payload access.
+func Sensitive() PayloadOption {
+	return func(pt *payloadType) {
+		pt.sensitive = true
+	}
+}
+
+type payloadType struct {
+	name      string
+	typ       reflect.Type
+	codec     Codec
+	sensitive bool
+}
+
+// payloadTypes maps payload types to the codec persisting them, both ways
+type payloadTypes struct {
+	mu     sync.RWMutex
+	byName map[string]payloadType
+	byType map[reflect.Type]payloadType
+	keys   KeyProvider
+}
+
+func newPayloadTypes() *payloadTypes {
+	return &payloadTypes{
+		byName: map[string]payloadType{},
+		byType: map[reflect.Type]payloadType{},
+	}
+}
+
+// RegisterPayloadType registers the type of sample under name, to be persisted with codec.
+// The name is stored with every payload, so it must not change once instances were persisted with it.
+// It fails if the name or the type is already registered, if codec cannot encode and decode sample back,
+// or if the type is Sensitive and no key provider was set with SetKeyProvider.
+func (r *Registry) RegisterPayloadType(name string, sample interface{}, codec Codec, opts ...PayloadOption) error {
+	return r.registerPayloadType(name, sample, codec, true, opts...)
+}
+
+// registerPayloadType registers a payload type, without requiring a key provider yet for the built-in sensitive
+// types, which checkPayloadType requires once a saga uses them
+func (r *Registry) registerPayloadType(name string, sample interface{}, codec Codec, requireKeys bool, opts ...PayloadOption) error {
+	if name == "" {
+		return errors.New("payload type must have a name")
+	}
+	if sample == nil {
+		return fmt.Errorf("payload type %q must have a sample value", name)
+	}
+	pt := payloadType{name: name, typ: reflect.TypeOf(sample), codec: codec}
+	for _, opt := range opts {
+		opt(&pt)
+	}
+
+	// codec errors show up here rather than in the middle of a recovery
+	data, err := codec.Encode(sample)
+	if err != nil {
+		return fmt.Errorf("payload type %q cannot be encoded with the %s codec: %w", name, codec.Name(), err)
+	}
+	if _, err := pt.decode(data); err != nil {
+		return fmt.Errorf("payload type %q cannot be decoded with the %s codec: %w", name, codec.Name(), err)
+	}
+
+	r.payloads.mu.Lock()
+	defer r.payloads.mu.Unlock()
+
+	if pt.sensitive && requireKeys && r.payloads.keys == nil {
+		return fmt.Errorf("payload type %q is sensitive but no key provider is set", name)
+	}
+	if _, ok := r.payloads.byName[name]; ok {
+		return fmt.Errorf("payload type %q is already registered", name)
+	}
+	if existing, ok := r.payloads.byType[pt.typ]; ok {
+		return fmt.Errorf("%s is already registered as payload type %q", pt.typ, existing.name)
+	}
+	r.payloads.byName[name] = pt
+	r.payloads.byType[pt.typ] = pt
+
+	return nil
+}
+
+// SetKeyProvider sets the provider of the keys encrypting Sensitive payload types.
+// Keys it used before must remain available from it for as long as payloads encrypted with them are stored.
+func (r *Registry) SetKeyProvider(keys KeyProvider) {
+	r.payloads.mu.Lock()
+	defer r.payloads.mu.Unlock()
+
+	r.payloads.keys = keys
+}
+
+// checkPayloadType fails if sample is set and its type was not registered with RegisterPayloadType,
+// or is sensitive while no key provider is set
+func (r *Registry) checkPayloadType(sample interface{}) error {
+	if sample == nil {
+		return nil
+	}
+
+	r.payloads.mu.RLock()
+	defer r.payloads.mu.RUnlock()
+
+	pt, ok := r.payloads.byType[reflect.TypeOf(sample)]
+	if !ok {
+		return fmt.Errorf("payload type %T is not registered", sample)
+	}
+	if pt.sensitive && r.payloads.keys == nil {
+		return fmt.Errorf("payload type %q is sensitive but no key provider is set", pt.name)
+	}
+
+	return nil
+}
+
+// EncodePayload serializes payload with the codec of its type, and encrypts it for owner if the type is Sensitive.
+// Payloads of unregistered types are returned as they are.
+func (r *Registry) EncodePayload(ctx context.Context, owner PayloadOwner, payload interface{}) (interface{}, error) {
+	if payload == nil {
+		return nil, nil
+	}
+
+	r.payloads.mu.RLock()
+	pt, ok := r.payloads.byType[reflect.TypeOf(payload)]
+	keys := r.payloads.keys
+	r.payloads.mu.RUnlock()
+	if !ok {
+		return payload, nil
+	}
+
+	data, err := pt.codec.Encode(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encoding %s payload: %w", pt.name, err)
+	}
+	if !pt.sensitive {
+		return EncodedPayload{Type: pt.name, Codec: pt.codec.Name(), Data: data}, nil
+	}
+
+	encoded, err := encrypt(ctx, keys, pt.name, owner, data)
+	if err != nil {
+		return nil, fmt.Errorf("encrypting %s payload: %w", pt.name, err)
+	}
+	encoded.Codec = pt.codec.Name()
+
+	return encoded, nil
+}
+
+// DecodePayload decrypts and turns an EncodedPayload back into its registered type. Encrypted payloads only decrypt
+// for the owner they were encoded for. Other payloads are returned as they are.
+func (r *Registry) DecodePayload(ctx context.Context, owner PayloadOwner, payload interface{}) (interface{}, error) {
+	encoded, ok := payload.(EncodedPayload)
+	if !ok {
+		return payload, nil
+	}
+
+	r.payloads.mu.RLock()
+	pt, ok := r.payloads.byName[encoded.Type]
+	keys := r.payloads.keys
+	r.payloads.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("payload type %q is not registered", encoded.Type)
+	}
+	if pt.codec.Name() != encoded.Codec {
+		return nil, fmt.Errorf("payload type %q is registered with the %s codec but was encoded with %s",
+			encoded.Type, pt.codec.Name(), encoded.Codec)
+	}
+
+	data := encoded.Data
+	if encoded.Encrypted() {
+		var err error
+		if data, err = decrypt(ctx, keys, owner, encoded); err != nil {
+			return nil, fmt.Errorf("decrypting %s payload: %w", encoded.Type, err)
+		}
+	}
+
+	return pt.decode(data)
+}
+
+// RedactPayload replaces payload with a RedactedPayload if it is an EncodedPayload of a Sensitive type
+func (r *Registry) RedactPayload(payload interface{}) (interface{}, bool) {
+	encoded, ok := payload.(EncodedPayload)
+	if !ok {
+		return payload, false
+	}
+
+	r.payloads.mu.RLock()
+	pt, ok := r.payloads.byName[encoded.Type]
+	r.payloads.mu.RUnlock()
+	if !encoded.Encrypted() && (!ok || !pt.sensitive) {
+		return payload, false
+	}
+
+	return RedactedPayload{Type: encoded.Type}, true
+}
+
+func (pt payloadType) decode(data []byte) (interface{}, error) {
+	if pt.typ.Kind() == reflect.Ptr {
+		value := reflect.New(pt.typ.Elem())
+		if err := pt.codec.Decode(data, value.Interface()); err != nil {
+			return nil, err
+		}
+		return value.Interface(), nil
+	}
+
+	value := reflect.New(pt.typ)
+	if err := pt.codec.Decode(data, value.Interface()); err != nil {
+		return nil, err
+	}
+
+	return value.Elem().Interface(), nil
+}
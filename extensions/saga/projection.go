@@ -0,0 +1,143 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Projection maintains a read model from the histories of saga instances, e.g. the orders awaiting delivery.
+// Events can be delivered again, e.g. after a restart from an older position, so Project must be idempotent.
+type Projection interface {
+	Project(ctx context.Context, event Event) error
+}
+
+// ProjectionFunc adapts a function to a Projection
+type ProjectionFunc func(ctx context.Context, event Event) error
+
+func (f ProjectionFunc) Project(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+// Projector feeds a Projection with the events recorded by an Executor, in position order, with their payloads
+// decoded. It keeps its position in memory: a projection that persists its read model should persist the position
+// of the last event it projected as well, and pass it to NewProjector when starting up.
+//
+// Positions are taken when events are appended, so an append still in flight can leave a gap before the events of
+// appends committed after it. The projector stops before a gap until it is filled, and only skips it once it is
+// older than the gap timeout, as the positions of failed appends are never filled, see SetGapTimeout.
+type Projector struct {
+	executor   *Executor
+	projection Projection
+	interval   time.Duration
+	batch      int
+	gapTimeout time.Duration
+
+	mu       sync.Mutex
+	position int64
+	// gapSince is when the position after position was first found missing
+	gapSince time.Time
+	gapAt    int64
+}
+
+// NewProjector creates a projector reading the events appended after position every interval
+func NewProjector(executor *Executor, projection Projection, position int64, interval time.Duration) *Projector {
+	return &Projector{
+		executor:   executor,
+		projection: projection,
+		interval:   interval,
+		batch:      100,
+		gapTimeout: 10 * time.Second,
+		position:   position,
+	}
+}
+
+// SetGapTimeout sets how long a missing position is waited for before the events after it are projected,
+// 10s by default. It must outlast the appends of the EventStore.
+func (p *Projector) SetGapTimeout(timeout time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.gapTimeout = timeout
+}
+
+// Position returns the position of the last event projected
+func (p *Projector) Position() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.position
+}
+
+// Run projects new events until ctx is done. Errors are passed to report, and the failed event is projected again
+// on the next tick.
+func (p *Projector) Run(ctx context.Context, report func(error)) error {
+	if p.executor.events == nil {
+		return errors.New("saga projector requires an EventStore")
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.CatchUp(ctx); err != nil {
+			report(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// CatchUp projects every event appended since the last one projected, and returns how many it projected.
+// It stops at the first event the projection fails on, and before a gap younger than the gap timeout.
+func (p *Projector) CatchUp(ctx context.Context) (int, error) {
+	if p.executor.events == nil {
+		return 0, errors.New("saga projector requires an EventStore")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	projected := 0
+	for {
+		events, err := p.executor.events.ReadEvents(ctx, p.position, p.batch)
+		if err != nil {
+			return projected, fmt.Errorf("reading saga events: %w", err)
+		}
+		if len(events) == 0 {
+			return projected, nil
+		}
+
+		for _, event := range events {
+			if event.Position > p.position+1 && !p.skipGap() {
+				return projected, nil
+			}
+			if event.Payload, err = p.executor.registry.DecodePayload(ctx, eventOwner(event), event.Payload); err != nil {
+				return projected, fmt.Errorf("decoding payload of saga event %d: %w", event.Position, err)
+			}
+			if err := p.projection.Project(ctx, event); err != nil {
+				return projected, fmt.Errorf("projecting saga event %d: %w", event.Position, err)
+			}
+			p.position = event.Position
+			projected++
+		}
+	}
+}
+
+// skipGap tells whether the position after the last one projected has been missing for longer than the gap timeout.
+// It must be called with p.mu held.
+func (p *Projector) skipGap() bool {
+	now := p.executor.clock.Now()
+	if p.gapAt != p.position+1 {
+		p.gapAt = p.position + 1
+		p.gapSince = now
+	}
+
+	return now.Sub(p.gapSince) >= p.gapTimeout
+}
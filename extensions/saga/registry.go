@@ -0,0 +1,126 @@
+package saga
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// VersionNotFoundError is returned when a saga definition version is not registered,
+// e.g. when recovering an instance started with a version that has since been removed
+type VersionNotFoundError struct {
+	Name    string
+	Version int
+}
+
+func (e *VersionNotFoundError) Error() string {
+	return fmt.Sprintf("saga %q has no version %d registered", e.Name, e.Version)
+}
+
+// Registry holds saga definitions by name and version.
+// Several versions of the same saga can be registered at once: new instances use the latest one,
+// while unfinished instances keep the version they were started with.
+//
+// It also holds the payload types of the sagas, with the codecs persisting them, see RegisterPayloadType.
+type Registry struct {
+	mu       sync.RWMutex
+	sagas    map[string]map[int]Saga
+	payloads *payloadTypes
+}
+
+func NewRegistry() *Registry {
+	r := &Registry{
+		sagas:    map[string]map[int]Saga{},
+		payloads: newPayloadTypes(),
+	}
+	// the output of Commands steps, which holds whatever the services replied, e.g. payment details
+	_ = r.registerPayloadType("saga.Reply", Reply{}, JSONCodec{}, false, Sensitive())
+
+	return r
+}
+
+// Register adds a saga definition. It fails if the definition is invalid, if that version is already registered,
+// or if it declares an Input or an Output whose payload type is not registered.
+func (r *Registry) Register(s Saga) error {
+	if s.Name == "" {
+		return errors.New("saga definition must have a name")
+	}
+	if s.Version < 1 {
+		return fmt.Errorf("saga %q must have a version greater than zero", s.Name)
+	}
+	if len(s.Steps) == 0 {
+		return fmt.Errorf("saga %q version %d has no steps", s.Name, s.Version)
+	}
+	for i, step := range s.Steps {
+		if step.Command == nil && step.Timer == nil && step.Signal == "" {
+			return fmt.Errorf("step %d of saga %q version %d has no command", i, s.Name, s.Version)
+		}
+		if err := r.checkPayloadType(step.Output); err != nil {
+			return fmt.Errorf("output of step %d of saga %q version %d: %w", i, s.Name, s.Version, err)
+		}
+	}
+	if err := r.checkPayloadType(s.Input); err != nil {
+		return fmt.Errorf("input of saga %q version %d: %w", s.Name, s.Version, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	versions, ok := r.sagas[s.Name]
+	if !ok {
+		versions = map[int]Saga{}
+		r.sagas[s.Name] = versions
+	}
+	if _, ok := versions[s.Version]; ok {
+		return fmt.Errorf("saga %q version %d is already registered", s.Name, s.Version)
+	}
+	versions[s.Version] = s
+
+	return nil
+}
+
+// Unregister removes a saga definition version. Unfinished instances of it can no longer be resumed.
+func (r *Registry) Unregister(name string, version int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.sagas[name], version)
+}
+
+// Get returns the given version of a saga, or a *VersionNotFoundError
+func (r *Registry) Get(name string, version int) (Saga, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.sagas[name][version]
+	if !ok {
+		return Saga{}, &VersionNotFoundError{Name: name, Version: version}
+	}
+
+	return s, nil
+}
+
+// Latest returns the highest registered version of a saga
+func (r *Registry) Latest(name string) (Saga, error) {
+	versions := r.Versions(name)
+	if len(versions) == 0 {
+		return Saga{}, fmt.Errorf("saga %q is not registered", name)
+	}
+
+	return r.Get(name, versions[len(versions)-1])
+}
+
+// Versions returns the registered versions of a saga in ascending order
+func (r *Registry) Versions(name string) []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := make([]int, 0, len(r.sagas[name]))
+	for v := range r.sagas[name] {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+
+	return versions
+}
@@ -0,0 +1,19 @@
+package saga
+
+import "time"
+
+// RetryPolicy tells how many times the coordinator runs a failing step command before compensating the saga
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt. Zero or one means no retries.
+	MaxAttempts int
+	// Backoff is the delay between attempts
+	Backoff time.Duration
+}
+
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+
+	return p.MaxAttempts
+}
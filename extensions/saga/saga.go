@@ -1,16 +1,59 @@
 package saga
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type Saga struct {
-	Steps []Step
+	// Name and Version identify the definition in a Registry. They are only required to run it with an Executor.
+	Name    string
+	Version int
+	Steps   []Step
+	// Input is an optional sample of the payload the saga is started with, e.g. CreateOrderInput{}.
+	// When set, its type must be registered with Registry.RegisterPayloadType, so it can be persisted.
+	Input interface{}
+	// Recovery tells what happens when a step fails: Backward, the default, compensates the saga,
+	// while Forward retries the step according to ForwardRetry until it succeeds
+	Recovery     RecoveryStrategy
+	ForwardRetry ForwardRetryPolicy
 }
 
 type Step struct {
+	// Name identifies the step. It is optional, but it makes errors and test assertions readable
+	Name                string
 	Command             func(ctx context.Context) (interface{}, error)
 	CompensationCommand func(ctx context.Context) (interface{}, error)
+	// Timer makes this a timer step, see Sleep and WaitUntil. It returns when the saga can go on, and replaces Command.
+	// Run by an Executor, the instance is suspended until then without holding a goroutine, and resumed by a Scheduler.
+	// A timer step passes the output of the previous step on to the next one.
+	Timer func(ctx context.Context, now time.Time) (time.Time, error)
+	// Signal makes this a signal step, see WaitForSignal. The instance is suspended until Executor.SignalSaga
+	// delivers that signal, whose payload becomes the step output. Timer then optionally gives its timeout.
+	// Command then optionally asks for the signal, once the instance is saved as waiting, see Commands.
+	Signal string
+	// Retry runs the command again when it fails, before compensating the saga
+	Retry RetryPolicy
+	// HeartbeatTimeout, when positive, fails an attempt of the command that did not call RecordHeartbeat for that long,
+	// which tells a slow step apart from a dead one. Its context is cancelled, but the coordinator does not wait for it.
+	HeartbeatTimeout time.Duration
+	// Output is an optional sample of the command output, e.g. entities.Order{}.
+	// When set, its type must be registered with Registry.RegisterPayloadType, so it can be persisted.
+	Output interface{}
+	// Pivot marks the go/no-go step of the saga: once it completed the saga can no longer be compensated, so the steps
+	// after it must be Retriable. A failed pivot has nothing to undo, so its CompensationCommand is optional.
+	Pivot bool
+	// Retriable makes a failed step be retried according to Saga.ForwardRetry until it succeeds, as in a Forward saga,
+	// instead of compensating the saga. It is meant for the steps after the pivot.
+	Retriable bool
 }
 
 func NewSaga(steps []Step) Saga {
 	return Saga{Steps: steps}
 }
+
+// NewVersionedSaga creates a saga definition that can be registered in a Registry.
+// A new version must be registered whenever the steps change in a way that running instances could not follow.
+func NewVersionedSaga(name string, version int, steps []Step) Saga {
+	return Saga{Name: name, Version: version, Steps: steps}
+}
@@ -0,0 +1,292 @@
+package sagatest
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/stretchr/testify/require"
+)
+
+// Invariant is a property that must hold once a saga run is done, whatever failed during it
+type Invariant struct {
+	Name  string
+	Check func(o Outcome) error
+}
+
+// Outcome describes a single run of the Harness, as the saga instance ended up
+type Outcome struct {
+	Faults    []Fault
+	Completed bool
+	// Result is the payload of the completed instance, decoded
+	Result             interface{}
+	Errors             []string
+	CompensationErrors []string
+	Calls              []Call
+}
+
+// RepliesDestination is where the commands sent through Env.Commands ask for their replies
+const RepliesDestination = "sagatest.replies"
+
+// Env is given to Harness.Setup for each run: the saga must send its commands through Commands, and the services
+// handling them are served on the same transport with Serve, so the saga runs as it does in production.
+type Env struct {
+	Transport *saga.MemoryTransport
+	Commands  *saga.Commands
+	// Registry is the registry the run is executed from. Setup registers the payload types of the saga on it,
+	// and may register the saga itself, which the harness replaces with its wrapped version.
+	Registry *saga.Registry
+	services map[string]func(ctx context.Context, command saga.Message) (interface{}, error)
+}
+
+// Serve handles the commands sent to destination with handle during the run, see saga.ServeCommands
+func (e *Env) Serve(destination string, handle func(ctx context.Context, command saga.Message) (interface{}, error)) {
+	e.services[destination] = handle
+}
+
+func newEnv(t testing.TB) *Env {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	keys, err := saga.NewLocalKeyProvider("sagatest", map[string][]byte{"sagatest": key})
+	require.NoError(t, err)
+	registry := saga.NewRegistry()
+	// replies are sensitive
+	registry.SetKeyProvider(keys)
+	transport := saga.NewMemoryTransport(time.Millisecond)
+
+	return &Env{
+		Transport: transport,
+		Commands:  saga.NewCommands(transport, RepliesDestination),
+		Registry:  registry,
+		services:  map[string]func(ctx context.Context, command saga.Message) (interface{}, error){},
+	}
+}
+
+// Harness runs a saga once for every possible failure point and checks invariants after each run.
+//
+// The failure points are each step's command failing and each step's compensation failing.
+// Failure points are combined up to Depth faults per run. Combinations that cannot happen are skipped:
+// a command failure stops the saga, so a run holds at most one of them, and a compensation failure
+// only makes sense alongside a command failure at or after that step.
+//
+// Each run goes through a saga.Executor backed by a saga.MemoryStore: command steps wait for the replies of the
+// services served on the Env, and retried steps are resumed with Recover, until the instance is finished.
+// The commands still queued by then, e.g. compensating commands, are handled before the invariants are checked.
+type Harness struct {
+	// Setup is called before every run. It must return a fresh saga backed by fresh fakes and built on env,
+	// the context to start it with, e.g. carrying its tenant, its input and the invariants to check on those fakes
+	// once it is done.
+	Setup func(t testing.TB, env *Env) (s saga.Saga, ctx context.Context, input interface{}, invariants []Invariant)
+	// Depth is the maximum number of faults combined in a single run. Defaults to 1.
+	Depth int
+	// Timeout is how long a run can take to finish. Defaults to 5s.
+	Timeout time.Duration
+}
+
+// Run executes every scenario as a subtest named after its faults
+func (h Harness) Run(t *testing.T) {
+	t.Helper()
+
+	s, _, _, _ := h.Setup(t, newEnv(t))
+	for _, faults := range h.Scenarios(s) {
+		faults := faults
+		t.Run(scenarioName(s, faults), func(t *testing.T) {
+			h.run(t, faults)
+		})
+	}
+}
+
+// Scenarios lists the fault combinations Run goes through for s, starting with the run without faults
+func (h Harness) Scenarios(s saga.Saga) [][]Fault {
+	depth := h.Depth
+	if depth <= 0 {
+		depth = 1
+	}
+
+	var points []Fault
+	for i, step := range s.Steps {
+		points = append(points, FailStep(i, 1, errInjected))
+		if step.CompensationCommand != nil {
+			points = append(points, FailCompensation(i, 1, errInjected))
+		}
+	}
+
+	scenarios := [][]Fault{nil}
+	var combine func(start int, current []Fault)
+	combine = func(start int, current []Fault) {
+		for i := start; i < len(points); i++ {
+			next := append(append([]Fault(nil), current...), points[i])
+			if reachable(next) {
+				scenarios = append(scenarios, next)
+			}
+			if len(next) < depth {
+				combine(i+1, next)
+			}
+		}
+	}
+	combine(0, nil)
+
+	return scenarios
+}
+
+var errInjected = errors.New("sagatest: injected failure")
+
+func (h Harness) run(t *testing.T, faults []Fault) {
+	env := newEnv(t)
+	s, ctx, input, invariants := h.Setup(t, env)
+	rec := NewRecorder()
+	env.Registry.Unregister(s.Name, s.Version)
+	require.NoError(t, env.Registry.Register(rec.Wrap(s, faults...)))
+	executor := saga.NewExecutor(saga.ExecutorSettings{Registry: env.Registry, Store: saga.NewMemoryStore()})
+
+	serveCtx, stop := context.WithCancel(context.Background())
+	var served sync.WaitGroup
+	serve := func(f func(ctx context.Context) error) {
+		served.Add(1)
+		go func() {
+			defer served.Done()
+			_ = f(serveCtx)
+		}()
+	}
+	for destination, handle := range env.services {
+		destination, handle := destination, handle
+		serve(func(ctx context.Context) error { return saga.ServeCommands(ctx, env.Transport, destination, handle) })
+	}
+	serve(func(ctx context.Context) error {
+		return env.Transport.Receive(ctx, RepliesDestination, executor.HandleReply)
+	})
+	shutdown := func() {
+		stop()
+		served.Wait()
+	}
+	defer shutdown()
+
+	instance, err := executor.Start(ctx, s.Name, input)
+	var execErr *saga.ExecutionError
+	if err != nil && !errors.As(err, &execErr) {
+		t.Fatalf("starting saga %s: %v", s.Name, err)
+	}
+	instance = h.await(ctx, t, executor, instance)
+	h.settle(t, env)
+	shutdown()
+
+	outcome := Outcome{
+		Faults:             faults,
+		Completed:          instance.Status == saga.StatusCompleted,
+		Result:             instance.Payload,
+		Errors:             instance.Errors,
+		CompensationErrors: instance.CompensationErrors,
+		Calls:              rec.Calls(),
+	}
+	for _, inv := range invariants {
+		if err := inv.Check(outcome); err != nil {
+			t.Errorf("invariant %q violated: %v", inv.Name, err)
+		}
+	}
+}
+
+// await resumes the instance until it is finished
+func (h Harness) await(ctx context.Context, t *testing.T, executor *saga.Executor, instance saga.Instance) saga.Instance {
+	deadline := time.Now().Add(h.timeout())
+	for !instance.Finished() {
+		if time.Now().After(deadline) {
+			t.Fatalf("saga instance %s is still %s after %s", instance.ID, instance.Status, h.timeout())
+		}
+		time.Sleep(time.Millisecond)
+
+		// retried steps are due once their backoff elapsed
+		if _, err := executor.Recover(ctx); err != nil {
+			t.Fatalf("recovering saga instances: %v", err)
+		}
+		var err error
+		if instance, err = executor.Get(saga.WithPayloadAccess(ctx), instance.ID); err != nil {
+			t.Fatalf("getting saga instance %s: %v", instance.ID, err)
+		}
+	}
+
+	return instance
+}
+
+// settle waits for the services to handle the commands sent to them
+func (h Harness) settle(t *testing.T, env *Env) {
+	deadline := time.Now().Add(h.timeout())
+	for destination := range env.services {
+		for env.Transport.Pending(destination) > 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("commands sent to %s are still pending after %s", destination, h.timeout())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func (h Harness) timeout() time.Duration {
+	if h.Timeout <= 0 {
+		return 5 * time.Second
+	}
+
+	return h.Timeout
+}
+
+func reachable(faults []Fault) bool {
+	failedStep := -1
+	for _, f := range faults {
+		if f.compensation {
+			continue
+		}
+		if failedStep >= 0 {
+			return false
+		}
+		failedStep = f.step
+	}
+
+	for _, f := range faults {
+		if f.compensation && f.step > failedStep {
+			return false
+		}
+	}
+
+	return true
+}
+
+func scenarioName(s saga.Saga, faults []Fault) string {
+	if len(faults) == 0 {
+		return "no faults"
+	}
+
+	// the failing command is named first since it is what triggers the compensations
+	ordered := make([]Fault, 0, len(faults))
+	for _, f := range faults {
+		if !f.compensation {
+			ordered = append(ordered, f)
+		}
+	}
+	for _, f := range faults {
+		if f.compensation {
+			ordered = append(ordered, f)
+		}
+	}
+
+	names := make([]string, 0, len(faults))
+	for _, f := range ordered {
+		step := s.Steps[f.step].Name
+		if step == "" {
+			step = fmt.Sprintf("step-%d", f.step)
+		}
+
+		if f.compensation {
+			names = append(names, "compensation of "+step+" fails")
+		} else {
+			names = append(names, step+" fails")
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
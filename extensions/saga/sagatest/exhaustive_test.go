@@ -0,0 +1,175 @@
+package sagatest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/saga/sagatest"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+	"github.com/stretchr/testify/require"
+)
+
+type charge struct {
+	Amount int64
+}
+
+// ledger is the state of a fake payments service
+type ledger struct {
+	mu       sync.Mutex
+	balance  int64
+	commands []saga.Message
+}
+
+func (l *ledger) handle(_ context.Context, command saga.Message) (interface{}, error) {
+	var c charge
+	if err := json.Unmarshal(command.Payload, &c); err != nil {
+		return nil, saga.Reject(err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.commands = append(l.commands, command)
+	switch command.Type {
+	case "charge":
+		l.balance += c.Amount
+	case "refund":
+		l.balance -= c.Amount
+	}
+
+	return c, nil
+}
+
+func (l *ledger) Balance() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.balance
+}
+
+func chargeSaga(env *sagatest.Env) saga.Saga {
+	amount := func(ctx context.Context) (interface{}, error) { return charge{Amount: 10}, nil }
+	step := env.Commands.Step("charge", "payments", "charge", amount, time.Hour)
+	// only a charge that was replied to is refunded
+	step.CompensationCommand = env.Commands.Compensation("charge", "payments", "refund", func(ctx context.Context) (interface{}, error) {
+		reply, ok := ctx.Value(saga.ParamKey).(saga.Reply)
+		if !ok {
+			return nil, nil
+		}
+		var c charge
+		err := reply.Decode(&c)
+		return c, err
+	})
+
+	return saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		sagatest.Step("reserve", nil),
+		step,
+		{
+			Name: "confirm",
+			Command: func(ctx context.Context) (interface{}, error) {
+				var c charge
+				err := ctx.Value(saga.ParamKey).(saga.Reply).Decode(&c)
+				return c.Amount, err
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) { return nil, nil },
+		},
+	})
+}
+
+func TestHarness_Scenarios(t *testing.T) {
+	s := saga.NewVersionedSaga("checkout", 1, []saga.Step{sagatest.Step("reserve", nil), sagatest.Step("charge", nil)})
+
+	// without faults, each command failing, then each compensation failing along with a later command
+	require.Len(t, sagatest.Harness{}.Scenarios(s), 3)
+	require.Len(t, sagatest.Harness{Depth: 2}.Scenarios(s), 6)
+}
+
+func TestHarness_RunsTheSagaThroughTheExecutor(t *testing.T) {
+	var outcomes []sagatest.Outcome
+	var ledgers []*ledger
+	sagatest.Harness{
+		Depth: 2,
+		Setup: func(t testing.TB, env *sagatest.Env) (saga.Saga, context.Context, interface{}, []sagatest.Invariant) {
+			payments := &ledger{}
+			ledgers = append(ledgers, payments)
+			env.Serve("payments", payments.handle)
+
+			return chargeSaga(env), tenant.WithID(context.Background(), "acme"), nil, []sagatest.Invariant{
+				{
+					Name: "outcomes are recorded",
+					Check: func(o sagatest.Outcome) error {
+						outcomes = append(outcomes, o)
+						return nil
+					},
+				},
+				{
+					Name: "a compensated charge is refunded",
+					Check: func(o sagatest.Outcome) error {
+						if o.Completed || len(o.CompensationErrors) > 0 {
+							return nil
+						}
+						if balance := payments.Balance(); balance != 0 {
+							return fmt.Errorf("balance is %d", balance)
+						}
+						return nil
+					},
+				},
+			}
+		},
+	}.Run(t)
+
+	// the first setup only lists the scenarios
+	require.Len(t, ledgers, len(outcomes)+1)
+	require.Len(t, outcomes, 10)
+
+	completed := outcomes[0]
+	require.True(t, completed.Completed)
+	require.Equal(t, int64(10), completed.Result)
+	require.Equal(t, int64(10), ledgers[1].Balance())
+	// the command went through the transport, on behalf of the tenant of the saga
+	require.Len(t, ledgers[1].commands, 1)
+	require.Equal(t, "acme", ledgers[1].commands[0].Tenant)
+	require.NotEmpty(t, ledgers[1].commands[0].InstanceID)
+
+	for i, o := range outcomes[1:] {
+		require.False(t, o.Completed, "scenario %d", i+1)
+		require.NotEmpty(t, o.Errors, "scenario %d", i+1)
+	}
+}
+
+func TestHarness_ReportsTheErrorsOfTheInstance(t *testing.T) {
+	var outcome sagatest.Outcome
+	sagatest.Harness{
+		Setup: func(t testing.TB, env *sagatest.Env) (saga.Saga, context.Context, interface{}, []sagatest.Invariant) {
+			env.Serve("payments", func(context.Context, saga.Message) (interface{}, error) {
+				return nil, saga.Reject(errors.New("card declined"))
+			})
+
+			return chargeSaga(env), tenant.WithID(context.Background(), "acme"), nil, []sagatest.Invariant{
+				{
+					Name: "the rejection compensates",
+					Check: func(o sagatest.Outcome) error {
+						if len(o.Faults) == 0 {
+							outcome = o
+						}
+						return nil
+					},
+				},
+			}
+		},
+	}.Run(t)
+
+	require.False(t, outcome.Completed)
+	require.Equal(t, []string{"command of step charge was rejected: card declined"}, outcome.Errors)
+	require.Equal(t, []sagatest.Call{
+		{Step: "reserve", Index: 0, Attempt: 1},
+		{Step: "charge", Index: 1, Attempt: 1},
+		{Step: "charge", Index: 1, Compensation: true, Attempt: 1},
+		{Step: "reserve", Index: 0, Compensation: true, Attempt: 1},
+	}, outcome.Calls)
+}
@@ -0,0 +1,89 @@
+package sagatest
+
+import (
+	"context"
+	"fmt"
+)
+
+type faultKind int
+
+const (
+	faultError faultKind = iota
+	faultPanic
+	faultTimeout
+)
+
+// Fault scripts a failure for a single execution of a step's command or compensation.
+// Steps are addressed by their 0-based index in the saga and attempts are 1-based, so
+// FailStep(2, 1, err) makes the first execution of the third step return err.
+type Fault struct {
+	step         int
+	attempt      int
+	compensation bool
+	kind         faultKind
+	err          error
+	panicValue   interface{}
+}
+
+// FailStep makes the command of the step return err on the given attempt
+func FailStep(step, attempt int, err error) Fault {
+	return Fault{step: step, attempt: attempt, kind: faultError, err: err}
+}
+
+// PanicStep makes the command of the step panic with value on the given attempt
+func PanicStep(step, attempt int, value interface{}) Fault {
+	return Fault{step: step, attempt: attempt, kind: faultPanic, panicValue: value}
+}
+
+// TimeoutStep makes the command of the step time out on the given attempt.
+// The command blocks until the context is done and returns its error. If the context
+// has no deadline it returns context.DeadlineExceeded right away, so tests never hang.
+func TimeoutStep(step, attempt int) Fault {
+	return Fault{step: step, attempt: attempt, kind: faultTimeout}
+}
+
+// FailCompensation makes the compensation of the step return err on the given attempt
+func FailCompensation(step, attempt int, err error) Fault {
+	return Fault{step: step, attempt: attempt, compensation: true, kind: faultError, err: err}
+}
+
+// PanicCompensation makes the compensation of the step panic with value on the given attempt
+func PanicCompensation(step, attempt int, value interface{}) Fault {
+	return Fault{step: step, attempt: attempt, compensation: true, kind: faultPanic, panicValue: value}
+}
+
+func (f Fault) String() string {
+	target := "command"
+	if f.compensation {
+		target = "compensation"
+	}
+
+	switch f.kind {
+	case faultPanic:
+		return fmt.Sprintf("panic on %s of step %d, attempt %d", target, f.step, f.attempt)
+	case faultTimeout:
+		return fmt.Sprintf("timeout on %s of step %d, attempt %d", target, f.step, f.attempt)
+	default:
+		return fmt.Sprintf("failure on %s of step %d, attempt %d", target, f.step, f.attempt)
+	}
+}
+
+func (f Fault) matches(step, attempt int, compensation bool) bool {
+	return f.step == step && f.attempt == attempt && f.compensation == compensation
+}
+
+// trigger applies the fault. It either panics or returns the error the step must fail with
+func (f Fault) trigger(ctx context.Context) error {
+	switch f.kind {
+	case faultPanic:
+		panic(f.panicValue)
+	case faultTimeout:
+		if _, ok := ctx.Deadline(); !ok {
+			return context.DeadlineExceeded
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	default:
+		return f.err
+	}
+}
@@ -0,0 +1,238 @@
+// Package sagatest provides helpers to unit test sagas without their real dependencies.
+//
+// A Recorder wraps the steps of a saga, keeps track of every command and compensation
+// executed and injects scripted faults:
+//
+//	rec := sagatest.NewRecorder()
+//	s := rec.Wrap(aSaga, sagatest.FailStep(2, 1, errors.New("boom")))
+//	saga.NewCoordinator(s).Execute(ctx)
+//	rec.AssertCommands(t, "create-order", "create-payment", "create-delivery")
+//	rec.AssertCompensations(t, "create-delivery", "create-payment", "create-order")
+package sagatest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/stretchr/testify/require"
+)
+
+// Call is a single execution of a step's command or compensation
+type Call struct {
+	Step         string
+	Index        int
+	Compensation bool
+	Attempt      int
+	Err          error
+	Panicked     bool
+}
+
+func (c Call) String() string {
+	if c.Compensation {
+		return fmt.Sprintf("compensation(%s)", c.Step)
+	}
+
+	return fmt.Sprintf("command(%s)", c.Step)
+}
+
+// Command describes an expected command call for AssertCalls
+func Command(step string) Call {
+	return Call{Step: step}
+}
+
+// Compensation describes an expected compensation call for AssertCalls
+func Compensation(step string) Call {
+	return Call{Step: step, Compensation: true}
+}
+
+type attemptKey struct {
+	index        int
+	compensation bool
+}
+
+// Recorder records the calls made to the steps it wraps. It is safe for concurrent use.
+type Recorder struct {
+	mu       sync.Mutex
+	calls    []Call
+	attempts map[attemptKey]int
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{attempts: map[attemptKey]int{}}
+}
+
+// Step returns a fake step whose command returns output and whose compensation does nothing.
+// Wrap the saga built with it to record its calls.
+func Step(name string, output interface{}) saga.Step {
+	return saga.Step{
+		Name: name,
+		Command: func(ctx context.Context) (interface{}, error) {
+			return output, nil
+		},
+		CompensationCommand: func(ctx context.Context) (interface{}, error) {
+			return nil, nil
+		},
+	}
+}
+
+// Wrap returns a copy of s whose steps are recorded and fail as scripted by faults.
+// Steps without a name are recorded as "step-<index>". Nil commands, e.g. of timer steps, and nil compensations are kept nil.
+func (r *Recorder) Wrap(s saga.Saga, faults ...Fault) saga.Saga {
+	wrapped := s
+	wrapped.Steps = make([]saga.Step, len(s.Steps))
+	for i, step := range s.Steps {
+		name := step.Name
+		if name == "" {
+			name = fmt.Sprintf("step-%d", i)
+		}
+
+		wrappedStep := step
+		wrappedStep.Name = name
+		if step.Command != nil {
+			wrappedStep.Command = r.record(i, name, false, step.Command, faults)
+		}
+		if step.CompensationCommand != nil {
+			wrappedStep.CompensationCommand = r.record(i, name, true, step.CompensationCommand, faults)
+		}
+		wrapped.Steps[i] = wrappedStep
+	}
+
+	return wrapped
+}
+
+func (r *Recorder) record(
+	index int,
+	name string,
+	compensation bool,
+	command func(ctx context.Context) (interface{}, error),
+	faults []Fault,
+) func(ctx context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		r.mu.Lock()
+		key := attemptKey{index: index, compensation: compensation}
+		r.attempts[key]++
+		call := Call{Step: name, Index: index, Compensation: compensation, Attempt: r.attempts[key]}
+		position := len(r.calls)
+		r.calls = append(r.calls, call)
+		r.mu.Unlock()
+
+		for _, f := range faults {
+			if !f.matches(index, call.Attempt, compensation) {
+				continue
+			}
+
+			if f.kind == faultPanic {
+				r.update(position, func(c *Call) { c.Panicked = true })
+			}
+			err := f.trigger(ctx)
+			r.update(position, func(c *Call) { c.Err = err })
+
+			return nil, err
+		}
+
+		response, err := command(ctx)
+		r.update(position, func(c *Call) { c.Err = err })
+
+		return response, err
+	}
+}
+
+func (r *Recorder) update(position int, f func(c *Call)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f(&r.calls[position])
+}
+
+// Calls returns every recorded call in execution order
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Call(nil), r.calls...)
+}
+
+// Commands returns the names of the steps whose command was executed, in order
+func (r *Recorder) Commands() []string {
+	return r.names(false)
+}
+
+// Compensations returns the names of the steps whose compensation was executed, in order
+func (r *Recorder) Compensations() []string {
+	return r.names(true)
+}
+
+// Attempts returns how many times the command of the step at index was executed
+func (r *Recorder) Attempts(index int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.attempts[attemptKey{index: index}]
+}
+
+// Reset forgets every recorded call and attempt
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = nil
+	r.attempts = map[attemptKey]int{}
+}
+
+func (r *Recorder) names(compensation bool) []string {
+	var names []string
+	for _, c := range r.Calls() {
+		if c.Compensation == compensation {
+			names = append(names, c.Step)
+		}
+	}
+
+	return names
+}
+
+// AssertCommands checks that exactly the given commands were executed, in that order
+func (r *Recorder) AssertCommands(t testing.TB, steps ...string) {
+	t.Helper()
+	require.Equal(t, nilIfEmpty(steps), r.Commands(), "executed commands")
+}
+
+// AssertCompensations checks that exactly the given compensations were executed, in that order
+func (r *Recorder) AssertCompensations(t testing.TB, steps ...string) {
+	t.Helper()
+	require.Equal(t, nilIfEmpty(steps), r.Compensations(), "executed compensations")
+}
+
+// AssertCalls checks the full sequence of commands and compensations.
+// Only the step name and whether it was a compensation are compared.
+func (r *Recorder) AssertCalls(t testing.TB, expected ...Call) {
+	t.Helper()
+
+	var want, got []string
+	for _, c := range expected {
+		want = append(want, c.String())
+	}
+	for _, c := range r.Calls() {
+		got = append(got, c.String())
+	}
+	require.Equal(t, want, got, "executed calls")
+}
+
+// AssertNotCompensated checks that none of the given steps had its compensation executed
+func (r *Recorder) AssertNotCompensated(t testing.TB, steps ...string) {
+	t.Helper()
+
+	compensated := r.Compensations()
+	for _, s := range steps {
+		require.NotContains(t, compensated, s, "step %s must not be compensated", s)
+	}
+}
+
+func nilIfEmpty(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+
+	return s
+}
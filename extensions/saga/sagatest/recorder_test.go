@@ -0,0 +1,40 @@
+package sagatest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/saga/sagatest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder_InjectsFaults(t *testing.T) {
+	boom := errors.New("boom")
+	rec := sagatest.NewRecorder()
+	s := rec.Wrap(saga.NewSaga([]saga.Step{
+		sagatest.Step("reserve", 1),
+		sagatest.Step("charge", 2),
+		sagatest.Step("", 3),
+	}), sagatest.FailStep(2, 1, boom), sagatest.FailCompensation(1, 1, boom))
+
+	_, ok := saga.NewCoordinator(s).Execute(context.Background())
+
+	require.False(t, ok)
+	rec.AssertCommands(t, "reserve", "charge", "step-2")
+	rec.AssertCompensations(t, "step-2", "charge", "reserve")
+	rec.AssertCalls(t,
+		sagatest.Command("reserve"), sagatest.Command("charge"), sagatest.Command("step-2"),
+		sagatest.Compensation("step-2"), sagatest.Compensation("charge"), sagatest.Compensation("reserve"))
+	require.Equal(t, 1, rec.Attempts(2))
+
+	calls := rec.Calls()
+	require.ErrorIs(t, calls[2].Err, boom)
+	require.ErrorIs(t, calls[4].Err, boom)
+	require.NoError(t, calls[5].Err)
+
+	rec.Reset()
+	require.Empty(t, rec.Calls())
+	require.Equal(t, 0, rec.Attempts(2))
+}
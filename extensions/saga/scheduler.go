@@ -0,0 +1,53 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Scheduler periodically resumes the instances of an Executor that are due: instances whose timer fired,
+// and instances abandoned by a replica that died, once their lease expired.
+// It requires the Executor to use a LeaseStore, otherwise it would also resume instances still running.
+type Scheduler struct {
+	executor *Executor
+	interval time.Duration
+	report   func(RecoveryResult, error)
+}
+
+// NewScheduler creates a scheduler checking for due instances every interval.
+// Every resumed instance, and any error listing them, is passed to report.
+func NewScheduler(executor *Executor, interval time.Duration, report func(RecoveryResult, error)) *Scheduler {
+	return &Scheduler{executor: executor, interval: interval, report: report}
+}
+
+// Run resumes due instances until ctx is done
+func (s *Scheduler) Run(ctx context.Context) error {
+	if s.executor.leases == nil {
+		return errors.New("saga scheduler requires a LeaseStore")
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.Tick(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick resumes the instances that are due right now, see Executor.Recover
+func (s *Scheduler) Tick(ctx context.Context) {
+	results, err := s.executor.Recover(ctx)
+	if err != nil {
+		s.report(RecoveryResult{}, err)
+	}
+	for _, result := range results {
+		s.report(result, nil)
+	}
+}
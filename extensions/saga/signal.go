@@ -0,0 +1,63 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNotWaitingForSignal is returned by Executor.SignalSaga when the instance does not wait for that signal,
+// e.g. because it has not reached the signal step yet, or it already received the signal or timed out
+var ErrNotWaitingForSignal = errors.New("saga instance is not waiting for this signal")
+
+// ReplySignalPrefix starts the names of the signals resuming Commands steps, which only Executor.HandleReply
+// delivers. Executor.SignalSaga rejects them with ErrReservedSignal, so its callers cannot forge a reply.
+const ReplySignalPrefix = "reply:"
+
+// ErrReservedSignal is returned by Executor.SignalSaga for the signals reserved to command replies
+var ErrReservedSignal = errors.New("signal is reserved for command replies")
+
+// reserved tells whether signal can only be delivered by HandleReply
+func reserved(signal string) bool {
+	return strings.HasPrefix(signal, ReplySignalPrefix)
+}
+
+// SignalTimeoutError fails a signal step that did not receive its signal in time, which compensates the saga
+type SignalTimeoutError struct {
+	Signal string
+}
+
+func (e *SignalTimeoutError) Error() string {
+	return fmt.Sprintf("timed out waiting for signal %q", e.Signal)
+}
+
+// WaitForSignal returns a signal step suspending the instance until Executor.SignalSaga delivers the signal.
+// Its payload becomes the step output, available to the next step through ParamKey.
+// If timeout is positive and the signal does not arrive in time, the step fails with a *SignalTimeoutError.
+// Signal steps can only run in an Executor.
+func WaitForSignal(name string, signal string, timeout time.Duration) Step {
+	step := Step{
+		Name:   name,
+		Signal: signal,
+		CompensationCommand: func(ctx context.Context) (interface{}, error) {
+			return nil, nil
+		},
+	}
+	if timeout > 0 {
+		step.Timer = func(ctx context.Context, now time.Time) (time.Time, error) {
+			return now.Add(timeout), nil
+		}
+	}
+
+	return step
+}
+
+// signal is a signal delivered to a waiting instance
+type signal struct {
+	name    string
+	payload interface{}
+	// err fails the signal step rather than completing it, e.g. when a command was rejected
+	err error
+}
@@ -0,0 +1,88 @@
+package saga_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/saga/sagatest"
+	"github.com/stretchr/testify/require"
+)
+
+func newDeliverySaga(rec *sagatest.Recorder) saga.Saga {
+	return rec.Wrap(saga.NewVersionedSaga("delivery", 1, []saga.Step{
+		sagatest.Step("create-delivery", "delivery"),
+		saga.WaitForSignal("wait-for-courier", "courier-accepted", time.Hour),
+		{
+			Name: "notify-customer",
+			Command: func(ctx context.Context) (interface{}, error) {
+				return ctx.Value(saga.ParamKey), nil
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) { return nil, nil },
+		},
+	}))
+}
+
+func TestExecutor_SignalSaga_ResumesWithThePayload(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	executor, _, _ := newExecutor(t, newDeliverySaga(rec))
+	ctx := tenantCtx()
+
+	instance, err := executor.Start(ctx, "delivery", nil)
+	require.NoError(t, err)
+	require.Equal(t, saga.StatusWaiting, instance.Status)
+	require.Equal(t, "courier-accepted", instance.WaitingFor)
+	rec.AssertCommands(t, "create-delivery")
+
+	_, err = executor.SignalSaga(ctx, instance.ID, "courier-refused", nil)
+	require.ErrorIs(t, err, saga.ErrNotWaitingForSignal)
+
+	instance, err = executor.SignalSaga(ctx, instance.ID, "courier-accepted", map[string]interface{}{"courier": "bob"})
+	require.NoError(t, err)
+	require.Equal(t, saga.StatusCompleted, instance.Status)
+	require.Equal(t, map[string]interface{}{"courier": "bob"}, instance.Payload)
+	rec.AssertCommands(t, "create-delivery", "notify-customer")
+
+	_, err = executor.SignalSaga(ctx, instance.ID, "courier-accepted", nil)
+	require.ErrorIs(t, err, saga.ErrNotWaitingForSignal)
+}
+
+func TestExecutor_SignalSaga_TimeoutCompensates(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	clock := sagatest.NewFakeClock(time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC))
+	registry := saga.NewRegistry()
+	require.NoError(t, registry.Register(newDeliverySaga(rec)))
+	executor := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: saga.NewMemoryStore(), Clock: clock})
+	var resumed []saga.RecoveryResult
+	scheduler := saga.NewScheduler(executor, time.Second, func(result saga.RecoveryResult, err error) {
+		require.NoError(t, err)
+		resumed = append(resumed, result)
+	})
+	ctx := tenantCtx()
+
+	instance, err := executor.Start(ctx, "delivery", nil)
+	require.NoError(t, err)
+	require.Equal(t, clock.Now().Add(time.Hour), instance.WakeAt)
+
+	clock.Advance(time.Hour)
+	scheduler.Tick(ctx)
+
+	require.Len(t, resumed, 1)
+	var timeoutErr *saga.SignalTimeoutError
+	require.ErrorAs(t, resumed[0].Err, &timeoutErr)
+	require.Equal(t, "courier-accepted", timeoutErr.Signal)
+	require.Equal(t, saga.StatusCompensated, resumed[0].Instance.Status)
+	rec.AssertCompensations(t, "wait-for-courier", "create-delivery")
+
+	_, err = executor.SignalSaga(ctx, instance.ID, "courier-accepted", nil)
+	require.ErrorIs(t, err, saga.ErrNotWaitingForSignal)
+}
+
+func TestCoordinator_SignalStep_RequiresExecutor(t *testing.T) {
+	s := saga.NewSaga([]saga.Step{saga.WaitForSignal("wait", "approved", 0)})
+
+	_, ok := saga.NewCoordinator(s).Execute(tenantCtx())
+
+	require.False(t, ok)
+}
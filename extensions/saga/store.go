@@ -0,0 +1,257 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrInstanceNotFound = errors.New("saga instance not found")
+
+// Store persists saga instances so they can be resumed after a crash or a deploy
+type Store interface {
+	CreateInstance(ctx context.Context, instance Instance) error
+	UpdateInstance(ctx context.Context, instance Instance) error
+	// GetInstance returns ErrInstanceNotFound if there is no instance with that id
+	GetInstance(ctx context.Context, id string) (Instance, error)
+	ListUnfinishedInstances(ctx context.Context) ([]Instance, error)
+}
+
+var (
+	_ LeaseStore = &MemoryStore{}
+	_ EventStore = &MemoryStore{}
+	_ KeyStore   = &MemoryStore{}
+)
+
+// MemoryStore is a LeaseStore, an EventStore and a KeyStore that keeps instances and their history in memory.
+// It does not survive restarts, so it is meant for tests and for running sagas that do not need to be durable.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	instances map[string]Instance
+	// events holds the events of every instance in position order, positions starting at 1
+	events    []Event
+	histories map[string][]int64
+	// keys holds the ids of the instances with a business key
+	keys map[businessKey]string
+}
+
+type businessKey struct {
+	tenant, sagaName, key string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{instances: map[string]Instance{}, histories: map[string][]int64{}, keys: map[businessKey]string{}}
+}
+
+func (s *MemoryStore) CreateInstance(_ context.Context, instance Instance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.instances[instance.ID]; ok {
+		return errors.New("saga instance already exists")
+	}
+	if instance.BusinessKey != "" {
+		key := businessKey{tenant: instance.Tenant, sagaName: instance.SagaName, key: instance.BusinessKey}
+		if _, ok := s.keys[key]; ok {
+			return ErrDuplicateBusinessKey
+		}
+		s.keys[key] = instance.ID
+	}
+	s.instances[instance.ID] = instance
+
+	return nil
+}
+
+func (s *MemoryStore) UpdateInstance(_ context.Context, instance Instance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.instances[instance.ID]
+	if !ok {
+		return ErrInstanceNotFound
+	}
+	if instance.Lease.Owner != stored.Lease.Owner {
+		return ErrLeaseLost
+	}
+	instance.Lease = stored.Lease
+	s.instances[instance.ID] = instance
+
+	return nil
+}
+
+func (s *MemoryStore) GetInstance(_ context.Context, id string) (Instance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	instance, ok := s.instances[id]
+	if !ok {
+		return Instance{}, ErrInstanceNotFound
+	}
+
+	return instance, nil
+}
+
+func (s *MemoryStore) GetInstanceByKey(_ context.Context, tenantID, sagaName, key string) (Instance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.keys[businessKey{tenant: tenantID, sagaName: sagaName, key: key}]
+	if !ok {
+		return Instance{}, ErrInstanceNotFound
+	}
+
+	return s.instances[id], nil
+}
+
+func (s *MemoryStore) ListUnfinishedInstances(_ context.Context) ([]Instance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var instances []Instance
+	for _, instance := range s.instances {
+		if !instance.Finished() {
+			instances = append(instances, instance)
+		}
+	}
+	sortByCreation(instances)
+
+	return instances, nil
+}
+
+func (s *MemoryStore) ClaimInstances(_ context.Context, lease Lease, now time.Time, limit int) ([]Instance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var claimable []Instance
+	for _, instance := range s.instances {
+		if !instance.Finished() && instance.Due(now) && abandoned(instance.Lease, now) {
+			claimable = append(claimable, instance)
+		}
+	}
+	sortByCreation(claimable)
+	if len(claimable) > limit {
+		claimable = claimable[:limit]
+	}
+
+	for i := range claimable {
+		claimable[i].Lease = lease
+		s.instances[claimable[i].ID] = claimable[i]
+	}
+
+	return claimable, nil
+}
+
+func (s *MemoryStore) ClaimInstance(_ context.Context, id string, lease Lease, now time.Time) (Instance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instance, ok := s.instances[id]
+	if !ok {
+		return Instance{}, ErrInstanceNotFound
+	}
+	if instance.Lease.Owner != "" && instance.Lease.Owner != lease.Owner && !instance.Lease.ExpiresAt.Before(now) {
+		return Instance{}, ErrLeaseLost
+	}
+	instance.Lease = lease
+	s.instances[id] = instance
+
+	return instance, nil
+}
+
+func (s *MemoryStore) RenewLease(_ context.Context, id string, lease Lease) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instance, ok := s.instances[id]
+	if !ok {
+		return ErrInstanceNotFound
+	}
+	if instance.Lease.Owner != lease.Owner {
+		return ErrLeaseLost
+	}
+	instance.Lease = lease
+	s.instances[id] = instance
+
+	return nil
+}
+
+func (s *MemoryStore) ReleaseLease(_ context.Context, id string, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instance, ok := s.instances[id]
+	if !ok {
+		return ErrInstanceNotFound
+	}
+	if instance.Lease.Owner != owner {
+		return ErrLeaseLost
+	}
+	instance.Lease = Lease{}
+	s.instances[id] = instance
+
+	return nil
+}
+
+func (s *MemoryStore) AppendEvents(_ context.Context, events []Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := map[string]int{}
+	for _, event := range events {
+		expected, ok := next[event.InstanceID]
+		if !ok {
+			expected = len(s.histories[event.InstanceID]) + 1
+		}
+		if event.Sequence != expected {
+			return ErrEventConflict
+		}
+		next[event.InstanceID] = expected + 1
+	}
+
+	for _, event := range events {
+		event.Position = int64(len(s.events) + 1)
+		s.events = append(s.events, event)
+		s.histories[event.InstanceID] = append(s.histories[event.InstanceID], event.Position)
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) ListEvents(_ context.Context, instanceID string) ([]Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := s.histories[instanceID]
+	events := make([]Event, 0, len(history))
+	for _, position := range history {
+		events = append(events, s.events[position-1])
+	}
+
+	return events, nil
+}
+
+func (s *MemoryStore) ReadEvents(_ context.Context, after int64, limit int) ([]Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if after < 0 {
+		after = 0
+	}
+	if after >= int64(len(s.events)) {
+		return nil, nil
+	}
+	end := after + int64(limit)
+	if end > int64(len(s.events)) {
+		end = int64(len(s.events))
+	}
+
+	return append([]Event(nil), s.events[after:end]...), nil
+}
+
+func sortByCreation(instances []Instance) {
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].CreatedAt.Before(instances[j].CreatedAt)
+	})
+}
@@ -0,0 +1,26 @@
+package saga
+
+import (
+	"context"
+	"time"
+)
+
+// Sleep returns a timer step suspending the instance for d
+func Sleep(name string, d time.Duration) Step {
+	return WaitUntil(name, func(ctx context.Context, now time.Time) (time.Time, error) {
+		return now.Add(d), nil
+	})
+}
+
+// WaitUntil returns a timer step suspending the instance until the time returned by until.
+// until is called once, when the step is reached, and can read the previous step output through ParamKey.
+// An error from until fails the step, like an error from a command.
+func WaitUntil(name string, until func(ctx context.Context, now time.Time) (time.Time, error)) Step {
+	return Step{
+		Name:  name,
+		Timer: until,
+		CompensationCommand: func(ctx context.Context) (interface{}, error) {
+			return nil, nil
+		},
+	}
+}
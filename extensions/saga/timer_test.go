@@ -0,0 +1,92 @@
+package saga_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/saga/sagatest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecutor_Sleep_SuspendsUntilTheSchedulerResumes(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	s := rec.Wrap(saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		sagatest.Step("authorize-payment", "authorization"),
+		saga.Sleep("wait-for-stock", 30*time.Minute),
+		{
+			Name: "capture-payment",
+			Command: func(ctx context.Context) (interface{}, error) {
+				return ctx.Value(saga.ParamKey), nil
+			},
+			CompensationCommand: func(ctx context.Context) (interface{}, error) { return nil, nil },
+		},
+	}))
+	clock := sagatest.NewFakeClock(time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC))
+	store := saga.NewMemoryStore()
+	registry := saga.NewRegistry()
+	require.NoError(t, registry.Register(s))
+	executor := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: store, Clock: clock})
+	var resumed []saga.RecoveryResult
+	scheduler := saga.NewScheduler(executor, time.Second, func(result saga.RecoveryResult, err error) {
+		require.NoError(t, err)
+		resumed = append(resumed, result)
+	})
+
+	instance, err := executor.Start(tenantCtx(), "checkout", nil)
+	require.NoError(t, err)
+	require.Equal(t, saga.StatusWaiting, instance.Status)
+	require.Equal(t, clock.Now().Add(30*time.Minute), instance.WakeAt)
+	rec.AssertCommands(t, "authorize-payment")
+
+	// the lease is released, so whichever replica runs a scheduler can resume it
+	stored, err := store.GetInstance(tenantCtx(), instance.ID)
+	require.NoError(t, err)
+	require.Equal(t, saga.Lease{}, stored.Lease)
+
+	clock.Advance(29 * time.Minute)
+	scheduler.Tick(tenantCtx())
+	require.Empty(t, resumed)
+
+	clock.Advance(time.Minute)
+	scheduler.Tick(tenantCtx())
+	require.Len(t, resumed, 1)
+	require.NoError(t, resumed[0].Err)
+	require.Equal(t, saga.StatusCompleted, resumed[0].Instance.Status)
+	require.Equal(t, "authorization", resumed[0].Instance.Payload)
+	rec.AssertCommands(t, "authorize-payment", "capture-payment")
+}
+
+func TestExecutor_WaitUntil_ErrorCompensates(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	deadlineErr := errors.New("no deadline for this order")
+	s := rec.Wrap(saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		sagatest.Step("authorize-payment", "authorization"),
+		saga.WaitUntil("wait-for-deadline", func(ctx context.Context, now time.Time) (time.Time, error) {
+			return time.Time{}, deadlineErr
+		}),
+	}))
+	executor, _, _ := newExecutor(t, s)
+
+	instance, err := executor.Start(tenantCtx(), "checkout", nil)
+
+	require.ErrorIs(t, err, deadlineErr)
+	require.Equal(t, saga.StatusCompensated, instance.Status)
+	rec.AssertCompensations(t, "wait-for-deadline", "authorize-payment")
+}
+
+func TestCoordinator_Sleep_BlocksWithoutExecutor(t *testing.T) {
+	s := saga.NewSaga([]saga.Step{
+		sagatest.Step("first", 1),
+		saga.Sleep("wait", 10*time.Millisecond),
+	})
+
+	started := time.Now()
+	result, ok := saga.NewCoordinator(s).Execute(tenantCtx())
+
+	require.True(t, ok)
+	require.Equal(t, 1, result)
+	require.GreaterOrEqual(t, time.Since(started), 10*time.Millisecond)
+}
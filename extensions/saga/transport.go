@@ -0,0 +1,139 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Message is a command sent by a saga step to another service, or the reply to it
+type Message struct {
+	// ID identifies the message. Commands sent again by a resumed step keep their id, so handlers can
+	// deduplicate them, and replies keep the id of their command.
+	ID string
+	// Destination is the queue the message is sent to, e.g. "payments.commands"
+	Destination string
+	// Type tells commands apart, e.g. "payments.CreatePayment"
+	Type string
+	// InstanceID and Step correlate a command and its reply with the saga step waiting for it
+	InstanceID string
+	Step       string
+	// ReplyTo is the destination of the reply to a command
+	ReplyTo string
+	// Tenant is the tenant the command is sent for, see tenant.WithID. Handlers act on its behalf.
+	Tenant  string
+	Payload json.RawMessage
+	// Error is set by replies to commands that failed
+	Error string
+}
+
+// Transport delivers messages between services, at least once
+type Transport interface {
+	Send(ctx context.Context, message Message) error
+	// Receive hands the messages sent to destination to handle, one at a time, until ctx is done.
+	// Messages that handle fails on are delivered again later.
+	Receive(ctx context.Context, destination string, handle func(ctx context.Context, message Message) error) error
+}
+
+var _ Transport = &MemoryTransport{}
+
+// MemoryTransport delivers messages within the process. Undelivered messages are lost on restart,
+// so it is meant for tests and development.
+type MemoryTransport struct {
+	mu     sync.Mutex
+	queues map[string]*memoryQueue
+	// redelivery is how long a message that failed to be handled waits before being delivered again
+	redelivery time.Duration
+}
+
+type memoryQueue struct {
+	messages []Message
+	// ready is signaled whenever a message is added
+	ready chan struct{}
+}
+
+// NewMemoryTransport creates a transport delivering messages that failed to be handled again after redelivery
+func NewMemoryTransport(redelivery time.Duration) *MemoryTransport {
+	return &MemoryTransport{queues: map[string]*memoryQueue{}, redelivery: redelivery}
+}
+
+func (t *MemoryTransport) Send(_ context.Context, message Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	q := t.queue(message.Destination)
+	q.messages = append(q.messages, message)
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+func (t *MemoryTransport) Receive(ctx context.Context, destination string, handle func(ctx context.Context, message Message) error) error {
+	t.mu.Lock()
+	q := t.queue(destination)
+	t.mu.Unlock()
+
+	for {
+		message, ok := t.next(q)
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-q.ready:
+			}
+			continue
+		}
+
+		if err := handle(ctx, message); err != nil {
+			go t.redeliver(ctx, message)
+		}
+	}
+}
+
+// Pending returns the number of messages sent to destination and not handled yet
+func (t *MemoryTransport) Pending(destination string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.queue(destination).messages)
+}
+
+func (t *MemoryTransport) next(q *memoryQueue) (Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(q.messages) == 0 {
+		return Message{}, false
+	}
+	message := q.messages[0]
+	q.messages = q.messages[1:]
+
+	return message, true
+}
+
+func (t *MemoryTransport) redeliver(ctx context.Context, message Message) {
+	timer := time.NewTimer(t.redelivery)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		// keep it for the next receiver
+	case <-timer.C:
+	}
+	_ = t.Send(context.Background(), message)
+}
+
+// queue must be called with t.mu held
+func (t *MemoryTransport) queue(destination string) *memoryQueue {
+	q, ok := t.queues[destination]
+	if !ok {
+		q = &memoryQueue{ready: make(chan struct{}, 1)}
+		t.queues[destination] = q
+	}
+
+	return q
+}
@@ -0,0 +1,97 @@
+package saga
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError lists every structural problem Validate found in a saga definition
+type ValidationError struct {
+	Saga     string
+	Version  int
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("saga %q version %d is invalid: %s", e.Saga, e.Version, strings.Join(e.Problems, "; "))
+}
+
+// Validate checks the structure of a saga definition, without running it:
+//   - every step has a command, a timer or a signal, otherwise the steps after it are unreachable
+//   - timer steps have no command, as it would never run
+//   - at most one step is the pivot
+//   - no Retriable step comes before the pivot, and every step after it is Retriable,
+//     so the saga is never compensated past its point of no return
+//   - every compensatable step has a compensation: in a Backward saga, the steps before the pivot, or every step
+//     that is not Retriable without a pivot
+//
+// It is meant to be run in unit tests for every saga definition, along with DryRun.
+func Validate(s Saga) error {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if len(s.Steps) == 0 {
+		report("it has no steps")
+	}
+
+	pivot := -1
+	for i, step := range s.Steps {
+		if step.Pivot {
+			if pivot >= 0 {
+				report("steps %s and %s are both pivots", stepName(s, pivot), stepName(s, i))
+				continue
+			}
+			pivot = i
+		}
+	}
+
+	for i, step := range s.Steps {
+		name := stepName(s, i)
+		switch {
+		case step.Command == nil && step.Timer == nil && step.Signal == "":
+			if i < len(s.Steps)-1 {
+				report("step %s has no command, so the steps after it are unreachable", name)
+			} else {
+				report("step %s has no command", name)
+			}
+		case step.Command != nil && step.Timer != nil && step.Signal == "":
+			report("step %s is a timer step, so its command is unreachable", name)
+		}
+
+		if pivot >= 0 && i < pivot && step.Retriable {
+			report("step %s is retriable but comes before the pivot %s", name, stepName(s, pivot))
+		}
+		if pivot >= 0 && i > pivot && !step.Retriable {
+			report("step %s comes after the pivot %s but is not retriable", name, stepName(s, pivot))
+		}
+		if s.Recovery == Backward && compensatable(step, i, pivot) && step.CompensationCommand == nil {
+			report("step %s is compensatable but has no compensation", name)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Saga: s.Name, Version: s.Version, Problems: problems}
+	}
+
+	return nil
+}
+
+// compensatable tells whether the step at index may be compensated, given the index of the pivot or -1
+func compensatable(step Step, index, pivot int) bool {
+	if step.Pivot || step.Retriable {
+		return false
+	}
+
+	return pivot < 0 || index < pivot
+}
+
+// stepName returns the name of a step for reports, and its index when it has none
+func stepName(s Saga, index int) string {
+	if s.Steps[index].Name == "" {
+		return fmt.Sprintf("%d", index)
+	}
+
+	return fmt.Sprintf("%d %q", index, s.Steps[index].Name)
+}
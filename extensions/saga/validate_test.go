@@ -0,0 +1,110 @@
+package saga_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/saga/sagatest"
+	"github.com/stretchr/testify/require"
+)
+
+func noop(ctx context.Context) (interface{}, error) {
+	return nil, nil
+}
+
+func TestValidate_ReportsEveryProblem(t *testing.T) {
+	s := saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		{Name: "reserve-stock", Command: noop},
+		{Name: "refund", Command: noop, Retriable: true},
+		{Name: "charge", Command: noop, Pivot: true},
+		{Name: "ship", Command: noop, Pivot: true},
+		{Name: "notify", Command: noop},
+		{Name: "wait", Command: noop, Timer: func(ctx context.Context, now time.Time) (time.Time, error) { return now, nil }},
+		{Name: "broken"},
+		{Name: "unreachable", Command: noop, Retriable: true},
+	})
+
+	err := saga.Validate(s)
+
+	var validationErr *saga.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, []string{
+		`steps 2 "charge" and 3 "ship" are both pivots`,
+		`step 0 "reserve-stock" is compensatable but has no compensation`,
+		`step 1 "refund" is retriable but comes before the pivot 2 "charge"`,
+		`step 3 "ship" comes after the pivot 2 "charge" but is not retriable`,
+		`step 4 "notify" comes after the pivot 2 "charge" but is not retriable`,
+		`step 5 "wait" is a timer step, so its command is unreachable`,
+		`step 5 "wait" comes after the pivot 2 "charge" but is not retriable`,
+		`step 6 "broken" has no command, so the steps after it are unreachable`,
+		`step 6 "broken" comes after the pivot 2 "charge" but is not retriable`,
+	}, validationErr.Problems)
+}
+
+func TestValidate_PivotAndForwardSagasNeedNoCompensation(t *testing.T) {
+	pivoted := saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		{Name: "reserve-stock", Command: noop, CompensationCommand: noop},
+		{Name: "charge", Command: noop, Pivot: true},
+		{Name: "ship", Command: noop, Retriable: true},
+	})
+	require.NoError(t, saga.Validate(pivoted))
+
+	forward := saga.NewVersionedSaga("refund", 1, []saga.Step{{Name: "refund", Command: noop}})
+	forward.Recovery = saga.Forward
+	require.NoError(t, saga.Validate(forward))
+}
+
+func TestDryRun_PlansEveryFailurePoint(t *testing.T) {
+	s := saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		{Name: "reserve-stock", Command: noop, CompensationCommand: noop},
+		saga.Sleep("wait-for-stock", time.Hour),
+		{Name: "charge", Command: noop, Pivot: true},
+		{Name: "ship", Command: noop, Retriable: true},
+	})
+
+	plan, err := saga.DryRun(s)
+
+	require.NoError(t, err)
+	require.Equal(t, `saga "checkout" version 1
+  no failure: run reserve-stock, wait-for-stock, charge, ship; completed
+  step 0 fails: run reserve-stock; compensate reserve-stock; compensated
+  step 1 fails: run reserve-stock, wait-for-stock; compensate wait-for-stock, reserve-stock; compensated
+  step 2 fails: run reserve-stock, wait-for-stock, charge; compensate wait-for-stock, reserve-stock; compensated
+  step 3 fails: run reserve-stock, wait-for-stock, charge, ship, ship; completed
+`, plan.String())
+}
+
+func TestDryRun_RejectsInvalidSagas(t *testing.T) {
+	_, err := saga.DryRun(saga.NewVersionedSaga("checkout", 1, []saga.Step{{Name: "charge", Command: noop}}))
+
+	var validationErr *saga.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+}
+
+func TestExecutor_RetriableStep_RetriesInsteadOfCompensating(t *testing.T) {
+	rec := sagatest.NewRecorder()
+	s := rec.Wrap(saga.NewVersionedSaga("checkout", 1, []saga.Step{
+		sagatest.Step("reserve-stock", 1),
+		{Name: "charge", Command: noop, Pivot: true},
+		{Name: "ship", Command: noop, Retriable: true},
+	}), sagatest.FailStep(2, 1, errors.New("carrier unavailable")))
+	clock := sagatest.NewFakeClock(time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC))
+	registry := saga.NewRegistry()
+	require.NoError(t, registry.Register(s))
+	executor := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: saga.NewMemoryStore(), Clock: clock})
+
+	instance, err := executor.Start(tenantCtx(), "checkout", nil)
+	require.NoError(t, err)
+	require.Equal(t, saga.StatusRetrying, instance.Status)
+
+	clock.Advance(time.Second)
+	results, err := executor.Recover(tenantCtx())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, saga.StatusCompleted, results[0].Instance.Status)
+	rec.AssertCommands(t, "reserve-stock", "charge", "ship", "ship")
+	require.Empty(t, rec.Compensations())
+}
@@ -0,0 +1,182 @@
+package tenant
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ErrInvalidCredentials is returned for credentials that were not issued by the Authenticator, or that expired
+var ErrInvalidCredentials = errors.New("invalid tenant credentials")
+
+// MetadataKey is the gRPC metadata key holding the credentials of the tenant, as "Bearer <token>".
+// The grpc-gateway forwards the Authorization header of HTTP requests to it.
+const MetadataKey = "authorization"
+
+const bearerPrefix = "Bearer "
+
+// Authenticator issues and verifies the credentials of tenants: tokens naming the tenant and their expiry, signed
+// with HMAC-SHA256 and a secret shared by the services, so a tenant cannot act on behalf of another one.
+type Authenticator struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+type claims struct {
+	Tenant    string   `json:"tenant"`
+	Roles     []string `json:"roles,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// NewAuthenticator creates an authenticator issuing tokens valid for ttl. The secret must be at least 32 bytes long.
+func NewAuthenticator(secret []byte, ttl time.Duration) (*Authenticator, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("tenant token secret must be at least 32 bytes long")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("tenant token ttl must be positive")
+	}
+
+	return &Authenticator{secret: secret, ttl: ttl, now: time.Now}, nil
+}
+
+// Sign issues a token for the tenant, granting the given roles to its bearer, see HasRole
+func (a *Authenticator) Sign(id string, roles ...string) (string, error) {
+	if id == "" {
+		return "", ErrMissing
+	}
+
+	data, err := json.Marshal(claims{Tenant: id, Roles: roles, ExpiresAt: a.now().Add(a.ttl).Unix()})
+	if err != nil {
+		return "", fmt.Errorf("encoding tenant token: %w", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+
+	return payload + "." + base64.RawURLEncoding.EncodeToString(a.mac(payload)), nil
+}
+
+// Verify returns the tenant of a token issued by Sign, or ErrInvalidCredentials
+func (a *Authenticator) Verify(token string) (string, error) {
+	c, err := a.verify(token)
+
+	return c.Tenant, err
+}
+
+func (a *Authenticator) verify(token string) (claims, error) {
+	payload, signature, ok := cut(token, ".")
+	if !ok {
+		return claims{}, ErrInvalidCredentials
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, a.mac(payload)) {
+		return claims{}, ErrInvalidCredentials
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return claims{}, ErrInvalidCredentials
+	}
+	var c claims
+	if err := json.Unmarshal(data, &c); err != nil || c.Tenant == "" {
+		return claims{}, ErrInvalidCredentials
+	}
+	if a.now().Unix() >= c.ExpiresAt {
+		return claims{}, ErrInvalidCredentials
+	}
+
+	return c, nil
+}
+
+func (a *Authenticator) mac(payload string) []byte {
+	h := hmac.New(sha256.New, a.secret)
+	h.Write([]byte(payload)) //nolint:errcheck
+
+	return h.Sum(nil)
+}
+
+// FromIncomingContext returns the tenant authenticated by the credentials a gRPC client sent in MetadataKey.
+// It returns ErrMissing without credentials, and ErrInvalidCredentials for invalid ones.
+func (a *Authenticator) FromIncomingContext(ctx context.Context) (string, error) {
+	c, err := a.fromIncomingContext(ctx)
+
+	return c.Tenant, err
+}
+
+func (a *Authenticator) fromIncomingContext(ctx context.Context) (claims, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(MetadataKey)
+	if len(values) == 0 {
+		return claims{}, ErrMissing
+	}
+	if !strings.HasPrefix(values[0], bearerPrefix) {
+		return claims{}, ErrInvalidCredentials
+	}
+
+	return a.verify(strings.TrimSpace(strings.TrimPrefix(values[0], bearerPrefix)))
+}
+
+// UnaryServerInterceptor serves every call on behalf of the tenant authenticated by its credentials, with the roles
+// they grant, and rejects calls without valid ones with Unauthenticated, except the health checks
+func UnaryServerInterceptor(auth *Authenticator) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if strings.HasSuffix(info.FullMethod, "/GetHealth") {
+			return handler(ctx, req)
+		}
+
+		c, err := auth.fromIncomingContext(ctx)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		return handler(withRoles(WithID(ctx, c.Tenant), c.Roles), req)
+	}
+}
+
+// UnaryClientInterceptor sends credentials for the tenant of the context along with every call, so downstream
+// services act on behalf of the same tenant. Roles are not forwarded.
+func UnaryClientInterceptor(auth *Authenticator) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		if id := ID(ctx); id != "" {
+			token, err := auth.Sign(id)
+			if err != nil {
+				return err
+			}
+			ctx = metadata.AppendToOutgoingContext(ctx, MetadataKey, bearerPrefix+token)
+		}
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// cut is strings.Cut, which needs go 1.18
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+
+	return s, "", false
+}
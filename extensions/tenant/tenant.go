@@ -0,0 +1,82 @@
+// Package tenant carries the tenant a request is served for, e.g. a merchant, through contexts and gRPC metadata,
+// so every layer down to the persistence queries only acts on that tenant's data.
+package tenant
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrMissing is returned when an operation scoped to a tenant is run without one
+var ErrMissing = errors.New("no tenant in context")
+
+type contextKey string
+
+const (
+	idKey     = contextKey("tenant-id")
+	systemKey = contextKey("tenant-system")
+	rolesKey  = contextKey("tenant-roles")
+)
+
+// WithID returns a context acting on behalf of the tenant
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idKey, id)
+}
+
+// WithSystem returns a context acting on behalf of every tenant, for background jobs such as saga recovery.
+// It must never be derived from a request. Setting a tenant with WithID restricts it to that tenant again.
+func WithSystem(ctx context.Context) context.Context {
+	return context.WithValue(ctx, systemKey, true)
+}
+
+// ID returns the tenant of ctx, or an empty string if it has none
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(idKey).(string)
+
+	return id
+}
+
+// IsSystem tells whether ctx acts on behalf of every tenant, see WithSystem
+func IsSystem(ctx context.Context) bool {
+	system, _ := ctx.Value(systemKey).(bool)
+
+	return system && ID(ctx) == ""
+}
+
+// withRoles returns a context granted roles. They only come from credentials verified by an Authenticator.
+func withRoles(ctx context.Context, roles []string) context.Context {
+	return context.WithValue(ctx, rolesKey, roles)
+}
+
+// HasRole tells whether the credentials ctx was authenticated with grant role, see Authenticator.Sign
+func HasRole(ctx context.Context, role string) bool {
+	roles, _ := ctx.Value(rolesKey).([]string)
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Require returns the tenant of ctx, or ErrMissing if it has none
+func Require(ctx context.Context) (string, error) {
+	id := ID(ctx)
+	if id == "" {
+		return "", ErrMissing
+	}
+
+	return id, nil
+}
+
+// Visible tells whether a record owned by owner can be seen from ctx. System contexts see every record, and other
+// contexts only see the records of their own tenant, so a context missing its tenant sees no record at all.
+func Visible(ctx context.Context, owner string) bool {
+	if IsSystem(ctx) {
+		return true
+	}
+	id := ID(ctx)
+
+	return id != "" && id == owner
+}
@@ -0,0 +1,146 @@
+package tenant_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var secret = []byte(strings.Repeat("s", 32))
+
+func TestRequire(t *testing.T) {
+	_, err := tenant.Require(context.Background())
+	require.ErrorIs(t, err, tenant.ErrMissing)
+
+	id, err := tenant.Require(tenant.WithID(context.Background(), "acme"))
+	require.NoError(t, err)
+	require.Equal(t, "acme", id)
+}
+
+func TestVisible(t *testing.T) {
+	require.True(t, tenant.Visible(tenant.WithID(context.Background(), "acme"), "acme"))
+	require.False(t, tenant.Visible(tenant.WithID(context.Background(), "globex"), "acme"))
+	require.False(t, tenant.Visible(tenant.WithID(context.Background(), "globex"), ""))
+
+	// without a tenant, a context sees no record at all
+	require.False(t, tenant.Visible(context.Background(), "acme"))
+	require.False(t, tenant.Visible(context.Background(), ""))
+
+	system := tenant.WithSystem(context.Background())
+	require.True(t, tenant.Visible(system, "acme"))
+	require.True(t, tenant.Visible(system, ""))
+	require.False(t, tenant.Visible(tenant.WithID(system, "globex"), "acme"))
+}
+
+func TestAuthenticator(t *testing.T) {
+	_, err := tenant.NewAuthenticator([]byte("short"), time.Minute)
+	require.Error(t, err)
+
+	auth, err := tenant.NewAuthenticator(secret, time.Minute)
+	require.NoError(t, err)
+
+	token, err := auth.Sign("acme")
+	require.NoError(t, err)
+	id, err := auth.Verify(token)
+	require.NoError(t, err)
+	require.Equal(t, "acme", id)
+
+	other, err := tenant.NewAuthenticator([]byte(strings.Repeat("o", 32)), time.Minute)
+	require.NoError(t, err)
+	_, err = other.Verify(token)
+	require.ErrorIs(t, err, tenant.ErrInvalidCredentials)
+
+	for _, forged := range []string{"", "acme", token + "x", "eyJ0ZW5hbnQiOiJnbG9iZXgifQ." + strings.SplitN(token, ".", 2)[1]} {
+		_, err = auth.Verify(forged)
+		require.ErrorIs(t, err, tenant.ErrInvalidCredentials, forged)
+	}
+}
+
+func TestAuthenticator_RejectsExpiredTokens(t *testing.T) {
+	auth, err := tenant.NewAuthenticator(secret, time.Nanosecond)
+	require.NoError(t, err)
+
+	token, err := auth.Sign("acme")
+	require.NoError(t, err)
+
+	_, err = auth.Verify(token)
+	require.ErrorIs(t, err, tenant.ErrInvalidCredentials)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	auth, err := tenant.NewAuthenticator(secret, time.Minute)
+	require.NoError(t, err)
+	interceptor := tenant.UnaryServerInterceptor(auth)
+	info := &grpc.UnaryServerInfo{FullMethod: "/orders.OrdersAPI/GetOrder"}
+
+	var served string
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		served = tenant.ID(ctx)
+		return nil, nil
+	}
+
+	// a bare tenant id is not a credential
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenant.MetadataKey, "acme"))
+	_, err = interceptor(ctx, nil, info, handler)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = interceptor(context.Background(), nil, info, handler)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/orders.OrdersAPI/GetHealth"}, handler)
+	require.NoError(t, err)
+
+	token, err := auth.Sign("acme")
+	require.NoError(t, err)
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenant.MetadataKey, "Bearer "+token))
+	_, err = interceptor(ctx, nil, info, handler)
+	require.NoError(t, err)
+	require.Equal(t, "acme", served)
+}
+
+func TestUnaryServerInterceptor_GrantsTheRolesOfTheToken(t *testing.T) {
+	auth, err := tenant.NewAuthenticator(secret, time.Minute)
+	require.NoError(t, err)
+	info := &grpc.UnaryServerInfo{FullMethod: "/orders.OrdersAPI/GetSaga"}
+
+	var operator, admin bool
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		operator, admin = tenant.HasRole(ctx, "operator"), tenant.HasRole(ctx, "admin")
+		return nil, nil
+	}
+
+	token, err := auth.Sign("acme", "operator")
+	require.NoError(t, err)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenant.MetadataKey, "Bearer "+token))
+	_, err = tenant.UnaryServerInterceptor(auth)(ctx, nil, info, handler)
+	require.NoError(t, err)
+	require.True(t, operator)
+	require.False(t, admin)
+
+	// roles only come from verified credentials
+	require.False(t, tenant.HasRole(tenant.WithID(context.Background(), "acme"), "operator"))
+}
+
+func TestUnaryClientInterceptor_PropagatesTheTenant(t *testing.T) {
+	auth, err := tenant.NewAuthenticator(secret, time.Minute)
+	require.NoError(t, err)
+
+	var received string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		received, err = auth.FromIncomingContext(metadata.NewIncomingContext(ctx, md))
+		return err
+	}
+
+	ctx := tenant.WithID(context.Background(), "acme")
+	require.NoError(t, tenant.UnaryClientInterceptor(auth)(ctx, "/payments.PaymentsAPI/CreatePayment", nil, nil, nil, invoker))
+	require.Equal(t, "acme", received)
+}
@@ -2,20 +2,35 @@ package deliveries
 
 import (
 	"context"
+	"fmt"
+	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/domain/delivery"
 	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/extensions/circuitbreaker"
 	v1 "github.com/didopimentel/go-saga-poc/protogen/delivery/api/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type Gateway struct {
-	cli v1.DeliveryAPIClient
+	cli     v1.DeliveryAPIClient
+	breaker *circuitbreaker.Breaker
 }
 
-func NewGateway(client v1.DeliveryAPIClient) *Gateway {
-	return &Gateway{cli: client}
+// NewGateway creates a deliveries gateway. While the breaker is open, calls fail fast with a *circuitbreaker.OpenError,
+// except compensations such as ReinstateDelivery, which are always attempted.
+func NewGateway(client v1.DeliveryAPIClient, breaker *circuitbreaker.Breaker) *Gateway {
+	return &Gateway{cli: client, breaker: breaker}
 }
 
 func (g *Gateway) CreateDelivery(ctx context.Context, orderID int64) (entities.Delivery, error) {
-	response, err := g.cli.CreateDelivery(ctx, &v1.CreateDeliveryRequest{OrderId: orderID})
+	var response *v1.CreateDeliveryResponse
+	err := g.breaker.Execute(func() error {
+		var err error
+		response, err = g.cli.CreateDelivery(ctx, &v1.CreateDeliveryRequest{OrderId: orderID})
+		return err
+	})
 	if err != nil {
 		return entities.Delivery{}, err
 	}
@@ -25,3 +40,48 @@ func (g *Gateway) CreateDelivery(ctx context.Context, orderID int64) (entities.D
 		OrderID: response.OrderId,
 	}, nil
 }
+
+// CancelDelivery fails with domain.ErrAlreadyDelivered if the delivery was delivered, and with
+// domain.ErrStatusChanged if its status changed concurrently
+func (g *Gateway) CancelDelivery(ctx context.Context, deliveryID int64) error {
+	err := g.breaker.Execute(func() error {
+		_, err := g.cli.CancelDelivery(ctx, &v1.CancelDeliveryRequest{Id: deliveryID})
+		return err
+	})
+
+	return domainError(err)
+}
+
+func (g *Gateway) ReinstateDelivery(ctx context.Context, deliveryID int64) error {
+	_, err := g.cli.ReinstateDelivery(ctx, &v1.ReinstateDeliveryRequest{Id: deliveryID})
+
+	return err
+}
+
+// reasons maps the reasons of the failed preconditions of the delivery API to domain errors
+var reasons = map[string]error{
+	delivery.ReasonAlreadyDelivered:  domain.ErrAlreadyDelivered,
+	delivery.ReasonDeliveryCancelled: domain.ErrDeliveryCancelled,
+	delivery.ReasonStatusChanged:     domain.ErrStatusChanged,
+}
+
+// domainError wraps the domain error matching the reason of a failed precondition, which the delivery API sends as
+// an ErrorInfo detail. Other errors are returned as is.
+func domainError(err error) error {
+	if status.Code(err) != codes.FailedPrecondition {
+		return err
+	}
+
+	st := status.Convert(err)
+	for _, detail := range st.Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if !ok || info.Domain != delivery.ErrorDomain {
+			continue
+		}
+		if domainErr, ok := reasons[info.Reason]; ok {
+			return fmt.Errorf("%w: %s", domainErr, st.Message())
+		}
+	}
+
+	return err
+}
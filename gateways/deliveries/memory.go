@@ -0,0 +1,89 @@
+package deliveries
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+)
+
+// MemoryGateway is an in-memory replacement of Gateway, meant for tests
+type MemoryGateway struct {
+	mu         sync.Mutex
+	nextID     int64
+	deliveries map[int64]entities.Delivery
+}
+
+func NewMemoryGateway() *MemoryGateway {
+	return &MemoryGateway{deliveries: map[int64]entities.Delivery{}}
+}
+
+func (g *MemoryGateway) CreateDelivery(_ context.Context, orderID int64) (entities.Delivery, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.nextID++
+	delivery := entities.Delivery{ID: g.nextID, OrderID: orderID, Status: entities.DeliveryStatusScheduled}
+	g.deliveries[delivery.ID] = delivery
+
+	return delivery, nil
+}
+
+// CancelDelivery fails with domain.ErrAlreadyDelivered if the delivery was delivered, see Complete
+func (g *MemoryGateway) CancelDelivery(_ context.Context, deliveryID int64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delivery, ok := g.deliveries[deliveryID]
+	if !ok {
+		return fmt.Errorf("delivery %d: %w", deliveryID, domain.ErrNotFound)
+	}
+	if delivery.Status == entities.DeliveryStatusDelivered {
+		return fmt.Errorf("delivery %d: %w", deliveryID, domain.ErrAlreadyDelivered)
+	}
+	delivery.Status = entities.DeliveryStatusCancelled
+	g.deliveries[deliveryID] = delivery
+
+	return nil
+}
+
+func (g *MemoryGateway) ReinstateDelivery(_ context.Context, deliveryID int64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delivery, ok := g.deliveries[deliveryID]
+	if !ok {
+		return fmt.Errorf("delivery %d: %w", deliveryID, domain.ErrNotFound)
+	}
+	if delivery.Status == entities.DeliveryStatusCancelled {
+		delivery.Status = entities.DeliveryStatusScheduled
+		g.deliveries[deliveryID] = delivery
+	}
+
+	return nil
+}
+
+// Complete marks a delivery as delivered, as the delivery service does once the courier delivered it
+func (g *MemoryGateway) Complete(deliveryID int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delivery := g.deliveries[deliveryID]
+	delivery.Status = entities.DeliveryStatusDelivered
+	g.deliveries[deliveryID] = delivery
+}
+
+// Deliveries returns every delivery that currently exists
+func (g *MemoryGateway) Deliveries() []entities.Delivery {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	deliveries := make([]entities.Delivery, 0, len(g.deliveries))
+	for _, d := range g.deliveries {
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries
+}
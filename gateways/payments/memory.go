@@ -0,0 +1,52 @@
+package payments
+
+import (
+	"context"
+	"sync"
+
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+)
+
+// MemoryGateway is an in-memory replacement of Gateway, meant for tests
+type MemoryGateway struct {
+	mu       sync.Mutex
+	nextID   int64
+	payments map[int64]entities.Payment
+}
+
+func NewMemoryGateway() *MemoryGateway {
+	return &MemoryGateway{payments: map[int64]entities.Payment{}}
+}
+
+func (g *MemoryGateway) CreatePayment(_ context.Context, orderID, amount int64) (entities.Payment, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.nextID++
+	payment := entities.Payment{ID: g.nextID, OrderID: orderID, Amount: amount}
+	g.payments[payment.ID] = payment
+
+	return payment, nil
+}
+
+func (g *MemoryGateway) DeletePayment(_ context.Context, paymentID int64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.payments, paymentID)
+
+	return nil
+}
+
+// Payments returns every payment that currently exists
+func (g *MemoryGateway) Payments() []entities.Payment {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	payments := make([]entities.Payment, 0, len(g.payments))
+	for _, p := range g.payments {
+		payments = append(payments, p)
+	}
+
+	return payments
+}
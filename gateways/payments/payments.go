@@ -3,19 +3,28 @@ package payments
 import (
 	"context"
 	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/extensions/circuitbreaker"
 	v1 "github.com/didopimentel/go-saga-poc/protogen/payments/api/v1"
 )
 
 type Gateway struct {
-	cli v1.PaymentsAPIClient
+	cli     v1.PaymentsAPIClient
+	breaker *circuitbreaker.Breaker
 }
 
-func NewGateway(client v1.PaymentsAPIClient) *Gateway {
-	return &Gateway{cli: client}
+// NewGateway creates a payments gateway. While the breaker is open, CreatePayment fails fast with a
+// *circuitbreaker.OpenError. Compensations such as DeletePayment are always attempted.
+func NewGateway(client v1.PaymentsAPIClient, breaker *circuitbreaker.Breaker) *Gateway {
+	return &Gateway{cli: client, breaker: breaker}
 }
 
-func (g *Gateway) CreatePayment(ctx context.Context, orderID int64) (entities.Payment, error) {
-	response, err := g.cli.CreatePayment(ctx, &v1.CreatePaymentRequest{OrderId: orderID})
+func (g *Gateway) CreatePayment(ctx context.Context, orderID, amount int64) (entities.Payment, error) {
+	var response *v1.CreatePaymentResponse
+	err := g.breaker.Execute(func() error {
+		var err error
+		response, err = g.cli.CreatePayment(ctx, &v1.CreatePaymentRequest{OrderId: orderID, Amount: amount})
+		return err
+	})
 	if err != nil {
 		return entities.Payment{}, err
 	}
@@ -23,6 +32,7 @@ func (g *Gateway) CreatePayment(ctx context.Context, orderID int64) (entities.Pa
 	return entities.Payment{
 		ID:      response.Id,
 		OrderID: response.OrderId,
+		Amount:  response.Amount,
 	}, nil
 }
 
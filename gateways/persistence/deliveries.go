@@ -2,30 +2,41 @@ package persistence
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/didopimentel/go-saga-poc/domain"
 	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+	"github.com/jackc/pgx/v4"
 )
 
+// Deliveries only acts on the deliveries of the tenant of the context, and fails with tenant.ErrMissing without one
 type Deliveries struct {
 	domain.Transactioner
 	Q querier
 }
 
-const deliveriesArray = "id, order_id"
+const deliveriesArray = "id, order_id, status"
 
 func scanDelivery(scanner scanner) (entities.Delivery, error) {
 	delivery := entities.Delivery{}
 
-	err := scanner.Scan(&delivery.ID, &delivery.OrderID)
+	var status string
+	err := scanner.Scan(&delivery.ID, &delivery.OrderID, &status)
+	delivery.Status = entities.DeliveryStatus(status)
 
 	return delivery, err
 }
 
 func (e *Deliveries) CreateDelivery(ctx context.Context, orderID int64) (entities.Delivery, error) {
-	query := fmt.Sprintf("INSERT INTO deliveries (order_id) VALUES ($1) RETURNING %s", deliveriesArray)
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return entities.Delivery{}, err
+	}
+
+	query := fmt.Sprintf("INSERT INTO deliveries (tenant_id, order_id) VALUES ($1, $2) RETURNING %s", deliveriesArray)
 
-	delivery, err := scanDelivery(e.Q.QueryRow(ctx, query, orderID))
+	delivery, err := scanDelivery(e.Q.QueryRow(ctx, query, tenantID, orderID))
 
 	if err != nil {
 		return entities.Delivery{}, err
@@ -33,3 +44,40 @@ func (e *Deliveries) CreateDelivery(ctx context.Context, orderID int64) (entitie
 
 	return delivery, nil
 }
+
+func (e *Deliveries) GetDelivery(ctx context.Context, id int64) (entities.Delivery, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return entities.Delivery{}, err
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM deliveries WHERE id = $1 AND tenant_id = $2", deliveriesArray)
+
+	delivery, err := scanDelivery(e.Q.QueryRow(ctx, query, id, tenantID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.Delivery{}, domain.ErrNotFound
+	}
+
+	return delivery, err
+}
+
+func (e *Deliveries) UpdateDeliveryStatus(ctx context.Context, id int64, from, to entities.DeliveryStatus) (entities.Delivery, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return entities.Delivery{}, err
+	}
+
+	query := fmt.Sprintf("UPDATE deliveries SET status = $4 WHERE id = $1 AND tenant_id = $2 AND status = $3 RETURNING %s",
+		deliveriesArray)
+
+	delivery, err := scanDelivery(e.Q.QueryRow(ctx, query, id, tenantID, string(from), string(to)))
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return delivery, err
+	}
+
+	if _, err := e.GetDelivery(ctx, id); err != nil {
+		return entities.Delivery{}, err
+	}
+
+	return entities.Delivery{}, domain.ErrStatusChanged
+}
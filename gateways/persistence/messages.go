@@ -0,0 +1,129 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/jackc/pgx/v4"
+)
+
+var _ saga.Transport = &Messages{}
+
+// Messages implements saga.Transport as a queue over the saga_messages table, shared by the services using the
+// same database. A received message is hidden from other receivers for VisibilityTimeout, and deleted once handled,
+// so the messages of a receiver that died are delivered again.
+type Messages struct {
+	Q querier
+	// PollInterval is how often an empty queue is checked. Defaults to 500ms.
+	PollInterval time.Duration
+	// VisibilityTimeout must be longer than handling a message takes. Defaults to 30s.
+	VisibilityTimeout time.Duration
+	// RedeliveryDelay is how long a message that failed to be handled waits to be delivered again. Defaults to 1s.
+	RedeliveryDelay time.Duration
+}
+
+func (m *Messages) Send(ctx context.Context, message saga.Message) error {
+	query := `INSERT INTO saga_messages
+		(id, destination, type, instance_id, step, reply_to, payload, error, tenant_id, available_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, NULLIF($8, ''), NULLIF($9, ''), now())`
+
+	_, err := m.Q.Exec(ctx, query, message.ID, message.Destination, message.Type, message.InstanceID, message.Step,
+		message.ReplyTo, nullJSON(message.Payload), message.Error, message.Tenant)
+
+	return err
+}
+
+func (m *Messages) Receive(ctx context.Context, destination string, handle func(ctx context.Context, message saga.Message) error) error {
+	for {
+		position, message, err := m.claim(ctx, destination)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			if err := m.sleep(ctx); err != nil {
+				return err
+			}
+			continue
+		case err != nil:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// the database may be down, try again later
+			if err := m.sleep(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// if these fail, the message is delivered again once its visibility timeout expires
+		if err := handle(ctx, message); err != nil {
+			_, _ = m.Q.Exec(ctx, "UPDATE saga_messages SET available_at = now() + $2::interval WHERE position = $1",
+				position, m.redeliveryDelay())
+			continue
+		}
+		_, _ = m.Q.Exec(ctx, "DELETE FROM saga_messages WHERE position = $1", position)
+	}
+}
+
+// claim hides the oldest available message of destination from other receivers for the visibility timeout
+func (m *Messages) claim(ctx context.Context, destination string) (int64, saga.Message, error) {
+	query := `UPDATE saga_messages SET available_at = now() + $2::interval
+		WHERE position = (
+			SELECT position FROM saga_messages
+			WHERE destination = $1 AND available_at <= now()
+			ORDER BY position
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING position, id, destination, type, instance_id, step, COALESCE(reply_to, ''), payload, COALESCE(error, ''),
+			COALESCE(tenant_id, '')`
+
+	var position int64
+	var message saga.Message
+	var payload []byte
+	err := m.Q.QueryRow(ctx, query, destination, m.visibilityTimeout()).Scan(&position, &message.ID, &message.Destination,
+		&message.Type, &message.InstanceID, &message.Step, &message.ReplyTo, &payload, &message.Error, &message.Tenant)
+	message.Payload = payload
+
+	return position, message, err
+}
+
+func (m *Messages) sleep(ctx context.Context) error {
+	interval := m.PollInterval
+	if interval <= 0 {
+		interval = 500 * time.Millisecond
+	}
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (m *Messages) visibilityTimeout() time.Duration {
+	if m.VisibilityTimeout <= 0 {
+		return 30 * time.Second
+	}
+
+	return m.VisibilityTimeout
+}
+
+func (m *Messages) redeliveryDelay() time.Duration {
+	if m.RedeliveryDelay <= 0 {
+		return time.Second
+	}
+
+	return m.RedeliveryDelay
+}
+
+func nullJSON(data []byte) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+
+	return data
+}
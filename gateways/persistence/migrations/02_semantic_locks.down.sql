@@ -0,0 +1,3 @@
+ALTER TABLE orders DROP COLUMN locked_by;
+ALTER TABLE payments DROP COLUMN locked_by;
+ALTER TABLE deliveries DROP COLUMN locked_by;
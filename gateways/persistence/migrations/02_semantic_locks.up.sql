@@ -0,0 +1,3 @@
+ALTER TABLE orders ADD COLUMN locked_by text;
+ALTER TABLE payments ADD COLUMN locked_by text;
+ALTER TABLE deliveries ADD COLUMN locked_by text;
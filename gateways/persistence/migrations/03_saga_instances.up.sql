@@ -0,0 +1,17 @@
+CREATE TABLE saga_instances (
+    id text PRIMARY KEY,
+    saga_name text NOT NULL,
+    saga_version int NOT NULL,
+    status text NOT NULL,
+    step int NOT NULL,
+    payload jsonb,
+    errors text[] NOT NULL DEFAULT '{}',
+    compensation_errors text[] NOT NULL DEFAULT '{}',
+    lease_owner text,
+    lease_expires_at timestamptz,
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz NOT NULL
+);
+
+CREATE INDEX saga_instances_unfinished_idx ON saga_instances (created_at)
+    WHERE status IN ('running', 'compensating');
@@ -0,0 +1,5 @@
+DROP INDEX saga_instances_unfinished_idx;
+CREATE INDEX saga_instances_unfinished_idx ON saga_instances (created_at)
+    WHERE status IN ('running', 'compensating');
+
+ALTER TABLE saga_instances DROP COLUMN wake_at;
@@ -0,0 +1,5 @@
+ALTER TABLE saga_instances ADD COLUMN wake_at timestamptz;
+
+DROP INDEX saga_instances_unfinished_idx;
+CREATE INDEX saga_instances_unfinished_idx ON saga_instances (created_at)
+    WHERE status IN ('running', 'compensating', 'waiting');
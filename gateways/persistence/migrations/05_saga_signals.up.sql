@@ -0,0 +1 @@
+ALTER TABLE saga_instances ADD COLUMN waiting_for text;
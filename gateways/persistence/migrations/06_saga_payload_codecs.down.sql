@@ -0,0 +1,3 @@
+ALTER TABLE saga_instances DROP COLUMN payload_data;
+ALTER TABLE saga_instances DROP COLUMN payload_codec;
+ALTER TABLE saga_instances DROP COLUMN payload_type;
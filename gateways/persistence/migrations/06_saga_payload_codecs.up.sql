@@ -0,0 +1,3 @@
+ALTER TABLE saga_instances ADD COLUMN payload_type text;
+ALTER TABLE saga_instances ADD COLUMN payload_codec text;
+ALTER TABLE saga_instances ADD COLUMN payload_data bytea;
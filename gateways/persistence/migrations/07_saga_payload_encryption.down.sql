@@ -0,0 +1,2 @@
+ALTER TABLE saga_instances DROP COLUMN payload_wrapped_key;
+ALTER TABLE saga_instances DROP COLUMN payload_key_id;
@@ -0,0 +1,2 @@
+ALTER TABLE saga_instances ADD COLUMN payload_key_id text;
+ALTER TABLE saga_instances ADD COLUMN payload_wrapped_key bytea;
@@ -0,0 +1 @@
+DROP TABLE saga_events;
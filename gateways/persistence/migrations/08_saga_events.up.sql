@@ -0,0 +1,21 @@
+CREATE TABLE saga_events (
+    position bigserial PRIMARY KEY,
+    instance_id text NOT NULL,
+    sequence int NOT NULL,
+    type text NOT NULL,
+    saga_name text NOT NULL,
+    saga_version int NOT NULL,
+    step int NOT NULL,
+    step_name text NOT NULL,
+    payload jsonb,
+    payload_type text,
+    payload_codec text,
+    payload_data bytea,
+    payload_key_id text,
+    payload_wrapped_key bytea,
+    error text,
+    wake_at timestamptz,
+    waiting_for text,
+    at timestamptz NOT NULL,
+    UNIQUE (instance_id, sequence)
+);
@@ -0,0 +1,14 @@
+CREATE TABLE saga_messages (
+    position bigserial PRIMARY KEY,
+    id text NOT NULL,
+    destination text NOT NULL,
+    type text NOT NULL,
+    instance_id text NOT NULL,
+    step text NOT NULL,
+    reply_to text,
+    payload jsonb,
+    error text,
+    available_at timestamptz NOT NULL
+);
+
+CREATE INDEX saga_messages_destination_idx ON saga_messages (destination, available_at);
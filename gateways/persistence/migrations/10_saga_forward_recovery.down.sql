@@ -0,0 +1,6 @@
+DROP INDEX saga_instances_unfinished_idx;
+CREATE INDEX saga_instances_unfinished_idx ON saga_instances (created_at)
+    WHERE status IN ('running', 'compensating', 'waiting');
+
+ALTER TABLE saga_events DROP COLUMN failures;
+ALTER TABLE saga_instances DROP COLUMN failures;
@@ -0,0 +1,6 @@
+ALTER TABLE saga_instances ADD COLUMN failures int NOT NULL DEFAULT 0;
+ALTER TABLE saga_events ADD COLUMN failures int NOT NULL DEFAULT 0;
+
+DROP INDEX saga_instances_unfinished_idx;
+CREATE INDEX saga_instances_unfinished_idx ON saga_instances (created_at)
+    WHERE status IN ('running', 'compensating', 'waiting', 'retrying', 'stuck');
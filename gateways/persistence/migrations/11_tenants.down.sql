@@ -0,0 +1,13 @@
+DROP INDEX saga_instances_tenant_idx;
+
+ALTER TABLE saga_messages DROP COLUMN tenant_id;
+ALTER TABLE saga_events DROP COLUMN tenant_id;
+ALTER TABLE saga_instances DROP COLUMN tenant_id;
+
+DROP INDEX deliveries_tenant_idx;
+DROP INDEX payments_tenant_idx;
+DROP INDEX orders_tenant_idx;
+
+ALTER TABLE deliveries DROP COLUMN tenant_id;
+ALTER TABLE payments DROP COLUMN tenant_id;
+ALTER TABLE orders DROP COLUMN tenant_id;
@@ -0,0 +1,17 @@
+-- existing records belong to the tenant served before multi-tenancy
+ALTER TABLE orders ADD COLUMN tenant_id text NOT NULL DEFAULT 'default';
+ALTER TABLE orders ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE payments ADD COLUMN tenant_id text NOT NULL DEFAULT 'default';
+ALTER TABLE payments ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE deliveries ADD COLUMN tenant_id text NOT NULL DEFAULT 'default';
+ALTER TABLE deliveries ALTER COLUMN tenant_id DROP DEFAULT;
+
+CREATE INDEX orders_tenant_idx ON orders (tenant_id, id);
+CREATE INDEX payments_tenant_idx ON payments (tenant_id, id);
+CREATE INDEX deliveries_tenant_idx ON deliveries (tenant_id, id);
+
+ALTER TABLE saga_instances ADD COLUMN tenant_id text;
+ALTER TABLE saga_events ADD COLUMN tenant_id text;
+ALTER TABLE saga_messages ADD COLUMN tenant_id text;
+
+CREATE INDEX saga_instances_tenant_idx ON saga_instances (tenant_id);
@@ -0,0 +1,5 @@
+DROP INDEX orders_idempotency_key_idx;
+
+ALTER TABLE orders DROP COLUMN saga_instance_id;
+ALTER TABLE orders DROP COLUMN request_fingerprint;
+ALTER TABLE orders DROP COLUMN idempotency_key;
@@ -0,0 +1,6 @@
+ALTER TABLE orders ADD COLUMN idempotency_key text;
+ALTER TABLE orders ADD COLUMN request_fingerprint text;
+ALTER TABLE orders ADD COLUMN saga_instance_id text;
+
+CREATE UNIQUE INDEX orders_idempotency_key_idx ON orders (tenant_id, idempotency_key)
+    WHERE idempotency_key IS NOT NULL;
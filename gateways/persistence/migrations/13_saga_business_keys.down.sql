@@ -0,0 +1,3 @@
+DROP INDEX saga_instances_business_key_idx;
+
+ALTER TABLE saga_instances DROP COLUMN business_key;
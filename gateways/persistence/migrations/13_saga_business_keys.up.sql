@@ -0,0 +1,4 @@
+ALTER TABLE saga_instances ADD COLUMN business_key text;
+
+CREATE UNIQUE INDEX saga_instances_business_key_idx ON saga_instances (COALESCE(tenant_id, ''), saga_name, business_key)
+    WHERE business_key IS NOT NULL;
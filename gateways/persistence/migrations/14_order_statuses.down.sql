@@ -0,0 +1,5 @@
+DROP TABLE order_status_transitions;
+
+ALTER TABLE orders DROP COLUMN updated_at;
+ALTER TABLE orders DROP COLUMN created_at;
+ALTER TABLE orders DROP COLUMN status;
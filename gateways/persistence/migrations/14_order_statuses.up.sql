@@ -0,0 +1,20 @@
+ALTER TABLE orders ADD COLUMN status text NOT NULL DEFAULT 'PENDING';
+ALTER TABLE orders ADD COLUMN created_at timestamptz NOT NULL DEFAULT now();
+ALTER TABLE orders ADD COLUMN updated_at timestamptz NOT NULL DEFAULT now();
+
+-- orders created before statuses are approved once their saga released them, unless their saga was compensated
+UPDATE orders SET status = 'APPROVED' WHERE locked_by IS NULL;
+UPDATE orders SET status = 'REJECTED'
+FROM saga_instances
+WHERE saga_instances.id = orders.saga_instance_id AND saga_instances.status = 'compensated';
+
+CREATE TABLE order_status_transitions (
+    id bigserial PRIMARY KEY,
+    order_id bigint NOT NULL REFERENCES orders (id),
+    tenant_id text NOT NULL,
+    from_status text,
+    to_status text NOT NULL,
+    at timestamptz NOT NULL
+);
+
+CREATE INDEX order_status_transitions_order_idx ON order_status_transitions (tenant_id, order_id, at);
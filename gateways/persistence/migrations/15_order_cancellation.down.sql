@@ -0,0 +1,4 @@
+ALTER TABLE orders DROP COLUMN delivery_id;
+ALTER TABLE orders DROP COLUMN payment_id;
+
+ALTER TABLE deliveries DROP COLUMN status;
@@ -0,0 +1,12 @@
+ALTER TABLE deliveries ADD COLUMN status text NOT NULL DEFAULT 'SCHEDULED';
+
+ALTER TABLE orders ADD COLUMN payment_id bigint;
+ALTER TABLE orders ADD COLUMN delivery_id bigint;
+
+UPDATE orders SET payment_id = payments.id
+FROM payments
+WHERE payments.order_id = orders.id AND payments.tenant_id = orders.tenant_id;
+
+UPDATE orders SET delivery_id = deliveries.id
+FROM deliveries
+WHERE deliveries.order_id = orders.id AND deliveries.tenant_id = orders.tenant_id;
@@ -0,0 +1,5 @@
+ALTER TABLE payments DROP COLUMN amount;
+
+DROP TABLE order_line_items;
+
+DROP TABLE products;
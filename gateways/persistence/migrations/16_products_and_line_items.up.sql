@@ -0,0 +1,26 @@
+CREATE TABLE products (
+    id bigserial PRIMARY KEY,
+    tenant_id text NOT NULL,
+    name text NOT NULL,
+    price bigint NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX products_tenant_idx ON products (tenant_id, id);
+
+-- items keep the price they were ordered at, and outlive the products deleted from the catalog
+CREATE TABLE order_line_items (
+    id bigserial PRIMARY KEY,
+    order_id bigint NOT NULL REFERENCES orders (id),
+    tenant_id text NOT NULL,
+    product_id bigint NOT NULL,
+    quantity bigint NOT NULL,
+    unit_price bigint NOT NULL
+);
+
+CREATE INDEX order_line_items_order_idx ON order_line_items (tenant_id, order_id, id);
+
+-- payments created before charge the amount of their order
+ALTER TABLE payments ADD COLUMN amount bigint NOT NULL DEFAULT 0;
+UPDATE payments SET amount = orders.amount FROM orders WHERE orders.id = payments.order_id;
@@ -0,0 +1,5 @@
+CREATE TABLE processed_messages (
+    id text PRIMARY KEY,
+    reply jsonb,
+    processed_at timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,2 @@
+-- orders are priced by dividing by the unit price, which must never be zero
+ALTER TABLE products ADD CONSTRAINT products_price_positive CHECK (price > 0);
@@ -0,0 +1 @@
+-- the amounts reset by the up migration were wrong, they are not restored
@@ -0,0 +1,5 @@
+-- the backfill of migration 16 matched payments to their order by id alone, so a payment of another tenant than
+-- its order got the amount of that order: it is reset to the default it would have kept, like migration 15 matches
+-- payments and orders of the same tenant only
+UPDATE payments SET amount = 0 FROM orders
+WHERE orders.id = payments.order_id AND orders.tenant_id <> payments.tenant_id;
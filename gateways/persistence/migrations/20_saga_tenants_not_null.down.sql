@@ -0,0 +1,5 @@
+-- the backfilled tenants are not reset
+ALTER TABLE saga_events DROP CONSTRAINT saga_events_tenant_id_check;
+ALTER TABLE saga_events ALTER COLUMN tenant_id DROP NOT NULL;
+ALTER TABLE saga_instances DROP CONSTRAINT saga_instances_tenant_id_check;
+ALTER TABLE saga_instances ALTER COLUMN tenant_id DROP NOT NULL;
@@ -0,0 +1,11 @@
+-- saga instances started before multi-tenancy belong to the tenant served then, like the records of migration 11,
+-- and their events to the tenant of their instance
+UPDATE saga_instances SET tenant_id = 'default' WHERE tenant_id IS NULL OR tenant_id = '';
+UPDATE saga_events SET tenant_id = saga_instances.tenant_id FROM saga_instances
+WHERE saga_instances.id = saga_events.instance_id AND (saga_events.tenant_id IS NULL OR saga_events.tenant_id = '');
+UPDATE saga_events SET tenant_id = 'default' WHERE tenant_id IS NULL OR tenant_id = '';
+
+ALTER TABLE saga_instances ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE saga_instances ADD CONSTRAINT saga_instances_tenant_id_check CHECK (tenant_id <> '');
+ALTER TABLE saga_events ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE saga_events ADD CONSTRAINT saga_events_tenant_id_check CHECK (tenant_id <> '');
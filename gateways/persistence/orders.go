@@ -2,34 +2,249 @@ package persistence
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/didopimentel/go-saga-poc/domain"
 	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"time"
 )
 
+// Orders only acts on the orders of the tenant of the context, and fails with tenant.ErrMissing without one
 type Orders struct {
 	domain.Transactioner
 	Q querier
 }
 
-const ordersArray = "id, amount"
+const ordersArray = "id, amount, COALESCE(payment_id, 0), COALESCE(delivery_id, 0), status, COALESCE(locked_by, ''), " +
+	"COALESCE(idempotency_key, ''), COALESCE(request_fingerprint, ''), COALESCE(saga_instance_id, ''), " +
+	"created_at, updated_at"
+
+// ordersIdempotencyKeyIndex is the unique index of the idempotency keys of each tenant
+const ordersIdempotencyKeyIndex = "orders_idempotency_key_idx"
 
 func scanActivityLog(scanner scanner) (entities.Order, error) {
 	order := entities.Order{}
 
-	err := scanner.Scan(&order.ID, &order.Amount)
+	var status string
+	err := scanner.Scan(&order.ID, &order.Amount, &order.PaymentID, &order.DeliveryID, &status, &order.LockedBy,
+		&order.IdempotencyKey, &order.RequestFingerprint, &order.SagaInstanceID, &order.CreatedAt, &order.UpdatedAt)
+	order.Status = entities.OrderStatus(status)
 
 	return order, err
 }
 
-func (e *Orders) CreateOrder(ctx context.Context, amount int64) (entities.Order, error) {
-	query := fmt.Sprintf("INSERT INTO orders (amount) VALUES ($1) RETURNING %s", ordersArray)
+func (e *Orders) CreateOrder(ctx context.Context, order entities.Order) (entities.Order, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return entities.Order{}, err
+	}
+
+	productIDs := make([]int64, 0, len(order.Items))
+	quantities := make([]int64, 0, len(order.Items))
+	unitPrices := make([]int64, 0, len(order.Items))
+	for _, item := range order.Items {
+		productIDs = append(productIDs, item.ProductID)
+		quantities = append(quantities, item.Quantity)
+		unitPrices = append(unitPrices, item.UnitPrice)
+	}
+
+	// the creation is the first transition of the order
+	query := fmt.Sprintf(`WITH created AS (
+			INSERT INTO orders (tenant_id, amount, status, idempotency_key, request_fingerprint, saga_instance_id)
+			VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, '')) RETURNING *
+		), recorded AS (
+			INSERT INTO order_status_transitions (order_id, tenant_id, to_status, at)
+			SELECT id, tenant_id, status, created_at FROM created
+		), items AS (
+			INSERT INTO order_line_items (order_id, tenant_id, product_id, quantity, unit_price)
+			SELECT created.id, created.tenant_id, i.product_id, i.quantity, i.unit_price
+			FROM created, unnest($7::bigint[], $8::bigint[], $9::bigint[])
+			WITH ORDINALITY AS i(product_id, quantity, unit_price, n)
+			ORDER BY i.n
+		)
+		SELECT %s FROM created`, ordersArray)
+
+	created, err := scanActivityLog(e.Q.QueryRow(ctx, query, tenantID, order.Amount, string(order.Status),
+		order.IdempotencyKey, order.RequestFingerprint, order.SagaInstanceID, productIDs, quantities, unitPrices))
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == ordersIdempotencyKeyIndex {
+		return entities.Order{}, domain.ErrIdempotencyKeyConflict
+	}
+	if err != nil {
+		return entities.Order{}, err
+	}
+	created.Items = order.Items
+
+	return created, nil
+}
+
+func (e *Orders) GetOrderByIdempotencyKey(ctx context.Context, key string) (entities.Order, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return entities.Order{}, err
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM orders WHERE tenant_id = $1 AND idempotency_key = $2", ordersArray)
+
+	order, err := scanActivityLog(e.Q.QueryRow(ctx, query, tenantID, key))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.Order{}, domain.ErrNotFound
+	}
+	if err != nil {
+		return entities.Order{}, err
+	}
+
+	return e.withItems(ctx, tenantID, order)
+}
+
+func (e *Orders) GetOrder(ctx context.Context, id int64) (entities.Order, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return entities.Order{}, err
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM orders WHERE id = $1 AND tenant_id = $2", ordersArray)
+
+	order, err := scanActivityLog(e.Q.QueryRow(ctx, query, id, tenantID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.Order{}, domain.ErrNotFound
+	}
+	if err != nil {
+		return entities.Order{}, err
+	}
+
+	return e.withItems(ctx, tenantID, order)
+}
+
+// UpdateOrder records the transition in order_status_transitions along with the new status
+func (e *Orders) UpdateOrder(ctx context.Context, o entities.Order, from entities.OrderStatus) (entities.Order, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return entities.Order{}, err
+	}
+
+	query := fmt.Sprintf(`WITH updated AS (
+			UPDATE orders SET status = $4, updated_at = now(),
+			payment_id = COALESCE(NULLIF($5::bigint, 0), payment_id),
+			delivery_id = COALESCE(NULLIF($6::bigint, 0), delivery_id)
+			WHERE id = $1 AND tenant_id = $2 AND status = $3 RETURNING *
+		), recorded AS (
+			INSERT INTO order_status_transitions (order_id, tenant_id, from_status, to_status, at)
+			SELECT id, tenant_id, $3, status, updated_at FROM updated
+		)
+		SELECT %s FROM updated`, ordersArray)
+
+	order, err := scanActivityLog(e.Q.QueryRow(ctx, query, o.ID, tenantID, string(from), string(o.Status),
+		o.PaymentID, o.DeliveryID))
+	if err == nil {
+		return e.withItems(ctx, tenantID, order)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return entities.Order{}, err
+	}
+
+	if _, err := e.GetOrder(ctx, o.ID); err != nil {
+		return entities.Order{}, err
+	}
 
-	order, err := scanActivityLog(e.Q.QueryRow(ctx, query, amount))
+	return entities.Order{}, domain.ErrStatusChanged
+}
 
+// ListOrders pages through the orders by descending id, which orders_tenant_idx serves
+func (e *Orders) ListOrders(ctx context.Context, filter entities.OrderFilter, afterID int64, limit int) ([]entities.Order, error) {
+	tenantID, err := tenant.Require(ctx)
 	if err != nil {
+		return nil, err
+	}
+
+	var statuses []string
+	for _, status := range filter.Statuses {
+		statuses = append(statuses, string(status))
+	}
+	var createdAfter, createdBefore *time.Time
+	if !filter.CreatedAfter.IsZero() {
+		createdAfter = &filter.CreatedAfter
+	}
+	if !filter.CreatedBefore.IsZero() {
+		createdBefore = &filter.CreatedBefore
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM orders
+		WHERE tenant_id = $1
+		AND ($2::bigint = 0 OR id < $2)
+		AND ($3::text[] IS NULL OR status = ANY($3))
+		AND ($4::bigint IS NULL OR amount >= $4)
+		AND ($5::bigint IS NULL OR amount <= $5)
+		AND ($6::timestamptz IS NULL OR created_at >= $6)
+		AND ($7::timestamptz IS NULL OR created_at < $7)
+		ORDER BY id DESC
+		LIMIT $8`, ordersArray)
+
+	rows, err := e.Q.Query(ctx, query, tenantID, afterID, statuses, filter.MinAmount, filter.MaxAmount,
+		createdAfter, createdBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []entities.Order
+	for rows.Next() {
+		order, err := scanActivityLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orders, e.loadItems(ctx, tenantID, orders)
+}
+
+func (e *Orders) withItems(ctx context.Context, tenantID string, order entities.Order) (entities.Order, error) {
+	orders := []entities.Order{order}
+	if err := e.loadItems(ctx, tenantID, orders); err != nil {
 		return entities.Order{}, err
 	}
 
-	return order, nil
+	return orders[0], nil
+}
+
+// loadItems sets the line items of the orders in a single query
+func (e *Orders) loadItems(ctx context.Context, tenantID string, orders []entities.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(orders))
+	positions := make(map[int64]int, len(orders))
+	for i, order := range orders {
+		ids = append(ids, order.ID)
+		positions[order.ID] = i
+	}
+
+	query := `SELECT order_id, product_id, quantity, unit_price FROM order_line_items
+		WHERE tenant_id = $1 AND order_id = ANY($2) ORDER BY order_id, id`
+
+	rows, err := e.Q.Query(ctx, query, tenantID, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderID int64
+		item := entities.LineItem{}
+		if err := rows.Scan(&orderID, &item.ProductID, &item.Quantity, &item.UnitPrice); err != nil {
+			return err
+		}
+		i := positions[orderID]
+		orders[i].Items = append(orders[i].Items, item)
+	}
+
+	return rows.Err()
 }
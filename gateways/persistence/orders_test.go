@@ -0,0 +1,265 @@
+package persistence_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/domain/delivery"
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/domain/order"
+	"github.com/didopimentel/go-saga-poc/domain/payment"
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/gateways/deliveries"
+	"github.com/didopimentel/go-saga-poc/gateways/payments"
+	"github.com/didopimentel/go-saga-poc/gateways/persistence"
+	"github.com/stretchr/testify/require"
+)
+
+// orderReplica is a replica of the orders service creating orders with the real gateways
+type orderReplica struct {
+	createOrder *order.CreateOrderUseCase
+	executor    *saga.Executor
+}
+
+func newOrderReplica(t *testing.T, txManager *persistence.TxManager, transport saga.Transport) orderReplica {
+	registry := saga.NewRegistry()
+	keys, err := saga.NewLocalKeyProvider("test", map[string][]byte{"test": make([]byte, 32)})
+	require.NoError(t, err)
+	registry.SetKeyProvider(keys)
+	executor := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: &persistence.Sagas{Q: txManager}})
+
+	createOrder := order.NewCreateOrderUseCase(
+		&persistence.Orders{Transactioner: txManager, Q: txManager},
+		&persistence.Products{Q: txManager},
+		&persistence.SemanticLocks{Q: txManager, Table: "orders", Resource: "order"},
+		txManager,
+		payments.NewMemoryGateway(),
+		deliveries.NewMemoryGateway(),
+		saga.NewCommands(transport, order.RepliesDestination),
+		executor,
+		saga.NewLimiter(saga.LimiterConfig{}),
+	)
+	require.NoError(t, createOrder.RegisterSagas(registry))
+
+	return orderReplica{createOrder: createOrder, executor: executor}
+}
+
+// serveServices stands for the payments and delivery services, and has replica consume their replies.
+// Payments are declined when paymentErr is set.
+func serveServices(t *testing.T, transport saga.Transport, replica orderReplica, paymentErr error) *payments.MemoryGateway {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	paymentsGateway := payments.NewMemoryGateway()
+	deliveriesGateway := deliveries.NewMemoryGateway()
+
+	go func() {
+		_ = saga.ServeCommands(ctx, transport, payment.CommandsDestination, func(ctx context.Context, m saga.Message) (interface{}, error) {
+			if paymentErr != nil {
+				return nil, saga.Reject(paymentErr)
+			}
+			var input payment.CreatePaymentInput
+			if err := json.Unmarshal(m.Payload, &input); err != nil {
+				return nil, saga.Reject(err)
+			}
+			return paymentsGateway.CreatePayment(ctx, input.OrderID, input.Amount)
+		})
+	}()
+	go func() {
+		_ = saga.ServeCommands(ctx, transport, delivery.CommandsDestination, func(ctx context.Context, m saga.Message) (interface{}, error) {
+			var input delivery.CreateDeliveryInput
+			if err := json.Unmarshal(m.Payload, &input); err != nil {
+				return nil, saga.Reject(err)
+			}
+			return deliveriesGateway.CreateDelivery(ctx, input.OrderID)
+		})
+	}()
+	go func() { _ = transport.Receive(ctx, order.RepliesDestination, replica.executor.HandleReply) }()
+
+	return paymentsGateway
+}
+
+func waitForSaga(t *testing.T, ctx context.Context, executor *saga.Executor, id string, status saga.Status) {
+	require.Eventually(t, func() bool {
+		instance, err := executor.Get(ctx, id)
+		return err == nil && instance.Status == status
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func newBooks(t *testing.T, ctx context.Context, txManager *persistence.TxManager) []entities.LineItem {
+	book, err := (&persistence.Products{Q: txManager}).CreateProduct(ctx, entities.Product{Name: "book", Price: 50})
+	require.NoError(t, err)
+
+	return []entities.LineItem{{ProductID: book.ID, Quantity: 2}}
+}
+
+func TestCreateOrder_IdempotencyKey_ReplaysCompletedOrdersOnAnyReplica(t *testing.T) {
+	txManager := newTxManager(t)
+	ctx := tenantCtx(t)
+	transport := saga.NewMemoryTransport(10 * time.Millisecond)
+	first, other := newOrderReplica(t, txManager, transport), newOrderReplica(t, txManager, transport)
+	input := order.CreateOrderInput{Items: newBooks(t, ctx, txManager), IdempotencyKey: "key-1"}
+
+	created, err := first.createOrder.CreateOrder(ctx, input)
+	require.NoError(t, err)
+	require.True(t, created.InProgress)
+
+	// the payment was not handled yet, so the order is still in progress
+	retry, err := other.createOrder.CreateOrder(ctx, input)
+	require.NoError(t, err)
+	require.True(t, retry.InProgress)
+	require.Equal(t, created.Order.ID, retry.Order.ID)
+
+	paymentsGateway := serveServices(t, transport, first, nil)
+	waitForSaga(t, ctx, first.executor, created.Order.SagaInstanceID, saga.StatusCompleted)
+
+	retry, err = other.createOrder.CreateOrder(ctx, input)
+	require.NoError(t, err)
+	require.False(t, retry.InProgress)
+	require.Equal(t, created.Order.ID, retry.Order.ID)
+	require.Equal(t, entities.OrderStatusApproved, retry.Order.Status)
+	require.Len(t, paymentsGateway.Payments(), 1)
+}
+
+func TestCreateOrder_IdempotencyKey_ReplaysFailuresOnAnyReplica(t *testing.T) {
+	txManager := newTxManager(t)
+	ctx := tenantCtx(t)
+	transport := saga.NewMemoryTransport(10 * time.Millisecond)
+	first, other := newOrderReplica(t, txManager, transport), newOrderReplica(t, txManager, transport)
+	input := order.CreateOrderInput{Items: newBooks(t, ctx, txManager), IdempotencyKey: "key-1"}
+	serveServices(t, transport, first, errors.New("card declined"))
+
+	created, err := first.createOrder.CreateOrder(ctx, input)
+	require.NoError(t, err)
+	waitForSaga(t, ctx, first.executor, created.Order.SagaInstanceID, saga.StatusCompensated)
+
+	// the order was committed by its own step, so the compensation leaves it rejected rather than rolled back
+	orders := &persistence.Orders{Transactioner: txManager, Q: txManager}
+	rejected, err := orders.GetOrderByIdempotencyKey(ctx, "key-1")
+	require.NoError(t, err)
+	require.Equal(t, created.Order.ID, rejected.ID)
+	require.Equal(t, entities.OrderStatusRejected, rejected.Status)
+
+	_, err = other.createOrder.CreateOrder(ctx, input)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "card declined")
+
+	// the retry created no other order
+	again, err := orders.GetOrderByIdempotencyKey(ctx, "key-1")
+	require.NoError(t, err)
+	require.Equal(t, created.Order.ID, again.ID)
+}
+
+func TestSemanticLocks_LockOwner_UnknownRecordsAreNotFound(t *testing.T) {
+	txManager := newTxManager(t)
+	locks := &persistence.SemanticLocks{Q: txManager, Table: "orders", Resource: "order"}
+
+	_, err := locks.LockOwner(tenantCtx(t), math.MaxInt32)
+	require.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func TestOrders_ListOrders_Filters(t *testing.T) {
+	txManager := newTxManager(t)
+	orders := &persistence.Orders{Transactioner: txManager, Q: txManager}
+	ctx := tenantCtx(t)
+
+	var created []entities.Order
+	for _, o := range []entities.Order{
+		{Amount: 50, Status: entities.OrderStatusApproved},
+		{Amount: 100, Status: entities.OrderStatusRejected},
+		{Amount: 150, Status: entities.OrderStatusCancelled},
+		{Amount: 200, Status: entities.OrderStatusApproved},
+		{Amount: 250, Status: entities.OrderStatusPending},
+	} {
+		o, err := orders.CreateOrder(ctx, o)
+		require.NoError(t, err)
+		created = append(created, o)
+		// creation times are set by the database, keep them apart
+		time.Sleep(5 * time.Millisecond)
+	}
+	// an order of another tenant matching every filter
+	_, err := orders.CreateOrder(tenantCtx(t), entities.Order{Amount: 100, Status: entities.OrderStatusApproved})
+	require.NoError(t, err)
+
+	ids := func(indexes ...int) []int64 {
+		var ids []int64
+		for _, i := range indexes {
+			ids = append(ids, created[i].ID)
+		}
+		return ids
+	}
+	amount := func(a int64) *int64 { return &a }
+
+	for name, test := range map[string]struct {
+		filter  entities.OrderFilter
+		afterID int64
+		limit   int
+		ids     []int64
+	}{
+		"no filter": {
+			ids: ids(4, 3, 2, 1, 0),
+		},
+		"page": {
+			afterID: created[3].ID,
+			limit:   2,
+			ids:     ids(2, 1),
+		},
+		"one status": {
+			filter: entities.OrderFilter{Statuses: []entities.OrderStatus{entities.OrderStatusRejected}},
+			ids:    ids(1),
+		},
+		"several statuses": {
+			filter: entities.OrderFilter{Statuses: []entities.OrderStatus{entities.OrderStatusApproved, entities.OrderStatusCancelled}},
+			ids:    ids(3, 2, 0),
+		},
+		"min amount, inclusive": {
+			filter: entities.OrderFilter{MinAmount: amount(200)},
+			ids:    ids(4, 3),
+		},
+		"max amount, inclusive": {
+			filter: entities.OrderFilter{MaxAmount: amount(100)},
+			ids:    ids(1, 0),
+		},
+		"amount range": {
+			filter: entities.OrderFilter{MinAmount: amount(100), MaxAmount: amount(200)},
+			ids:    ids(3, 2, 1),
+		},
+		"created after, inclusive": {
+			filter: entities.OrderFilter{CreatedAfter: created[3].CreatedAt},
+			ids:    ids(4, 3),
+		},
+		"created before, exclusive": {
+			filter: entities.OrderFilter{CreatedBefore: created[1].CreatedAt},
+			ids:    ids(0),
+		},
+		"every filter": {
+			filter: entities.OrderFilter{
+				Statuses:      []entities.OrderStatus{entities.OrderStatusApproved, entities.OrderStatusRejected},
+				MinAmount:     amount(100),
+				MaxAmount:     amount(200),
+				CreatedAfter:  created[1].CreatedAt,
+				CreatedBefore: created[3].CreatedAt,
+			},
+			ids: ids(1),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			limit := test.limit
+			if limit == 0 {
+				limit = 10
+			}
+			listed, err := orders.ListOrders(ctx, test.filter, test.afterID, limit)
+			require.NoError(t, err)
+
+			var listedIDs []int64
+			for _, o := range listed {
+				listedIDs = append(listedIDs, o.ID)
+			}
+			require.Equal(t, test.ids, listedIDs)
+		})
+	}
+}
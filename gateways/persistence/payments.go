@@ -5,27 +5,34 @@ import (
 	"fmt"
 	"github.com/didopimentel/go-saga-poc/domain"
 	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
 )
 
+// Payments only acts on the payments of the tenant of the context, and fails with tenant.ErrMissing without one
 type Payments struct {
 	domain.Transactioner
 	Q querier
 }
 
-const paymentsArray = "id, order_id"
+const paymentsArray = "id, order_id, amount"
 
 func scanPayment(scanner scanner) (entities.Payment, error) {
 	order := entities.Payment{}
 
-	err := scanner.Scan(&order.ID, &order.OrderID)
+	err := scanner.Scan(&order.ID, &order.OrderID, &order.Amount)
 
 	return order, err
 }
 
-func (e *Payments) CreatePayment(ctx context.Context, orderID int64) (entities.Payment, error) {
-	query := fmt.Sprintf("INSERT INTO payments (order_id) VALUES ($1) RETURNING %s", paymentsArray)
+func (e *Payments) CreatePayment(ctx context.Context, orderID, amount int64) (entities.Payment, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return entities.Payment{}, err
+	}
+
+	query := fmt.Sprintf("INSERT INTO payments (tenant_id, order_id, amount) VALUES ($1, $2, $3) RETURNING %s", paymentsArray)
 
-	payment, err := scanPayment(e.Q.QueryRow(ctx, query, orderID))
+	payment, err := scanPayment(e.Q.QueryRow(ctx, query, tenantID, orderID, amount))
 
 	if err != nil {
 		return entities.Payment{}, err
@@ -35,9 +42,14 @@ func (e *Payments) CreatePayment(ctx context.Context, orderID int64) (entities.P
 }
 
 func (e *Payments) DeletePayment(ctx context.Context, paymentID int64) error {
-	query := "DELETE FROM payments WHERE id = $1"
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := "DELETE FROM payments WHERE id = $1 AND tenant_id = $2"
 
-	_, err := e.Q.Exec(ctx, query, paymentID)
+	_, err = e.Q.Exec(ctx, query, paymentID, tenantID)
 
 	return err
 }
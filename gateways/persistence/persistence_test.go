@@ -0,0 +1,33 @@
+package persistence_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+	"github.com/didopimentel/go-saga-poc/gateways/persistence"
+	"github.com/stretchr/testify/require"
+)
+
+// newTxManager connects to the database at PG_ADDR, which must have been migrated, e.g. with make migrations/up.
+// Tests using it are skipped when PG_ADDR is not set.
+func newTxManager(t *testing.T) *persistence.TxManager {
+	addr := os.Getenv("PG_ADDR")
+	if addr == "" {
+		t.Skip("PG_ADDR is not set")
+	}
+
+	txManager, err := persistence.NewTxManager(context.Background(), addr, 1, 4)
+	require.NoError(t, err)
+	t.Cleanup(txManager.ConnPool.Close)
+
+	return txManager
+}
+
+// tenantCtx returns a context of a tenant of its own, so tests do not see the rows of previous runs
+func tenantCtx(t *testing.T) context.Context {
+	return tenant.WithID(context.Background(), fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano()))
+}
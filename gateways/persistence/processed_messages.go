@@ -0,0 +1,53 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/didopimentel/go-saga-poc/domain"
+)
+
+// ProcessedMessages records the messages handled by a service with the reply to them, so a message delivered again,
+// e.g. after its visibility timeout expired or its deletion failed, is answered with the recorded reply rather than
+// handled twice
+type ProcessedMessages struct {
+	domain.Transactioner
+	Q querier
+}
+
+// Process runs handle in the same transaction that records id, or returns the reply recorded for it.
+// When handle fails nothing is recorded, so the message is handled again on redelivery.
+func (p *ProcessedMessages) Process(ctx context.Context, id string, handle func(ctx context.Context) (interface{}, error)) (json.RawMessage, error) {
+	var reply json.RawMessage
+	err := p.WithTx(ctx, func(ctx context.Context) error {
+		tag, err := p.Q.Exec(ctx, "INSERT INTO processed_messages (id) VALUES ($1) ON CONFLICT (id) DO NOTHING", id)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			var recorded []byte
+			if err := p.Q.QueryRow(ctx, "SELECT reply FROM processed_messages WHERE id = $1", id).Scan(&recorded); err != nil {
+				return err
+			}
+			reply = recorded
+			return nil
+		}
+
+		output, err := handle(ctx)
+		if err != nil {
+			return err
+		}
+		if reply, err = json.Marshal(output); err != nil {
+			return fmt.Errorf("encoding reply to message %s: %w", id, err)
+		}
+		_, err = p.Q.Exec(ctx, "UPDATE processed_messages SET reply = $2 WHERE id = $1", id, []byte(reply))
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reply, nil
+}
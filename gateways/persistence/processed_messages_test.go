@@ -0,0 +1,52 @@
+package persistence_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/gateways/persistence"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessedMessages_Process_HandlesEachMessageOnce(t *testing.T) {
+	txManager := newTxManager(t)
+	processed := &persistence.ProcessedMessages{Transactioner: txManager, Q: txManager}
+	ctx := context.Background()
+	id := fmt.Sprintf("%s-%d/create-payment", t.Name(), time.Now().UnixNano())
+
+	handled := 0
+	handle := func(ctx context.Context) (interface{}, error) {
+		handled++
+		return map[string]int{"ID": handled}, nil
+	}
+
+	reply, err := processed.Process(ctx, id, handle)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"ID":1}`, string(reply))
+
+	reply, err = processed.Process(ctx, id, handle)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"ID":1}`, string(reply))
+	require.Equal(t, 1, handled)
+}
+
+func TestProcessedMessages_Process_FailuresAreNotRecorded(t *testing.T) {
+	txManager := newTxManager(t)
+	processed := &persistence.ProcessedMessages{Transactioner: txManager, Q: txManager}
+	ctx := context.Background()
+	id := fmt.Sprintf("%s-%d/create-payment", t.Name(), time.Now().UnixNano())
+
+	_, err := processed.Process(ctx, id, func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("database is down")
+	})
+	require.Error(t, err)
+
+	reply, err := processed.Process(ctx, id, func(ctx context.Context) (interface{}, error) {
+		return map[string]int{"ID": 2}, nil
+	})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"ID":2}`, string(reply))
+}
@@ -0,0 +1,134 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/domain/entities"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+	"github.com/jackc/pgx/v4"
+)
+
+// Products only acts on the catalog of the tenant of the context, and fails with tenant.ErrMissing without one
+type Products struct {
+	Q querier
+}
+
+const productsArray = "id, name, price, created_at, updated_at"
+
+func scanProduct(scanner scanner) (entities.Product, error) {
+	product := entities.Product{}
+
+	err := scanner.Scan(&product.ID, &product.Name, &product.Price, &product.CreatedAt, &product.UpdatedAt)
+
+	return product, err
+}
+
+func scanProducts(rows pgx.Rows) ([]entities.Product, error) {
+	defer rows.Close()
+
+	var products []entities.Product
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+
+	return products, rows.Err()
+}
+
+func (e *Products) CreateProduct(ctx context.Context, product entities.Product) (entities.Product, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return entities.Product{}, err
+	}
+
+	query := fmt.Sprintf("INSERT INTO products (tenant_id, name, price) VALUES ($1, $2, $3) RETURNING %s", productsArray)
+
+	return scanProduct(e.Q.QueryRow(ctx, query, tenantID, product.Name, product.Price))
+}
+
+func (e *Products) GetProduct(ctx context.Context, id int64) (entities.Product, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return entities.Product{}, err
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM products WHERE id = $1 AND tenant_id = $2", productsArray)
+
+	product, err := scanProduct(e.Q.QueryRow(ctx, query, id, tenantID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.Product{}, domain.ErrNotFound
+	}
+
+	return product, err
+}
+
+func (e *Products) GetProducts(ctx context.Context, ids []int64) ([]entities.Product, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM products WHERE id = ANY($1) AND tenant_id = $2", productsArray)
+
+	rows, err := e.Q.Query(ctx, query, ids, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanProducts(rows)
+}
+
+func (e *Products) ListProducts(ctx context.Context, afterID int64, limit int) ([]entities.Product, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM products WHERE tenant_id = $1 AND id > $2 ORDER BY id LIMIT $3", productsArray)
+
+	rows, err := e.Q.Query(ctx, query, tenantID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanProducts(rows)
+}
+
+func (e *Products) UpdateProduct(ctx context.Context, product entities.Product) (entities.Product, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return entities.Product{}, err
+	}
+
+	query := fmt.Sprintf(`UPDATE products SET name = $3, price = $4, updated_at = now()
+		WHERE id = $1 AND tenant_id = $2 RETURNING %s`, productsArray)
+
+	updated, err := scanProduct(e.Q.QueryRow(ctx, query, product.ID, tenantID, product.Name, product.Price))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.Product{}, domain.ErrNotFound
+	}
+
+	return updated, err
+}
+
+func (e *Products) DeleteProduct(ctx context.Context, id int64) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	tag, err := e.Q.Exec(ctx, "DELETE FROM products WHERE id = $1 AND tenant_id = $2", id, tenantID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+var _ saga.EventStore = &Sagas{}
+
+const sagaEventsArray = "position, instance_id, sequence, type, saga_name, saga_version, tenant_id, " +
+	"step, step_name, payload, " +
+	"COALESCE(payload_type, ''), COALESCE(payload_codec, ''), payload_data, " +
+	"COALESCE(payload_key_id, ''), payload_wrapped_key, COALESCE(error, ''), failures, wake_at, COALESCE(waiting_for, ''), at"
+
+const uniqueViolation = "23505"
+
+func scanSagaEvent(scanner scanner) (saga.Event, error) {
+	event := saga.Event{}
+
+	var eventType string
+	var payload []byte
+	var encoded saga.EncodedPayload
+	var wakeAt *time.Time
+	err := scanner.Scan(&event.Position, &event.InstanceID, &event.Sequence, &eventType, &event.SagaName, &event.SagaVersion,
+		&event.Tenant, &event.Step, &event.StepName, &payload, &encoded.Type, &encoded.Codec, &encoded.Data, &encoded.KeyID, &encoded.WrappedKey,
+		&event.Error, &event.Failures, &wakeAt, &event.WaitingFor, &event.At)
+	if err != nil {
+		return saga.Event{}, err
+	}
+	event.Type = saga.EventType(eventType)
+	switch {
+	case encoded.Type != "":
+		event.Payload = encoded
+	case payload != nil:
+		event.Payload = json.RawMessage(payload)
+	}
+	if wakeAt != nil {
+		event.WakeAt = *wakeAt
+	}
+
+	return event, nil
+}
+
+func scanSagaEvents(rows pgx.Rows) ([]saga.Event, error) {
+	defer rows.Close()
+
+	var events []saga.Event
+	for rows.Next() {
+		event, err := scanSagaEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// AppendEvents inserts the events in a single statement, so either all of them are appended or none is
+func (s *Sagas) AppendEvents(ctx context.Context, events []saga.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	const columns = 19
+	values := make([]string, 0, len(events))
+	args := make([]interface{}, 0, len(events)*columns)
+	for i, event := range events {
+		payload, encoded, err := marshalSagaPayload(event.InstanceID, event.Payload)
+		if err != nil {
+			return err
+		}
+
+		n := i * columns
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, NULLIF($%d, ''), NULLIF($%d, ''), $%d, "+
+			"NULLIF($%d, ''), $%d, NULLIF($%d, ''), $%d, $%d, NULLIF($%d, ''), $%d, NULLIF($%d, ''))",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11, n+12, n+13, n+14, n+15, n+16, n+17, n+18, n+19))
+		args = append(args, event.InstanceID, event.Sequence, string(event.Type), event.SagaName, event.SagaVersion, event.Step,
+			event.StepName, payload, encoded.Type, encoded.Codec, encoded.Data, encoded.KeyID, encoded.WrappedKey,
+			event.Error, event.Failures, nullTime(event.WakeAt), event.WaitingFor, event.At, event.Tenant)
+	}
+
+	query := `INSERT INTO saga_events
+		(instance_id, sequence, type, saga_name, saga_version, step, step_name, payload, payload_type, payload_codec, payload_data,
+		payload_key_id, payload_wrapped_key, error, failures, wake_at, waiting_for, at, tenant_id)
+		VALUES ` + strings.Join(values, ", ")
+
+	_, err := s.Q.Exec(ctx, query, args...)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return saga.ErrEventConflict
+	}
+
+	return err
+}
+
+func (s *Sagas) ListEvents(ctx context.Context, instanceID string) ([]saga.Event, error) {
+	query := fmt.Sprintf("SELECT %s FROM saga_events WHERE instance_id = $1 AND %s ORDER BY sequence",
+		sagaEventsArray, visibleToTenant(2))
+
+	rows, err := s.Q.Query(ctx, query, instanceID, tenantScope(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSagaEvents(rows)
+}
+
+// ReadEvents reads the events of every tenant, for projections.
+// It does not see the events of appends still in flight, although their positions may be lower than the ones of
+// committed events, nor the positions of failed appends, which are never used. saga.Projector waits for such gaps.
+func (s *Sagas) ReadEvents(ctx context.Context, after int64, limit int) ([]saga.Event, error) {
+	query := fmt.Sprintf("SELECT %s FROM saga_events WHERE position > $1 ORDER BY position LIMIT $2", sagaEventsArray)
+
+	rows, err := s.Q.Query(ctx, query, after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSagaEvents(rows)
+}
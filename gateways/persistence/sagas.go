@@ -0,0 +1,326 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	_ saga.LeaseStore = &Sagas{}
+	_ saga.KeyStore   = &Sagas{}
+)
+
+// sagaInstancesBusinessKeyIndex is the unique index of the business keys of each tenant and saga
+const sagaInstancesBusinessKeyIndex = "saga_instances_business_key_idx"
+
+// Sagas implements saga.LeaseStore and saga.KeyStore over the saga_instances table, so several replicas can share
+// saga instances, and saga.EventStore over the saga_events table.
+// Payloads encoded by the saga.Registry are stored with their type and codec, and decoded back by the Executor.
+// Payloads of unregistered types are stored as JSON and read back as json.RawMessage.
+// Reads made on behalf of a tenant only return its own instances and events, see tenant.WithID.
+type Sagas struct {
+	Q querier
+}
+
+const sagaInstancesArray = "id, saga_name, saga_version, tenant_id, COALESCE(business_key, ''), status, step, payload, " +
+	"COALESCE(payload_type, ''), COALESCE(payload_codec, ''), payload_data, " +
+	"COALESCE(payload_key_id, ''), payload_wrapped_key, errors, compensation_errors, " +
+	"wake_at, COALESCE(waiting_for, ''), failures, COALESCE(lease_owner, ''), lease_expires_at, created_at, updated_at"
+
+const unfinishedSagaInstances = "status IN ('running', 'compensating', 'waiting', 'retrying', 'stuck')"
+
+// dueSagaInstances are the unfinished instances that are not waiting for a later time
+const dueSagaInstances = "(status NOT IN ('waiting', 'retrying', 'stuck') OR wake_at <= $3)"
+
+func scanSagaInstance(scanner scanner) (saga.Instance, error) {
+	instance := saga.Instance{}
+
+	var status string
+	var payload []byte
+	var encoded saga.EncodedPayload
+	var wakeAt, leaseExpiresAt *time.Time
+	err := scanner.Scan(&instance.ID, &instance.SagaName, &instance.SagaVersion, &instance.Tenant, &instance.BusinessKey, &status, &instance.Step,
+		&payload, &encoded.Type, &encoded.Codec, &encoded.Data, &encoded.KeyID, &encoded.WrappedKey, &instance.Errors, &instance.CompensationErrors, &wakeAt, &instance.WaitingFor, &instance.Failures, &instance.Lease.Owner, &leaseExpiresAt,
+		&instance.CreatedAt, &instance.UpdatedAt)
+	if err != nil {
+		return saga.Instance{}, err
+	}
+	instance.Status = saga.Status(status)
+	switch {
+	case encoded.Type != "":
+		instance.Payload = encoded
+	case payload != nil:
+		instance.Payload = json.RawMessage(payload)
+	}
+	if wakeAt != nil {
+		instance.WakeAt = *wakeAt
+	}
+	if leaseExpiresAt != nil {
+		instance.Lease.ExpiresAt = *leaseExpiresAt
+	}
+
+	return instance, nil
+}
+
+func scanSagaInstances(rows pgx.Rows) ([]saga.Instance, error) {
+	defer rows.Close()
+
+	var instances []saga.Instance
+	for rows.Next() {
+		instance, err := scanSagaInstance(rows)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, instance)
+	}
+
+	return instances, rows.Err()
+}
+
+func (s *Sagas) CreateInstance(ctx context.Context, instance saga.Instance) error {
+	payload, encoded, err := marshalSagaPayload(instance.ID, instance.Payload)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO saga_instances
+		(id, saga_name, saga_version, status, step, payload, payload_type, payload_codec, payload_data,
+		payload_key_id, payload_wrapped_key,
+		errors, compensation_errors, wake_at, waiting_for, failures, lease_owner, lease_expires_at, created_at, updated_at,
+		tenant_id, business_key)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9, NULLIF($10, ''), $11,
+		$12, $13, $14, NULLIF($15, ''), $16, NULLIF($17, ''), $18, $19, $20, NULLIF($21, ''), NULLIF($22, ''))`
+
+	_, err = s.Q.Exec(ctx, query, instance.ID, instance.SagaName, instance.SagaVersion, string(instance.Status), instance.Step,
+		payload, encoded.Type, encoded.Codec, encoded.Data, encoded.KeyID, encoded.WrappedKey,
+		nonNil(instance.Errors), nonNil(instance.CompensationErrors), nullTime(instance.WakeAt), instance.WaitingFor,
+		instance.Failures, instance.Lease.Owner, leaseExpiresAt(instance.Lease), instance.CreatedAt, instance.UpdatedAt,
+		instance.Tenant, instance.BusinessKey)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == sagaInstancesBusinessKeyIndex {
+		return saga.ErrDuplicateBusinessKey
+	}
+
+	return err
+}
+
+// UpdateInstance saves the progress of an instance, as long as instance.Lease.Owner still holds its lease
+func (s *Sagas) UpdateInstance(ctx context.Context, instance saga.Instance) error {
+	payload, encoded, err := marshalSagaPayload(instance.ID, instance.Payload)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE saga_instances
+		SET status = $2, step = $3, payload = $4, payload_type = NULLIF($5, ''), payload_codec = NULLIF($6, ''),
+		payload_data = $7, payload_key_id = NULLIF($8, ''), payload_wrapped_key = $9,
+		errors = $10, compensation_errors = $11, wake_at = $12, waiting_for = NULLIF($13, ''), failures = $14,
+		updated_at = $15
+		WHERE id = $1 AND lease_owner IS NOT DISTINCT FROM NULLIF($16, '')`
+
+	tag, err := s.Q.Exec(ctx, query, instance.ID, string(instance.Status), instance.Step, payload,
+		encoded.Type, encoded.Codec, encoded.Data, encoded.KeyID, encoded.WrappedKey,
+		nonNil(instance.Errors), nonNil(instance.CompensationErrors), nullTime(instance.WakeAt), instance.WaitingFor,
+		instance.Failures, instance.UpdatedAt, instance.Lease.Owner)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 1 {
+		return nil
+	}
+
+	if _, err := s.GetInstance(ctx, instance.ID); err != nil {
+		return err
+	}
+
+	return saga.ErrLeaseLost
+}
+
+func (s *Sagas) GetInstance(ctx context.Context, id string) (saga.Instance, error) {
+	query := fmt.Sprintf("SELECT %s FROM saga_instances WHERE id = $1 AND %s", sagaInstancesArray, visibleToTenant(2))
+
+	instance, err := scanSagaInstance(s.Q.QueryRow(ctx, query, id, tenantScope(ctx)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return saga.Instance{}, saga.ErrInstanceNotFound
+	}
+
+	return instance, err
+}
+
+func (s *Sagas) GetInstanceByKey(ctx context.Context, tenantID, sagaName, key string) (saga.Instance, error) {
+	query := fmt.Sprintf(`SELECT %s FROM saga_instances
+		WHERE COALESCE(tenant_id, '') = $1 AND saga_name = $2 AND business_key = $3`, sagaInstancesArray)
+
+	instance, err := scanSagaInstance(s.Q.QueryRow(ctx, query, tenantID, sagaName, key))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return saga.Instance{}, saga.ErrInstanceNotFound
+	}
+
+	return instance, err
+}
+
+func (s *Sagas) ListUnfinishedInstances(ctx context.Context) ([]saga.Instance, error) {
+	query := fmt.Sprintf("SELECT %s FROM saga_instances WHERE %s AND %s ORDER BY created_at",
+		sagaInstancesArray, unfinishedSagaInstances, visibleToTenant(1))
+
+	rows, err := s.Q.Query(ctx, query, tenantScope(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSagaInstances(rows)
+}
+
+// ClaimInstances skips the rows being claimed by other replicas, so concurrent claims never return the same instance
+func (s *Sagas) ClaimInstances(ctx context.Context, lease saga.Lease, now time.Time, limit int) ([]saga.Instance, error) {
+	query := fmt.Sprintf(`UPDATE saga_instances SET lease_owner = $1, lease_expires_at = $2
+		WHERE id IN (
+			SELECT id FROM saga_instances
+			WHERE %s AND %s AND (lease_owner IS NULL OR lease_expires_at < $3)
+			ORDER BY created_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING %s`, unfinishedSagaInstances, dueSagaInstances, sagaInstancesArray)
+
+	rows, err := s.Q.Query(ctx, query, lease.Owner, lease.ExpiresAt, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := scanSagaInstances(rows)
+	if err != nil {
+		return nil, err
+	}
+	sortSagaInstances(instances)
+
+	return instances, nil
+}
+
+func (s *Sagas) ClaimInstance(ctx context.Context, id string, lease saga.Lease, now time.Time) (saga.Instance, error) {
+	query := fmt.Sprintf(`UPDATE saga_instances SET lease_owner = $2, lease_expires_at = $3
+		WHERE id = $1 AND (lease_owner IS NULL OR lease_owner = $2 OR lease_expires_at < $4)
+		RETURNING %s`, sagaInstancesArray)
+
+	instance, err := scanSagaInstance(s.Q.QueryRow(ctx, query, id, lease.Owner, lease.ExpiresAt, now))
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return instance, err
+	}
+
+	if _, err := s.GetInstance(ctx, id); err != nil {
+		return saga.Instance{}, err
+	}
+
+	return saga.Instance{}, saga.ErrLeaseLost
+}
+
+func (s *Sagas) RenewLease(ctx context.Context, id string, lease saga.Lease) error {
+	query := "UPDATE saga_instances SET lease_expires_at = $3 WHERE id = $1 AND lease_owner = $2"
+
+	tag, err := s.Q.Exec(ctx, query, id, lease.Owner, lease.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 1 {
+		return nil
+	}
+
+	if _, err := s.GetInstance(ctx, id); err != nil {
+		return err
+	}
+
+	return saga.ErrLeaseLost
+}
+
+func (s *Sagas) ReleaseLease(ctx context.Context, id string, owner string) error {
+	query := "UPDATE saga_instances SET lease_owner = NULL, lease_expires_at = NULL WHERE id = $1 AND lease_owner = $2"
+
+	tag, err := s.Q.Exec(ctx, query, id, owner)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 1 {
+		return nil
+	}
+
+	if _, err := s.GetInstance(ctx, id); err != nil {
+		return err
+	}
+
+	return saga.ErrLeaseLost
+}
+
+// marshalSagaPayload returns either the payload encoded by the saga.Registry, or the JSON of an unregistered one
+func marshalSagaPayload(instanceID string, payload interface{}) ([]byte, saga.EncodedPayload, error) {
+	switch payload := payload.(type) {
+	case nil:
+		return nil, saga.EncodedPayload{}, nil
+	case saga.EncodedPayload:
+		return nil, payload, nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, saga.EncodedPayload{}, fmt.Errorf("encoding payload of saga instance %s: %w", instanceID, err)
+	}
+
+	return data, saga.EncodedPayload{}, nil
+}
+
+// visibleToTenant is the predicate of the rows visible to the tenant scope given as the n-th argument, see
+// tenantScope and tenant.Visible
+func visibleToTenant(n int) string {
+	return fmt.Sprintf("($%d::text IS NULL OR tenant_id = $%d)", n, n)
+}
+
+// tenantScope is the argument of visibleToTenant: nil for system contexts, which see every row, and the tenant of
+// ctx otherwise, so contexts missing their tenant see no rows, as every row has a tenant since migration 20
+func tenantScope(ctx context.Context) *string {
+	if tenant.IsSystem(ctx) {
+		return nil
+	}
+	id := tenant.ID(ctx)
+
+	return &id
+}
+
+func leaseExpiresAt(lease saga.Lease) *time.Time {
+	if lease.Owner == "" {
+		return nil
+	}
+
+	return &lease.ExpiresAt
+}
+
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+
+	return values
+}
+
+// sortSagaInstances orders instances by creation, as RETURNING does not keep the order of the subquery
+func sortSagaInstances(instances []saga.Instance) {
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].CreatedAt.Before(instances[j].CreatedAt)
+	})
+}
@@ -0,0 +1,138 @@
+package persistence_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/didopimentel/go-saga-poc/extensions/saga"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+	"github.com/didopimentel/go-saga-poc/gateways/persistence"
+	"github.com/stretchr/testify/require"
+)
+
+func newSagaExecutor(t *testing.T, sagas ...saga.Saga) (*saga.Executor, *persistence.Sagas) {
+	registry := saga.NewRegistry()
+	for _, s := range sagas {
+		require.NoError(t, registry.Register(s))
+	}
+	store := &persistence.Sagas{Q: newTxManager(t)}
+
+	return saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: store}), store
+}
+
+func TestSagas_StartWithKey(t *testing.T) {
+	runs := 0
+	executor, store := newSagaExecutor(t, saga.NewVersionedSaga("checkout", 1, []saga.Step{{
+		Name: "charge",
+		Command: func(ctx context.Context) (interface{}, error) {
+			runs++
+			return "receipt", nil
+		},
+	}}))
+	ctx := tenantCtx(t)
+
+	first, err := executor.StartWithKey(ctx, "checkout", "cart-1", nil)
+	require.NoError(t, err)
+	again, err := executor.StartWithKey(ctx, "checkout", "cart-1", nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, runs)
+	require.Equal(t, first.ID, again.ID)
+	require.Equal(t, saga.StatusCompleted, again.Status)
+
+	stored, err := store.GetInstance(ctx, first.ID)
+	require.NoError(t, err)
+	require.Equal(t, "cart-1", stored.BusinessKey)
+	require.Equal(t, tenant.ID(ctx), stored.Tenant)
+
+	byKey, err := store.GetInstanceByKey(ctx, tenant.ID(ctx), "checkout", "cart-1")
+	require.NoError(t, err)
+	require.Equal(t, first.ID, byKey.ID)
+
+	// keys are unique per tenant
+	_, err = executor.StartWithKey(tenantCtx(t), "checkout", "cart-1", nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, runs)
+}
+
+func TestSagas_StartWithKey_ReturnsTheStoredFailure(t *testing.T) {
+	executor, _ := newSagaExecutor(t, saga.NewVersionedSaga("checkout", 1, []saga.Step{{
+		Name: "charge",
+		Command: func(ctx context.Context) (interface{}, error) {
+			return nil, errors.New("card declined")
+		},
+	}}))
+	ctx := tenantCtx(t)
+
+	_, err := executor.StartWithKey(ctx, "checkout", "cart-1", nil)
+	require.Error(t, err)
+	instance, err := executor.StartWithKey(ctx, "checkout", "cart-1", nil)
+	var execErr *saga.ExecutionError
+	require.ErrorAs(t, err, &execErr)
+	require.Equal(t, saga.StatusCompensated, instance.Status)
+	require.Equal(t, "cart-1", instance.BusinessKey)
+}
+
+func TestSagas_GetInstanceByKey_NotFound(t *testing.T) {
+	_, store := newSagaExecutor(t)
+	ctx := tenantCtx(t)
+
+	_, err := store.GetInstanceByKey(ctx, tenant.ID(ctx), "checkout", "cart-1")
+	require.ErrorIs(t, err, saga.ErrInstanceNotFound)
+}
+
+func TestSagas_LostLease_StopsWithoutCompensating(t *testing.T) {
+	store := &persistence.Sagas{Q: newTxManager(t)}
+	compensated := false
+	stolen := saga.Step{
+		Name: "stolen",
+		Command: func(ctx context.Context) (interface{}, error) {
+			// another replica claims the instance while this step runs
+			_, err := store.ClaimInstance(ctx, saga.InstanceID(ctx), saga.Lease{Owner: "replica-b", ExpiresAt: time.Now().Add(time.Minute)}, time.Now().Add(time.Hour))
+			return nil, err
+		},
+		CompensationCommand: func(ctx context.Context) (interface{}, error) {
+			compensated = true
+			return nil, nil
+		},
+	}
+	registry := saga.NewRegistry()
+	require.NoError(t, registry.Register(saga.NewVersionedSaga("checkout", 1, []saga.Step{stolen, {
+		Name:    "second",
+		Command: func(ctx context.Context) (interface{}, error) { return "receipt", nil },
+	}})))
+	replica := saga.NewExecutor(saga.ExecutorSettings{Registry: registry, Store: store, Owner: "replica-a"})
+	ctx := tenantCtx(t)
+
+	instance, err := replica.Start(ctx, "checkout", nil)
+	require.ErrorIs(t, err, saga.ErrLeaseLost)
+	require.False(t, compensated)
+
+	stored, err := store.GetInstance(ctx, instance.ID)
+	require.NoError(t, err)
+	require.Equal(t, "replica-b", stored.Lease.Owner)
+	require.Equal(t, saga.StatusRunning, stored.Status)
+
+	// the lease of replica-b is still valid
+	_, err = replica.Resume(ctx, instance.ID)
+	require.ErrorIs(t, err, saga.ErrLeaseLost)
+}
+
+func TestSagas_RequireATenant(t *testing.T) {
+	_, store := newSagaExecutor(t)
+	ctx := tenantCtx(t)
+	require.NoError(t, store.CreateInstance(ctx, saga.Instance{ID: t.Name(), SagaName: "checkout", SagaVersion: 1,
+		Tenant: tenant.ID(ctx), Status: saga.StatusRunning, CreatedAt: time.Now(), UpdatedAt: time.Now()}))
+
+	// a context missing its tenant sees no instance, and instances cannot be stored without one
+	_, err := store.GetInstance(context.Background(), t.Name())
+	require.ErrorIs(t, err, saga.ErrInstanceNotFound)
+	err = store.CreateInstance(context.Background(), saga.Instance{ID: t.Name() + "-untenanted", SagaName: "checkout", SagaVersion: 1,
+		Status: saga.StatusRunning, CreatedAt: time.Now(), UpdatedAt: time.Now()})
+	require.Error(t, err)
+
+	instances, err := store.ListUnfinishedInstances(tenant.WithSystem(context.Background()))
+	require.NoError(t, err)
+	require.NotEmpty(t, instances)
+}
@@ -0,0 +1,82 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/didopimentel/go-saga-poc/domain"
+	"github.com/didopimentel/go-saga-poc/extensions/tenant"
+	"github.com/jackc/pgx/v4"
+)
+
+var _ domain.SemanticLocker = &SemanticLocks{}
+
+// SemanticLocks implements domain.SemanticLocker over the locked_by column of a table,
+// e.g. orders, payments or deliveries. It only acts on the records of the tenant of the context,
+// and fails with tenant.ErrMissing without one.
+type SemanticLocks struct {
+	Q querier
+	// Table must be a trusted table name, it is not escaped
+	Table string
+	// Resource names the locked records in errors. Defaults to Table.
+	Resource string
+}
+
+func (l *SemanticLocks) Lock(ctx context.Context, id int64, owner string) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET locked_by = $2 WHERE id = $1 AND tenant_id = $3 AND (locked_by IS NULL OR locked_by = $2)",
+		l.Table)
+
+	tag, err := l.Q.Exec(ctx, query, id, owner, tenantID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 1 {
+		return nil
+	}
+
+	return domain.EnsureUnlocked(ctx, l, l.resource(), id)
+}
+
+func (l *SemanticLocks) Unlock(ctx context.Context, id int64, owner string) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET locked_by = NULL WHERE id = $1 AND tenant_id = $3 AND locked_by = $2", l.Table)
+
+	_, err = l.Q.Exec(ctx, query, id, owner, tenantID)
+
+	return err
+}
+
+func (l *SemanticLocks) LockOwner(ctx context.Context, id int64) (string, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := fmt.Sprintf("SELECT COALESCE(locked_by, '') FROM %s WHERE id = $1 AND tenant_id = $2", l.Table)
+
+	var owner string
+	err = l.Q.QueryRow(ctx, query, id, tenantID).Scan(&owner)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("%s %d: %w", l.resource(), id, domain.ErrNotFound)
+	}
+
+	return owner, err
+}
+
+func (l *SemanticLocks) resource() string {
+	if l.Resource != "" {
+		return l.Resource
+	}
+
+	return l.Table
+}
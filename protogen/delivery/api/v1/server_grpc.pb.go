@@ -21,6 +21,12 @@ type DeliveryAPIClient interface {
 	// Smallest request that needs no auth and returns 200.
 	GetHealth(ctx context.Context, in *GetHealthRequest, opts ...grpc.CallOption) (*GetHealthResponse, error)
 	CreateDelivery(ctx context.Context, in *CreateDeliveryRequest, opts ...grpc.CallOption) (*CreateDeliveryResponse, error)
+	// Cancels a scheduled delivery. Fails with FAILED_PRECONDITION if it was already delivered.
+	CancelDelivery(ctx context.Context, in *CancelDeliveryRequest, opts ...grpc.CallOption) (*CancelDeliveryResponse, error)
+	// Schedules a cancelled delivery again, undoing CancelDelivery.
+	ReinstateDelivery(ctx context.Context, in *ReinstateDeliveryRequest, opts ...grpc.CallOption) (*ReinstateDeliveryResponse, error)
+	// Records that a delivery was delivered. Fails with FAILED_PRECONDITION if it was cancelled.
+	CompleteDelivery(ctx context.Context, in *CompleteDeliveryRequest, opts ...grpc.CallOption) (*CompleteDeliveryResponse, error)
 }
 
 type deliveryAPIClient struct {
@@ -49,6 +55,33 @@ func (c *deliveryAPIClient) CreateDelivery(ctx context.Context, in *CreateDelive
 	return out, nil
 }
 
+func (c *deliveryAPIClient) CancelDelivery(ctx context.Context, in *CancelDeliveryRequest, opts ...grpc.CallOption) (*CancelDeliveryResponse, error) {
+	out := new(CancelDeliveryResponse)
+	err := c.cc.Invoke(ctx, "/delivery.api.v1.DeliveryAPI/CancelDelivery", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deliveryAPIClient) ReinstateDelivery(ctx context.Context, in *ReinstateDeliveryRequest, opts ...grpc.CallOption) (*ReinstateDeliveryResponse, error) {
+	out := new(ReinstateDeliveryResponse)
+	err := c.cc.Invoke(ctx, "/delivery.api.v1.DeliveryAPI/ReinstateDelivery", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deliveryAPIClient) CompleteDelivery(ctx context.Context, in *CompleteDeliveryRequest, opts ...grpc.CallOption) (*CompleteDeliveryResponse, error) {
+	out := new(CompleteDeliveryResponse)
+	err := c.cc.Invoke(ctx, "/delivery.api.v1.DeliveryAPI/CompleteDelivery", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // DeliveryAPIServer is the server API for DeliveryAPI service.
 // All implementations should embed UnimplementedDeliveryAPIServer
 // for forward compatibility
@@ -56,6 +89,12 @@ type DeliveryAPIServer interface {
 	// Smallest request that needs no auth and returns 200.
 	GetHealth(context.Context, *GetHealthRequest) (*GetHealthResponse, error)
 	CreateDelivery(context.Context, *CreateDeliveryRequest) (*CreateDeliveryResponse, error)
+	// Cancels a scheduled delivery. Fails with FAILED_PRECONDITION if it was already delivered.
+	CancelDelivery(context.Context, *CancelDeliveryRequest) (*CancelDeliveryResponse, error)
+	// Schedules a cancelled delivery again, undoing CancelDelivery.
+	ReinstateDelivery(context.Context, *ReinstateDeliveryRequest) (*ReinstateDeliveryResponse, error)
+	// Records that a delivery was delivered. Fails with FAILED_PRECONDITION if it was cancelled.
+	CompleteDelivery(context.Context, *CompleteDeliveryRequest) (*CompleteDeliveryResponse, error)
 }
 
 // UnimplementedDeliveryAPIServer should be embedded to have forward compatible implementations.
@@ -68,6 +107,15 @@ func (UnimplementedDeliveryAPIServer) GetHealth(context.Context, *GetHealthReque
 func (UnimplementedDeliveryAPIServer) CreateDelivery(context.Context, *CreateDeliveryRequest) (*CreateDeliveryResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CreateDelivery not implemented")
 }
+func (UnimplementedDeliveryAPIServer) CancelDelivery(context.Context, *CancelDeliveryRequest) (*CancelDeliveryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelDelivery not implemented")
+}
+func (UnimplementedDeliveryAPIServer) ReinstateDelivery(context.Context, *ReinstateDeliveryRequest) (*ReinstateDeliveryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReinstateDelivery not implemented")
+}
+func (UnimplementedDeliveryAPIServer) CompleteDelivery(context.Context, *CompleteDeliveryRequest) (*CompleteDeliveryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CompleteDelivery not implemented")
+}
 
 // UnsafeDeliveryAPIServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to DeliveryAPIServer will
@@ -116,6 +164,60 @@ func _DeliveryAPI_CreateDelivery_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _DeliveryAPI_CancelDelivery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelDeliveryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeliveryAPIServer).CancelDelivery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/delivery.api.v1.DeliveryAPI/CancelDelivery",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeliveryAPIServer).CancelDelivery(ctx, req.(*CancelDeliveryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DeliveryAPI_ReinstateDelivery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReinstateDeliveryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeliveryAPIServer).ReinstateDelivery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/delivery.api.v1.DeliveryAPI/ReinstateDelivery",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeliveryAPIServer).ReinstateDelivery(ctx, req.(*ReinstateDeliveryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DeliveryAPI_CompleteDelivery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CompleteDeliveryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeliveryAPIServer).CompleteDelivery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/delivery.api.v1.DeliveryAPI/CompleteDelivery",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeliveryAPIServer).CompleteDelivery(ctx, req.(*CompleteDeliveryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // DeliveryAPI_ServiceDesc is the grpc.ServiceDesc for DeliveryAPI service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -131,6 +233,18 @@ var DeliveryAPI_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "CreateDelivery",
 			Handler:    _DeliveryAPI_CreateDelivery_Handler,
 		},
+		{
+			MethodName: "CancelDelivery",
+			Handler:    _DeliveryAPI_CancelDelivery_Handler,
+		},
+		{
+			MethodName: "ReinstateDelivery",
+			Handler:    _DeliveryAPI_ReinstateDelivery_Handler,
+		},
+		{
+			MethodName: "CompleteDelivery",
+			Handler:    _DeliveryAPI_CompleteDelivery_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "delivery/api/v1/server.proto",